@@ -0,0 +1,129 @@
+package project
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	sessionentity "github.com/albertwidi/go-project-example/internal/entity/session"
+	userentity "github.com/albertwidi/go-project-example/internal/entity/user"
+	"github.com/albertwidi/go-project-example/internal/kothak"
+	"github.com/albertwidi/go-project-example/internal/objstoragepath"
+	requestctx "github.com/albertwidi/go-project-example/internal/pkg/context"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis/lock"
+	"github.com/albertwidi/go-project-example/internal/pkg/router"
+	"github.com/albertwidi/go-project-example/internal/server/imageproxy"
+	imageusecase "github.com/albertwidi/go-project-example/internal/usecase/image"
+)
+
+// ImageConfig of image
+type ImageConfig struct {
+	PrivateDownload ImageDownloadConfig `yaml:"private_download" toml:"private_download"`
+}
+
+// ImageDownloadConfig is the link of image download
+type ImageDownloadConfig struct {
+	Proto string `yaml:"proto" toml:"proto"`
+	Host  string `yaml:"host" toml:"host"`
+	Port  string `yaml:"port" toml:"port"`
+	Path  string `yaml:"path" toml:"path"`
+}
+
+func newImageServer(address string, c ImageConfig, resources *kothak.Kothak, r *Repositories) (*imageproxy.Server, error) {
+	privateStorage, err := resources.GetObjectStorage("image-private")
+	if err != nil {
+		return nil, err
+	}
+
+	// use the address of local machine as download host when the host is empty
+	objPath, err := objstoragepath.New(&objstoragepath.Config{
+		Private: objstoragepath.DownloadConfig{
+			DownloadProto: c.PrivateDownload.Proto,
+			DownloadHost:  c.PrivateDownload.Host,
+			DownloadPort:  c.PrivateDownload.Port,
+			DownloadPath:  c.PrivateDownload.Path,
+		},
+	}, c.PrivateDownload.Host == "")
+	if err != nil {
+		return nil, err
+	}
+
+	// lock the image references using the same redis with the image repository
+	imageRedis, err := resources.GetRedis("image")
+	if err != nil {
+		return nil, err
+	}
+	locker, err := lock.New([]redis.Redis{imageRedis}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	images, err := imageusecase.New(privateStorage, r.Image, objPath, locker, nil)
+	if err != nil {
+		return nil, err
+	}
+	return imageproxy.New(address, images, imageProxyOptions(c, r.Session))
+}
+
+// imageProxyOptions return the options of image proxy, the session of the request is loaded from the session repository
+func imageProxyOptions(c ImageConfig, sessions sessionRepository) *imageproxy.Options {
+	return &imageproxy.Options{
+		DownloadPath: c.PrivateDownload.Path,
+		Middlewares:  []router.MiddlewareFunc{sessionMiddleware(sessions)},
+	}
+}
+
+// sessionCookie is the name of cookie that holds the session id
+const sessionCookie = "session_id"
+
+type sessionRepository interface {
+	Get(ctx context.Context, userhash userentity.Hash, sessionid string) (sessionentity.Session, error)
+}
+
+// sessionMiddleware load the session from the session cookie and set it to the request context
+// the request without a valid session is served without session, so only the anonymous access is allowed.
+func sessionMiddleware(sessions sessionRepository) router.MiddlewareFunc {
+	return func(next router.HandlerFunc) router.HandlerFunc {
+		return func(rctx *requestctx.RequestContext) error {
+			cookie, err := rctx.Request().Cookie(sessionCookie)
+			if err != nil {
+				return next(rctx)
+			}
+			userHash, ok := sessionUserHash(cookie.Value)
+			if !ok {
+				return next(rctx)
+			}
+
+			sess, err := sessions.Get(rctx.Context(), userHash, cookie.Value)
+			if err != nil {
+				if errors.Is(err, sessionentity.ErrSessionNotFound) {
+					return next(rctx)
+				}
+				http.Error(rctx.ResponseWriter(), http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return err
+			}
+			if sess.HashID != string(userHash) || (!sess.ExpiredAt.IsZero() && !time.Now().Before(sess.ExpiredAt)) {
+				return next(rctx)
+			}
+			return next(rctx.WithContext(sessionentity.WithSession(rctx.Context(), &sess)))
+		}
+	}
+}
+
+// sessionUserHash return the user hash in the session id
+// the session id is created by the session usecase by encoding {time}:{user_hash}:{uuid} in base64
+func sessionUserHash(id string) (userentity.Hash, bool) {
+	decoded, err := base64.RawStdEncoding.DecodeString(id)
+	if err != nil {
+		return "", false
+	}
+	keys := strings.Split(string(decoded), ":")
+	if len(keys) < 3 || keys[len(keys)-2] == "" {
+		return "", false
+	}
+	return userentity.Hash(keys[len(keys)-2]), true
+}
@@ -0,0 +1,174 @@
+package project
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image"
+	"image/jpeg"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	imageentity "github.com/albertwidi/go-project-example/internal/entity/image"
+	sessionentity "github.com/albertwidi/go-project-example/internal/entity/session"
+	userentity "github.com/albertwidi/go-project-example/internal/entity/user"
+	"github.com/albertwidi/go-project-example/internal/objstoragepath"
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage"
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage/local"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis/lock"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis/memory"
+	imagerepo "github.com/albertwidi/go-project-example/internal/repository/image"
+	sessionrepo "github.com/albertwidi/go-project-example/internal/repository/session"
+	"github.com/albertwidi/go-project-example/internal/server/imageproxy"
+	imageusecase "github.com/albertwidi/go-project-example/internal/usecase/image"
+)
+
+func newSessionID(userHash string) string {
+	return base64.RawStdEncoding.EncodeToString([]byte(time.Now().String() + ":" + userHash + ":2c1f7a0e-5d4b-4f4e-9a51-0c6f0b5e7d21"))
+}
+
+func TestImageProxySession(t *testing.T) {
+	t.Parallel()
+
+	bucket, err := local.New(context.Background(), "./testImageProxySession/", &local.Options{DeleteOnClose: true})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	storage := objectstorage.New(bucket)
+	defer os.RemoveAll("./testImageProxySession")
+	defer storage.Close()
+
+	c := ImageConfig{PrivateDownload: ImageDownloadConfig{Proto: "http://", Host: "localhost", Port: ":9000", Path: "/image"}}
+	objPath, err := objstoragepath.New(&objstoragepath.Config{
+		Private: objstoragepath.DownloadConfig{
+			DownloadProto: c.PrivateDownload.Proto,
+			DownloadHost:  c.PrivateDownload.Host,
+			DownloadPort:  c.PrivateDownload.Port,
+			DownloadPath:  c.PrivateDownload.Path,
+		},
+	}, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	m := memory.New(nil)
+	lock.RegisterMemoryScripts(m)
+	locker, err := lock.New([]redis.Redis{m}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	images, err := imageusecase.New(storage, imagerepo.New(m), objPath, locker, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	buff := bytes.Buffer{}
+	if err := jpeg.Encode(&buff, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Error(err)
+		return
+	}
+	uploaded, err := images.Upload(context.Background(), &buff, imageentity.FileInfo{
+		FileName: "ktp.jpg",
+		UserHash: "eUjks",
+		Mode:     imageentity.ModePrivate,
+		Group:    imageentity.GroupUserKTP,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	sessions := sessionrepo.New(memory.New(nil))
+	ownerSession := newSessionID("eUjks")
+	otherSession := newSessionID("qRstu")
+	expiredSession := newSessionID("eUjks")
+	for _, sess := range []sessionentity.Session{
+		{ID: ownerSession, HashID: "eUjks", Authenticated: true, ExpiredAt: time.Now().Add(time.Hour)},
+		{ID: otherSession, HashID: "qRstu", Authenticated: true, ExpiredAt: time.Now().Add(time.Hour)},
+		{ID: expiredSession, HashID: "eUjks", Authenticated: true, ExpiredAt: time.Now().Add(-time.Hour)},
+	} {
+		if err := sessions.Save(context.Background(), userentity.Hash(sess.HashID), sess.ID, sess); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	// the image proxy is created with the same options as the project
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	address := l.Addr().String()
+	l.Close()
+	server, err := imageproxy.New(address, images, imageProxyOptions(c, sessions))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	go server.Run()
+	defer server.Shutdown(context.Background())
+
+	cases := []struct {
+		name         string
+		session      string
+		expectStatus int
+	}{
+		{
+			name:         "owner session",
+			session:      ownerSession,
+			expectStatus: http.StatusOK,
+		},
+		{
+			name:         "other user session",
+			session:      otherSession,
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			name:         "expired session",
+			session:      expiredSession,
+			expectStatus: http.StatusUnauthorized,
+		},
+		{
+			name:         "unknown session",
+			session:      newSessionID("eUjks"),
+			expectStatus: http.StatusUnauthorized,
+		},
+		{
+			name:         "invalid session",
+			session:      "eUjks",
+			expectStatus: http.StatusUnauthorized,
+		},
+		{
+			name:         "without session",
+			expectStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, cs := range cases {
+		req, err := http.NewRequest(http.MethodGet, "http://"+address+"/image/"+uploaded.FilePath, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if cs.session != "" {
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: cs.session})
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("%s: %v", cs.name, err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode != cs.expectStatus {
+			t.Errorf("%s: expecting status %d but got %d", cs.name, cs.expectStatus, resp.StatusCode)
+			return
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package project
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/albertwidi/go-project-example/internal/config"
+	"github.com/albertwidi/go-project-example/internal/kothak"
+	lg "github.com/albertwidi/go-project-example/internal/pkg/log/logger"
+	"github.com/albertwidi/go-project-example/internal/pkg/log/logger/zap"
+	"github.com/albertwidi/go-project-example/internal/pkg/sqldb/migrate"
+)
+
+// list of migrate command
+const (
+	MigrateUp       = "up"
+	MigrateDown     = "down"
+	MigrateRedo     = "redo"
+	MigrateStatus   = "status"
+	MigrateValidate = "validate"
+)
+
+// MigrateFlags of migrate command
+type MigrateFlags struct {
+	Command string
+	// Database is the kothak database name, all databases are migrated if empty
+	Database  string
+	SchemaDir string
+	// Steps is the number of migrations to apply or rollback
+	Steps int
+}
+
+// Migrate the databases schema from {schema_dir}/{database_name}
+func Migrate(f Flags, mf MigrateFlags) error {
+	switch mf.Command {
+	case MigrateUp, MigrateDown, MigrateRedo, MigrateStatus, MigrateValidate:
+	default:
+		return fmt.Errorf("migrate: command %q is not valid, must be up/down/redo/status/validate", mf.Command)
+	}
+
+	projectConfig := Config{}
+	if err := config.ParseFile(f.ConfigurationFile, &projectConfig, f.EnvironmentFile.envFiles...); err != nil {
+		return err
+	}
+
+	logger, err := zap.New(&lg.Config{
+		Level:    lg.StringToLevel(projectConfig.Log.Level),
+		LogFile:  projectConfig.Log.File,
+		UseColor: projectConfig.Log.Color,
+	})
+	if err != nil {
+		return fmt.Errorf("migrate: error when initiating logger: %w", err)
+	}
+
+	// only connect to the databases that need to be migrated
+	dbConfig := projectConfig.Resources.DBConfig
+	if mf.Database != "" {
+		var sqldbs []kothak.SQLDBConfig
+		for _, c := range dbConfig.SQLDBs {
+			if c.Name == mf.Database {
+				sqldbs = append(sqldbs, c)
+			}
+		}
+		if len(sqldbs) == 0 {
+			return fmt.Errorf("migrate: database %s is not found in configuration", mf.Database)
+		}
+		dbConfig.SQLDBs = sqldbs
+	}
+
+	ctx := context.Background()
+	resources, err := kothak.New(ctx, kothak.Config{DBConfig: dbConfig}, logger)
+	if err != nil {
+		return err
+	}
+	defer resources.CloseAll()
+
+	for _, c := range dbConfig.SQLDBs {
+		migrations, err := migrate.Load(filepath.Join(mf.SchemaDir, c.Name))
+		if err != nil {
+			// skip database without schema when migrating all databases
+			if os.IsNotExist(err) && mf.Database == "" {
+				logger.Infof("migrate: skipping %s, no schema directory", c.Name)
+				continue
+			}
+			return err
+		}
+
+		migrator, err := migrate.New(resources.MustGetSQLDB(c.Name).Leader(), migrations, nil)
+		if err != nil {
+			return err
+		}
+		if err := runMigrate(ctx, migrator, c.Name, mf); err != nil {
+			return fmt.Errorf("migrate: %s: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+func runMigrate(ctx context.Context, migrator *migrate.Migrator, name string, mf MigrateFlags) error {
+	switch mf.Command {
+	case MigrateUp:
+		applied, err := migrator.Up(ctx, mf.Steps)
+		for _, m := range applied {
+			fmt.Printf("%s: applied %s\n", name, m)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Printf("%s: no pending migration\n", name)
+		}
+		return err
+
+	case MigrateDown:
+		rolledBack, err := migrator.Down(ctx, mf.Steps)
+		for _, m := range rolledBack {
+			fmt.Printf("%s: rolled back %s\n", name, m)
+		}
+		if errors.Is(err, migrate.ErrNoMigration) {
+			fmt.Printf("%s: no applied migration\n", name)
+			return nil
+		}
+		return err
+
+	case MigrateRedo:
+		m, err := migrator.Redo(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: redo %s\n", name, m)
+
+	case MigrateStatus:
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s:\n", name)
+		for _, s := range status {
+			state := "pending"
+			if s.Applied {
+				state = "applied at " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("\t%s\t%s\n", s.Migration, state)
+		}
+
+	case MigrateValidate:
+		err := migrator.Validate(ctx)
+		// skip database that cannot be validated when validating all databases
+		if errors.Is(err, migrate.ErrValidateNotSupported) && mf.Database == "" {
+			fmt.Printf("%s: skipped, %v\n", name, err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: pending migrations are valid\n", name)
+	}
+	return nil
+}
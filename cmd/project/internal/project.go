@@ -26,9 +26,13 @@ type Flags struct {
 	Version           bool
 }
 
+// shutdownTimeout is the maximum time for servers and consumers to shutdown gracefully
+const shutdownTimeout = time.Second * 30
+
 // Config of project
 type Config struct {
 	config.DefaultConfig
+	Image ImageConfig `json:"image" yaml:"image" toml:"image"`
 }
 
 // Run the project
@@ -79,14 +83,26 @@ func Run(f Flags) error {
 		return err
 	}
 
-	s, err := server.New(projectConfig.Servers.Admin.Address, debugServer)
+	imageServer, err := newImageServer(projectConfig.Servers.Image.Address, projectConfig.Image, resources, repo)
+	if err != nil {
+		return err
+	}
+
+	s, err := server.New(projectConfig.Servers.Admin.Address, debugServer, imageServer)
 	if err != nil {
 		return err
 	}
+	// serve resources health check in admin server
+	s.SetHealthChecker(resources)
+	// reload resources configuration from admin server
+	reload := func(ctx context.Context) (interface{}, error) {
+		return reloadResources(ctx, f, resources)
+	}
+	s.SetReloader(server.ReloaderFunc(reload))
 	// run the server
 	errChan := s.Run()
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGHUP)
 	// exit early if we only test config
 	testChan := make(chan struct{}, 1)
 	if f.Debug.TestConfig {
@@ -97,19 +113,43 @@ func Run(f Flags) error {
 		}()
 	}
 
-	select {
-	case err := <-errChan:
-		return err
-	case sig := <-sigChan:
-		switch sig {
-		case syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT:
-			return errors.New("project: receive signal to terminate program")
+	for {
+		select {
+		case err := <-errChan:
+			return err
+		case sig := <-sigChan:
+			switch sig {
+			case syscall.SIGHUP:
+				logger.Infoln("project: receive signal to reload resources")
+				result, err := reload(context.Background())
+				if err != nil {
+					logger.Errorf("project: failed to reload resources: %v", err)
+					continue
+				}
+				logger.Infof("project: resources reloaded: %+v", result)
+			case syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT:
+				// give time for servers and consumers to finish their work
+				ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+				defer cancel()
+				if err := s.Shutdown(ctx); err != nil {
+					logger.Errorf("project: failed to shutdown gracefully: %v", err)
+				}
+				return errors.New("project: receive signal to terminate program")
+			}
+		case <-testChan:
+			logger.Infoln("testing: test completed successfully")
+			return nil
 		}
-	case <-testChan:
-		logger.Infoln("testing: test completed successfully")
-		return nil
 	}
-	return nil
+}
+
+// reloadResources parse the configuration file again and reload the resources
+func reloadResources(ctx context.Context, f Flags, resources *kothak.Kothak) (*kothak.ReloadResult, error) {
+	projectConfig := Config{}
+	if err := config.ParseFile(f.ConfigurationFile, &projectConfig, f.EnvironmentFile.envFiles...); err != nil {
+		return nil, err
+	}
+	return resources.Reload(ctx, projectConfig.Resources, kothak.DefaultDrainGracePeriod)
 }
 
 func newMainServer() {
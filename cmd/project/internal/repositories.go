@@ -3,11 +3,13 @@ package project
 import (
 	"github.com/albertwidi/go-project-example/internal/kothak"
 	"github.com/albertwidi/go-project-example/internal/repository/image"
+	"github.com/albertwidi/go-project-example/internal/repository/session"
 )
 
 // Repositories list
 type Repositories struct {
-	Image *image.Repository
+	Image   *image.Repository
+	Session *session.Repository
 }
 
 func newRepositories(resources *kothak.Kothak) (*Repositories, error) {
@@ -16,5 +18,8 @@ func newRepositories(resources *kothak.Kothak) (*Repositories, error) {
 	// iamge repository
 	imageRepo := image.New(resources.MustGetRedis("image"))
 	r.Image = imageRepo
+
+	// session repository
+	r.Session = session.New(resources.MustGetRedis("session"))
 	return &r, nil
 }
@@ -0,0 +1,113 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/albertwidi/go-project-example/internal/config"
+	"github.com/albertwidi/go-project-example/internal/kothak"
+	lg "github.com/albertwidi/go-project-example/internal/pkg/log/logger"
+	"github.com/albertwidi/go-project-example/internal/pkg/log/logger/zap"
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage/replicate"
+)
+
+// list of storage command
+const (
+	StorageSync = "sync"
+)
+
+// StorageFlags of storage command
+type StorageFlags struct {
+	Command string
+	// From and To are the kothak object storage names
+	From        string
+	To          string
+	Prefix      string
+	Checkpoint  string
+	Concurrency int
+}
+
+// Storage run the object storage command
+func Storage(f Flags, sf StorageFlags) error {
+	if sf.Command != StorageSync {
+		return fmt.Errorf("storage: command %q is not valid, must be sync", sf.Command)
+	}
+	if sf.From == "" || sf.To == "" {
+		return fmt.Errorf("storage: from and to cannot be empty")
+	}
+	if sf.From == sf.To {
+		return fmt.Errorf("storage: from and to cannot be the same storage")
+	}
+
+	projectConfig := Config{}
+	if err := config.ParseFile(f.ConfigurationFile, &projectConfig, f.EnvironmentFile.envFiles...); err != nil {
+		return err
+	}
+
+	logger, err := zap.New(&lg.Config{
+		Level:    lg.StringToLevel(projectConfig.Log.Level),
+		LogFile:  projectConfig.Log.File,
+		UseColor: projectConfig.Log.Color,
+	})
+	if err != nil {
+		return fmt.Errorf("storage: error when initiating logger: %w", err)
+	}
+
+	// only connect to the storages that need to be synced
+	var storageConfig []kothak.ObjectStorageConfig
+	for _, c := range projectConfig.Resources.ObjectStorageConfig {
+		if c.Name == sf.From || c.Name == sf.To {
+			storageConfig = append(storageConfig, c)
+		}
+	}
+
+	// stop the sync when receiving signal, the progress is saved in checkpoint
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	resources, err := kothak.New(ctx, kothak.Config{ObjectStorageConfig: storageConfig}, logger)
+	if err != nil {
+		return err
+	}
+	defer resources.CloseAll()
+
+	src, err := resources.GetObjectStorage(sf.From)
+	if err != nil {
+		return fmt.Errorf("storage: %s: %w", sf.From, err)
+	}
+	dst, err := resources.GetObjectStorage(sf.To)
+	if err != nil {
+		return fmt.Errorf("storage: %s: %w", sf.To, err)
+	}
+
+	replicator, err := replicate.New(src, dst, &replicate.Options{
+		Prefix:         sf.Prefix,
+		Concurrency:    sf.Concurrency,
+		CheckpointFile: sf.Checkpoint,
+		OnObject: func(key, status string, err error) {
+			if err != nil {
+				logger.Errorf("storage: %s %s: %v", status, key, err)
+				return
+			}
+			logger.Debugf("storage: %s %s", status, key)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	result, err := replicator.Run(ctx)
+	if result != nil {
+		fmt.Printf("%s -> %s: copied %d (%d bytes), skipped %d, failed %d\n", sf.From, sf.To, result.Copied, result.Bytes, result.Skipped, result.Failed)
+	}
+	return err
+}
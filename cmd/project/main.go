@@ -17,10 +17,24 @@ const (
 	usage = `Usage:
 	backend -config_file=./project.config.toml \
 		-env_file=./project.env.toml
+	backend migrate -config_file=./project.config.toml \
+		-env_file=./project.env.toml \
+		[-db=users] [-schema_dir=./database/schema] [-n=1] up|down|redo|status|validate
+	backend storage -config_file=./project.config.toml \
+		-env_file=./project.env.toml \
+		-from=do_image -to=gcs_image [-prefix=user/ktp/] \
+		[-checkpoint=./storage_sync.json] [-concurrency=4] sync
 	`
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(migrate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "storage" {
+		os.Exit(storage(os.Args[2:]))
+	}
+
 	exitCode := 0
 	f := project.Flags{}
 	flag.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", usage) }
@@ -41,3 +55,47 @@ func main() {
 	}
 	os.Exit(exitCode)
 }
+
+// migrate run the database migration subcommand
+func migrate(args []string) int {
+	f := project.Flags{}
+	mf := project.MigrateFlags{}
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", usage) }
+	fs.StringVar(&f.ConfigurationFile, "config_file", "./aha.config.toml", "configuration file of the project")
+	fs.Var(&f.EnvironmentFile, "env_file", "helper file for environment variable configuration")
+	fs.StringVar(&mf.Database, "db", "", "name of the database to migrate, all databases are migrated if empty")
+	fs.StringVar(&mf.SchemaDir, "schema_dir", "./database/schema", "directory of the database schema")
+	fs.IntVar(&mf.Steps, "n", 0, "number of migrations to apply or rollback")
+	fs.Parse(args)
+	mf.Command = fs.Arg(0)
+
+	if err := project.Migrate(f, mf); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// storage run the object storage subcommand
+func storage(args []string) int {
+	f := project.Flags{}
+	sf := project.StorageFlags{}
+	fs := flag.NewFlagSet("storage", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", usage) }
+	fs.StringVar(&f.ConfigurationFile, "config_file", "./aha.config.toml", "configuration file of the project")
+	fs.Var(&f.EnvironmentFile, "env_file", "helper file for environment variable configuration")
+	fs.StringVar(&sf.From, "from", "", "name of the source object storage")
+	fs.StringVar(&sf.To, "to", "", "name of the destination object storage")
+	fs.StringVar(&sf.Prefix, "prefix", "", "prefix of objects to sync, all objects are synced if empty")
+	fs.StringVar(&sf.Checkpoint, "checkpoint", "./storage_sync.json", "checkpoint file to resume the sync")
+	fs.IntVar(&sf.Concurrency, "concurrency", 4, "number of objects copied concurrently")
+	fs.Parse(args)
+	sf.Command = fs.Arg(0)
+
+	if err := project.Storage(f, sf); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS users_token;
+DROP TABLE IF EXISTS users_credentials;
+DROP TABLE IF EXISTS scopes;
+DROP TABLE IF EXISTS registrations;
+DROP TABLE IF EXISTS user_secrets;
+DROP TABLE IF EXISTS users_bio;
+DROP TABLE IF EXISTS users;
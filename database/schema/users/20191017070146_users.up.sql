@@ -1,3 +1,6 @@
+-- extension for uuid
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
 DROP TABLE IF EXISTS users;
 CREATE TABLE users(
     id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -62,7 +65,7 @@ CREATE TABLE registrations(
     device_token varchar(200),
     created_at timestamp NOT NULL,
     updated_at timestamp,
-    is_test boolean NOT NULL,
+    is_test boolean NOT NULL
 );
 
 DROP TABLE IF EXISTS scopes;
@@ -71,26 +74,26 @@ CREATE TABLE scopes(
     name varchar(60) NOT NULL,
     description text NOT NULL,
     created_at timestamp NOT NULL,
-    created_by string NOT NULL,
-    updated_by string,
+    created_by varchar(36) NOT NULL,
+    updated_by varchar(36),
     updated_at timestamp
 );
 
 -- insert default scopes
-INSERT INTO scopes("kos:search", "search for kos", NOW(), 1)
+INSERT INTO scopes(name, description, created_at, created_by) VALUES('kos:search', 'search for kos', NOW(), '1');
 
-DROP TABLE IF EXISTS user_credentials;
+DROP TABLE IF EXISTS users_credentials;
 CREATE TABLE users_credentials(
     id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
     user_id uuid,
     token_name varchar(60),
-    scopes []string,
+    scopes varchar(60)[],
     created_at timestamp NOT NULL,
     created_by uuid,
     UNIQUE(user_id, token_name)
-)
+);
 
-DROP TABLE IF EXISTS user_token;
+DROP TABLE IF EXISTS users_token;
 CREATE TABLE users_token(
     id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
     user_id uuid,
@@ -98,9 +101,9 @@ CREATE TABLE users_token(
     client_id varchar(60),
     client_secret varchar(60),
     refresh_token varchar(60),
-    created_at timestamp NOT NULL
+    created_at timestamp NOT NULL,
     created_by uuid
-)
+);
 
 DROP INDEX IF EXISTS idx_credential_id;
 CREATE INDEX idx_credential_id ON users_token(credential_id);
@@ -109,4 +112,4 @@ DROP INDEX IF EXISTS idx_client_id;
 CREATE INDEX idx_client_id ON users_token(client_id);
 
 DROP INDEX IF EXISTS idx_refresh_token;
-CREATE INDEX idx_refresh_token ON users_token(refresh_token);
\ No newline at end of file
+CREATE INDEX idx_refresh_token ON users_token(refresh_token);
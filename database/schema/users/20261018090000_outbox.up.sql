@@ -0,0 +1,19 @@
+-- outbox of events that published to nsq by the outbox relay
+-- the event is inserted in the same transaction with the data changes.
+CREATE TABLE IF NOT EXISTS outbox (
+    -- id is the id of the message envelope
+    id uuid PRIMARY KEY,
+    topic varchar(100) NOT NULL,
+    body bytea NOT NULL,
+    attempts int NOT NULL DEFAULT 0,
+    last_error text,
+    created_at timestamp NOT NULL,
+    sent_at timestamp,
+    -- parked_at is set when the event reach the maximum attempts, the parked event is not published by the relay
+    parked_at timestamp
+);
+
+-- index for the relay to find the pending events
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(created_at) WHERE sent_at IS NULL AND parked_at IS NULL;
+-- index for the relay to purge the sent events
+CREATE INDEX IF NOT EXISTS idx_outbox_sent ON outbox(sent_at) WHERE sent_at IS NOT NULL;
@@ -58,26 +58,27 @@ generate() {
     cd -
 }
 
+# migration is done by the project migrate command
+# example: ./setup.sh migrate users up
 migrate() {
     if [ -z $1 ]; then
-        echo "database configuration cannot be empty"
-        exit 1;
-    fi
-
-    if [ -z $2 ]; then
         echo "database name cannot be empty"
         exit 1;
     fi
 
-    if [ -z $3 ]; then 
-        echo "migration type cannot be empty. must be up/down"
+    if [ -z $2 ]; then 
+        echo "migration type cannot be empty. must be up/down/redo/status/validate"
         exit 1;
     fi
 
-    cd ${SCRIPT_DIR}
-    soda migrate $3 -d -c $1 -e $2 -p ${DATABASE_SCHEMA_DIR}
+    cd ${SCRIPT_DIR}/..
+    go run ./cmd/project migrate \
+        -config_file=./project.config.toml \
+        -env_file=./project.env.toml \
+        -schema_dir=./database/schema \
+        -db=$1 $2
     if [ $? -ne 0 ]; then
-        echo "failed to generate new sql migration schema"
+        echo "failed to migrate database $1"
         cd -
         exit 1;
     fi
@@ -96,6 +97,6 @@ case $1 in
         generate $2 $3 $4
     ;;
     migrate)
-        migrate $2 $3 $4
+        migrate $2 $3
     ;;
 esac 
\ No newline at end of file
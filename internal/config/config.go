@@ -31,6 +31,7 @@ type DefaultServers struct {
 	Main  ServerConfig `json:"main" yaml:"main" toml:"main"`
 	Debug ServerConfig `json:"debug" yaml:"debug" toml:"debug"`
 	Admin ServerConfig `json:"admin" yaml:"admin" toml:"admin"`
+	Image ServerConfig `json:"image" yaml:"image" toml:"image"`
 }
 
 // ServerConfig struct
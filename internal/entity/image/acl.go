@@ -0,0 +1,371 @@
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	userentity "github.com/albertwidi/go-project-example/internal/entity/user"
+)
+
+// list of principal type
+const (
+	PrincipalUser          PrincipalType = "user"
+	PrincipalRole          PrincipalType = "role"
+	PrincipalPropertyOwner PrincipalType = "property_owner"
+)
+
+// list of permission
+const (
+	PermissionRead   Permission = "read"
+	PermissionWrite  Permission = "write"
+	PermissionDelete Permission = "delete"
+	// PermissionShare allow the principal to grant its permissions to other principal
+	PermissionShare Permission = "share"
+)
+
+// RoleAdmin is the role of administrator
+const RoleAdmin = "admin"
+
+// AllPermissions is the permissions of image owner
+var AllPermissions = []Permission{PermissionRead, PermissionWrite, PermissionDelete, PermissionShare}
+
+// PrincipalType of principal
+type PrincipalType string
+
+// Permission of image
+type Permission string
+
+// Validate permission
+func (p Permission) Validate() error {
+	switch p {
+	case PermissionRead, PermissionWrite, PermissionDelete, PermissionShare:
+	default:
+		return fmt.Errorf("image: invalid permission, got %s", p)
+	}
+	return nil
+}
+
+// Principal is the subject that is granted permissions
+type Principal struct {
+	Type PrincipalType `json:"type"`
+	ID   string        `json:"id"`
+}
+
+// UserPrincipal return principal of user
+func UserPrincipal(hash userentity.Hash) Principal {
+	return Principal{Type: PrincipalUser, ID: string(hash)}
+}
+
+// RolePrincipal return principal of role
+func RolePrincipal(role string) Principal {
+	return Principal{Type: PrincipalRole, ID: role}
+}
+
+// PropertyOwnerPrincipal return principal of the owner of property
+func PropertyOwnerPrincipal(propertyID string) Principal {
+	return Principal{Type: PrincipalPropertyOwner, ID: propertyID}
+}
+
+// Validate principal
+func (p Principal) Validate() error {
+	switch p.Type {
+	case PrincipalUser, PrincipalRole, PrincipalPropertyOwner:
+	default:
+		return fmt.Errorf("image: invalid principal type, got %s", p.Type)
+	}
+	if p.ID == "" {
+		return fmt.Errorf("image: principal id of %s cannot be empty", p.Type)
+	}
+	return nil
+}
+
+// String return principal in {type}:{id} format
+func (p Principal) String() string {
+	return string(p.Type) + ":" + p.ID
+}
+
+// Subject is the user that access the image
+type Subject struct {
+	UserHash userentity.Hash
+	Roles    []string
+	// OwnedProperties is the list of property id owned by the user
+	OwnedProperties []string
+}
+
+// Principals of the subject
+func (s Subject) Principals() []Principal {
+	principals := make([]Principal, 0, 1+len(s.Roles)+len(s.OwnedProperties))
+	if s.UserHash != "" {
+		principals = append(principals, UserPrincipal(s.UserHash))
+	}
+	for _, role := range s.Roles {
+		principals = append(principals, RolePrincipal(role))
+	}
+	for _, propertyID := range s.OwnedProperties {
+		principals = append(principals, PropertyOwnerPrincipal(propertyID))
+	}
+	return principals
+}
+
+// Grant of permissions to principal
+type Grant struct {
+	Principal   Principal    `json:"principal"`
+	Permissions []Permission `json:"permissions"`
+	// ExpiresAt is the time when the grant expires, grant without expiry never expires
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// IssuedBy is the user that issued the grant, the grant of the system has no issuer
+	IssuedBy userentity.Hash `json:"issued_by,omitempty"`
+}
+
+// Expired check whether the grant is expired
+func (g Grant) Expired(now time.Time) bool {
+	return g.ExpiresAt != nil && !now.Before(*g.ExpiresAt)
+}
+
+func (g Grant) has(permission Permission) bool {
+	for _, p := range g.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate grant
+func (g Grant) Validate() error {
+	if err := g.Principal.Validate(); err != nil {
+		return err
+	}
+	if len(g.Permissions) == 0 {
+		return fmt.Errorf("image: permissions of %s cannot be empty", g.Principal)
+	}
+	for _, p := range g.Permissions {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ACL is the access control list of image
+// the owner always has all permissions, and other principals only have the permissions granted to them
+type ACL struct {
+	Owner  userentity.Hash `json:"owner"`
+	Grants []Grant         `json:"grants,omitempty"`
+}
+
+// NewACL return the default access control list of image
+// the administrator is allowed to read, write and delete the image
+func NewACL(owner userentity.Hash) *ACL {
+	acl := ACL{
+		Owner: owner,
+		Grants: []Grant{
+			{
+				Principal:   RolePrincipal(RoleAdmin),
+				Permissions: []Permission{PermissionRead, PermissionWrite, PermissionDelete},
+			},
+		},
+	}
+	return &acl
+}
+
+// Permissions return the permissions of the subject
+func (a *ACL) Permissions(subject Subject, now time.Time) []Permission {
+	if subject.UserHash != "" && subject.UserHash == a.Owner {
+		return AllPermissions
+	}
+
+	principals := make(map[Principal]bool)
+	for _, p := range subject.Principals() {
+		principals[p] = true
+	}
+
+	granted := make(map[Permission]bool)
+	var permissions []Permission
+	for _, g := range a.Grants {
+		if !principals[g.Principal] || g.Expired(now) {
+			continue
+		}
+		for _, p := range g.Permissions {
+			if !granted[p] {
+				granted[p] = true
+				permissions = append(permissions, p)
+			}
+		}
+	}
+	return permissions
+}
+
+// Expiry return the time when the subject loses any of the permissions, nil is returned if the permissions never expire
+// the permission is kept until the last grant of the permission expires.
+func (a *ACL) Expiry(subject Subject, permissions []Permission, now time.Time) *time.Time {
+	if subject.UserHash != "" && subject.UserHash == a.Owner {
+		return nil
+	}
+
+	principals := make(map[Principal]bool)
+	for _, p := range subject.Principals() {
+		principals[p] = true
+	}
+
+	var expiry *time.Time
+	for _, permission := range permissions {
+		var (
+			last  *time.Time
+			never bool
+		)
+		for _, g := range a.Grants {
+			if !principals[g.Principal] || g.Expired(now) || !g.has(permission) {
+				continue
+			}
+			if g.ExpiresAt == nil {
+				never = true
+				break
+			}
+			if last == nil || g.ExpiresAt.After(*last) {
+				last = g.ExpiresAt
+			}
+		}
+		if never || last == nil {
+			continue
+		}
+		if expiry == nil || last.Before(*expiry) {
+			expiry = last
+		}
+	}
+	return expiry
+}
+
+// Allowed check whether the subject has the permission
+func (a *ACL) Allowed(subject Subject, permission Permission, now time.Time) bool {
+	for _, p := range a.Permissions(subject, now) {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Grant permissions to principal, the existing grant of the principal from the same issuer is replaced
+// expired grants are removed, so the list does not grow with old grants
+func (a *ACL) Grant(grant Grant, now time.Time) error {
+	if err := grant.Validate(); err != nil {
+		return err
+	}
+
+	grants := []Grant{grant}
+	for _, g := range a.Grants {
+		if (g.Principal == grant.Principal && g.IssuedBy == grant.IssuedBy) || g.Expired(now) {
+			continue
+		}
+		grants = append(grants, g)
+	}
+	a.Grants = grants
+	return nil
+}
+
+// Revoke all permissions of principal, return false if the principal has no grant
+func (a *ACL) Revoke(principal Principal) bool {
+	return a.revoke(func(g Grant) bool {
+		return g.Principal == principal
+	})
+}
+
+// RevokeIssued revoke the permissions of principal issued by the issuer, return false if the issuer has no grant to the principal
+func (a *ACL) RevokeIssued(principal Principal, issuer userentity.Hash) bool {
+	return a.revoke(func(g Grant) bool {
+		return g.Principal == principal && g.IssuedBy == issuer
+	})
+}
+
+// RevokeIssuer revoke all grants issued by the issuer, return false if the issuer has no grant
+func (a *ACL) RevokeIssuer(issuer userentity.Hash) bool {
+	return a.revoke(func(g Grant) bool {
+		return g.IssuedBy == issuer
+	})
+}
+
+func (a *ACL) revoke(match func(g Grant) bool) bool {
+	revoked := false
+	grants := a.Grants[:0]
+	for _, g := range a.Grants {
+		if match(g) {
+			revoked = true
+			continue
+		}
+		grants = append(grants, g)
+	}
+	a.Grants = grants
+	return revoked
+}
+
+// Encode the access control list to be stored in metadata
+func (a *ACL) Encode() (string, error) {
+	out, err := json.Marshal(a)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// DecodeACL decode access control list from metadata
+func DecodeACL(s string) (*ACL, error) {
+	acl := ACL{}
+	if err := json.Unmarshal([]byte(s), &acl); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAccessAttribute, err)
+	}
+	for _, g := range acl.Grants {
+		if err := g.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAccessAttribute, err)
+		}
+	}
+	return &acl, nil
+}
+
+// ACLFromAccess convert the access of image uploaded before the access control list exists
+// the owner access is allowed:{user_hash};priviledge:read, and the admin access is allowed:all;priviledge:read,write
+func ACLFromAccess(owner, admin Access) (*ACL, error) {
+	acl := ACL{}
+	for _, access := range []Access{owner, admin} {
+		if access == "" {
+			continue
+		}
+
+		var (
+			allowed     []string
+			permissions []Permission
+		)
+		for _, acc := range strings.Split(string(access), ";") {
+			detail := strings.Split(acc, ":")
+			if len(detail) < 2 {
+				return nil, ErrInvalidAccessAttribute
+			}
+			switch detail[0] {
+			case "allowed":
+				allowed = strings.Split(detail[1], ",")
+			case "priviledge":
+				for _, p := range strings.Split(detail[1], ",") {
+					permissions = append(permissions, Permission(p))
+				}
+			}
+		}
+		if len(permissions) == 0 {
+			permissions = []Permission{PermissionRead}
+		}
+
+		for _, a := range allowed {
+			principal := UserPrincipal(userentity.Hash(a))
+			if a == "all" {
+				principal = RolePrincipal(RoleAdmin)
+			}
+			grant := Grant{Principal: principal, Permissions: permissions}
+			if err := grant.Validate(); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidAccessAttribute, err)
+			}
+			acl.Grants = append(acl.Grants, grant)
+		}
+	}
+	return &acl, nil
+}
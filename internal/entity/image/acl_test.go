@@ -0,0 +1,226 @@
+package image_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/entity/image"
+)
+
+func TestACLAllowed(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	expired := now.Add(-time.Minute)
+	acl := image.NewACL("eUjks")
+	grants := []image.Grant{
+		{
+			Principal:   image.UserPrincipal("kLmno"),
+			Permissions: []image.Permission{image.PermissionRead},
+		},
+		{
+			Principal:   image.UserPrincipal("qRstu"),
+			Permissions: []image.Permission{image.PermissionRead},
+			ExpiresAt:   &expired,
+		},
+	}
+	for _, g := range grants {
+		if err := acl.Grant(g, expired.Add(-time.Minute)); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	cases := []struct {
+		subject    image.Subject
+		permission image.Permission
+		expect     bool
+	}{
+		{subject: image.Subject{UserHash: "eUjks"}, permission: image.PermissionShare, expect: true},
+		{subject: image.Subject{UserHash: "kLmno"}, permission: image.PermissionRead, expect: true},
+		{subject: image.Subject{UserHash: "kLmno"}, permission: image.PermissionDelete, expect: false},
+		{subject: image.Subject{UserHash: "qRstu"}, permission: image.PermissionRead, expect: false},
+		{subject: image.Subject{Roles: []string{image.RoleAdmin}}, permission: image.PermissionDelete, expect: true},
+		{subject: image.Subject{}, permission: image.PermissionRead, expect: false},
+	}
+
+	for _, c := range cases {
+		if allowed := acl.Allowed(c.subject, c.permission, now); allowed != c.expect {
+			t.Errorf("%+v %s: expecting %v but got %v", c.subject, c.permission, c.expect, allowed)
+			return
+		}
+	}
+
+	// the acl is still the same after encoded
+	encoded, err := acl.Encode()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	decoded, err := image.DecodeACL(encoded)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, c := range cases {
+		if allowed := decoded.Allowed(c.subject, c.permission, now); allowed != c.expect {
+			t.Errorf("decoded %+v %s: expecting %v but got %v", c.subject, c.permission, c.expect, allowed)
+			return
+		}
+	}
+}
+
+func TestACLFromAccess(t *testing.T) {
+	t.Parallel()
+
+	owner := image.CreateAccess([]string{"eUjks"}, []string{"read"})
+	admin := image.CreateAccess([]string{"all"}, []string{"read", "write"})
+	acl, err := image.ACLFromAccess(owner, admin)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	cases := []struct {
+		subject    image.Subject
+		permission image.Permission
+		expect     bool
+	}{
+		{subject: image.Subject{UserHash: "eUjks"}, permission: image.PermissionRead, expect: true},
+		{subject: image.Subject{UserHash: "eUjks"}, permission: image.PermissionWrite, expect: false},
+		{subject: image.Subject{Roles: []string{image.RoleAdmin}}, permission: image.PermissionWrite, expect: true},
+	}
+	for _, c := range cases {
+		if allowed := acl.Allowed(c.subject, c.permission, time.Now()); allowed != c.expect {
+			t.Errorf("%+v %s: expecting %v but got %v", c.subject, c.permission, c.expect, allowed)
+			return
+		}
+	}
+
+	if _, err := image.ACLFromAccess("invalid", ""); err == nil {
+		t.Error("expecting error for invalid access")
+		return
+	}
+}
+
+func TestACLExpiry(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	hour := now.Add(time.Hour)
+	day := now.Add(time.Hour * 24)
+	acl := image.NewACL("eUjks")
+	grants := []image.Grant{
+		{
+			Principal:   image.UserPrincipal("kLmno"),
+			Permissions: []image.Permission{image.PermissionRead, image.PermissionShare},
+			ExpiresAt:   &hour,
+		},
+		{
+			Principal:   image.PropertyOwnerPrincipal("prop-1"),
+			Permissions: []image.Permission{image.PermissionRead},
+			ExpiresAt:   &day,
+		},
+	}
+	for _, g := range grants {
+		if err := acl.Grant(g, now); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	cases := []struct {
+		name        string
+		subject     image.Subject
+		permissions []image.Permission
+		expect      *time.Time
+	}{
+		{
+			name:        "owner",
+			subject:     image.Subject{UserHash: "eUjks"},
+			permissions: []image.Permission{image.PermissionRead, image.PermissionShare},
+		},
+		{
+			name:        "single grant",
+			subject:     image.Subject{UserHash: "kLmno"},
+			permissions: []image.Permission{image.PermissionRead, image.PermissionShare},
+			expect:      &hour,
+		},
+		{
+			name:        "permission kept by the last grant",
+			subject:     image.Subject{UserHash: "kLmno", OwnedProperties: []string{"prop-1"}},
+			permissions: []image.Permission{image.PermissionRead},
+			expect:      &day,
+		},
+		{
+			name:        "permission lost by the first expired permission",
+			subject:     image.Subject{UserHash: "kLmno", OwnedProperties: []string{"prop-1"}},
+			permissions: []image.Permission{image.PermissionRead, image.PermissionShare},
+			expect:      &hour,
+		},
+		{
+			name:        "grant without expiry",
+			subject:     image.Subject{Roles: []string{image.RoleAdmin}},
+			permissions: []image.Permission{image.PermissionRead},
+		},
+	}
+	for _, c := range cases {
+		expiry := acl.Expiry(c.subject, c.permissions, now)
+		if (expiry == nil) != (c.expect == nil) || (expiry != nil && !expiry.Equal(*c.expect)) {
+			t.Errorf("%s: expecting expiry %v but got %v", c.name, c.expect, expiry)
+			return
+		}
+	}
+}
+
+func TestACLRevokeIssued(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	acl := image.NewACL("eUjks")
+	grants := []image.Grant{
+		{
+			Principal:   image.UserPrincipal("qRstu"),
+			Permissions: []image.Permission{image.PermissionRead},
+			IssuedBy:    "eUjks",
+		},
+		{
+			Principal:   image.UserPrincipal("qRstu"),
+			Permissions: []image.Permission{image.PermissionRead},
+			IssuedBy:    "kLmno",
+		},
+	}
+	for _, g := range grants {
+		if err := acl.Grant(g, now); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	// the grant of each issuer is kept
+	if len(acl.Grants) != 3 {
+		t.Errorf("expecting 3 grants but got %d", len(acl.Grants))
+		return
+	}
+
+	friend := image.Subject{UserHash: "qRstu"}
+	if acl.RevokeIssued(image.UserPrincipal("qRstu"), "vWxyz") {
+		t.Error("expecting no grant revoked for other issuer")
+		return
+	}
+	if !acl.RevokeIssued(image.UserPrincipal("qRstu"), "kLmno") {
+		t.Error("expecting grant revoked")
+		return
+	}
+	if !acl.Allowed(friend, image.PermissionRead, now) {
+		t.Error("expecting the grant of other issuer is kept")
+		return
+	}
+	if !acl.RevokeIssuer("eUjks") {
+		t.Error("expecting grant revoked")
+		return
+	}
+	if acl.Allowed(friend, image.PermissionRead, now) {
+		t.Error("expecting all grants revoked")
+		return
+	}
+}
@@ -21,3 +21,17 @@ const (
 	GroupUserAvatar     = "user/avatar"
 	GroupPaymentProof   = "payment/proof"
 )
+
+// list of image variant
+const (
+	VariantOriginal  Variant = "original"
+	VariantThumbnail Variant = "thumbnail"
+	VariantMedium    Variant = "medium"
+)
+
+// list of image format
+const (
+	FormatJPEG Format = "jpeg"
+	FormatPNG  Format = "png"
+	FormatGIF  Format = "gif"
+)
@@ -7,4 +7,12 @@ var (
 	ErrTooManyTags            = errors.New("image: cannot have more than 5 tags")
 	ErrTempPathNotFound       = errors.New("image: temporary path not found")
 	ErrInvalidAccessAttribute = errors.New("image: invalid access attribute")
+	ErrChecksumMismatch       = errors.New("image: checksum of the image does not match")
+	ErrUnsupportedFormat      = errors.New("image: unsupported image format")
+	ErrContentTypeMismatch    = errors.New("image: content of the image does not match its content type")
+	ErrInvalidImage           = errors.New("image: invalid image content")
+	ErrImageNotFound          = errors.New("image: image not found")
+	ErrPermissionDenied       = errors.New("image: user is not permitted to access this image")
+	ErrImageTooLarge          = errors.New("image: image dimension is too large")
+	ErrShareToSelf            = errors.New("image: cannot share image to yourself")
 )
@@ -58,6 +58,8 @@ type FileInfo struct {
 	Mode     Mode
 	Group    Group
 	Tags     string
+	// Grants is the additional grants of private image, for example to allow the property owner to access the image
+	Grants []Grant
 }
 
 // Options struct
@@ -68,14 +70,39 @@ type Options struct {
 // Manipulation struct
 type Manipulation struct {
 	Resize Resize
+	// Format of the result, the format of the original image is used if empty
+	Format Format
 }
 
 // Resize struct
+// the image is resized to fit the height and width while keeping its aspect ratio
+// zero height or width means the size is not limited, and the image is never enlarged
 type Resize struct {
 	Height int
 	Width  int
 }
 
+// Variant of image, variant is generated from the original image when uploading
+type Variant string
+
+// Format of image
+type Format string
+
+// Validate format
+func (f Format) Validate() error {
+	switch f {
+	case FormatJPEG, FormatPNG, FormatGIF:
+	default:
+		return fmt.Errorf("image: invalid format, got %s", f)
+	}
+	return nil
+}
+
+// ContentType of image format
+func (f Format) ContentType() string {
+	return "image/" + string(f)
+}
+
 // Access of image
 type Access string
 
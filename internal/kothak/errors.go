@@ -0,0 +1,57 @@
+package kothak
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ResourceError is an error returned by a resource inside kothak
+type ResourceError struct {
+	Name string
+	Kind string
+	Err  error
+}
+
+// Error return the string of resource error
+func (re *ResourceError) Error() string {
+	return fmt.Sprintf("%s %s: %v", re.Kind, re.Name, re.Err)
+}
+
+// Unwrap return the original error of the resource
+func (re *ResourceError) Unwrap() error {
+	return re.Err
+}
+
+// Errors is a list of resource errors
+// kothak open and close resources concurrently,
+// so all errors are collected instead of returning the first one
+type Errors []*ResourceError
+
+// Error return all resource errors in one string
+func (errs Errors) Error() string {
+	s := make([]string, len(errs))
+	for i, err := range errs {
+		s[i] = err.Error()
+	}
+	return fmt.Sprintf("kothak: %d error(s) occurred: [%s]", len(errs), strings.Join(s, "; "))
+}
+
+// Is return true if one of the resource errors match the target
+func (errs Errors) Is(target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Err return nil if there is no error in the list
+// this is needed to avoid returning a non-nil error interface with nil value
+func (errs Errors) Err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
@@ -0,0 +1,33 @@
+package kothak
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+
+	errDSN := errors.New("invalid dsn")
+	errs := Errors{
+		{Name: "session", Kind: KindRedis, Err: errors.New("connection refused")},
+		{Name: "users", Kind: KindSQLDB, Err: errDSN},
+	}
+
+	expect := "kothak: 2 error(s) occurred: [redis session: connection refused; sqldb users: invalid dsn]"
+	if errs.Error() != expect {
+		t.Errorf("expecting error %s but got %s", expect, errs.Error())
+		return
+	}
+
+	if !errors.Is(errs.Err(), errDSN) {
+		t.Error("expecting errors to contain invalid dsn error")
+		return
+	}
+
+	var empty Errors
+	if empty.Err() != nil {
+		t.Errorf("expecting nil error from empty errors but got %v", empty.Err())
+		return
+	}
+}
@@ -0,0 +1,367 @@
+package kothak
+
+import (
+	"context"
+	"sync"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	"gocloud.dev/blob"
+)
+
+// The handles are returned by kothak instead of the connections,
+// so the resources retrieved before the reload are pointing to the new connections after the reload.
+
+// redisHandle is the redis returned by kothak, the connection is swapped on reload
+type redisHandle struct {
+	mu  sync.RWMutex
+	rds redis.Redis
+}
+
+func newRedisHandle(rds redis.Redis) *redisHandle {
+	return &redisHandle{rds: rds}
+}
+
+func (h *redisHandle) get() redis.Redis {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.rds
+}
+
+// swap the connection and return the old connection
+func (h *redisHandle) swap(rds redis.Redis) redis.Redis {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	old := h.rds
+	h.rds = rds
+	return old
+}
+
+// Close the current redis connection
+func (h *redisHandle) Close() error {
+	return h.get().Close()
+}
+
+// Ping call Ping of the current redis
+func (h *redisHandle) Ping(ctx context.Context) (string, error) {
+	return h.get().Ping(ctx)
+}
+
+// IsErrNil call IsErrNil of the current redis
+func (h *redisHandle) IsErrNil(err error) bool {
+	return h.get().IsErrNil(err)
+}
+
+// IsResponseOK call IsResponseOK of the current redis
+func (h *redisHandle) IsResponseOK(result string) bool {
+	return h.get().IsResponseOK(result)
+}
+
+// Set call Set of the current redis
+func (h *redisHandle) Set(ctx context.Context, key string, value interface{}) (string, error) {
+	return h.get().Set(ctx, key, value)
+}
+
+// SetNX call SetNX of the current redis
+func (h *redisHandle) SetNX(ctx context.Context, key string, value interface{}, expire int) (int, error) {
+	return h.get().SetNX(ctx, key, value, expire)
+}
+
+// SetEX call SetEX of the current redis
+func (h *redisHandle) SetEX(ctx context.Context, key string, value interface{}, expire int) (string, error) {
+	return h.get().SetEX(ctx, key, value, expire)
+}
+
+// Get call Get of the current redis
+func (h *redisHandle) Get(ctx context.Context, key string) (string, error) {
+	return h.get().Get(ctx, key)
+}
+
+// Delete call Delete of the current redis
+func (h *redisHandle) Delete(ctx context.Context, key string) (int, error) {
+	return h.get().Delete(ctx, key)
+}
+
+// Increment call Increment of the current redis
+func (h *redisHandle) Increment(ctx context.Context, key string) (int, error) {
+	return h.get().Increment(ctx, key)
+}
+
+// IncrementBy call IncrementBy of the current redis
+func (h *redisHandle) IncrementBy(ctx context.Context, key string, amount int) (int, error) {
+	return h.get().IncrementBy(ctx, key, amount)
+}
+
+// Expire call Expire of the current redis
+func (h *redisHandle) Expire(ctx context.Context, key string, duration int) (int, error) {
+	return h.get().Expire(ctx, key, duration)
+}
+
+// MSet call MSet of the current redis
+func (h *redisHandle) MSet(ctx context.Context, pairs ...interface{}) (string, error) {
+	return h.get().MSet(ctx, pairs...)
+}
+
+// MGet call MGet of the current redis
+func (h *redisHandle) MGet(ctx context.Context, keys ...string) ([]string, error) {
+	return h.get().MGet(ctx, keys...)
+}
+
+// HSet call HSet of the current redis
+func (h *redisHandle) HSet(ctx context.Context, key string, field string, value interface{}) (int, error) {
+	return h.get().HSet(ctx, key, field, value)
+}
+
+// HSetEX call HSetEX of the current redis
+func (h *redisHandle) HSetEX(ctx context.Context, key string, field string, value interface{}, expire int) (int, error) {
+	return h.get().HSetEX(ctx, key, field, value, expire)
+}
+
+// HGet call HGet of the current redis
+func (h *redisHandle) HGet(ctx context.Context, key string, field string) (string, error) {
+	return h.get().HGet(ctx, key, field)
+}
+
+// HGetAll call HGetAll of the current redis
+func (h *redisHandle) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return h.get().HGetAll(ctx, key)
+}
+
+// HMSet call HMSet of the current redis
+func (h *redisHandle) HMSet(ctx context.Context, key string, kv map[string]interface{}) (string, error) {
+	return h.get().HMSet(ctx, key, kv)
+}
+
+// HMGet call HMGet of the current redis
+func (h *redisHandle) HMGet(ctx context.Context, key string, fields ...string) ([]string, error) {
+	return h.get().HMGet(ctx, key, fields...)
+}
+
+// HDel call HDel of the current redis
+func (h *redisHandle) HDel(ctx context.Context, key string, fields ...string) (int, error) {
+	return h.get().HDel(ctx, key, fields...)
+}
+
+// LLen call LLen of the current redis
+func (h *redisHandle) LLen(ctx context.Context, key string) (int, error) {
+	return h.get().LLen(ctx, key)
+}
+
+// LIndex call LIndex of the current redis
+func (h *redisHandle) LIndex(ctx context.Context, key string, index int) (string, error) {
+	return h.get().LIndex(ctx, key, index)
+}
+
+// LSet call LSet of the current redis
+func (h *redisHandle) LSet(ctx context.Context, key string, value string, index int) (int, error) {
+	return h.get().LSet(ctx, key, value, index)
+}
+
+// LPush call LPush of the current redis
+func (h *redisHandle) LPush(ctx context.Context, key string, values ...interface{}) (int, error) {
+	return h.get().LPush(ctx, key, values...)
+}
+
+// LPushX call LPushX of the current redis
+func (h *redisHandle) LPushX(ctx context.Context, key string, values ...interface{}) (int, error) {
+	return h.get().LPushX(ctx, key, values...)
+}
+
+// LPop call LPop of the current redis
+func (h *redisHandle) LPop(ctx context.Context, key string) (string, error) {
+	return h.get().LPop(ctx, key)
+}
+
+// LRem call LRem of the current redis
+func (h *redisHandle) LRem(ctx context.Context, key string, value string, count int) (int, error) {
+	return h.get().LRem(ctx, key, value, count)
+}
+
+// LTrim call LTrim of the current redis
+func (h *redisHandle) LTrim(ctx context.Context, key string, start int, stop int) (string, error) {
+	return h.get().LTrim(ctx, key, start, stop)
+}
+
+// TTL call TTL of the current redis
+func (h *redisHandle) TTL(ctx context.Context, key string) (int, error) {
+	return h.get().TTL(ctx, key)
+}
+
+// Persist call Persist of the current redis
+func (h *redisHandle) Persist(ctx context.Context, key string) (int, error) {
+	return h.get().Persist(ctx, key)
+}
+
+// SAdd call SAdd of the current redis
+func (h *redisHandle) SAdd(ctx context.Context, key string, members ...interface{}) (int, error) {
+	return h.get().SAdd(ctx, key, members...)
+}
+
+// SRem call SRem of the current redis
+func (h *redisHandle) SRem(ctx context.Context, key string, members ...interface{}) (int, error) {
+	return h.get().SRem(ctx, key, members...)
+}
+
+// SMembers call SMembers of the current redis
+func (h *redisHandle) SMembers(ctx context.Context, key string) ([]string, error) {
+	return h.get().SMembers(ctx, key)
+}
+
+// SIsMember call SIsMember of the current redis
+func (h *redisHandle) SIsMember(ctx context.Context, key string, member interface{}) (bool, error) {
+	return h.get().SIsMember(ctx, key, member)
+}
+
+// SCard call SCard of the current redis
+func (h *redisHandle) SCard(ctx context.Context, key string) (int, error) {
+	return h.get().SCard(ctx, key)
+}
+
+// ZAdd call ZAdd of the current redis
+func (h *redisHandle) ZAdd(ctx context.Context, key string, members ...redis.ZMember) (int, error) {
+	return h.get().ZAdd(ctx, key, members...)
+}
+
+// ZRem call ZRem of the current redis
+func (h *redisHandle) ZRem(ctx context.Context, key string, members ...string) (int, error) {
+	return h.get().ZRem(ctx, key, members...)
+}
+
+// ZScore call ZScore of the current redis
+func (h *redisHandle) ZScore(ctx context.Context, key string, member string) (float64, error) {
+	return h.get().ZScore(ctx, key, member)
+}
+
+// ZCard call ZCard of the current redis
+func (h *redisHandle) ZCard(ctx context.Context, key string) (int, error) {
+	return h.get().ZCard(ctx, key)
+}
+
+// ZRangeByScore call ZRangeByScore of the current redis
+func (h *redisHandle) ZRangeByScore(ctx context.Context, key string, min string, max string) ([]redis.ZMember, error) {
+	return h.get().ZRangeByScore(ctx, key, min, max)
+}
+
+// ZRemRangeByScore call ZRemRangeByScore of the current redis
+func (h *redisHandle) ZRemRangeByScore(ctx context.Context, key string, min string, max string) (int, error) {
+	return h.get().ZRemRangeByScore(ctx, key, min, max)
+}
+
+// Eval call Eval of the current redis
+func (h *redisHandle) Eval(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (interface{}, error) {
+	return h.get().Eval(ctx, script, keys, args...)
+}
+
+// Publish call Publish of the current redis
+func (h *redisHandle) Publish(ctx context.Context, channel string, message interface{}) (int, error) {
+	return h.get().Publish(ctx, channel, message)
+}
+
+// Subscribe call Subscribe of the current redis
+func (h *redisHandle) Subscribe(ctx context.Context, channels ...string) (redis.Subscription, error) {
+	return h.get().Subscribe(ctx, channels...)
+}
+
+// Pipeline call Pipeline of the current redis
+func (h *redisHandle) Pipeline(ctx context.Context, commands ...redis.Command) ([]redis.Result, error) {
+	return h.get().Pipeline(ctx, commands...)
+}
+
+// Transaction call Transaction of the current redis
+func (h *redisHandle) Transaction(ctx context.Context, commands ...redis.Command) ([]redis.Result, error) {
+	return h.get().Transaction(ctx, commands...)
+}
+
+// objectStorageHandle is the object storage provider used by the object storage returned by kothak,
+// the provider and key provider are swapped on reload
+type objectStorageHandle struct {
+	mu          sync.RWMutex
+	provider    objectstorage.StorageProvider
+	keyProvider objectstorage.KeyProvider
+}
+
+// objectStorage is the object storage returned by kothak and its handle
+type objectStorage struct {
+	storage *objectstorage.Storage
+	handle  *objectStorageHandle
+}
+
+// newObjectStorageHandle return object storage using the handle as provider
+// the key provider is only set when the encryption is enabled, because the object is encrypted if the key provider is not nil.
+func newObjectStorageHandle(provider objectstorage.StorageProvider, keyProvider objectstorage.KeyProvider) *objectStorage {
+	h := &objectStorageHandle{provider: provider, keyProvider: keyProvider}
+	opts := &objectstorage.Options{}
+	if keyProvider != nil {
+		opts.KeyProvider = keyProviderHandle{h}
+	}
+	return &objectStorage{storage: objectstorage.NewWithOptions(h, opts), handle: h}
+}
+
+func (h *objectStorageHandle) get() (objectstorage.StorageProvider, objectstorage.KeyProvider) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.provider, h.keyProvider
+}
+
+// swap the provider and key provider, and return the old provider
+func (h *objectStorageHandle) swap(provider objectstorage.StorageProvider, keyProvider objectstorage.KeyProvider) objectstorage.StorageProvider {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	old := h.provider
+	h.provider = provider
+	h.keyProvider = keyProvider
+	return old
+}
+
+// Bucket of the current provider
+func (h *objectStorageHandle) Bucket() *blob.Bucket {
+	p, _ := h.get()
+	return p.Bucket()
+}
+
+// Name of the current provider
+func (h *objectStorageHandle) Name() string {
+	p, _ := h.get()
+	return p.Name()
+}
+
+// BucketName of the current provider
+func (h *objectStorageHandle) BucketName() string {
+	p, _ := h.get()
+	return p.BucketName()
+}
+
+// BucketURL of the current provider
+func (h *objectStorageHandle) BucketURL() string {
+	p, _ := h.get()
+	return p.BucketURL()
+}
+
+// Close the current provider
+func (h *objectStorageHandle) Close() error {
+	p, _ := h.get()
+	return p.Close()
+}
+
+// keyProviderHandle use the current key provider of object storage handle
+type keyProviderHandle struct {
+	h *objectStorageHandle
+}
+
+// KeyID of the current key provider
+func (kh keyProviderHandle) KeyID() string {
+	_, kp := kh.h.get()
+	return kp.KeyID()
+}
+
+// Encrypt with the current key provider
+func (kh keyProviderHandle) Encrypt(ctx context.Context, dataKey []byte) ([]byte, error) {
+	_, kp := kh.h.get()
+	return kp.Encrypt(ctx, dataKey)
+}
+
+// Decrypt with the current key provider
+func (kh keyProviderHandle) Decrypt(ctx context.Context, keyID string, encryptedKey []byte) ([]byte, error) {
+	_, kp := kh.h.get()
+	return kp.Decrypt(ctx, keyID, encryptedKey)
+}
@@ -0,0 +1,159 @@
+package kothak
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	"github.com/albertwidi/go-project-example/internal/pkg/sqldb"
+	"github.com/jmoiron/sqlx"
+	"go.opencensus.io/trace"
+)
+
+// list of resource kind
+const (
+	KindSQLDB         = "sqldb"
+	KindRedis         = "redis"
+	KindObjectStorage = "object_storage"
+)
+
+// list of sql database role
+const (
+	RoleLeader   = "leader"
+	RoleFollower = "follower"
+)
+
+// DefaultHealthCheckTimeout is the timeout used when timeout is not specified
+const DefaultHealthCheckTimeout = time.Second * 3
+
+// ResourceHealth is the health status of one resource
+type ResourceHealth struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Role    string `json:"role,omitempty"`
+	Healthy bool   `json:"healthy"`
+	// Latency of the health check in milliseconds
+	Latency int64  `json:"latency_ms"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Health is the health status of all resources inside kothak
+type Health struct {
+	Healthy   bool             `json:"healthy"`
+	Resources []ResourceHealth `json:"resources"`
+}
+
+// HealthCheck ping all resources concurrently and return the health status of each of them
+// sql database is checked for both leader and follower, follower is not checked if it is the same with leader
+// a resource is not healthy if the ping is failed or not finished within the timeout
+func (k *Kothak) HealthCheck(ctx context.Context, timeout time.Duration) Health {
+	ctx, span := trace.StartSpan(ctx, "kothak/healthcheck")
+	defer span.End()
+
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// copy the resources, so we don't hold the lock while checking
+	k.mutex.Lock()
+	dbs := make(map[string]*sqldb.DB, len(k.dbs))
+	for name, db := range k.dbs {
+		dbs[name] = db
+	}
+	rds := make(map[string]redis.Redis, len(k.rds))
+	for name, r := range k.rds {
+		rds[name] = r
+	}
+	objStorages := make(map[string]*objectstorage.Storage, len(k.objStorages))
+	for name, obj := range k.objStorages {
+		objStorages[name] = obj.storage
+	}
+	k.mutex.Unlock()
+
+	var (
+		health = Health{Healthy: true}
+		group  sync.WaitGroup
+		mu     sync.Mutex
+	)
+
+	check := func(name, kind, role string, ping func(ctx context.Context) error) {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+
+			now := time.Now()
+			err := ping(ctx)
+			rh := ResourceHealth{
+				Name:    name,
+				Kind:    kind,
+				Role:    role,
+				Healthy: err == nil,
+				Latency: time.Since(now).Milliseconds(),
+			}
+			if err != nil {
+				rh.Error = err.Error()
+			}
+
+			mu.Lock()
+			health.Resources = append(health.Resources, rh)
+			if !rh.Healthy {
+				health.Healthy = false
+			}
+			mu.Unlock()
+		}()
+	}
+
+	for name, db := range dbs {
+		check(name, KindSQLDB, RoleLeader, pingSQLDB(db.Leader()))
+		followers := db.Followers()
+		for i, follower := range followers {
+			if follower == db.Leader() {
+				continue
+			}
+			role := RoleFollower
+			if len(followers) > 1 {
+				role = fmt.Sprintf("%s_%d", RoleFollower, i)
+			}
+			check(name, KindSQLDB, role, pingSQLDB(follower))
+		}
+	}
+
+	for name, r := range rds {
+		r := r
+		check(name, KindRedis, "", func(ctx context.Context) error {
+			_, err := r.Ping(ctx)
+			return err
+		})
+	}
+
+	for name, obj := range objStorages {
+		check(name, KindObjectStorage, "", obj.Ping)
+	}
+
+	group.Wait()
+
+	// sort the result, so the order is always the same for every check
+	sort.Slice(health.Resources, func(i, j int) bool {
+		a, b := health.Resources[i], health.Resources[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Role < b.Role
+	})
+	return health
+}
+
+func pingSQLDB(db *sqlx.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
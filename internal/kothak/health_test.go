@@ -0,0 +1,149 @@
+package kothak
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	"github.com/albertwidi/go-project-example/internal/pkg/sqldb"
+	"github.com/albertwidi/go-project-example/internal/pkg/sqldb/fakesql"
+)
+
+// fakeRedis return err on ping, or block until the context is done
+type fakeRedis struct {
+	redis.Redis
+	err   error
+	block bool
+}
+
+func (r *fakeRedis) Ping(ctx context.Context) (string, error) {
+	if r.block {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	if r.err != nil {
+		return "", r.err
+	}
+	return "PONG", nil
+}
+
+func (r *fakeRedis) Close() error {
+	return nil
+}
+
+func newHealthKothak(t *testing.T, followerDown bool, rds redis.Redis) *Kothak {
+	fake := fakesql.New()
+	follower := fake.Open("postgres")
+	if followerDown {
+		follower.Close()
+	}
+	db, err := sqldb.Wrap(context.Background(), fake.Open("postgres"), follower)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := Kothak{
+		objStorages: make(map[string]*objectStorage),
+		dbs:         make(map[string]*sqldb.DB),
+		rds:         make(map[string]*redisHandle),
+	}
+	k.setSQLDB("users", db)
+	k.setRedis("session", rds)
+	return &k
+}
+
+func TestHealthCheck(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		followerDown  bool
+		redis         redis.Redis
+		expectHealthy bool
+		expect        []ResourceHealth
+	}{
+		{
+			name:          "all healthy",
+			redis:         &fakeRedis{},
+			expectHealthy: true,
+			expect: []ResourceHealth{
+				{Name: "session", Kind: KindRedis, Healthy: true},
+				{Name: "users", Kind: KindSQLDB, Role: RoleFollower, Healthy: true},
+				{Name: "users", Kind: KindSQLDB, Role: RoleLeader, Healthy: true},
+			},
+		},
+		{
+			name:          "follower down",
+			followerDown:  true,
+			redis:         &fakeRedis{},
+			expectHealthy: false,
+			expect: []ResourceHealth{
+				{Name: "session", Kind: KindRedis, Healthy: true},
+				{Name: "users", Kind: KindSQLDB, Role: RoleFollower, Healthy: false},
+				{Name: "users", Kind: KindSQLDB, Role: RoleLeader, Healthy: true},
+			},
+		},
+		{
+			name:          "redis down",
+			redis:         &fakeRedis{err: errors.New("connection refused")},
+			expectHealthy: false,
+			expect: []ResourceHealth{
+				{Name: "session", Kind: KindRedis, Healthy: false},
+				{Name: "users", Kind: KindSQLDB, Role: RoleFollower, Healthy: true},
+				{Name: "users", Kind: KindSQLDB, Role: RoleLeader, Healthy: true},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		k := newHealthKothak(t, c.followerDown, c.redis)
+		health := k.HealthCheck(context.Background(), time.Second)
+		k.CloseAll()
+
+		if health.Healthy != c.expectHealthy {
+			t.Errorf("%s: expecting healthy %v but got %v", c.name, c.expectHealthy, health.Healthy)
+			return
+		}
+		if len(health.Resources) != len(c.expect) {
+			t.Errorf("%s: expecting %d resources but got %+v", c.name, len(c.expect), health.Resources)
+			return
+		}
+		for i, rh := range health.Resources {
+			e := c.expect[i]
+			if rh.Name != e.Name || rh.Kind != e.Kind || rh.Role != e.Role || rh.Healthy != e.Healthy {
+				t.Errorf("%s: expecting resource %+v but got %+v", c.name, e, rh)
+				return
+			}
+			if !rh.Healthy && rh.Error == "" {
+				t.Errorf("%s: expecting error of unhealthy resource %s %s", c.name, rh.Name, rh.Role)
+				return
+			}
+		}
+	}
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	t.Parallel()
+
+	k := newHealthKothak(t, false, &fakeRedis{block: true})
+	defer k.CloseAll()
+
+	start := time.Now()
+	health := k.HealthCheck(context.Background(), time.Millisecond*50)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expecting health check to finish within the timeout but took %v", elapsed)
+		return
+	}
+	if health.Healthy {
+		t.Error("expecting unhealthy when the ping is not finished within the timeout")
+		return
+	}
+	for _, rh := range health.Resources {
+		if rh.Kind == KindRedis && (rh.Healthy || rh.Error != context.DeadlineExceeded.Error()) {
+			t.Errorf("expecting redis to be unhealthy with error %v but got %+v", context.DeadlineExceeded, rh)
+			return
+		}
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/albertwidi/go-project-example/internal/pkg/log/logger"
 	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage"
@@ -14,6 +16,7 @@ import (
 	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage/local"
 	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage/s3"
 	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis/memory"
 	redigo "github.com/albertwidi/go-project-example/internal/pkg/redis/redigo"
 	"github.com/albertwidi/go-project-example/internal/pkg/sqldb"
 	"github.com/jmoiron/sqlx"
@@ -29,10 +32,15 @@ type Config struct {
 
 // Kothak struct
 type Kothak struct {
-	objStorages map[string]*objectstorage.Storage
+	objStorages map[string]*objectStorage
 	dbs         map[string]*sqldb.DB
-	rds         map[string]redis.Redis
+	rds         map[string]*redisHandle
 	logger      logger.Logger
+	// config is the current configuration of all resources
+	// used to compare the configuration when reloading
+	config Config
+	// reloadMu guard the reload process, so only one reload is running
+	reloadMu sync.Mutex
 	// this mutex is used in two place
 	// the usage shared because the usage is not collide
 	// 1. when we initialize all the connections
@@ -48,127 +56,67 @@ func (k *Kothak) setSQLDB(name string, db *sqldb.DB) {
 
 func (k *Kothak) setRedis(name string, rds redis.Redis) {
 	k.mutex.Lock()
-	k.rds[name] = rds
+	k.rds[name] = newRedisHandle(rds)
 	k.mutex.Unlock()
 }
 
-func (k *Kothak) setObjectStorage(name string, obj objectstorage.StorageProvider) {
+func (k *Kothak) setObjectStorage(name string, provider objectstorage.StorageProvider, keyProvider objectstorage.KeyProvider) {
 	k.mutex.Lock()
-	k.objStorages[name] = objectstorage.New(obj)
+	k.objStorages[name] = newObjectStorageHandle(provider, keyProvider)
 	k.mutex.Unlock()
 }
 
 // New kothak instance
+// all resources are connected concurrently, and all errors are collected into Errors.
+// If one of the resources is failed to connect, all connected resources will be closed
 func New(ctx context.Context, kothakConfig Config, logger logger.Logger) (*Kothak, error) {
 	ctx, span := trace.StartSpan(ctx, "ktohak/new")
 	defer span.End()
 
 	var (
 		kothak = Kothak{
-			objStorages: make(map[string]*objectstorage.Storage),
+			objStorages: make(map[string]*objectStorage),
 			dbs:         make(map[string]*sqldb.DB),
-			rds:         make(map[string]redis.Redis),
+			rds:         make(map[string]*redisHandle),
 			logger:      logger,
 		}
 
 		group = sync.WaitGroup{}
-		errs  []error
-		err   error
+		errs  Errors
+		errMu sync.Mutex
 	)
 
+	addError := func(name, kind string, err error) {
+		errMu.Lock()
+		errs = append(errs, &ResourceError{Name: name, Kind: kind, Err: err})
+		errMu.Unlock()
+	}
+
 	// set default configuration for DBConfig
 	if err := kothakConfig.DBConfig.SetDefault(); err != nil {
 		return nil, err
 	}
+	kothak.config = kothakConfig
 
 	// connect to object storage
 	for _, objStorageConfig := range kothakConfig.ObjectStorageConfig {
 		group.Add(1)
 		go func(config ObjectStorageConfig) {
-			_, span = trace.StartSpan(ctx, fmt.Sprintf("object_storage/init/%s", config.Name))
+			_, span := trace.StartSpan(ctx, fmt.Sprintf("object_storage/init/%s", config.Name))
 			defer func() {
 				span.End()
 				group.Done()
 			}()
 
-			var (
-				provider objectstorage.StorageProvider
-				err      error
-			)
-
-			switch strings.ToLower(config.Provider) {
-			// local storage
-			case objectstorage.StorageLocal:
-				// defaulted to not delete local bucket when close the program
-				provider, err = local.New(ctx, fmt.Sprintf("./%s", config.Bucket), &local.Options{DeleteOnClose: false})
-
-			// gcs compatible storage
-			case objectstorage.StorageGCS:
-				gcsCreds, err := gcs.CredentialsFromFile(ctx, config.GCS.JSONKey)
-				if err != nil {
-					errs = append(errs, err)
-					return
-				}
-
-				gcsConfig, err := gcs.NewConfig(ctx, gcsCreds)
-				if err != nil {
-					errs = append(errs, err)
-					return
-				}
-				gcsConfig.
-					SetBucket(config.Bucket).
-					SetBucketProto(config.BucketProto).
-					SetBucketURL(config.BucketURL)
-
-				provider, err = gcs.New(ctx, gcsConfig)
-				if err != nil {
-					errs = append(errs, err)
-					return
-				}
-
-			// s3 compatible storage
-			case objectstorage.StorageS3, objectstorage.StorageDO, objectstorage.StorageMinio:
-				s3Creds, err := s3.CredentialsFromClient(ctx, config.S3.ClientID, config.S3.ClientSecret, "")
-				if err != nil {
-					errs = append(errs, err)
-					return
-				}
-
-				s3Config, err := s3.NewConfig(ctx, s3Creds)
-				if err != nil {
-					errs = append(errs, err)
-					return
-				}
-
-				s3Config.
-					SetBucket(config.Bucket).
-					SetBucketProto(config.BucketProto).
-					SetBucketURL(config.BucketURL).
-					SetRegion(config.Region).
-					SetEndpoint(config.Endpoint).
-					DisableSSL(config.S3.DisableSSL).
-					ForcePathStyle(config.S3.ForcePathStyle)
-
-				provider, err = s3.New(ctx, s3Config)
-				if err != nil {
-					errs = append(errs, err)
-					return
-				}
-
-			default:
-				err = errors.New("kothak: object storage provider not found")
-				errs = append(errs, err)
-				return
-			}
-
+			provider, keyProvider, err := newObjectStorage(ctx, config)
 			if err != nil {
-				errs = append(errs, err)
+				addError(config.Name, KindObjectStorage, err)
 				return
 			}
 
 			logger.Debugf("kothak: Connected to object_storage %s", config.Name)
 
-			kothak.setObjectStorage(config.Name, provider)
+			kothak.setObjectStorage(config.Name, provider, keyProvider)
 		}(objStorageConfig)
 	}
 
@@ -176,21 +124,15 @@ func New(ctx context.Context, kothakConfig Config, logger logger.Logger) (*Kotha
 	for _, redisconfig := range kothakConfig.RedisConfig.Rds {
 		group.Add(1)
 		go func(redisconfig RedisConnConfig) {
-			_, span = trace.StartSpan(ctx, fmt.Sprintf("redis/init/%s", redisconfig.Name))
+			_, span := trace.StartSpan(ctx, fmt.Sprintf("redis/init/%s", redisconfig.Name))
 			defer func() {
 				group.Done()
 				span.End()
 			}()
 
-			conf := redigo.Config{
-				MaxActive: kothakConfig.RedisConfig.MaxActive,
-				MaxIdle:   kothakConfig.RedisConfig.MaxIdle,
-				Timeout:   kothakConfig.RedisConfig.Timeout,
-			}
-
-			r, err := redigo.New(ctx, redisconfig.Address, &conf)
+			r, err := connectRedis(ctx, kothakConfig.RedisConfig, redisconfig)
 			if err != nil {
-				errs = append(errs, err)
+				addError(redisconfig.Name, KindRedis, err)
 				return
 			}
 
@@ -204,60 +146,15 @@ func New(ctx context.Context, kothakConfig Config, logger logger.Logger) (*Kotha
 	for _, dbconfig := range kothakConfig.DBConfig.SQLDBs {
 		group.Add(1)
 		go func(dbconfig SQLDBConfig) {
-			_, span = trace.StartSpan(ctx, fmt.Sprintf("database/connect/%s", dbconfig.Name))
+			_, span := trace.StartSpan(ctx, fmt.Sprintf("database/connect/%s", dbconfig.Name))
 			defer func() {
 				group.Done()
 				span.End()
 			}()
 
-			var (
-				err        error
-				leaderDB   *sqlx.DB
-				followerDB *sqlx.DB
-			)
-
-			if dbconfig.Driver == "" {
-
-			}
-
-			// setup leader connection
-			if err := dbconfig.LeaderConnConfig.SetDefault(kothakConfig.DBConfig); err != nil {
-				errs = append(errs, err)
-				return
-			}
-			// connect to leader
-			leaderDB, err = sqldb.Connect(ctx, dbconfig.Driver, dbconfig.LeaderConnConfig.DSN, &sqldb.ConnectOptions{
-				Retry:              dbconfig.LeaderConnConfig.MaxRetry,
-				MaxOpenConnections: dbconfig.LeaderConnConfig.MaxOpenConnections,
-				MaxIdleConnections: dbconfig.LeaderConnConfig.MaxIdleConnections,
-			})
+			db, err := connectSQLDB(ctx, kothakConfig.DBConfig, dbconfig, logger)
 			if err != nil {
-				errs = append(errs, err)
-				return
-			}
-			// by default, set replica to leader
-			followerDB = leaderDB
-
-			// connect to replica
-			if dbconfig.ReplicaConnConfig.DSN != "" {
-				if err := dbconfig.ReplicaConnConfig.SetDefault(kothakConfig.DBConfig); err != nil {
-					errs = append(errs, err)
-					return
-				}
-				followerDB, err = sqldb.Connect(ctx, dbconfig.Driver, dbconfig.ReplicaConnConfig.DSN, &sqldb.ConnectOptions{
-					Retry:              dbconfig.ReplicaConnConfig.MaxRetry,
-					MaxOpenConnections: dbconfig.ReplicaConnConfig.MaxOpenConnections,
-					MaxIdleConnections: dbconfig.ReplicaConnConfig.MaxIdleConnections,
-				})
-				if err != nil {
-					errs = append(errs, err)
-					return
-				}
-			}
-
-			db, err := sqldb.Wrap(ctx, leaderDB, followerDB)
-			if err != nil {
-				errs = append(errs, err)
+				addError(dbconfig.Name, KindSQLDB, err)
 				return
 			}
 
@@ -269,33 +166,233 @@ func New(ctx context.Context, kothakConfig Config, logger logger.Logger) (*Kotha
 
 	// wait for all connections
 	group.Wait()
-	// check for error, if error length is greater than 1
-	// set err to errs[0]
+
 	if len(errs) > 0 {
-		err = errs[0]
+		// close all connected resources as kothak is not returned to the caller
+		if err := kothak.CloseAll(); err != nil {
+			logger.Errorf("kothak: failed to close resources after initialization error: %v", err)
+		}
+		return nil, errs
 	}
+	return &kothak, nil
+}
 
-	return &kothak, err
+// newObjectStorage return object storage provider and key provider based on the configuration
+// the key provider is nil if the encryption is not enabled
+func newObjectStorage(ctx context.Context, config ObjectStorageConfig) (objectstorage.StorageProvider, objectstorage.KeyProvider, error) {
+	keyProvider, err := config.Encryption.keyProvider()
+	if err != nil {
+		return nil, nil, err
+	}
+	provider, err := newObjectStorageProvider(ctx, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return provider, keyProvider, nil
+}
+
+// newObjectStorageProvider return object storage provider based on the configuration
+func newObjectStorageProvider(ctx context.Context, config ObjectStorageConfig) (objectstorage.StorageProvider, error) {
+	switch strings.ToLower(config.Provider) {
+	// local storage
+	case objectstorage.StorageLocal:
+		// the bucket is relative to the current directory, unless it is an absolute path
+		bucket := config.Bucket
+		if !filepath.IsAbs(bucket) {
+			bucket = fmt.Sprintf("./%s", bucket)
+		}
+		// defaulted to not delete local bucket when close the program
+		return local.New(ctx, bucket, &local.Options{DeleteOnClose: false})
+
+	// gcs compatible storage
+	case objectstorage.StorageGCS:
+		gcsCreds, err := gcs.CredentialsFromFile(ctx, config.GCS.JSONKey)
+		if err != nil {
+			return nil, err
+		}
+
+		gcsConfig, err := gcs.NewConfig(ctx, gcsCreds)
+		if err != nil {
+			return nil, err
+		}
+		gcsConfig.
+			SetBucket(config.Bucket).
+			SetBucketProto(config.BucketProto).
+			SetBucketURL(config.BucketURL)
+
+		return gcs.New(ctx, gcsConfig)
+
+	// s3 compatible storage
+	case objectstorage.StorageS3, objectstorage.StorageDO, objectstorage.StorageMinio:
+		s3Creds, err := s3.CredentialsFromClient(ctx, config.S3.ClientID, config.S3.ClientSecret, "")
+		if err != nil {
+			return nil, err
+		}
+
+		s3Config, err := s3.NewConfig(ctx, s3Creds)
+		if err != nil {
+			return nil, err
+		}
+
+		s3Config.
+			SetBucket(config.Bucket).
+			SetBucketProto(config.BucketProto).
+			SetBucketURL(config.BucketURL).
+			SetRegion(config.Region).
+			SetEndpoint(config.Endpoint).
+			DisableSSL(config.S3.DisableSSL).
+			ForcePathStyle(config.S3.ForcePathStyle)
+
+		return s3.New(ctx, s3Config)
+
+	default:
+		return nil, errors.New("kothak: object storage provider not found")
+	}
+}
+
+// connectRedis connect to redis using the connection pool configuration from RedisConfig
+func connectRedis(ctx context.Context, defaultConfig RedisConfig, redisconfig RedisConnConfig) (redis.Redis, error) {
+	switch strings.ToLower(redisconfig.Driver) {
+	case "", RedisDriverRedigo:
+		if err := redisconfig.validate(); err != nil {
+			return nil, err
+		}
+
+		conf := redigo.Config{
+			MaxActive: defaultConfig.MaxActive,
+			MaxIdle:   defaultConfig.MaxIdle,
+			Timeout:   defaultConfig.Timeout,
+		}
+		switch {
+		case redisconfig.Sentinel.MasterName != "" || len(redisconfig.Sentinel.Addresses) > 0:
+			return redigo.NewSentinel(ctx, redigo.SentinelConfig{
+				MasterName: redisconfig.Sentinel.MasterName,
+				Addresses:  redisconfig.Sentinel.Addresses,
+			}, &conf)
+		case len(redisconfig.Cluster.Addresses) > 0:
+			return redigo.NewCluster(ctx, redigo.ClusterConfig{
+				Addresses: redisconfig.Cluster.Addresses,
+			}, &conf)
+		default:
+			return redigo.New(ctx, redisconfig.Address, &conf)
+		}
+
+	case RedisDriverMemory:
+		return memory.New(nil), nil
+
+	default:
+		return nil, fmt.Errorf("kothak: redis driver %s is not supported", redisconfig.Driver)
+	}
+}
+
+// connectSQLDB connect to leader and replicas and wrap them into one sqldb.DB
+// all connections are closed if connection to one of the replicas is failed
+func connectSQLDB(ctx context.Context, defaultConfig DBConfig, dbconfig SQLDBConfig, logger logger.Logger) (*sqldb.DB, error) {
+	var (
+		err         error
+		leaderDB    *sqlx.DB
+		followerDBs []*sqlx.DB
+	)
+
+	wrapOpts, err := dbconfig.Routing.WrapOptions()
+	if err != nil {
+		return nil, fmt.Errorf("routing: %w", err)
+	}
+	wrapOpts.Name = dbconfig.Name
+	wrapOpts.Logger = logger
+	if dbconfig.SlowQueryThreshold != "" {
+		wrapOpts.SlowQueryThreshold, err = time.ParseDuration(dbconfig.SlowQueryThreshold)
+		if err != nil {
+			return nil, fmt.Errorf("slow_query_threshold: %w", err)
+		}
+	}
+
+	// setup leader connection
+	if err := dbconfig.LeaderConnConfig.SetDefault(defaultConfig); err != nil {
+		return nil, err
+	}
+	// connect to leader
+	leaderDB, err = sqldb.Connect(ctx, dbconfig.Driver, dbconfig.LeaderConnConfig.DSN, &sqldb.ConnectOptions{
+		Retry:              dbconfig.LeaderConnConfig.MaxRetry,
+		MaxOpenConnections: dbconfig.LeaderConnConfig.MaxOpenConnections,
+		MaxIdleConnections: dbconfig.LeaderConnConfig.MaxIdleConnections,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	closeAll := func() {
+		leaderDB.Close()
+		for _, followerDB := range followerDBs {
+			followerDB.Close()
+		}
+	}
+
+	// connect to replicas, leader is used as follower when there is no replica
+	for _, replicaConfig := range dbconfig.replicas() {
+		if err := replicaConfig.SetDefault(defaultConfig); err != nil {
+			closeAll()
+			return nil, err
+		}
+		followerDB, err := sqldb.Connect(ctx, dbconfig.Driver, replicaConfig.DSN, &sqldb.ConnectOptions{
+			Retry:              replicaConfig.MaxRetry,
+			MaxOpenConnections: replicaConfig.MaxOpenConnections,
+			MaxIdleConnections: replicaConfig.MaxIdleConnections,
+		})
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		followerDBs = append(followerDBs, followerDB)
+	}
+
+	db, err := sqldb.WrapFollowers(ctx, leaderDB, followerDBs, wrapOpts)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	return db, nil
 }
 
 // CloseAll to close all connected resources
-// TODO: check error when closing connections and close connection concurrently
+// all resources are closed concurrently and all errors are returned as Errors
 func (k *Kothak) CloseAll() error {
-	for _, objStorage := range k.objStorages {
-		objStorage.Close()
-	}
+	var (
+		group sync.WaitGroup
+		errs  Errors
+		errMu sync.Mutex
+	)
 
-	for _, sqldb := range k.dbs {
-		sqldb.Close()
+	closeResource := func(name, kind string, closeFunc func() error) {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			if err := closeFunc(); err != nil {
+				errMu.Lock()
+				errs = append(errs, &ResourceError{Name: name, Kind: kind, Err: err})
+				errMu.Unlock()
+			}
+		}()
 	}
 
-	for _, redis := range k.rds {
-		redis.Close()
+	k.mutex.Lock()
+	for name, objStorage := range k.objStorages {
+		closeResource(name, KindObjectStorage, objStorage.storage.Close)
+	}
+	for name, sqldb := range k.dbs {
+		closeResource(name, KindSQLDB, sqldb.Close)
 	}
-	return nil
+	for name, redis := range k.rds {
+		closeResource(name, KindRedis, redis.Close)
+	}
+	k.mutex.Unlock()
+
+	group.Wait()
+	return errs.Err()
 }
 
 // GetSQLDB from kothak object
+// the database is swapped on reload, so the returned database always use the current connections.
 func (k *Kothak) GetSQLDB(dbname string) (*sqldb.DB, error) {
 	k.mutex.Lock()
 	defer k.mutex.Unlock()
@@ -318,6 +415,7 @@ func (k *Kothak) MustGetSQLDB(dbname string) *sqldb.DB {
 }
 
 // GetRedis from kothak object
+// the redis connection is swapped on reload, so the returned redis always use the current connection.
 func (k *Kothak) GetRedis(redisname string) (redis.Redis, error) {
 	k.mutex.Lock()
 	defer k.mutex.Unlock()
@@ -340,6 +438,7 @@ func (k *Kothak) MustGetRedis(redisname string) redis.Redis {
 }
 
 // GetObjectStorage from kothak object
+// the object storage provider is swapped on reload, so the returned object storage always use the current provider.
 func (k *Kothak) GetObjectStorage(objStorageName string) (*objectstorage.Storage, error) {
 	k.mutex.Lock()
 	defer k.mutex.Unlock()
@@ -348,7 +447,7 @@ func (k *Kothak) GetObjectStorage(objStorageName string) (*objectstorage.Storage
 		err := fmt.Errorf("kothak: object storage with name %s does not exists", objStorageName)
 		return nil, err
 	}
-	return i, nil
+	return i.storage, nil
 }
 
 // MustGetObjectStorage from kothak object
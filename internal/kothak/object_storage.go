@@ -1,5 +1,18 @@
 package kothak
 
+import (
+	"fmt"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage"
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage/localkey"
+)
+
+// list of object storage key provider
+const (
+	// KeyProviderLocal use master key from local file, only use this for local development
+	KeyProviderLocal = "local"
+)
+
 // ObjectStorageConfig struct
 type ObjectStorageConfig struct {
 	Name        string    `json:"name" yaml:"name" toml:"name"`
@@ -11,6 +24,27 @@ type ObjectStorageConfig struct {
 	BucketURL   string    `json:"bucket_url" yaml:"bucket_url" toml:"bucket_url"`
 	S3          S3Config  `json:"s3" yaml:"s3" toml:"s3"`
 	GCS         GCSConfig `json:"gcs" yaml:"gcs" toml:"gcs"`
+	// Encryption of uploaded object, the object is not encrypted if the key provider is empty
+	Encryption EncryptionConfig `json:"encryption" yaml:"encryption" toml:"encryption"`
+}
+
+// EncryptionConfig for object storage encryption
+type EncryptionConfig struct {
+	KeyProvider string `json:"key_provider" yaml:"key_provider" toml:"key_provider"`
+	// KeyFile is the master key file for local key provider
+	KeyFile string `json:"key_file" yaml:"key_file" toml:"key_file"`
+}
+
+// keyProvider return nil if encryption is not enabled
+func (c EncryptionConfig) keyProvider() (objectstorage.KeyProvider, error) {
+	switch c.KeyProvider {
+	case "":
+		return nil, nil
+	case KeyProviderLocal:
+		return localkey.New(c.KeyFile)
+	default:
+		return nil, fmt.Errorf("kothak: encryption key provider %s is not supported", c.KeyProvider)
+	}
 }
 
 // S3Config for s3 storage
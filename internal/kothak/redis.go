@@ -1,9 +1,20 @@
 package kothak
 
+import "fmt"
+
 // Redis interface for infra
 type Redis interface {
 }
 
+// list of redis driver
+const (
+	// RedisDriverRedigo connect to redis server using redigo, this is the default driver
+	RedisDriverRedigo = "redigo"
+	// RedisDriverMemory use in-memory redis, the data is lost when the program stopped
+	// only use this for test and local development
+	RedisDriverMemory = "memory"
+)
+
 // RedisConfig of kothak
 type RedisConfig struct {
 	MaxIdle   int               `json:"max_idle_conn" yaml:"max_idle_conn" toml:"max_idle_conn"`
@@ -15,8 +26,43 @@ type RedisConfig struct {
 // RedisConnConfig struct
 type RedisConnConfig struct {
 	Name      string `json:"name" yaml:"name" toml:"name"`
+	Driver    string `json:"driver" yaml:"driver" toml:"driver"`
 	Address   string `json:"address" yaml:"address" toml:"address"`
 	MaxIdle   int    `json:"max_idle_conn" yaml:"max_idle_conn" toml:"max_idle_conn"`
 	MaxActive int    `json:"max_active_conn" yaml:"max_active_conn" toml:"max_active_conn"`
 	Timeout   int    `json:"timeout" yaml:"timeout" toml:"timeout"`
+	// Sentinel is used to connect to the master monitored by sentinel instead of Address
+	Sentinel RedisSentinelConfig `json:"sentinel" yaml:"sentinel" toml:"sentinel"`
+	// Cluster is used to connect to redis cluster instead of Address
+	Cluster RedisClusterConfig `json:"cluster" yaml:"cluster" toml:"cluster"`
+}
+
+// RedisSentinelConfig struct
+type RedisSentinelConfig struct {
+	MasterName string   `json:"master_name" yaml:"master_name" toml:"master_name"`
+	Addresses  []string `json:"addresses" yaml:"addresses" toml:"addresses"`
+}
+
+// RedisClusterConfig struct
+type RedisClusterConfig struct {
+	// Addresses of the seed nodes
+	Addresses []string `json:"addresses" yaml:"addresses" toml:"addresses"`
+}
+
+// validate only one of address, sentinel or cluster is used
+func (c RedisConnConfig) validate() error {
+	modes := 0
+	if c.Address != "" {
+		modes++
+	}
+	if c.Sentinel.MasterName != "" || len(c.Sentinel.Addresses) > 0 {
+		modes++
+	}
+	if len(c.Cluster.Addresses) > 0 {
+		modes++
+	}
+	if modes > 1 {
+		return fmt.Errorf("kothak: redis %s: only one of address, sentinel or cluster can be used", c.Name)
+	}
+	return nil
 }
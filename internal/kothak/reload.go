@@ -0,0 +1,361 @@
+package kothak
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	"github.com/albertwidi/go-project-example/internal/pkg/sqldb"
+	"go.opencensus.io/trace"
+)
+
+// DefaultDrainGracePeriod is the time to wait before closing the replaced resources
+const DefaultDrainGracePeriod = time.Second * 30
+
+// ReloadResult is the summary of reload, contains resources name for each kind
+type ReloadResult struct {
+	Added     map[string][]string `json:"added"`
+	Changed   map[string][]string `json:"changed"`
+	Removed   map[string][]string `json:"removed"`
+	Unchanged map[string][]string `json:"unchanged"`
+}
+
+func newReloadResult() *ReloadResult {
+	return &ReloadResult{
+		Added:     make(map[string][]string),
+		Changed:   make(map[string][]string),
+		Removed:   make(map[string][]string),
+		Unchanged: make(map[string][]string),
+	}
+}
+
+// the status of resource configuration when compared to the current configuration
+const (
+	diffAdded = iota + 1
+	diffChanged
+	diffUnchanged
+)
+
+func (rr *ReloadResult) add(status int, kind, name string) {
+	switch status {
+	case diffAdded:
+		rr.Added[kind] = append(rr.Added[kind], name)
+	case diffChanged:
+		rr.Changed[kind] = append(rr.Changed[kind], name)
+	case diffUnchanged:
+		rr.Unchanged[kind] = append(rr.Unchanged[kind], name)
+	}
+}
+
+// Reload the resources with a new configuration
+//
+// The new configuration is compared to the current configuration by the resource Name.
+// New and changed resources are connected first, and if one of them failed, nothing is changed and all new connections are closed.
+// When all connections succeed, the resources are swapped at once, so GetSQLDB, GetRedis and GetObjectStorage return the new resources.
+//
+// The sql database, redis and object storage retrieved before the reload are handles to the current connections,
+// so they use the new connections after the reload without getting them from kothak again.
+// The old connections are closed after gracePeriod, to give time for in-flight requests to finish.
+// Encryption of object storage and the sql database driver cannot be changed by reload.
+func (k *Kothak) Reload(ctx context.Context, newConfig Config, gracePeriod time.Duration) (*ReloadResult, error) {
+	ctx, span := trace.StartSpan(ctx, "kothak/reload")
+	defer span.End()
+
+	k.reloadMu.Lock()
+	defer k.reloadMu.Unlock()
+
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultDrainGracePeriod
+	}
+	if err := newConfig.DBConfig.SetDefault(); err != nil {
+		return nil, err
+	}
+
+	var (
+		result  = newReloadResult()
+		current = k.config
+
+		group sync.WaitGroup
+		errs  Errors
+		mu    sync.Mutex
+
+		objStorages = make(map[string]newObjectStorageConn)
+		dbs         = make(map[string]*sqldb.DB)
+		rds         = make(map[string]redis.Redis)
+	)
+
+	addError := func(name, kind string, err error) {
+		mu.Lock()
+		errs = append(errs, &ResourceError{Name: name, Kind: kind, Err: err})
+		mu.Unlock()
+	}
+
+	// object storage
+	currentObjStorages := make(map[string]ObjectStorageConfig)
+	for _, c := range current.ObjectStorageConfig {
+		currentObjStorages[c.Name] = c
+	}
+	for _, c := range newConfig.ObjectStorageConfig {
+		old, ok := currentObjStorages[c.Name]
+		status := compareConfig(ok, old, c)
+		result.add(status, KindObjectStorage, c.Name)
+		if status == diffUnchanged {
+			continue
+		}
+
+		if ok && (old.Encryption.KeyProvider == "") != (c.Encryption.KeyProvider == "") {
+			addError(c.Name, KindObjectStorage, errors.New("kothak: encryption cannot be enabled or disabled by reload"))
+			continue
+		}
+
+		group.Add(1)
+		go func(config ObjectStorageConfig) {
+			defer group.Done()
+			provider, keyProvider, err := newObjectStorage(ctx, config)
+			if err != nil {
+				addError(config.Name, KindObjectStorage, err)
+				return
+			}
+			mu.Lock()
+			objStorages[config.Name] = newObjectStorageConn{provider: provider, keyProvider: keyProvider}
+			mu.Unlock()
+		}(c)
+	}
+
+	// redis, the pool configuration is shared for all redis connections
+	// so all redis connections is changed when the pool configuration is changed
+	currentRds := make(map[string]RedisConnConfig)
+	for _, c := range current.RedisConfig.Rds {
+		currentRds[c.Name] = c
+	}
+	for _, c := range newConfig.RedisConfig.Rds {
+		old, ok := currentRds[c.Name]
+		status := compareConfig(ok, redisEffectiveConfig(current.RedisConfig, old), redisEffectiveConfig(newConfig.RedisConfig, c))
+		result.add(status, KindRedis, c.Name)
+		if status == diffUnchanged {
+			continue
+		}
+
+		group.Add(1)
+		go func(config RedisConnConfig) {
+			defer group.Done()
+			r, err := connectRedis(ctx, newConfig.RedisConfig, config)
+			if err != nil {
+				addError(config.Name, KindRedis, err)
+				return
+			}
+			mu.Lock()
+			rds[config.Name] = r
+			mu.Unlock()
+		}(c)
+	}
+
+	// sql database, the default configuration is applied first before comparing the configuration
+	currentDBs := make(map[string]SQLDBConfig)
+	for _, c := range current.DBConfig.SQLDBs {
+		currentDBs[c.Name] = c
+	}
+	for _, c := range newConfig.DBConfig.SQLDBs {
+		old, ok := currentDBs[c.Name]
+		oldEffective, err := sqldbEffectiveConfig(current.DBConfig, old)
+		if err != nil {
+			addError(c.Name, KindSQLDB, err)
+			continue
+		}
+		newEffective, err := sqldbEffectiveConfig(newConfig.DBConfig, c)
+		if err != nil {
+			addError(c.Name, KindSQLDB, err)
+			continue
+		}
+		status := compareConfig(ok, oldEffective, newEffective)
+		result.add(status, KindSQLDB, c.Name)
+		if status == diffUnchanged {
+			continue
+		}
+
+		if ok && oldEffective.Driver != newEffective.Driver {
+			addError(c.Name, KindSQLDB, errors.New("kothak: sql database driver cannot be changed by reload"))
+			continue
+		}
+
+		group.Add(1)
+		go func(config SQLDBConfig) {
+			defer group.Done()
+			db, err := connectSQLDB(ctx, newConfig.DBConfig, config, k.logger)
+			if err != nil {
+				addError(config.Name, KindSQLDB, err)
+				return
+			}
+			mu.Lock()
+			dbs[config.Name] = db
+			mu.Unlock()
+		}(c)
+	}
+
+	group.Wait()
+
+	if len(errs) > 0 {
+		// close all new connections as the reload is cancelled
+		for _, obj := range objStorages {
+			obj.provider.Close()
+		}
+		for _, r := range rds {
+			r.Close()
+		}
+		for _, db := range dbs {
+			db.Close()
+		}
+		return nil, errs
+	}
+
+	// collect removed resources
+	newObjStorageNames := make(map[string]bool)
+	for _, c := range newConfig.ObjectStorageConfig {
+		newObjStorageNames[c.Name] = true
+	}
+	newRedisNames := make(map[string]bool)
+	for _, c := range newConfig.RedisConfig.Rds {
+		newRedisNames[c.Name] = true
+	}
+	newDBNames := make(map[string]bool)
+	for _, c := range newConfig.DBConfig.SQLDBs {
+		newDBNames[c.Name] = true
+	}
+
+	// swap all resources at once
+	drained := &Kothak{
+		objStorages: make(map[string]*objectStorage),
+		dbs:         make(map[string]*sqldb.DB),
+		rds:         make(map[string]*redisHandle),
+	}
+
+	k.mutex.Lock()
+	for name, obj := range k.objStorages {
+		if conn, ok := objStorages[name]; ok {
+			oldProvider := obj.handle.swap(conn.provider, conn.keyProvider)
+			drained.objStorages[name] = newObjectStorageHandle(oldProvider, nil)
+			delete(objStorages, name)
+			continue
+		}
+		if !newObjStorageNames[name] {
+			drained.objStorages[name] = obj
+			delete(k.objStorages, name)
+			result.Removed[KindObjectStorage] = append(result.Removed[KindObjectStorage], name)
+		}
+	}
+	for name, conn := range objStorages {
+		k.objStorages[name] = newObjectStorageHandle(conn.provider, conn.keyProvider)
+	}
+
+	for name, h := range k.rds {
+		if r, ok := rds[name]; ok {
+			drained.rds[name] = newRedisHandle(h.swap(r))
+			delete(rds, name)
+			continue
+		}
+		if !newRedisNames[name] {
+			drained.rds[name] = h
+			delete(k.rds, name)
+			result.Removed[KindRedis] = append(result.Removed[KindRedis], name)
+		}
+	}
+	for name, r := range rds {
+		k.rds[name] = newRedisHandle(r)
+	}
+
+	for name, db := range k.dbs {
+		if conn, ok := dbs[name]; ok {
+			// the driver is checked before connecting, so swap never fails here
+			old, err := db.Swap(conn)
+			if err != nil {
+				k.logger.Errorf("kothak: failed to swap sql database %s: %v", name, err)
+				drained.dbs[name] = conn
+			} else {
+				drained.dbs[name] = old
+			}
+			delete(dbs, name)
+			continue
+		}
+		if !newDBNames[name] {
+			drained.dbs[name] = db
+			delete(k.dbs, name)
+			result.Removed[KindSQLDB] = append(result.Removed[KindSQLDB], name)
+		}
+	}
+	for name, db := range dbs {
+		k.dbs[name] = db
+	}
+	k.config = newConfig
+	k.mutex.Unlock()
+
+	// drain the old resources after grace period
+	time.AfterFunc(gracePeriod, func() {
+		if err := drained.CloseAll(); err != nil {
+			k.logger.Errorf("kothak: failed to close drained resources: %v", err)
+			return
+		}
+		k.logger.Debugf("kothak: drained resources closed")
+	})
+
+	return result, nil
+}
+
+// newObjectStorageConn is the new connection of object storage on reload
+type newObjectStorageConn struct {
+	provider    objectstorage.StorageProvider
+	keyProvider objectstorage.KeyProvider
+}
+
+// compareConfig return the status of the new configuration compared to the current configuration
+func compareConfig(exists bool, current, next interface{}) int {
+	if !exists {
+		return diffAdded
+	}
+	if !reflect.DeepEqual(current, next) {
+		return diffChanged
+	}
+	return diffUnchanged
+}
+
+// redisEffective is the redis configuration used when connecting to redis
+type redisEffective struct {
+	Conn      RedisConnConfig
+	MaxIdle   int
+	MaxActive int
+	Timeout   int
+}
+
+func redisEffectiveConfig(defaultConfig RedisConfig, conn RedisConnConfig) redisEffective {
+	return redisEffective{
+		Conn:      conn,
+		MaxIdle:   defaultConfig.MaxIdle,
+		MaxActive: defaultConfig.MaxActive,
+		Timeout:   defaultConfig.Timeout,
+	}
+}
+
+// sqldbEffectiveConfig return the sql database configuration after default configuration is applied
+func sqldbEffectiveConfig(defaultConfig DBConfig, config SQLDBConfig) (SQLDBConfig, error) {
+	if err := config.LeaderConnConfig.SetDefault(defaultConfig); err != nil {
+		return config, fmt.Errorf("leader: %w", err)
+	}
+	if config.ReplicaConnConfig.DSN != "" {
+		if err := config.ReplicaConnConfig.SetDefault(defaultConfig); err != nil {
+			return config, fmt.Errorf("replica: %w", err)
+		}
+	}
+	replicas := make([]SQLDBConnectionConfig, len(config.ReplicasConnConfig))
+	for i, replicaConfig := range config.ReplicasConnConfig {
+		if err := replicaConfig.SetDefault(defaultConfig); err != nil {
+			return config, fmt.Errorf("replicas: %w", err)
+		}
+		replicas[i] = replicaConfig
+	}
+	config.ReplicasConnConfig = replicas
+	return config, nil
+}
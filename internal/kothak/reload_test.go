@@ -0,0 +1,214 @@
+package kothak
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/log/logger/zap"
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage"
+	"github.com/albertwidi/go-project-example/internal/pkg/sqldb"
+	"github.com/albertwidi/go-project-example/internal/pkg/sqldb/fakesql"
+)
+
+func TestReload(t *testing.T) {
+	t.Parallel()
+
+	var buckets []string
+	for i := 0; i < 2; i++ {
+		dir, err := ioutil.TempDir("", "testreload")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer os.RemoveAll(dir)
+		buckets = append(buckets, dir)
+	}
+
+	logger, err := zap.New(nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	k, err := New(context.Background(), Config{
+		ObjectStorageConfig: []ObjectStorageConfig{
+			{Name: "image", Provider: objectstorage.StorageLocal, Bucket: buckets[0]},
+			{Name: "document", Provider: objectstorage.StorageLocal, Bucket: buckets[0]},
+		},
+	}, logger)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer k.CloseAll()
+
+	oldImage := k.MustGetObjectStorage("image")
+	oldDocument := k.MustGetObjectStorage("document")
+
+	result, err := k.Reload(context.Background(), Config{
+		ObjectStorageConfig: []ObjectStorageConfig{
+			{Name: "image", Provider: objectstorage.StorageLocal, Bucket: buckets[1]},
+			{Name: "document", Provider: objectstorage.StorageLocal, Bucket: buckets[0]},
+			{Name: "video", Provider: objectstorage.StorageLocal, Bucket: buckets[1]},
+		},
+	}, time.Millisecond)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(result.Changed[KindObjectStorage]) != 1 || result.Changed[KindObjectStorage][0] != "image" {
+		t.Errorf("expecting image to be changed but got %v", result.Changed)
+		return
+	}
+	if len(result.Added[KindObjectStorage]) != 1 || result.Added[KindObjectStorage][0] != "video" {
+		t.Errorf("expecting video to be added but got %v", result.Added)
+		return
+	}
+	if k.MustGetObjectStorage("image") != oldImage {
+		t.Error("expecting image object storage to be the same handle")
+		return
+	}
+	if k.MustGetObjectStorage("document") != oldDocument {
+		t.Error("expecting document object storage to be the same")
+		return
+	}
+
+	// wait until the old connection is closed, the object storage retrieved before reload should use the new bucket
+	time.Sleep(time.Millisecond * 50)
+	if _, err := oldImage.UploadByte(context.Background(), []byte("reloaded"), "reload.txt", nil); err != nil {
+		t.Errorf("expecting old handle to be usable after reload but got %v", err)
+		return
+	}
+	if _, err := os.Stat(filepath.Join(buckets[1], "reload.txt")); err != nil {
+		t.Errorf("expecting object to be uploaded to the new bucket but got %v", err)
+		return
+	}
+
+	// reload with invalid configuration should not change anything
+	_, err = k.Reload(context.Background(), Config{
+		ObjectStorageConfig: []ObjectStorageConfig{
+			{Name: "image", Provider: "invalid", Bucket: buckets[0]},
+		},
+	}, time.Millisecond)
+	if err == nil {
+		t.Error("expecting error when reloading invalid provider")
+		return
+	}
+	if _, err := k.GetObjectStorage("video"); err != nil {
+		t.Errorf("expecting video to be exists after failed reload but got %v", err)
+		return
+	}
+}
+
+func TestReloadRedis(t *testing.T) {
+	t.Parallel()
+
+	logger, err := zap.New(nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	k, err := New(context.Background(), Config{
+		RedisConfig: RedisConfig{
+			Rds: []RedisConnConfig{{Name: "image", Driver: RedisDriverMemory}},
+		},
+	}, logger)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer k.CloseAll()
+
+	oldImage := k.MustGetRedis("image")
+	if _, err := oldImage.Set(context.Background(), "key", "old"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// change the pool configuration, so the redis connection is replaced
+	result, err := k.Reload(context.Background(), Config{
+		RedisConfig: RedisConfig{
+			MaxIdle: 10,
+			Rds:     []RedisConnConfig{{Name: "image", Driver: RedisDriverMemory}},
+		},
+	}, time.Millisecond)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(result.Changed[KindRedis]) != 1 {
+		t.Errorf("expecting image redis to be changed but got %v", result.Changed)
+		return
+	}
+
+	// wait until the old connection is closed
+	time.Sleep(time.Millisecond * 50)
+	if _, err := oldImage.Set(context.Background(), "key", "new"); err != nil {
+		t.Errorf("expecting old handle to be usable after reload but got %v", err)
+		return
+	}
+	value, err := k.MustGetRedis("image").Get(context.Background(), "key")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if value != "new" {
+		t.Errorf("expecting value new from the reloaded redis but got %s", value)
+		return
+	}
+}
+
+func TestReloadSQLDBDriver(t *testing.T) {
+	t.Parallel()
+
+	logger, err := zap.New(nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	k, err := New(context.Background(), Config{}, logger)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer k.CloseAll()
+
+	fake := fakesql.New()
+	db, err := sqldb.Wrap(context.Background(), fake.Open("postgres"), fake.Open("postgres"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	k.setSQLDB("book", db)
+	k.config.DBConfig.SQLDBs = []SQLDBConfig{
+		{Name: "book", Driver: "postgres", LeaderConnConfig: SQLDBConnectionConfig{DSN: "postgres://leader"}},
+	}
+
+	// the driver is checked before connecting, so the database is not changed
+	_, err = k.Reload(context.Background(), Config{
+		DBConfig: DBConfig{
+			SQLDBs: []SQLDBConfig{
+				{Name: "book", Driver: "mysql", LeaderConnConfig: SQLDBConnectionConfig{DSN: "mysql://leader"}},
+			},
+		},
+	}, time.Millisecond)
+	if err == nil {
+		t.Error("expecting error when changing the sql database driver")
+		return
+	}
+	if k.MustGetSQLDB("book") != db {
+		t.Error("expecting sql database to be the same after failed reload")
+		return
+	}
+	if k.MustGetSQLDB("book").Leader() != db.Leader() {
+		t.Error("expecting sql database connections to be unchanged after failed reload")
+		return
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/albertwidi/go-project-example/internal/pkg/defaults"
+	"github.com/albertwidi/go-project-example/internal/pkg/sqldb"
 )
 
 // DBConfig define sql databases configuration
@@ -38,6 +39,53 @@ type SQLDBConfig struct {
 	Driver            string                `yaml:"driver" toml:"driver"`
 	LeaderConnConfig  SQLDBConnectionConfig `yaml:"leader" toml:"leader"`
 	ReplicaConnConfig SQLDBConnectionConfig `yaml:"replica" toml:"replica"`
+	// ReplicasConnConfig is used when there are more than one replica
+	ReplicasConnConfig []SQLDBConnectionConfig `yaml:"replicas" toml:"replicas"`
+	Routing            SQLDBRoutingConfig      `yaml:"routing" toml:"routing"`
+	// SlowQueryThreshold is the minimum duration of a query to be logged as slow query
+	SlowQueryThreshold string `yaml:"slow_query_threshold" toml:"slow_query_threshold"`
+}
+
+// replicas return all replica configurations
+func (sqldbConfig SQLDBConfig) replicas() []SQLDBConnectionConfig {
+	var replicas []SQLDBConnectionConfig
+	if sqldbConfig.ReplicaConnConfig.DSN != "" {
+		replicas = append(replicas, sqldbConfig.ReplicaConnConfig)
+	}
+	return append(replicas, sqldbConfig.ReplicasConnConfig...)
+}
+
+// SQLDBRoutingConfig to configure how query is routed to replicas
+type SQLDBRoutingConfig struct {
+	// Balancer is round_robin or least_conn
+	Balancer          string `json:"balancer" yaml:"balancer" toml:"balancer"`
+	MaxReplicationLag string `json:"max_replication_lag" yaml:"max_replication_lag" toml:"max_replication_lag"`
+	LagCheckInterval  string `json:"lag_check_interval" yaml:"lag_check_interval" toml:"lag_check_interval"`
+	DisableFallback   bool   `json:"disable_fallback" yaml:"disable_fallback" toml:"disable_fallback"`
+}
+
+// WrapOptions return sqldb wrap options from routing configuration
+func (routingConfig SQLDBRoutingConfig) WrapOptions() (*sqldb.WrapOptions, error) {
+	opts := sqldb.WrapOptions{
+		Balancer:        routingConfig.Balancer,
+		DisableFallback: routingConfig.DisableFallback,
+	}
+
+	if routingConfig.MaxReplicationLag != "" {
+		dur, err := time.ParseDuration(routingConfig.MaxReplicationLag)
+		if err != nil {
+			return nil, err
+		}
+		opts.MaxReplicationLag = dur
+	}
+	if routingConfig.LagCheckInterval != "" {
+		dur, err := time.ParseDuration(routingConfig.LagCheckInterval)
+		if err != nil {
+			return nil, err
+		}
+		opts.LagCheckInterval = dur
+	}
+	return &opts, nil
 }
 
 // SQLDBConnectionConfig struct
@@ -0,0 +1,333 @@
+// Package cache is a read-through cache on top of redis.Redis with optional in-process lru tier
+// concurrent loads of the same key are coalesced, so only one loader is called when the key is missing
+//
+// the value is encoded to json, so the value must be json serializable
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// list of cache errors
+var (
+	// ErrNotFound should be returned by loader when the value does not exist, the result is cached as negative result
+	ErrNotFound  = errors.New("cache: not found")
+	ErrEmptyName = errors.New("cache: name is empty")
+)
+
+// list of default options
+const (
+	DefaultTTL         = time.Minute * 5
+	DefaultNegativeTTL = time.Second * 30
+	DefaultLocalTTL    = time.Minute
+)
+
+// list of cache tier
+const (
+	TierLocal = "local"
+	TierRedis = "redis"
+)
+
+// list of cached value type, the first byte of cached value
+const (
+	markValue    byte = 'v'
+	markNotFound byte = 'n'
+)
+
+var (
+	// prometheus metrics
+	_cacheRequestCounter *prometheus.CounterVec
+)
+
+// throwing fatal if prometheus metrics cannot be registered
+func init() {
+	_cacheRequestCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_request_total",
+		Help: "number of cache request for each cache name, tier and result (hit, miss or error)",
+	}, []string{"name", "tier", "result"})
+	if err := prometheus.Register(_cacheRequestCounter); err != nil {
+		if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			err = fmt.Errorf("error when registering cacheRequestCounter. err: %w", err)
+			log.Fatal(err)
+		}
+	}
+}
+
+// LoaderFunc load the value when the key is not in cache
+type LoaderFunc func(ctx context.Context) (interface{}, error)
+
+// Invalidator invalidate cached keys, repositories call it after writes
+type Invalidator interface {
+	Invalidate(ctx context.Context, keys ...string) error
+}
+
+// Options of cache
+type Options struct {
+	// TTL of the value in redis
+	TTL time.Duration
+	// NegativeTTL of not found result, negative caching is disabled if less than zero
+	NegativeTTL time.Duration
+	// LocalSize is the maximum number of keys in lru, lru is disabled if zero
+	LocalSize int
+	// LocalTTL of the value in lru, capped by TTL
+	LocalTTL time.Duration
+}
+
+// Cache is a read-through cache
+// nil cache is valid and always call the loader, so cache can be optional for repositories
+type Cache struct {
+	name  string
+	redis redis.Redis
+	local *lru
+	group group
+	opts  Options
+
+	// subscription to invalidate lru when the key is invalidated by other process
+	sub redis.Subscription
+}
+
+// New cache, redis can be nil to only use lru
+func New(ctx context.Context, name string, r redis.Redis, opts *Options) (*Cache, error) {
+	if name == "" {
+		return nil, ErrEmptyName
+	}
+
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.TTL <= 0 {
+		o.TTL = DefaultTTL
+	}
+	if o.NegativeTTL == 0 {
+		o.NegativeTTL = DefaultNegativeTTL
+	}
+	if o.LocalTTL <= 0 {
+		o.LocalTTL = DefaultLocalTTL
+	}
+	if o.LocalTTL > o.TTL {
+		o.LocalTTL = o.TTL
+	}
+
+	c := Cache{
+		name:  name,
+		redis: r,
+		opts:  o,
+	}
+	if o.LocalSize > 0 {
+		c.local = newLRU(o.LocalSize)
+	}
+
+	// other process might cache the key in their lru, so the invalidation is broadcasted
+	if c.local != nil && c.redis != nil {
+		sub, err := c.redis.Subscribe(ctx, c.invalidationChannel())
+		if err != nil {
+			return nil, fmt.Errorf("cache: failed to subscribe invalidation channel: %w", err)
+		}
+		c.sub = sub
+		go func() {
+			for msg := range sub.Messages() {
+				c.local.remove(string(msg.Payload))
+			}
+		}()
+	}
+	return &c, nil
+}
+
+func (c *Cache) redisKey(key string) string {
+	return "cache:" + c.name + ":" + key
+}
+
+func (c *Cache) invalidationChannel() string {
+	return "cache:invalidate:" + c.name
+}
+
+func (c *Cache) record(tier, result string) {
+	_cacheRequestCounter.WithLabelValues(c.name, tier, result).Inc()
+}
+
+// Get the value of key into out, the loader is called when the key is not in cache
+// out must be a pointer, ErrNotFound is returned when the loader returns ErrNotFound
+func (c *Cache) Get(ctx context.Context, key string, out interface{}, loader LoaderFunc) error {
+	if c == nil {
+		v, err := loader(ctx)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, out)
+	}
+
+	if c.local != nil {
+		if data, ok := c.local.get(key); ok {
+			c.record(TierLocal, "hit")
+			return decode(data, out)
+		}
+		c.record(TierLocal, "miss")
+	}
+
+	if c.redis != nil {
+		value, err := c.redis.Get(ctx, c.redisKey(key))
+		switch {
+		case err == nil:
+			c.record(TierRedis, "hit")
+			data := []byte(value)
+			c.setLocal(key, data)
+			return decode(data, out)
+		case c.redis.IsErrNil(err):
+			c.record(TierRedis, "miss")
+		default:
+			// redis is not available, load the value directly
+			c.record(TierRedis, "error")
+		}
+	}
+
+	data, err := c.group.do(key, func() ([]byte, error) {
+		return c.load(ctx, key, loader)
+	})
+	if err != nil {
+		return err
+	}
+	return decode(data, out)
+}
+
+// load the value using loader and store it in cache
+func (c *Cache) load(ctx context.Context, key string, loader LoaderFunc) ([]byte, error) {
+	v, err := loader(ctx)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) || c.opts.NegativeTTL < 0 {
+			return nil, err
+		}
+		data := []byte{markNotFound}
+		c.store(ctx, key, data, c.opts.NegativeTTL)
+		return data, nil
+	}
+
+	data, err := encode(v)
+	if err != nil {
+		return nil, err
+	}
+	c.store(ctx, key, data, c.opts.TTL)
+	return data, nil
+}
+
+// store the data in all tier, failing to store in redis is not an error as the value is already loaded
+func (c *Cache) store(ctx context.Context, key string, data []byte, ttl time.Duration) {
+	c.setLocal(key, data)
+	if c.redis == nil {
+		return
+	}
+	if _, err := c.redis.SetEX(ctx, c.redisKey(key), data, seconds(ttl)); err != nil {
+		c.record(TierRedis, "error")
+	}
+}
+
+func (c *Cache) setLocal(key string, data []byte) {
+	if c.local == nil {
+		return
+	}
+	ttl := c.opts.LocalTTL
+	if data[0] == markNotFound && c.opts.NegativeTTL < ttl {
+		ttl = c.opts.NegativeTTL
+	}
+	c.local.set(key, data, ttl)
+}
+
+// Set the value of key in cache
+func (c *Cache) Set(ctx context.Context, key string, value interface{}) error {
+	if c == nil {
+		return nil
+	}
+
+	data, err := encode(value)
+	if err != nil {
+		return err
+	}
+	if c.redis != nil {
+		if _, err := c.redis.SetEX(ctx, c.redisKey(key), data, seconds(c.opts.TTL)); err != nil {
+			return err
+		}
+	}
+	// invalidate other process lru, as the value is changed
+	if err := c.broadcast(ctx, key); err != nil {
+		return err
+	}
+	c.setLocal(key, data)
+	return nil
+}
+
+// Invalidate remove keys from cache, call it after the value is changed in the storage
+func (c *Cache) Invalidate(ctx context.Context, keys ...string) error {
+	if c == nil {
+		return nil
+	}
+
+	for _, key := range keys {
+		if c.local != nil {
+			c.local.remove(key)
+		}
+		if c.redis != nil {
+			if _, err := c.redis.Delete(ctx, c.redisKey(key)); err != nil {
+				return err
+			}
+		}
+		if err := c.broadcast(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// broadcast the invalidation to other process
+func (c *Cache) broadcast(ctx context.Context, key string) error {
+	if c.sub == nil {
+		return nil
+	}
+	_, err := c.redis.Publish(ctx, c.invalidationChannel(), key)
+	return err
+}
+
+// Close the cache
+func (c *Cache) Close() error {
+	if c == nil || c.sub == nil {
+		return nil
+	}
+	return c.sub.Close()
+}
+
+func encode(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{markValue}, data...), nil
+}
+
+func decode(data []byte, out interface{}) error {
+	if len(data) == 0 {
+		return errors.New("cache: invalid cached value")
+	}
+	switch data[0] {
+	case markNotFound:
+		return ErrNotFound
+	case markValue:
+		return json.Unmarshal(data[1:], out)
+	}
+	return errors.New("cache: invalid cached value")
+}
+
+// seconds return ttl in seconds, rounded up
+func seconds(ttl time.Duration) int {
+	return int((ttl + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis/memory"
+)
+
+type value struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestGet(t *testing.T) {
+	t.Parallel()
+
+	m := memory.New(nil)
+	cases := []struct {
+		name string
+		opts *Options
+	}{
+		{name: "redis", opts: nil},
+		{name: "redis_and_local", opts: &Options{LocalSize: 10}},
+	}
+
+	for _, cs := range cases {
+		c, err := New(context.Background(), cs.name, m, cs.opts)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		var loaded int32
+		loader := func(ctx context.Context) (interface{}, error) {
+			atomic.AddInt32(&loaded, 1)
+			return value{ID: "1", Name: "one"}, nil
+		}
+
+		for i := 0; i < 3; i++ {
+			v := value{}
+			if err := c.Get(context.Background(), "1", &v, loader); err != nil {
+				t.Error(err)
+				return
+			}
+			if v.Name != "one" {
+				t.Errorf("%s: expecting name one but got %s", cs.name, v.Name)
+				return
+			}
+		}
+		if loaded != 1 {
+			t.Errorf("%s: expecting loader to be called once but got %d", cs.name, loaded)
+			return
+		}
+
+		// the value is loaded again after invalidated
+		if err := c.Invalidate(context.Background(), "1"); err != nil {
+			t.Error(err)
+			return
+		}
+		v := value{}
+		if err := c.Get(context.Background(), "1", &v, loader); err != nil {
+			t.Error(err)
+			return
+		}
+		if loaded != 2 {
+			t.Errorf("%s: expecting loader to be called twice but got %d", cs.name, loaded)
+			return
+		}
+		c.Close()
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	t.Parallel()
+
+	c, err := New(context.Background(), "negative", memory.New(nil), &Options{LocalSize: 10})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer c.Close()
+
+	var loaded int32
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&loaded, 1)
+		return nil, ErrNotFound
+	}
+
+	for i := 0; i < 2; i++ {
+		v := value{}
+		if err := c.Get(context.Background(), "1", &v, loader); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expecting error %v but got %v", ErrNotFound, err)
+			return
+		}
+	}
+	if loaded != 1 {
+		t.Errorf("expecting loader to be called once but got %d", loaded)
+		return
+	}
+
+	// other error is not cached
+	loadErr := errors.New("load error")
+	for i := 0; i < 2; i++ {
+		v := value{}
+		err := c.Get(context.Background(), "2", &v, func(ctx context.Context) (interface{}, error) {
+			atomic.AddInt32(&loaded, 1)
+			return nil, loadErr
+		})
+		if !errors.Is(err, loadErr) {
+			t.Errorf("expecting error %v but got %v", loadErr, err)
+			return
+		}
+	}
+	if loaded != 3 {
+		t.Errorf("expecting loader to be called 3 times but got %d", loaded)
+		return
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	t.Parallel()
+
+	c, err := New(context.Background(), "coalesce", nil, &Options{LocalSize: 10})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var loaded int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&loaded, 1)
+		<-release
+		return value{ID: "1"}, nil
+	}
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v := value{}
+			errs <- c.Get(context.Background(), "1", &v, loader)
+		}()
+	}
+	// give time for all goroutines to wait for the loader
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if loaded != 1 {
+		t.Errorf("expecting loader to be called once but got %d", loaded)
+		return
+	}
+}
+
+func TestLRU(t *testing.T) {
+	t.Parallel()
+
+	l := newLRU(2)
+	l.set("1", []byte("1"), time.Minute)
+	l.set("2", []byte("2"), time.Minute)
+	// 1 is the most recently used, so 2 is evicted by 3
+	l.get("1")
+	l.set("3", []byte("3"), time.Minute)
+	l.set("4", []byte("4"), -time.Second)
+
+	cases := []struct {
+		key   string
+		exist bool
+	}{
+		{key: "1", exist: false},
+		{key: "2", exist: false},
+		{key: "3", exist: true},
+		{key: "4", exist: false},
+	}
+	// 1 is evicted by 4, and 4 is already expired
+	for _, cs := range cases {
+		if _, ok := l.get(cs.key); ok != cs.exist {
+			t.Errorf("key %s: expecting exist %v but got %v", cs.key, cs.exist, ok)
+			return
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lru is in-process least recently used cache with ttl
+type lru struct {
+	size int
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	list  *list.List
+}
+
+type lruItem struct {
+	key      string
+	data     []byte
+	expireAt time.Time
+}
+
+func newLRU(size int) *lru {
+	return &lru{
+		size:  size,
+		items: make(map[string]*list.Element),
+		list:  list.New(),
+	}
+}
+
+func (l *lru) get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	elem, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := elem.Value.(*lruItem)
+	if !time.Now().Before(item.expireAt) {
+		l.list.Remove(elem)
+		delete(l.items, key)
+		return nil, false
+	}
+	l.list.MoveToFront(elem)
+	return item.data, true
+}
+
+func (l *lru) set(key string, data []byte, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	expireAt := time.Now().Add(ttl)
+	if elem, ok := l.items[key]; ok {
+		item := elem.Value.(*lruItem)
+		item.data = data
+		item.expireAt = expireAt
+		l.list.MoveToFront(elem)
+		return
+	}
+
+	l.items[key] = l.list.PushFront(&lruItem{key: key, data: data, expireAt: expireAt})
+	// evict the least recently used item
+	if l.list.Len() > l.size {
+		elem := l.list.Back()
+		l.list.Remove(elem)
+		delete(l.items, elem.Value.(*lruItem).key)
+	}
+}
+
+func (l *lru) remove(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if elem, ok := l.items[key]; ok {
+		l.list.Remove(elem)
+		delete(l.items, key)
+	}
+}
@@ -64,6 +64,13 @@ func (rc *RequestContext) Context() context.Context {
 	return rc.httpRequest.Context()
 }
 
+// WithContext return a copy of request context with the http.Request.Context changed to ctx
+func (rc *RequestContext) WithContext(ctx context.Context) *RequestContext {
+	c := *rc
+	c.httpRequest = rc.httpRequest.WithContext(ctx)
+	return &c
+}
+
 // ResponseWriter return http response writer from request context
 func (rc *RequestContext) ResponseWriter() http.ResponseWriter {
 	return rc.httpResponseWriter
@@ -0,0 +1,159 @@
+package nsq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	guuid "github.com/google/uuid"
+	"go.opencensus.io/trace"
+	"go.opencensus.io/trace/propagation"
+)
+
+// list of envelope error
+var (
+	ErrInvalidEnvelope       = errors.New("nsq: invalid envelope")
+	ErrUnknownMessageType    = errors.New("nsq: unknown message type")
+	ErrUnknownMessageVersion = errors.New("nsq: unknown message version")
+)
+
+// Payload is the message that published inside an envelope
+// the type and version are used by the router to find the handler of the message.
+type Payload interface {
+	MessageType() string
+	MessageVersion() int
+}
+
+// Envelope of message, encoded in json
+type Envelope struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+	// ProducerID is the id of the producer that publish the message, the default is the hostname
+	ProducerID string `json:"producer_id"`
+	// TraceContext is the span context of the publisher in opencensus binary format
+	TraceContext []byte `json:"trace_context,omitempty"`
+	// IdempotencyKey is used by the handler to check whether the message is already handled,
+	// the default is the id of the envelope.
+	IdempotencyKey string          `json:"idempotency_key"`
+	Timestamp      time.Time       `json:"timestamp"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+// Validate envelope
+func (e *Envelope) Validate() error {
+	if e.Type == "" {
+		return fmt.Errorf("%w: message type cannot be empty", ErrInvalidEnvelope)
+	}
+	if e.Version < 1 {
+		return fmt.Errorf("%w: version of %s must be greater than 0, got %d", ErrInvalidEnvelope, e.Type, e.Version)
+	}
+	return nil
+}
+
+// Decode the payload of envelope
+func (e *Envelope) Decode(out interface{}) error {
+	if err := json.Unmarshal(e.Payload, out); err != nil {
+		return fmt.Errorf("%w: failed to decode payload of %s version %d: %v", ErrInvalidEnvelope, e.Type, e.Version, err)
+	}
+	return nil
+}
+
+// SpanContext return the span context of the publisher
+func (e *Envelope) SpanContext() (trace.SpanContext, bool) {
+	if len(e.TraceContext) == 0 {
+		return trace.SpanContext{}, false
+	}
+	return propagation.FromBinary(e.TraceContext)
+}
+
+// NewEnvelope create envelope of the payload
+// the trace context is taken from the span in the context.
+func NewEnvelope(ctx context.Context, producerID string, payload Payload) (*Envelope, error) {
+	out, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	id := guuid.New().String()
+	e := Envelope{
+		ID:             id,
+		Type:           payload.MessageType(),
+		Version:        payload.MessageVersion(),
+		ProducerID:     producerID,
+		IdempotencyKey: id,
+		Timestamp:      time.Now(),
+		Payload:        out,
+	}
+	if span := trace.FromContext(ctx); span != nil {
+		e.TraceContext = propagation.Binary(span.SpanContext())
+	}
+	return &e, e.Validate()
+}
+
+// DecodeEnvelope decode envelope from message body
+func DecodeEnvelope(body []byte) (*Envelope, error) {
+	e := Envelope{}
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+	}
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// PublishOptions of envelope
+type PublishOptions struct {
+	// IdempotencyKey of the message, the id of envelope is used if empty
+	IdempotencyKey string
+}
+
+// PublishPayload publish the payload inside an envelope to nsqd
+func (p *Producer) PublishPayload(ctx context.Context, topic string, payload Payload, opts *PublishOptions) error {
+	e, err := NewEnvelope(ctx, p.ID(), payload)
+	if err != nil {
+		return err
+	}
+	if opts != nil && opts.IdempotencyKey != "" {
+		e.IdempotencyKey = opts.IdempotencyKey
+	}
+	out, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return p.Publish(topic, out)
+}
+
+// MultiPublishPayload publish the payloads inside envelopes to nsqd
+func (p *Producer) MultiPublishPayload(ctx context.Context, topic string, payloads ...Payload) error {
+	body := make([][]byte, len(payloads))
+	for i, payload := range payloads {
+		e, err := NewEnvelope(ctx, p.ID(), payload)
+		if err != nil {
+			return err
+		}
+		body[i], err = json.Marshal(e)
+		if err != nil {
+			return err
+		}
+	}
+	return p.MultiPublish(topic, body)
+}
+
+// SetID set the producer id in the envelope
+func (p *Producer) SetID(id string) {
+	p.id = id
+}
+
+// ID return the producer id, the hostname is used if the id is not set
+func (p *Producer) ID() string {
+	if p.id != "" {
+		return p.id
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
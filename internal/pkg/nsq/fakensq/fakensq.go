@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	nsqio "github.com/nsqio/go-nsq"
@@ -28,12 +29,8 @@ func (fp *FakeProducer) Ping() error {
 // Publish a message
 // this function might block if the channel is full
 func (fp *FakeProducer) Publish(topic string, message []byte) error {
-	m := nsqio.Message{
-		Body:     message,
-		Delegate: &MessageDelegator{},
-	}
 	// publish to fakelookupd
-	fp.publish(topic, &m)
+	fp.publish(topic, message)
 	return nil
 }
 
@@ -62,8 +59,9 @@ type FakeConsumer struct {
 	handlers    []nsqHandler
 	started     bool
 	stopped     bool
-	// nsq configuration
-	MaxInFlight int
+	// nsq configuration, guarded by mu because it is changed by the handler
+	mu          sync.Mutex
+	maxInFlight int
 }
 
 type nsqHandler struct {
@@ -78,21 +76,54 @@ func (h *nsqHandler) Stop() {
 }
 
 // MessageDelegator implement Delegator of nsqio
+// the delegator records the response of the message, and deliver the message again when requeued
 type MessageDelegator struct {
+	mu       sync.Mutex
+	finished bool
+	requeued bool
+	delay    time.Duration
+	// requeue deliver the message again to the same topic and channel
+	requeue func(m *nsqio.Message, delay time.Duration)
 }
 
+// OnFinish is called when message is finished
 func (mdm *MessageDelegator) OnFinish(message *nsqio.Message) {
-	return
+	mdm.mu.Lock()
+	mdm.finished = true
+	mdm.mu.Unlock()
 }
 
+// OnRequeue is called when message is requeued
 func (mdm *MessageDelegator) OnRequeue(m *nsqio.Message, t time.Duration, backoff bool) {
-	return
+	mdm.mu.Lock()
+	mdm.requeued = true
+	mdm.delay = t
+	mdm.mu.Unlock()
+
+	if mdm.requeue != nil {
+		mdm.requeue(m, t)
+	}
 }
 
+// OnTouch is called when message is touched
 func (mdm *MessageDelegator) OnTouch(m *nsqio.Message) {
 	return
 }
 
+// Finished return true if the message is finished
+func (mdm *MessageDelegator) Finished() bool {
+	mdm.mu.Lock()
+	defer mdm.mu.Unlock()
+	return mdm.finished
+}
+
+// Requeued return true and the delay if the message is requeued
+func (mdm *MessageDelegator) Requeued() (bool, time.Duration) {
+	mdm.mu.Lock()
+	defer mdm.mu.Unlock()
+	return mdm.requeued, mdm.delay
+}
+
 // Message mock
 type Message struct {
 	Name string
@@ -196,7 +227,16 @@ func (cm *FakeConsumer) ConnectToNSQLookupds(addresses []string) error {
 
 // ChangeMaxInFlight message in nsq consumer
 func (cm *FakeConsumer) ChangeMaxInFlight(n int) {
-	cm.MaxInFlight = n
+	cm.mu.Lock()
+	cm.maxInFlight = n
+	cm.mu.Unlock()
+}
+
+// MaxInFlight return the max in flight set by ChangeMaxInFlight
+func (cm *FakeConsumer) MaxInFlight() int {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.maxInFlight
 }
 
 // Concurrency return the number of conccurent worker
@@ -224,13 +264,8 @@ func (cm *FakeConsumer) start() {
 				return
 			}
 
-			delegate := MessageDelegator{}
-			m := nsqio.Message{
-				Body:     d.Body,
-				Delegate: &delegate,
-			}
 			// send the message to the worker channel
-			cm.messageChan <- &m
+			cm.messageChan <- cm.FakeLookupd.newMessage(d.Body, 1, cm.messageChan)
 		}
 	}()
 	cm.started = true
@@ -249,11 +284,48 @@ func (cm *FakeConsumer) Stop() {
 // FakeLookupd for storing all information regarding topics and channel
 type FakeLookupd struct {
 	topicChannel map[string]map[string]chan *nsqio.Message
+	published    map[string][][]byte
+	messageID    uint64
 	mu           sync.Mutex
 }
 
+// Published return all messages published to the topic
+// the message is recorded even if there is no consumer for the topic
+func (fld *FakeLookupd) Published(topic string) [][]byte {
+	fld.mu.Lock()
+	defer fld.mu.Unlock()
+	return append([][]byte(nil), fld.published[topic]...)
+}
+
+// newMessage create a message that delivered again to the message channel when requeued
+func (fld *FakeLookupd) newMessage(body []byte, attempts uint16, messageChan chan *nsqio.Message) *nsqio.Message {
+	var id nsqio.MessageID
+	copy(id[:], fmt.Sprintf("%016x", atomic.AddUint64(&fld.messageID, 1)))
+
+	m := nsqio.NewMessage(id, body)
+	m.Attempts = attempts
+	m.Delegate = &MessageDelegator{
+		requeue: func(m *nsqio.Message, delay time.Duration) {
+			go func() {
+				if delay > 0 {
+					time.Sleep(delay)
+				}
+				requeued := nsqio.NewMessage(m.ID, m.Body)
+				requeued.Attempts = m.Attempts + 1
+				requeued.Timestamp = m.Timestamp
+				requeued.Delegate = m.Delegate
+				messageChan <- requeued
+			}()
+		},
+	}
+	return m
+}
+
 // register topic, channel and message channel to fake lookupd
 func (fld *FakeLookupd) register(topic, channel string, messageChan chan *nsqio.Message) {
+	fld.mu.Lock()
+	defer fld.mu.Unlock()
+
 	_, ok := fld.topicChannel[topic]
 	if !ok {
 		fld.topicChannel[topic] = make(map[string]chan *nsqio.Message)
@@ -262,21 +334,24 @@ func (fld *FakeLookupd) register(topic, channel string, messageChan chan *nsqio.
 }
 
 // publish the message to desired topic and multiplex via channel
-func (fld *FakeLookupd) publish(topic string, message *nsqio.Message) error {
+func (fld *FakeLookupd) publish(topic string, body []byte) error {
 	// block because we might see blocking in publishing message to channel
 	// no point of accessing this function concurrently
 	fld.mu.Lock()
-	defer fld.mu.Unlock()
-
-	t, ok := fld.topicChannel[topic]
-	if !ok {
-		return nil
+	if fld.published == nil {
+		fld.published = make(map[string][][]byte)
+	}
+	fld.published[topic] = append(fld.published[topic], body)
+	var channels []chan *nsqio.Message
+	for _, messageChan := range fld.topicChannel[topic] {
+		channels = append(channels, messageChan)
 	}
+	fld.mu.Unlock()
 
-	// publish to all possible channel
+	// publish to all possible channel, every channel has its own message
 	// expect this to be blocking
-	for _, messageChan := range t {
-		messageChan <- message
+	for _, messageChan := range channels {
+		messageChan <- fld.newMessage(body, 1, messageChan)
 	}
 	return nil
 }
@@ -3,6 +3,7 @@ package nsq
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	gonsq "github.com/nsqio/go-nsq"
@@ -42,6 +43,24 @@ func (m *Message) RequeueWithoutBackoff(delay time.Duration) {
 	m.Message.RequeueWithoutBackoff(delay)
 }
 
+// HasResponded return true if the message is already finished or requeued
+func (m *Message) HasResponded() bool {
+	return m.Message.HasResponded()
+}
+
+// respond to nsqd if the message is not finished or requeued by the handler or middleware
+// the message is finished if handled without error, otherwise the message is requeued with the default delay
+func (m *Message) respond(err error) {
+	if m.Message.HasResponded() {
+		return
+	}
+	if err != nil {
+		m.Requeue(-1)
+		return
+	}
+	m.Finish()
+}
+
 // Info for message
 type Info struct {
 	WorkerTotal     int
@@ -61,9 +80,25 @@ type nsqHandler struct {
 	// messageBuff is a buffered channel to buffer messages
 	messageBuff chan *Message
 	buffLength  int
-	stopChan    chan struct{}
-	mu          sync.Mutex
-	throttle    bool
+	// stopChan is closed when the handler is stopping,
+	// drainCtx is the deadline for the workers to handle the messages left in the buffer.
+	stopChan chan struct{}
+	// maxConcurrency is the concurrency from the configuration,
+	// the concurrency is changed at runtime by the throttle controller.
+	maxConcurrency int
+	maxInFlight    int
+	// retireChan is used to tell the workers to exit when the concurrency is decreased
+	retireChan chan struct{}
+	// stats is not nil if the handler is throttled by the throttle controller
+	stats    *handlerStats
+	stopOnce sync.Once
+	drainCtx context.Context
+	wg       sync.WaitGroup
+	// number of messages drained and requeued when the handler is stopping
+	drained  int64
+	requeued int64
+	mu       sync.Mutex
+	throttle bool
 }
 
 // SetThrottle to set the handler status if throttled or not
@@ -77,38 +112,160 @@ func (nh *nsqHandler) SetThrottle(throttle bool) {
 func (nh *nsqHandler) Work() {
 	nh.mu.Lock()
 	// Guard with lock,
-	// don't let worker number goes more than concurrency number.
-	if nh.workerNumber == nh.concurrency {
+	// don't let worker number goes more than concurrency number,
+	// and don't start a new worker when the handler is stopping.
+	if nh.workerNumber >= nh.concurrency || nh.drainCtx != nil {
+		nh.mu.Unlock()
 		return
 	}
 	nh.workerNumber++
+	nh.wg.Add(1)
 	nh.mu.Unlock()
 
+	defer func() {
+		nh.mu.Lock()
+		nh.workerNumber--
+		nh.mu.Unlock()
+		nh.wg.Done()
+	}()
+
 	for {
+		// Check the stop first, because select picks randomly when both channels are ready.
 		select {
 		case <-nh.stopChan:
+			nh.drain()
+			return
+		default:
+		}
+
+		select {
+		case <-nh.stopChan:
+			nh.drain()
+			return
+		case <-nh.retireChan:
 			return
 		case message := <-nh.messageBuff:
-			// Add information about worker to message
-			// this will add additional allocation and memory
-			// but essential to monitor the number of worker.
-			message.Info.WorkerTotal = nh.concurrency
-			message.Info.WorkerCurrent = nh.workerNumber
-			message.Info.MessageInBuffer = len(nh.messageBuff)
-			// Set the next message throttle flag to 1
-			// because the handler is set to throttle from the default handler.
-			if nh.throttle {
-				message.Info.ThrottleFlag = 1
-			}
-			nh.handler(context.Background(), message)
+			nh.handle(message)
+		}
+	}
+}
+
+// setConcurrency change the number of workers, and return the new concurrency
+// the concurrency is limited between 1 and the max concurrency.
+func (nh *nsqHandler) setConcurrency(n int) int {
+	if n < 1 {
+		n = 1
+	}
+	if n > nh.maxConcurrency {
+		n = nh.maxConcurrency
+	}
+
+	nh.mu.Lock()
+	diff := n - nh.concurrency
+	nh.concurrency = n
+	nh.mu.Unlock()
+
+	for ; diff < 0; diff++ {
+		nh.retireChan <- struct{}{}
+	}
+	for ; diff > 0; diff-- {
+		// cancel the retirement of worker that is not yet retired, before adding a new worker
+		select {
+		case <-nh.retireChan:
+		default:
+			go nh.Work()
+		}
+	}
+	return n
+}
+
+func (nh *nsqHandler) handle(message *Message) {
+	// Add information about worker to message
+	// this will add additional allocation and memory
+	// but essential to monitor the number of worker.
+	// The concurrency and throttle might be changed by the throttle controller, so guard with lock.
+	nh.mu.Lock()
+	message.Info.WorkerTotal = nh.concurrency
+	message.Info.WorkerCurrent = nh.workerNumber
+	throttle := nh.throttle
+	nh.mu.Unlock()
+	message.Info.MessageInBuffer = len(nh.messageBuff)
+	// Set the next message throttle flag to 1
+	// because the handler is set to throttle from the default handler.
+	if throttle {
+		message.Info.ThrottleFlag = 1
+	}
+	// The message is drained if it is handled when the handler is stopping.
+	select {
+	case <-nh.stopChan:
+		atomic.AddInt64(&nh.drained, 1)
+	default:
+	}
+	t := time.Now()
+	err := nh.handler(context.Background(), message)
+	if nh.stats != nil {
+		nh.stats.observe(time.Since(t), err)
+	}
+	message.respond(err)
+}
+
+// drain handle the messages left in the buffer until the buffer is empty or the drain deadline is exceeded
+func (nh *nsqHandler) drain() {
+	for nh.drainCtx.Err() == nil {
+		select {
+		case message := <-nh.messageBuff:
+			nh.handle(message)
+		default:
+			return
 		}
 	}
 }
 
-// Stop the work of nsq handler
-func (nh *nsqHandler) Stop() {
-	nh.stopChan <- struct{}{}
-	nh.workerNumber--
+// stopping tell the workers to drain the buffer and exit, and the default handler to stop buffering new messages
+func (nh *nsqHandler) stopping(ctx context.Context) {
+	nh.stopOnce.Do(func() {
+		nh.mu.Lock()
+		nh.drainCtx = ctx
+		close(nh.stopChan)
+		nh.mu.Unlock()
+	})
+}
+
+// Stop the workers of nsq handler gracefully
+// the workers handle the messages left in the buffer until ctx is done,
+// then the messages that are not handled are requeued to nsqd.
+func (nh *nsqHandler) Stop(ctx context.Context) error {
+	nh.stopping(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		nh.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	for {
+		select {
+		case message := <-nh.messageBuff:
+			nh.requeue(message.Message)
+		default:
+			_nsqDrainCount.WithLabelValues(nh.topic, nh.channel, "drained").Add(float64(atomic.LoadInt64(&nh.drained)))
+			_nsqDrainCount.WithLabelValues(nh.topic, nh.channel, "requeued").Add(float64(atomic.LoadInt64(&nh.requeued)))
+			return err
+		}
+	}
+}
+
+// requeue the message immediately when the handler is stopping, so the message is handled by other consumer
+func (nh *nsqHandler) requeue(message *gonsq.Message) {
+	message.RequeueWithoutBackoff(0)
+	atomic.AddInt64(&nh.requeued, 1)
 }
 
 type defaultHandler struct {
@@ -120,10 +277,14 @@ type defaultHandler struct {
 // HandleMessage of nsq
 func (dfh *defaultHandler) HandleMessage(message *gonsq.Message) error {
 	_nsqMessageRetrievedCount.WithLabelValues(dfh.topic, dfh.channel).Add(1)
+	// The message is buffered and handled by the worker after this function returns,
+	// so the worker is the one that responsible to finish or requeue the message.
+	message.DisableAutoResponse()
 	// Message in the buffer should always less than bufferLength/2
 	// if its already more than half of the buffer size, we should pause the consumption
 	// and wait for the buffer to be consumed first.
-	if len(dfh.messageBuff) > (dfh.buffLength / 2) {
+	// The throttle controller is responsible to throttle the message consumption if exists.
+	if dfh.stats == nil && len(dfh.messageBuff) > (dfh.buffLength/2) {
 		// set the handler throttle to true, so all message will be throttled right away
 		dfh.SetThrottle(true)
 		// pause the message consumption to NSQD by set the MaxInFlight to 0
@@ -133,7 +294,12 @@ func (dfh *defaultHandler) HandleMessage(message *gonsq.Message) error {
 			// it might be better to have a lower evaluation interval, but need some metrics first.
 			// The default throttling here won't affect the message consumer because messages already buffered
 			// but will have some effect for the nsqd itself because we pause the message consumption from nsqd.
-			time.Sleep(time.Second * 1)
+			select {
+			case <-time.After(time.Second * 1):
+			case <-dfh.stopChan:
+				dfh.requeue(message)
+				return nil
+			}
 			if len(dfh.messageBuff) < (dfh.buffLength / 2) {
 				// resume the message consumption to NSQD by set the MaxInFlight to buffer size
 				dfh.consumerBackend.ChangeMaxInFlight(dfh.buffLength)
@@ -142,12 +308,25 @@ func (dfh *defaultHandler) HandleMessage(message *gonsq.Message) error {
 			}
 		}
 	}
-	dfh.messageBuff <- &Message{
+	m := &Message{
 		Topic:   dfh.topic,
 		Channel: dfh.channel,
 		Message: message,
 		// allocate for info
 		Info: &Info{},
 	}
+	// Don't buffer new message when the handler is stopping,
+	// because the workers might already exit after the buffer is drained.
+	select {
+	case <-dfh.stopChan:
+		dfh.requeue(message)
+		return nil
+	default:
+	}
+	select {
+	case dfh.messageBuff <- m:
+	case <-dfh.stopChan:
+		dfh.requeue(message)
+	}
 	return nil
 }
@@ -5,7 +5,7 @@ import (
 	"testing"
 	"time"
 
-	fakensq "github.com/kyolabs/mono/gopkg/nsq/fakensq"
+	"github.com/albertwidi/go-project-example/internal/pkg/nsq/fakensq"
 	gonsq "github.com/nsqio/go-nsq"
 )
 
@@ -28,7 +28,7 @@ func TestNSQHandlerSetConcurrency(t *testing.T) {
 			concurrency:            -1,
 			buffMultiplier:         -1,
 			expectConcurreny:       1,
-			expectBufferMultiplier: 20,
+			expectBufferMultiplier: 30,
 		},
 		{
 			concurrency:            1,
@@ -40,7 +40,7 @@ func TestNSQHandlerSetConcurrency(t *testing.T) {
 			concurrency:            1,
 			buffMultiplier:         -1,
 			expectConcurreny:       1,
-			expectBufferMultiplier: 20,
+			expectBufferMultiplier: 30,
 		},
 	}
 
@@ -126,18 +126,26 @@ func TestNSQHandlerConcurrencyControl(t *testing.T) {
 		// Wait until the goroutines scheduled
 		// this might be too long, but its ok.
 		time.Sleep(time.Millisecond * 10)
-		if handler.workerNumber != i {
-			t.Errorf("start: expecting number worker number of %d but got %d", i, handler.workerNumber)
+		if workerNumber(handler) != i {
+			t.Errorf("start: expecting number worker number of %d but got %d", i, workerNumber(handler))
 			return
 		}
 	}
 
-	for i := handler.workerNumber; i < 0; i-- {
-		handler.Stop()
-		if handler.workerNumber != i-1 {
-			t.Errorf("stop: expecting worker number of %d but got %d", i-1, handler.workerNumber)
-			return
-		}
+	// the worker number should not exceed the concurrency
+	handler.Work()
+	if workerNumber(handler) != 5 {
+		t.Errorf("start: expecting number worker number of %d but got %d", 5, workerNumber(handler))
+		return
+	}
+
+	if err := handler.Stop(context.Background()); err != nil {
+		t.Error(err)
+		return
+	}
+	if workerNumber(handler) != 0 {
+		t.Errorf("stop: expecting worker number of %d but got %d", 0, workerNumber(handler))
+		return
 	}
 }
 
@@ -233,7 +241,7 @@ func TestDefaultHandlerThrottle(t *testing.T) {
 				t.Error("error while current buffer is less than half")
 				return
 			}
-			if backend.MaxInFlight != 0 {
+			if backend.MaxInFlight() != 0 {
 				t.Error("error: max in flight is not being set to 0")
 				return
 			}
@@ -241,3 +249,10 @@ func TestDefaultHandlerThrottle(t *testing.T) {
 		}
 	}
 }
+
+// workerNumber return the number of running workers of the handler
+func workerNumber(nh *nsqHandler) int {
+	nh.mu.Lock()
+	defer nh.mu.Unlock()
+	return nh.workerNumber
+}
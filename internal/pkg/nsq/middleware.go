@@ -21,7 +21,12 @@ func Metrics(handler HandlerFunc) HandlerFunc {
 		_nsqHandleDurationHist.WithLabelValues(message.Topic, message.Channel).Observe(float64(time.Now().Sub(t).Milliseconds()))
 		_nsqHandleCount.WithLabelValues(message.Topic, message.Channel, e).Add(1)
 		_nsqWorkerCurrentGauge.WithLabelValues(message.Topic, message.Channel).Set(float64(message.Info.WorkerCurrent))
-		_nsqThrottleGauge.WithLabelValues(message.Topic, message.Channel).Set(float64(message.Info.Throttled))
+		// the message is flagged when the handler is throttled, even if the throttle middleware is not used
+		throttled := message.Info.Throttled
+		if message.Info.ThrottleFlag == 1 {
+			throttled = 1
+		}
+		_nsqThrottleGauge.WithLabelValues(message.Topic, message.Channel).Set(float64(throttled))
 		_nsqMessageInBuffGauge.WithLabelValues(message.Topic, message.Channel).Set(float64(message.Info.MessageInBuffer))
 		return err
 	}
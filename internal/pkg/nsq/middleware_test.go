@@ -8,7 +8,7 @@ import (
 	"testing"
 	"time"
 
-	fakensq "github.com/kyolabs/mono/gopkg/nsq/fakensq"
+	"github.com/albertwidi/go-project-example/internal/pkg/nsq/fakensq"
 )
 
 func TestThrottleMiddleware(t *testing.T) {
@@ -18,7 +18,6 @@ func TestThrottleMiddleware(t *testing.T) {
 		topic             = "test_topic"
 		channel           = "test_channel"
 		errChan           = make(chan error)
-		messageNum        int32
 		currentMessageNum int32
 		messageThrottled  int32
 
@@ -32,6 +31,7 @@ func TestThrottleMiddleware(t *testing.T) {
 	// and the number of message buffer is 1 * _bufferMultiplier.
 	_buffMultiplier := 10
 	_concurrency := 1
+	messageNum := int32(_buffMultiplier/2) + 3
 	consumer, err := fakensq.NewFakeConsumer(fakensq.ConsumerConfig{Topic: topic, Channel: channel, Concurrency: _concurrency, BufferMultiplier: _buffMultiplier})
 	if err != nil {
 		t.Error(err)
@@ -54,7 +54,7 @@ func TestThrottleMiddleware(t *testing.T) {
 	)
 
 	wc.Handle(topic, channel, func(ctx context.Context, message *Message) error {
-		atomic.AddInt32(&currentMessageNum, 1)
+		current := atomic.AddInt32(&currentMessageNum, 1)
 
 		if string(message.Message.Body) != messageExpect {
 			err := fmt.Errorf("epecting message %s but got %s", messageExpect, string(message.Message.Body))
@@ -65,7 +65,7 @@ func TestThrottleMiddleware(t *testing.T) {
 		// This means this is the first message, sleep to make other message to wait
 		// because if the handler is not finished, the worker is not back to consume state
 		// to make sure the buffer is filled first before consuming more message.
-		if currentMessageNum == 1 {
+		if current == 1 {
 			time.Sleep(time.Millisecond * 100)
 		}
 
@@ -78,8 +78,8 @@ func TestThrottleMiddleware(t *testing.T) {
 		}
 
 		// this means the test have reach the end of message
-		if currentMessageNum == messageNum {
-			if messageThrottled < 1 {
+		if current == messageNum {
+			if atomic.LoadInt32(&messageThrottled) < 1 {
 				err := errors.New("message is never throttled")
 				errChan <- err
 				return err
@@ -89,7 +89,7 @@ func TestThrottleMiddleware(t *testing.T) {
 		}
 
 		errChan <- errNil
-		return err
+		return nil
 	})
 
 	if err := wc.Start(); err != nil {
@@ -128,12 +128,11 @@ func TestThrottleMiddleware(t *testing.T) {
 	// is more than half of the buffer size. Then throttle mechanism will be invoked
 	// this is why, with lower number of messages the test won't pass,
 	// because it depends on messages number in the buffer.
-	for i := 1; i <= (_buffMultiplier/2)+3; i++ {
+	for i := 1; i <= int(messageNum); i++ {
 		if err := producer.Publish(topic, []byte(messageExpect)); err != nil {
 			t.Error(err)
 			return
 		}
-		messageNum++
 	}
 
 	for i := 1; i <= int(messageNum); i++ {
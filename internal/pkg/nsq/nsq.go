@@ -1,10 +1,13 @@
 package nsq
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	gonsq "github.com/nsqio/go-nsq"
 	"github.com/prometheus/client_golang/prometheus"
@@ -20,6 +23,13 @@ var (
 	_nsqWorkerCurrentGauge    *prometheus.GaugeVec
 	_nsqThrottleGauge         *prometheus.GaugeVec
 	_nsqMessageInBuffGauge    *prometheus.GaugeVec
+	_nsqRetryCount            *prometheus.CounterVec
+	_nsqDrainCount            *prometheus.CounterVec
+	// metrics of throttle controller
+	_nsqThrottleMaxInFlightGauge *prometheus.GaugeVec
+	_nsqThrottleConcurrencyGauge *prometheus.GaugeVec
+	_nsqThrottleLatencyGauge     *prometheus.GaugeVec
+	_nsqThrottleErrorRateGauge   *prometheus.GaugeVec
 )
 
 // throwing fatal if prometheus metrics cannot be registered
@@ -82,6 +92,66 @@ func init() {
 			log.Fatal(err)
 		}
 	}
+	_nsqRetryCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nsq_message_retry_total",
+		Help: "total of failed message being requeued or published to dead letter topic by retry policy",
+	}, []string{"topic", "channel", "action"})
+	if err := prometheus.Register(_nsqRetryCount); err != nil {
+		if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			err = fmt.Errorf("error when registering nsqRetryCount. err: %w", err)
+			log.Fatal(err)
+		}
+	}
+	_nsqDrainCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nsq_message_drain_total",
+		Help: "total of buffered message being handled or requeued when the consumer is stopped",
+	}, []string{"topic", "channel", "result"})
+	if err := prometheus.Register(_nsqDrainCount); err != nil {
+		if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			err = fmt.Errorf("error when registering nsqDrainCount. err: %w", err)
+			log.Fatal(err)
+		}
+	}
+	_nsqThrottleMaxInFlightGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nsq_throttle_max_in_flight",
+		Help: "max in flight of the consumer decided by throttle controller",
+	}, []string{"topic", "channel"})
+	if err := prometheus.Register(_nsqThrottleMaxInFlightGauge); err != nil {
+		if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			err = fmt.Errorf("error when registering nsqThrottleMaxInFlightGauge. err: %w", err)
+			log.Fatal(err)
+		}
+	}
+	_nsqThrottleConcurrencyGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nsq_throttle_concurrency",
+		Help: "number of worker decided by throttle controller",
+	}, []string{"topic", "channel"})
+	if err := prometheus.Register(_nsqThrottleConcurrencyGauge); err != nil {
+		if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			err = fmt.Errorf("error when registering nsqThrottleConcurrencyGauge. err: %w", err)
+			log.Fatal(err)
+		}
+	}
+	_nsqThrottleLatencyGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nsq_throttle_handle_latency_seconds",
+		Help: "percentile of the latest handler latency used by throttle controller",
+	}, []string{"topic", "channel", "quantile"})
+	if err := prometheus.Register(_nsqThrottleLatencyGauge); err != nil {
+		if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			err = fmt.Errorf("error when registering nsqThrottleLatencyGauge. err: %w", err)
+			log.Fatal(err)
+		}
+	}
+	_nsqThrottleErrorRateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nsq_throttle_handle_error_rate",
+		Help: "error rate of the handler since the last evaluation of throttle controller",
+	}, []string{"topic", "channel"})
+	if err := prometheus.Register(_nsqThrottleErrorRateGauge); err != nil {
+		if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			err = fmt.Errorf("error when registering nsqThrottleErrorRateGauge. err: %w", err)
+			log.Fatal(err)
+		}
+	}
 }
 
 // ProducerBackend for NSQ
@@ -109,6 +179,7 @@ type ConsumerBackend interface {
 type Producer struct {
 	producer ProducerBackend
 	topics   map[string]bool
+	id       string
 }
 
 // WrapProducer is a function to wrap the nsq producer
@@ -150,6 +221,11 @@ type ConsumerConfig struct {
 	// before the buffer is half full from the nsqd message consumption.
 	// To fill this configuration correctly, it is needed to observe the consumption rate of the message and the handling rate of the worker.
 	BufferMultiplier int
+	// Throttle is the controller that adjusts the max in flight and the number of workers at runtime,
+	// the consumption is only paused when the buffer is more than half full if the controller is empty.
+	Throttle ThrottleController
+	// ThrottleInterval is the interval to evaluate the throttle, the default is 1 second
+	ThrottleInterval time.Duration
 }
 
 // Validate consumer configuration
@@ -167,6 +243,7 @@ type Consumer struct {
 	handlers        []*nsqHandler
 	middlewares     []MiddlewareFunc
 	lookupdsAddress []string
+	stopped         bool
 	mu              sync.Mutex
 }
 
@@ -255,18 +332,27 @@ func (c *Consumer) Handle(topic, channel string, handler HandlerFunc) {
 	// this is because the name of backends will not detected in start state
 	// so its safe to skip the error here.
 	if backend != nil {
-		// Retrieve and validate concurrency and buffer multiplier.
+		// Retrieve and validate concurrency and buffer multiplier,
+		// the consumer configuration is used when the backend doesn't set them.
 		concurrency := backend.Concurrency()
 		buffMultiplier := backend.BufferMultiplier()
+		if concurrency <= 0 {
+			concurrency = c.config.Concurrency
+		}
 		if concurrency <= 0 {
 			concurrency = 1
 		}
+		if buffMultiplier <= 0 {
+			buffMultiplier = c.config.BufferMultiplier
+		}
 		if buffMultiplier <= 0 {
 			buffMultiplier = 30
 		}
 
-		h.concurrency = backend.Concurrency()
-		h.buffMultiplier = backend.BufferMultiplier()
+		h.concurrency = concurrency
+		h.maxConcurrency = concurrency
+		h.retireChan = make(chan struct{}, concurrency)
+		h.buffMultiplier = buffMultiplier
 		// Determine the maximum length of buffer based on concurrency number
 		// for example, the concurrency have multiplication factor of 5.
 		// |message_processed|buffer|buffer|buffer|limit|
@@ -306,6 +392,10 @@ func (c *Consumer) Start() error {
 		}
 		// change the MaxInFlight to buffLength as the number of message won't exceed the buffLength
 		backend.ChangeMaxInFlight(dh.buffLength)
+		handler.maxInFlight = dh.buffLength
+		if c.config.Throttle != nil {
+			handler.stats = newHandlerStats()
+		}
 
 		if err := backend.ConnectToNSQLookupds(c.lookupdsAddress); err != nil {
 			return err
@@ -315,24 +405,82 @@ func (c *Consumer) Start() error {
 		for i := 0; i < handler.concurrency; i++ {
 			go handler.Work()
 		}
+		if c.config.Throttle != nil {
+			interval := c.config.ThrottleInterval
+			if interval <= 0 {
+				interval = DefaultThrottleInterval
+			}
+			go dh.throttle(c.config.Throttle, interval)
+		}
 	}
 	return nil
 }
 
-// Stop all the nsq consumer
-func (c *Consumer) Stop() error {
+// DrainResult is the number of buffered messages when the consumer is stopped
+type DrainResult struct {
+	// Drained is the number of messages in the buffer that handled by the workers before the deadline
+	Drained int
+	// Requeued is the number of messages that requeued to nsqd because the deadline is exceeded,
+	// or because the messages arrived when the consumer is stopping
+	Requeued int
+}
+
+// Drain stop the consumer gracefully
+// the consumer stops buffering new messages from nsqd, and the workers handle the messages left in the buffer until ctx is done.
+// Messages that are not handled before ctx is done are requeued to nsqd, so other consumer is able to handle them.
+func (c *Consumer) Drain(ctx context.Context) (DrainResult, error) {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return DrainResult{}, nil
+	}
+	c.stopped = true
+	c.mu.Unlock()
+
+	// Stop buffering before stopping the backends, so message that still arrives is requeued right away.
+	for _, handler := range c.handlers {
+		handler.stopping(ctx)
+	}
 	for _, channels := range c.backends {
 		for _, backend := range channels {
 			backend.Stop()
 		}
 	}
+
+	// All handlers are drained concurrently with the same deadline.
+	errs := make(chan error, len(c.handlers))
 	for _, handler := range c.handlers {
-		// Stop all the handler worker based on concurrency number
-		// this step is expected to be blocking,
-		// wait until all worker is exited.
-		for i := 0; i < handler.concurrency; i++ {
-			handler.Stop()
+		go func(handler *nsqHandler) {
+			errs <- handler.Stop(ctx)
+		}(handler)
+	}
+	var err error
+	for range c.handlers {
+		if e := <-errs; e != nil {
+			err = e
 		}
 	}
-	return nil
+
+	result := DrainResult{}
+	for _, handler := range c.handlers {
+		result.Drained += int(atomic.LoadInt64(&handler.drained))
+		result.Requeued += int(atomic.LoadInt64(&handler.requeued))
+	}
+	if err != nil {
+		return result, fmt.Errorf("nsq: drain deadline exceeded, %d messages requeued. error: %w", result.Requeued, err)
+	}
+	return result, nil
+}
+
+// Shutdown the consumer gracefully, see Drain
+func (c *Consumer) Shutdown(ctx context.Context) error {
+	_, err := c.Drain(ctx)
+	return err
+}
+
+// Stop all the nsq consumer
+// this step is expected to be blocking, wait until all messages in the buffer are handled.
+// Use Shutdown to limit the time to handle the messages.
+func (c *Consumer) Stop() error {
+	return c.Shutdown(context.Background())
 }
@@ -4,10 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/kyolabs/mono/gopkg/nsq/fakensq"
+	"github.com/albertwidi/go-project-example/internal/pkg/nsq/fakensq"
 )
 
 func TestStartStop(t *testing.T) {
@@ -42,7 +43,7 @@ func TestStartStop(t *testing.T) {
 	time.Sleep(time.Millisecond * 100)
 
 	for _, h := range wc.handlers {
-		if h.workerNumber == 0 {
+		if workerNumber(h) == 0 {
 			t.Error("worker number should not be 0 because consumer is started")
 			return
 		}
@@ -57,7 +58,7 @@ func TestStartStop(t *testing.T) {
 	time.Sleep(time.Millisecond * 100)
 
 	for _, h := range wc.handlers {
-		if h.workerNumber != 0 {
+		if workerNumber(h) != 0 {
 			t.Error("worker number should be 0 because consumer is stopped")
 			return
 		}
@@ -144,7 +145,7 @@ func TestMiddlewareChaining(t *testing.T) {
 		}
 
 		errChan <- errNil
-		return err
+		return nil
 	})
 
 	if err := wc.Start(); err != nil {
@@ -168,3 +169,97 @@ func TestMiddlewareChaining(t *testing.T) {
 		return
 	}
 }
+
+func TestDrain(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name           string
+		timeout        time.Duration
+		release        bool
+		expectDrained  int
+		expectRequeued int
+		expectError    bool
+	}{
+		{name: "drained", timeout: time.Second, release: true, expectDrained: 4},
+		{name: "deadline exceeded", timeout: time.Millisecond * 50, expectRequeued: 4, expectError: true},
+	}
+
+	for _, c := range cases {
+		topic := "test_drain"
+		channel := "test_drain"
+		consumer, err := fakensq.NewFakeConsumer(fakensq.ConsumerConfig{Topic: topic, Channel: channel})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		producer := fakensq.NewFakeProducer(consumer)
+
+		wc, err := WrapConsumers(ConsumerConfig{
+			LookupdsAddr:     []string{"testing"},
+			Concurrency:      1,
+			BufferMultiplier: 10,
+		}, consumer)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		// the first message blocks the worker, so the rest of messages stay in the buffer
+		gate := make(chan struct{})
+		defer close(gate)
+		started := make(chan struct{}, 1)
+		var handled int32
+		wc.Handle(topic, channel, func(ctx context.Context, message *Message) error {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-gate
+			atomic.AddInt32(&handled, 1)
+			return nil
+		})
+		if err := wc.Start(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		for i := 0; i < 5; i++ {
+			if err := producer.Publish(topic, []byte("drain")); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		<-started
+		deadline := time.Now().Add(time.Second)
+		for len(wc.handlers[0].messageBuff) != 4 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond * 10)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		defer cancel()
+		if c.release {
+			// release the worker after the consumer is stopping
+			go func() {
+				time.Sleep(time.Millisecond * 20)
+				for i := 0; i < 5; i++ {
+					gate <- struct{}{}
+				}
+			}()
+		}
+
+		result, err := wc.Drain(ctx)
+		if (err != nil) != c.expectError {
+			t.Errorf("%s: expecting error %v but got %v", c.name, c.expectError, err)
+			return
+		}
+		if result.Drained != c.expectDrained || result.Requeued != c.expectRequeued {
+			t.Errorf("%s: expecting drained %d and requeued %d but got %+v", c.name, c.expectDrained, c.expectRequeued, result)
+			return
+		}
+		if c.release && atomic.LoadInt32(&handled) != 5 {
+			t.Errorf("%s: expecting 5 messages handled but got %d", c.name, handled)
+			return
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package nsq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// default value of retry policy
+const (
+	DefaultMaxAttempts    = 5
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = time.Minute * 10
+)
+
+// list of retry action for metrics
+const (
+	retryActionRequeue    = "requeue"
+	retryActionDeadLetter = "dead_letter"
+	retryActionDrop       = "drop"
+)
+
+// RetryPolicy implement MiddlewareFunc
+// the failed message is requeued with exponential backoff until it reaches the max attempts,
+// after the final attempt the message is published to the dead letter topic and finished.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts before the message is sent to dead letter topic, the default is 5
+	MaxAttempts uint16
+	// InitialBackoff is the delay of the first requeue, the delay is doubled for every attempt
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum delay of requeue, note that nsqd also limit the delay with --max-req-timeout
+	MaxBackoff time.Duration
+	// Jitter is the fraction of the delay that is randomized, between 0 and 1.
+	// For example, 0.2 jitter of 10 seconds delay means the delay is between 8 and 10 seconds.
+	Jitter float64
+	// DeadLetterTopic is the topic for message that still failed after the final attempt,
+	// the producer must be allowed to publish to this topic.
+	// The message is dropped if the topic or the producer is empty.
+	DeadLetterTopic string
+	Producer        *Producer
+}
+
+// DeadLetter is the message published to dead letter topic
+type DeadLetter struct {
+	ID       string `json:"id"`
+	Topic    string `json:"topic"`
+	Channel  string `json:"channel"`
+	Body     []byte `json:"body"`
+	Attempts uint16 `json:"attempts"`
+	Error    string `json:"error"`
+	// Timestamp is the time when the message is published to the topic for the first time
+	Timestamp time.Time `json:"timestamp"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// Retry middleware for nsq.
+// The message that is already finished or requeued by the handler is not retried.
+func (rp *RetryPolicy) Retry(handler HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, message *Message) error {
+		err := handler(ctx, message)
+		if err == nil || message.HasResponded() {
+			return err
+		}
+
+		attempts := message.Message.Attempts
+		if attempts < rp.maxAttempts() {
+			message.RequeueWithoutBackoff(rp.Backoff(attempts))
+			_nsqRetryCount.WithLabelValues(message.Topic, message.Channel, retryActionRequeue).Add(1)
+			return err
+		}
+
+		if rp.DeadLetterTopic == "" || rp.Producer == nil {
+			message.Finish()
+			_nsqRetryCount.WithLabelValues(message.Topic, message.Channel, retryActionDrop).Add(1)
+			return err
+		}
+		if dlErr := rp.publishDeadLetter(message, err); dlErr != nil {
+			// keep the message in nsq, so the message is not lost when dead letter topic is not available
+			message.RequeueWithoutBackoff(rp.Backoff(attempts))
+			return fmt.Errorf("nsq: failed to publish to dead letter topic %s: %v. error: %w", rp.DeadLetterTopic, dlErr, err)
+		}
+		message.Finish()
+		_nsqRetryCount.WithLabelValues(message.Topic, message.Channel, retryActionDeadLetter).Add(1)
+		return err
+	}
+}
+
+// Backoff return the delay of requeue for the number of attempts
+func (rp *RetryPolicy) Backoff(attempts uint16) time.Duration {
+	initial := rp.InitialBackoff
+	if initial <= 0 {
+		initial = DefaultInitialBackoff
+	}
+	max := rp.MaxBackoff
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	delay := time.Duration(math.Min(float64(initial)*math.Pow(2, float64(attempts-1)), float64(max)))
+	if rp.Jitter > 0 {
+		jitter := math.Min(rp.Jitter, 1)
+		delay -= time.Duration(float64(delay) * jitter * rand.Float64())
+	}
+	return delay
+}
+
+func (rp *RetryPolicy) maxAttempts() uint16 {
+	if rp.MaxAttempts == 0 {
+		return DefaultMaxAttempts
+	}
+	return rp.MaxAttempts
+}
+
+func (rp *RetryPolicy) publishDeadLetter(message *Message, err error) error {
+	id := message.ID()
+	dl := DeadLetter{
+		ID:        string(id[:]),
+		Topic:     message.Topic,
+		Channel:   message.Channel,
+		Body:      message.Message.Body,
+		Attempts:  message.Message.Attempts,
+		Error:     err.Error(),
+		Timestamp: time.Unix(0, message.Message.Timestamp),
+		FailedAt:  time.Now(),
+	}
+	out, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	return rp.Producer.Publish(rp.DeadLetterTopic, out)
+}
@@ -0,0 +1,152 @@
+package nsq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/nsq/fakensq"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	t.Parallel()
+
+	var (
+		topic           = "test_retry"
+		channel         = "test_retry"
+		deadLetterTopic = "test_retry_dead_letter"
+		errHandle       = errors.New("failed to handle message")
+		attemptsChan    = make(chan uint16, 10)
+		delegatorChan   = make(chan *fakensq.MessageDelegator, 10)
+	)
+
+	consumer, err := fakensq.NewFakeConsumer(fakensq.ConsumerConfig{Topic: topic, Channel: channel})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	producer := fakensq.NewFakeProducer(consumer)
+
+	wc, err := WrapConsumers(ConsumerConfig{
+		LookupdsAddr:     []string{"testing"},
+		Concurrency:      1,
+		BufferMultiplier: 10,
+	}, consumer)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	rp := RetryPolicy{
+		MaxAttempts:     3,
+		InitialBackoff:  time.Millisecond * 10,
+		DeadLetterTopic: deadLetterTopic,
+		Producer:        WrapProducer(producer, deadLetterTopic),
+	}
+	wc.Use(rp.Retry)
+	wc.Handle(topic, channel, func(ctx context.Context, message *Message) error {
+		attemptsChan <- message.Message.Attempts
+		delegatorChan <- message.Message.Delegate.(*fakensq.MessageDelegator)
+		// the success message is handled at the second attempt
+		if string(message.Message.Body) == "success" && message.Message.Attempts == 2 {
+			return nil
+		}
+		return errHandle
+	})
+	if err := wc.Start(); err != nil {
+		t.Error(err)
+		return
+	}
+	defer wc.Stop()
+
+	cases := []struct {
+		body            string
+		expectAttempts  uint16
+		expectDeadLeter bool
+	}{
+		{body: "success", expectAttempts: 2},
+		{body: "failed", expectAttempts: 3, expectDeadLeter: true},
+	}
+
+	for _, c := range cases {
+		if err := producer.Publish(topic, []byte(c.body)); err != nil {
+			t.Error(err)
+			return
+		}
+
+		var delegator *fakensq.MessageDelegator
+		for i := uint16(1); i <= c.expectAttempts; i++ {
+			select {
+			case attempts := <-attemptsChan:
+				if attempts != i {
+					t.Errorf("%s: expecting attempts %d but got %d", c.body, i, attempts)
+					return
+				}
+				delegator = <-delegatorChan
+			case <-time.After(time.Second):
+				t.Errorf("%s: message is not retried, expecting attempts %d", c.body, i)
+				return
+			}
+		}
+
+		// wait until the message is finished after the last attempt
+		deadline := time.Now().Add(time.Second)
+		for !delegator.Finished() && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond * 10)
+		}
+		if !delegator.Finished() {
+			t.Errorf("%s: message is not finished", c.body)
+			return
+		}
+	}
+
+	published := producer.Published(deadLetterTopic)
+	if len(published) != 1 {
+		t.Errorf("expecting 1 dead letter message but got %d", len(published))
+		return
+	}
+	dl := DeadLetter{}
+	if err := json.Unmarshal(published[0], &dl); err != nil {
+		t.Error(err)
+		return
+	}
+	if string(dl.Body) != "failed" || dl.Attempts != 3 || dl.Error != errHandle.Error() || dl.Topic != topic || dl.Channel != channel {
+		t.Errorf("dead letter message is not expected, got %+v", dl)
+		return
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	t.Parallel()
+
+	rp := RetryPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Second * 5,
+	}
+	cases := []struct {
+		attempts uint16
+		expect   time.Duration
+	}{
+		{attempts: 1, expect: time.Second},
+		{attempts: 2, expect: time.Second * 2},
+		{attempts: 3, expect: time.Second * 4},
+		{attempts: 4, expect: time.Second * 5},
+		{attempts: 100, expect: time.Second * 5},
+	}
+	for _, c := range cases {
+		if delay := rp.Backoff(c.attempts); delay != c.expect {
+			t.Errorf("attempts %d: expecting delay %s but got %s", c.attempts, c.expect, delay)
+			return
+		}
+	}
+
+	rp.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if delay := rp.Backoff(3); delay < time.Second*2 || delay > time.Second*4 {
+			t.Errorf("expecting delay between 2s and 4s but got %s", delay)
+			return
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package nsq
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"go.opencensus.io/trace"
+)
+
+// EnvelopeHandlerFunc handle the message inside an envelope
+type EnvelopeHandlerFunc func(ctx context.Context, envelope *Envelope, message *Message) error
+
+type routeKey struct {
+	messageType string
+	version     int
+}
+
+// Router decode the envelope of the message and dispatch the envelope to the handler of its type and version
+// use Router.HandleMessage as the HandlerFunc of the consumer.
+type Router struct {
+	handlers map[routeKey]EnvelopeHandlerFunc
+	types    map[string]bool
+	fallback EnvelopeHandlerFunc
+}
+
+// NewRouter for envelope
+func NewRouter() *Router {
+	r := Router{
+		handlers: make(map[routeKey]EnvelopeHandlerFunc),
+		types:    make(map[string]bool),
+	}
+	return &r
+}
+
+// Handle the message type and version with handler
+// this function should be called before the consumer is started.
+func (r *Router) Handle(messageType string, version int, handler EnvelopeHandlerFunc) {
+	r.handlers[routeKey{messageType: messageType, version: version}] = handler
+	r.types[messageType] = true
+}
+
+// Fallback handle the envelope that has no handler for its type or version,
+// for example to upgrade the old version of the payload and handle it with the latest handler.
+// ErrUnknownMessageType or ErrUnknownMessageVersion is returned if fallback is not set.
+func (r *Router) Fallback(handler EnvelopeHandlerFunc) {
+	r.fallback = handler
+}
+
+// HandleMessage decode the envelope and dispatch it to the handler
+func (r *Router) HandleMessage(ctx context.Context, message *Message) error {
+	e, err := DecodeEnvelope(message.Message.Body)
+	if err != nil {
+		return err
+	}
+
+	// continue the trace of the publisher if exists
+	if sc, ok := e.SpanContext(); ok {
+		var span *trace.Span
+		ctx, span = trace.StartSpanWithRemoteParent(ctx, "nsq/"+message.Topic+"/"+e.Type, sc)
+		span.AddAttributes(
+			trace.StringAttribute("nsq.channel", message.Channel),
+			trace.StringAttribute("nsq.message.version", strconv.Itoa(e.Version)),
+		)
+		defer span.End()
+	}
+
+	handler, ok := r.handlers[routeKey{messageType: e.Type, version: e.Version}]
+	if ok {
+		return handler(ctx, e, message)
+	}
+	if r.fallback != nil {
+		return r.fallback(ctx, e, message)
+	}
+	if !r.types[e.Type] {
+		return fmt.Errorf("%w: %s", ErrUnknownMessageType, e.Type)
+	}
+	return fmt.Errorf("%w: %s version %d", ErrUnknownMessageVersion, e.Type, e.Version)
+}
@@ -0,0 +1,144 @@
+package nsq
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/nsq/fakensq"
+	gonsq "github.com/nsqio/go-nsq"
+	"go.opencensus.io/trace"
+)
+
+type bookingCreatedV1 struct {
+	BookingID string `json:"booking_id"`
+}
+
+func (bookingCreatedV1) MessageType() string { return "booking_created" }
+func (bookingCreatedV1) MessageVersion() int { return 1 }
+
+type bookingCreatedV2 struct {
+	BookingID string `json:"booking_id"`
+	UserHash  string `json:"user_hash"`
+}
+
+func (bookingCreatedV2) MessageType() string { return "booking_created" }
+func (bookingCreatedV2) MessageVersion() int { return 2 }
+
+type bookingCreatedV3 struct{}
+
+func (bookingCreatedV3) MessageType() string { return "booking_created" }
+func (bookingCreatedV3) MessageVersion() int { return 3 }
+
+type bookingCancelled struct{}
+
+func (bookingCancelled) MessageType() string { return "booking_cancelled" }
+func (bookingCancelled) MessageVersion() int { return 1 }
+
+func TestRouter(t *testing.T) {
+	t.Parallel()
+
+	topic := "test_router"
+	consumer, err := fakensq.NewFakeConsumer(fakensq.ConsumerConfig{Topic: topic, Channel: topic})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	fakeProducer := fakensq.NewFakeProducer(consumer)
+	producer := WrapProducer(fakeProducer, topic)
+	producer.SetID("test-producer")
+
+	var handled []bookingCreatedV2
+	handleV2 := func(ctx context.Context, e *Envelope, message *Message) error {
+		payload := bookingCreatedV2{}
+		if err := e.Decode(&payload); err != nil {
+			return err
+		}
+		handled = append(handled, payload)
+		return nil
+	}
+	// the fallback upgrades the first version, and reject the other versions
+	fallback := func(ctx context.Context, e *Envelope, message *Message) error {
+		if e.Type != "booking_created" || e.Version != 1 {
+			return ErrUnknownMessageVersion
+		}
+		payload := bookingCreatedV1{}
+		if err := e.Decode(&payload); err != nil {
+			return err
+		}
+		handled = append(handled, bookingCreatedV2{BookingID: payload.BookingID})
+		return nil
+	}
+
+	ctx, span := trace.StartSpan(context.Background(), "test")
+	defer span.End()
+	payloads := []Payload{
+		bookingCreatedV2{BookingID: "b2", UserHash: "eUjks"},
+		bookingCreatedV1{BookingID: "b1"},
+		bookingCreatedV3{},
+		bookingCancelled{},
+	}
+	if err := producer.MultiPublishPayload(ctx, topic, payloads...); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := producer.PublishPayload(ctx, topic, bookingCreatedV2{BookingID: "b3"}, &PublishOptions{IdempotencyKey: "b3"}); err != nil {
+		t.Error(err)
+		return
+	}
+	published := fakeProducer.Published(topic)
+
+	cases := []struct {
+		name        string
+		fallback    EnvelopeHandlerFunc
+		body        []byte
+		expectError error
+		expectID    string
+	}{
+		{name: "latest version", body: published[0], expectID: "b2"},
+		{name: "fallback", fallback: fallback, body: published[1], expectID: "b1"},
+		{name: "unknown version", body: published[2], expectError: ErrUnknownMessageVersion},
+		{name: "unknown version with fallback", fallback: fallback, body: published[2], expectError: ErrUnknownMessageVersion},
+		{name: "unknown type", body: published[3], expectError: ErrUnknownMessageType},
+		{name: "invalid envelope", body: []byte(`{"payload":{}}`), expectError: ErrInvalidEnvelope},
+		{name: "idempotency key", body: published[4], expectID: "b3"},
+	}
+
+	for _, c := range cases {
+		handled = nil
+		router := NewRouter()
+		router.Handle("booking_created", 2, handleV2)
+		if c.fallback != nil {
+			router.Fallback(c.fallback)
+		}
+
+		message := &Message{Topic: topic, Channel: topic, Message: gonsq.NewMessage(gonsq.MessageID{}, c.body)}
+		err := router.HandleMessage(context.Background(), message)
+		if !errors.Is(err, c.expectError) {
+			t.Errorf("%s: expecting error %v but got %v", c.name, c.expectError, err)
+			return
+		}
+		if c.expectID == "" {
+			continue
+		}
+		if len(handled) != 1 || handled[0].BookingID != c.expectID {
+			t.Errorf("%s: expecting booking %s is handled but got %+v", c.name, c.expectID, handled)
+			return
+		}
+	}
+
+	e, err := DecodeEnvelope(published[4])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if e.ProducerID != "test-producer" || e.IdempotencyKey != "b3" {
+		t.Errorf("expecting producer id and idempotency key is set but got %+v", e)
+		return
+	}
+	sc, ok := e.SpanContext()
+	if !ok || sc.TraceID != span.SpanContext().TraceID {
+		t.Errorf("expecting trace id %s but got %s", span.SpanContext().TraceID, sc.TraceID)
+		return
+	}
+}
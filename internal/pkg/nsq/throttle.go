@@ -0,0 +1,244 @@
+package nsq
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// default value of throttle
+const (
+	DefaultThrottleInterval = time.Second
+	// latencySamples is the number of latest handler latency used to calculate the percentiles
+	latencySamples = 512
+)
+
+// ThrottleStats is the statistics of the handler, used by ThrottleController to decide the throttle
+type ThrottleStats struct {
+	Topic   string
+	Channel string
+	// MaxInFlight and Concurrency are the current value of the handler
+	MaxInFlight int
+	Concurrency int
+	// MaxConcurrency is the concurrency from the configuration, the concurrency cannot exceed this number
+	MaxConcurrency  int
+	BufferLength    int
+	MessageInBuffer int
+	// Handled and Errors are the number of messages handled since the last evaluation
+	Handled   int
+	Errors    int
+	ErrorRate float64
+	// LatencyP50 and LatencyP99 are the percentiles of the latest handler latency
+	LatencyP50 time.Duration
+	LatencyP99 time.Duration
+}
+
+// ThrottleDecision is the new value for the handler
+// MaxInFlight is limited between 1 and the buffer length, and Concurrency is limited between 1 and MaxConcurrency.
+type ThrottleDecision struct {
+	MaxInFlight int
+	Concurrency int
+	// Throttled set the ThrottleFlag of the message, so the Throttle middleware is able to slow down the handler
+	Throttled bool
+}
+
+// ThrottleController decide the max in flight and concurrency of the handler at runtime
+type ThrottleController interface {
+	Decide(stats ThrottleStats) ThrottleDecision
+}
+
+// ThrottleControllerFunc is an adapter to allow a function to be used as ThrottleController
+type ThrottleControllerFunc func(stats ThrottleStats) ThrottleDecision
+
+// Decide call the controller function
+func (tf ThrottleControllerFunc) Decide(stats ThrottleStats) ThrottleDecision {
+	return tf(stats)
+}
+
+// AIMDThrottle is additive increase and multiplicative decrease throttle controller.
+// The max in flight and concurrency are decreased when the handler is congested, which is when
+// the p99 latency is higher than target latency or the error rate is higher than max error rate.
+// When the buffer is more than half full, the max in flight is decreased and the concurrency is increased,
+// because the workers are slower than the message consumption.
+// Otherwise both are increased slowly until they reach the limit.
+type AIMDThrottle struct {
+	// TargetLatency is the p99 latency of the handler, latency is not checked if empty
+	TargetLatency time.Duration
+	// MaxErrorRate is the maximum error rate of the handler between 0 and 1, the default is 0.1
+	MaxErrorRate float64
+	// InFlightStep is the number added to max in flight, the default is 10% of the buffer length
+	InFlightStep int
+	// ConcurrencyStep is the number of worker added, the default is 1
+	ConcurrencyStep int
+	// DecreaseFactor is multiplied to max in flight and concurrency when decreased, the default is 0.5
+	DecreaseFactor float64
+}
+
+// Decide the throttle of the handler
+func (at *AIMDThrottle) Decide(stats ThrottleStats) ThrottleDecision {
+	maxErrorRate := at.MaxErrorRate
+	if maxErrorRate <= 0 {
+		maxErrorRate = 0.1
+	}
+	inFlightStep := at.InFlightStep
+	if inFlightStep <= 0 {
+		inFlightStep = stats.BufferLength / 10
+	}
+	if inFlightStep <= 0 {
+		inFlightStep = 1
+	}
+	concurrencyStep := at.ConcurrencyStep
+	if concurrencyStep <= 0 {
+		concurrencyStep = 1
+	}
+	factor := at.DecreaseFactor
+	if factor <= 0 || factor >= 1 {
+		factor = 0.5
+	}
+	decrease := func(n int) int {
+		return int(math.Floor(float64(n) * factor))
+	}
+
+	d := ThrottleDecision{MaxInFlight: stats.MaxInFlight, Concurrency: stats.Concurrency}
+	congested := stats.ErrorRate > maxErrorRate || (at.TargetLatency > 0 && stats.LatencyP99 > at.TargetLatency)
+	switch {
+	case congested:
+		d.MaxInFlight = decrease(stats.MaxInFlight)
+		d.Concurrency = decrease(stats.Concurrency)
+		d.Throttled = true
+	case stats.MessageInBuffer > stats.BufferLength/2:
+		d.MaxInFlight = decrease(stats.MaxInFlight)
+		d.Concurrency = stats.Concurrency + concurrencyStep
+		d.Throttled = true
+	default:
+		d.MaxInFlight = stats.MaxInFlight + inFlightStep
+		// only add worker when the messages are waiting in the buffer
+		if stats.MessageInBuffer > 0 {
+			d.Concurrency = stats.Concurrency + concurrencyStep
+		}
+	}
+	return d
+}
+
+// handlerStats record the latency and error of the handler
+type handlerStats struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+	handled   int
+	errors    int
+}
+
+func newHandlerStats() *handlerStats {
+	return &handlerStats{latencies: make([]time.Duration, 0, latencySamples)}
+}
+
+func (hs *handlerStats) observe(latency time.Duration, err error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	if len(hs.latencies) < latencySamples {
+		hs.latencies = append(hs.latencies, latency)
+	} else {
+		hs.latencies[hs.next] = latency
+		hs.next = (hs.next + 1) % latencySamples
+	}
+	hs.handled++
+	if err != nil {
+		hs.errors++
+	}
+}
+
+// collect the statistics into stats and reset the counter of handled and errors
+// the latencies are kept, so the percentiles are calculated from the latest messages
+func (hs *handlerStats) collect(stats *ThrottleStats) {
+	hs.mu.Lock()
+	latencies := append([]time.Duration(nil), hs.latencies...)
+	stats.Handled, stats.Errors = hs.handled, hs.errors
+	hs.handled, hs.errors = 0, 0
+	hs.mu.Unlock()
+
+	if stats.Handled > 0 {
+		stats.ErrorRate = float64(stats.Errors) / float64(stats.Handled)
+	}
+	if len(latencies) == 0 {
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	stats.LatencyP50 = percentile(latencies, 0.5)
+	stats.LatencyP99 = percentile(latencies, 0.99)
+}
+
+// percentile of sorted latencies
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(float64(len(latencies))*p)) - 1
+	if i < 0 {
+		i = 0
+	}
+	return latencies[i]
+}
+
+// throttle evaluate the handler every interval and apply the decision of the controller
+// until the handler is stopping
+func (dfh *defaultHandler) throttle(controller ThrottleController, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-dfh.stopChan:
+			return
+		case <-ticker.C:
+			dfh.applyThrottle(controller.Decide(dfh.throttleStats()))
+		}
+	}
+}
+
+func (dfh *defaultHandler) throttleStats() ThrottleStats {
+	dfh.mu.Lock()
+	stats := ThrottleStats{
+		Topic:           dfh.topic,
+		Channel:         dfh.channel,
+		MaxInFlight:     dfh.maxInFlight,
+		Concurrency:     dfh.concurrency,
+		MaxConcurrency:  dfh.maxConcurrency,
+		BufferLength:    dfh.buffLength,
+		MessageInBuffer: len(dfh.messageBuff),
+	}
+	dfh.mu.Unlock()
+	dfh.stats.collect(&stats)
+
+	_nsqThrottleLatencyGauge.WithLabelValues(dfh.topic, dfh.channel, "p50").Set(stats.LatencyP50.Seconds())
+	_nsqThrottleLatencyGauge.WithLabelValues(dfh.topic, dfh.channel, "p99").Set(stats.LatencyP99.Seconds())
+	_nsqThrottleErrorRateGauge.WithLabelValues(dfh.topic, dfh.channel).Set(stats.ErrorRate)
+	return stats
+}
+
+// applyThrottle change the max in flight of the backend and the number of workers
+func (dfh *defaultHandler) applyThrottle(d ThrottleDecision) {
+	if d.MaxInFlight < 1 {
+		d.MaxInFlight = 1
+	}
+	if d.MaxInFlight > dfh.buffLength {
+		d.MaxInFlight = dfh.buffLength
+	}
+
+	dfh.mu.Lock()
+	changed := d.MaxInFlight != dfh.maxInFlight
+	dfh.maxInFlight = d.MaxInFlight
+	dfh.mu.Unlock()
+	if changed {
+		dfh.consumerBackend.ChangeMaxInFlight(d.MaxInFlight)
+	}
+	concurrency := dfh.setConcurrency(d.Concurrency)
+	dfh.SetThrottle(d.Throttled)
+
+	throttled := 0
+	if d.Throttled {
+		throttled = 1
+	}
+	_nsqThrottleGauge.WithLabelValues(dfh.topic, dfh.channel).Set(float64(throttled))
+	_nsqThrottleMaxInFlightGauge.WithLabelValues(dfh.topic, dfh.channel).Set(float64(d.MaxInFlight))
+	_nsqThrottleConcurrencyGauge.WithLabelValues(dfh.topic, dfh.channel).Set(float64(concurrency))
+}
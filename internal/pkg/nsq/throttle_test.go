@@ -0,0 +1,172 @@
+package nsq
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/nsq/fakensq"
+)
+
+func TestAIMDThrottle(t *testing.T) {
+	t.Parallel()
+
+	at := AIMDThrottle{TargetLatency: time.Millisecond * 100}
+	stats := ThrottleStats{
+		MaxInFlight:    40,
+		Concurrency:    4,
+		MaxConcurrency: 8,
+		BufferLength:   100,
+	}
+
+	cases := []struct {
+		name   string
+		modify func(s ThrottleStats) ThrottleStats
+		expect ThrottleDecision
+	}{
+		{
+			name:   "healthy",
+			modify: func(s ThrottleStats) ThrottleStats { return s },
+			expect: ThrottleDecision{MaxInFlight: 50, Concurrency: 4},
+		},
+		{
+			name: "healthy with backlog",
+			modify: func(s ThrottleStats) ThrottleStats {
+				s.MessageInBuffer = 10
+				return s
+			},
+			expect: ThrottleDecision{MaxInFlight: 50, Concurrency: 5},
+		},
+		{
+			name: "high latency",
+			modify: func(s ThrottleStats) ThrottleStats {
+				s.LatencyP99 = time.Millisecond * 200
+				return s
+			},
+			expect: ThrottleDecision{MaxInFlight: 20, Concurrency: 2, Throttled: true},
+		},
+		{
+			name: "high error rate",
+			modify: func(s ThrottleStats) ThrottleStats {
+				s.ErrorRate = 0.5
+				return s
+			},
+			expect: ThrottleDecision{MaxInFlight: 20, Concurrency: 2, Throttled: true},
+		},
+		{
+			name: "buffer more than half full",
+			modify: func(s ThrottleStats) ThrottleStats {
+				s.MessageInBuffer = 60
+				return s
+			},
+			expect: ThrottleDecision{MaxInFlight: 20, Concurrency: 5, Throttled: true},
+		},
+	}
+
+	for _, c := range cases {
+		if d := at.Decide(c.modify(stats)); d != c.expect {
+			t.Errorf("%s: expecting %+v but got %+v", c.name, c.expect, d)
+			return
+		}
+	}
+}
+
+func TestHandlerStats(t *testing.T) {
+	t.Parallel()
+
+	hs := newHandlerStats()
+	for i := 1; i <= 100; i++ {
+		var err error
+		if i%10 == 0 {
+			err = context.DeadlineExceeded
+		}
+		hs.observe(time.Duration(i)*time.Millisecond, err)
+	}
+
+	stats := ThrottleStats{}
+	hs.collect(&stats)
+	if stats.Handled != 100 || stats.Errors != 10 || stats.ErrorRate != 0.1 {
+		t.Errorf("expecting 100 handled with 10 errors but got %+v", stats)
+		return
+	}
+	if stats.LatencyP50 != time.Millisecond*50 || stats.LatencyP99 != time.Millisecond*99 {
+		t.Errorf("expecting p50 50ms and p99 99ms but got %s and %s", stats.LatencyP50, stats.LatencyP99)
+		return
+	}
+
+	// the counter is reset, but the latencies are kept
+	stats = ThrottleStats{}
+	hs.collect(&stats)
+	if stats.Handled != 0 || stats.LatencyP99 != time.Millisecond*99 {
+		t.Errorf("expecting counter is reset and latencies are kept but got %+v", stats)
+		return
+	}
+}
+
+func TestThrottleController(t *testing.T) {
+	t.Parallel()
+
+	var (
+		topic   = "test_throttle_controller"
+		channel = "test_throttle_controller"
+		mu      sync.Mutex
+		handled int
+	)
+
+	consumer, err := fakensq.NewFakeConsumer(fakensq.ConsumerConfig{Topic: topic, Channel: channel})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	producer := fakensq.NewFakeProducer(consumer)
+
+	decision := ThrottleDecision{MaxInFlight: 3, Concurrency: 2, Throttled: true}
+	wc, err := WrapConsumers(ConsumerConfig{
+		LookupdsAddr:     []string{"testing"},
+		Concurrency:      4,
+		BufferMultiplier: 10,
+		Throttle: ThrottleControllerFunc(func(stats ThrottleStats) ThrottleDecision {
+			mu.Lock()
+			handled += stats.Handled
+			mu.Unlock()
+			return decision
+		}),
+		ThrottleInterval: time.Millisecond * 10,
+	}, consumer)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	wc.Handle(topic, channel, func(ctx context.Context, message *Message) error {
+		return nil
+	})
+	if err := wc.Start(); err != nil {
+		t.Error(err)
+		return
+	}
+	defer wc.Stop()
+
+	for i := 0; i < 5; i++ {
+		if err := producer.Publish(topic, []byte("throttle")); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	handler := wc.handlers[0]
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		h := handled
+		mu.Unlock()
+		handler.mu.Lock()
+		workerNumber, maxInFlight, throttle := handler.workerNumber, handler.maxInFlight, handler.throttle
+		handler.mu.Unlock()
+		if h == 5 && workerNumber == decision.Concurrency && maxInFlight == decision.MaxInFlight && throttle {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Errorf("throttle decision is not applied, expecting %+v", decision)
+}
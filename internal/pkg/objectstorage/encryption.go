@@ -0,0 +1,252 @@
+package objectstorage
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// list of encryption errors
+var (
+	ErrNoKeyProvider     = errors.New("objectstorage: object is encrypted but key provider is not set")
+	ErrInvalidEncryption = errors.New("objectstorage: invalid encryption metadata")
+	ErrChunkTooLarge     = errors.New("objectstorage: too many encrypted chunks")
+)
+
+// EncryptionAlgorithm is the algorithm used to encrypt the object
+// the object is split into chunks, and each chunk is encrypted using aes-256-gcm with the data key
+const EncryptionAlgorithm = "AES256-GCM-CHUNKED"
+
+// list of encryption metadata, stored in blob attributes alongside the object metadata
+const (
+	MetadataEncryptionAlgorithm = "encryption_algorithm"
+	MetadataEncryptionKeyID     = "encryption_key_id"
+	MetadataEncryptionKey       = "encryption_key"
+	MetadataEncryptionNonce     = "encryption_nonce"
+)
+
+const (
+	dataKeySize = 32
+	// chunkSize is the size of plaintext in one encrypted chunk
+	chunkSize = 64 * 1024
+	// the nonce of each chunk is {nonce_prefix}{chunk_counter}
+	noncePrefixSize = 8
+	// chunkOverhead is the size of gcm tag appended to each chunk
+	chunkOverhead = 16
+	// encryptedChunkSize is the size of encrypted chunk stored in the object
+	encryptedChunkSize = chunkSize + chunkOverhead
+)
+
+// KeyProvider encrypt and decrypt the data key of object using master key
+// the data key is generated for each object, and only the encrypted data key is stored
+type KeyProvider interface {
+	// KeyID return the id of master key used to encrypt new data key
+	KeyID() string
+	Encrypt(ctx context.Context, dataKey []byte) ([]byte, error)
+	// Decrypt the data key using the master key with keyID
+	Decrypt(ctx context.Context, keyID string, encryptedKey []byte) ([]byte, error)
+}
+
+// isEncrypted check whether the metadata belongs to an encrypted object
+func isEncrypted(metadata map[string]string) bool {
+	_, ok := metadata[MetadataEncryptionAlgorithm]
+	return ok
+}
+
+// encryptionMetadata is the list of metadata set by the storage when the object is encrypted
+var encryptionMetadata = []string{MetadataEncryptionAlgorithm, MetadataEncryptionKeyID, MetadataEncryptionKey, MetadataEncryptionNonce}
+
+// hasEncryptionMetadata check whether the metadata contains any of encryption metadata
+func hasEncryptionMetadata(metadata map[string]string) bool {
+	for _, k := range encryptionMetadata {
+		if _, ok := metadata[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutEncryptionMetadata return copy of metadata without the encryption metadata
+func withoutEncryptionMetadata(metadata map[string]string) map[string]string {
+	md := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		md[k] = v
+	}
+	for _, k := range encryptionMetadata {
+		delete(md, k)
+	}
+	return md
+}
+
+// encrypt return the reader of encrypted content and the metadata with encryption metadata
+func (s *Storage) encrypt(ctx context.Context, reader io.Reader, metadata map[string]string) (io.Reader, map[string]string, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	noncePrefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(noncePrefix); err != nil {
+		return nil, nil, err
+	}
+
+	encryptedKey, err := s.keyProvider.Encrypt(ctx, dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// copy the metadata, so the write options is not changed
+	md := make(map[string]string, len(metadata)+4)
+	for k, v := range metadata {
+		md[k] = v
+	}
+	md[MetadataEncryptionAlgorithm] = EncryptionAlgorithm
+	md[MetadataEncryptionKeyID] = s.keyProvider.KeyID()
+	md[MetadataEncryptionKey] = base64.StdEncoding.EncodeToString(encryptedKey)
+	md[MetadataEncryptionNonce] = base64.StdEncoding.EncodeToString(noncePrefix)
+
+	cr := &chunkReader{
+		src:         bufio.NewReaderSize(reader, chunkSize),
+		aead:        aead,
+		noncePrefix: noncePrefix,
+		size:        chunkSize,
+		encrypt:     true,
+	}
+	return cr, md, nil
+}
+
+// decrypt return the reader of decrypted content
+func (s *Storage) decrypt(ctx context.Context, reader io.Reader, metadata map[string]string) (io.Reader, error) {
+	return s.decryptFrom(ctx, reader, metadata, 0)
+}
+
+// decryptFrom return the reader of decrypted content, the reader starts from the chunk with the counter
+func (s *Storage) decryptFrom(ctx context.Context, reader io.Reader, metadata map[string]string, counter uint32) (io.Reader, error) {
+	if metadata[MetadataEncryptionAlgorithm] != EncryptionAlgorithm {
+		return nil, ErrInvalidEncryption
+	}
+	if s.keyProvider == nil {
+		return nil, ErrNoKeyProvider
+	}
+
+	encryptedKey, err := base64.StdEncoding.DecodeString(metadata[MetadataEncryptionKey])
+	if err != nil {
+		return nil, ErrInvalidEncryption
+	}
+	noncePrefix, err := base64.StdEncoding.DecodeString(metadata[MetadataEncryptionNonce])
+	if err != nil || len(noncePrefix) != noncePrefixSize {
+		return nil, ErrInvalidEncryption
+	}
+
+	dataKey, err := s.keyProvider.Decrypt(ctx, metadata[MetadataEncryptionKeyID], encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cr := &chunkReader{
+		src:         bufio.NewReaderSize(reader, encryptedChunkSize),
+		aead:        aead,
+		noncePrefix: noncePrefix,
+		size:        encryptedChunkSize,
+		counter:     counter,
+	}
+	return cr, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkReader encrypt or decrypt the source chunk by chunk, so the object is never fully loaded into memory
+// the last chunk is authenticated differently from other chunks, so a truncated object cannot be decrypted
+type chunkReader struct {
+	src         *bufio.Reader
+	aead        cipher.AEAD
+	noncePrefix []byte
+	// size of chunk read from the source
+	size    int
+	encrypt bool
+
+	counter uint32
+	buf     []byte
+	out     []byte
+	done    bool
+}
+
+func (c *chunkReader) Read(b []byte) (int, error) {
+	for len(c.out) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(b, c.out)
+	c.out = c.out[n:]
+	return n, nil
+}
+
+// next process the next chunk from the source
+func (c *chunkReader) next() error {
+	if c.buf == nil {
+		c.buf = make([]byte, c.size)
+	}
+
+	n, err := io.ReadFull(c.src, c.buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	// the chunk is the last chunk if there is nothing left in the source
+	last := err != nil
+	if !last {
+		if _, err := c.src.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if c.counter == ^uint32(0) {
+		return ErrChunkTooLarge
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	copy(nonce, c.noncePrefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], c.counter)
+	c.counter++
+
+	additionalData := []byte{0}
+	if last {
+		additionalData[0] = 1
+		c.done = true
+	}
+
+	if c.encrypt {
+		c.out = c.aead.Seal(c.out[:0], nonce, c.buf[:n], additionalData)
+		return nil
+	}
+
+	c.out, err = c.aead.Open(c.out[:0], nonce, c.buf[:n], additionalData)
+	if err != nil {
+		return ErrInvalidEncryption
+	}
+	return nil
+}
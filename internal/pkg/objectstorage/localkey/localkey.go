@@ -0,0 +1,114 @@
+// Package localkey is a key provider for object storage encryption using master key stored in local file
+// the master key is not protected, so it should only be used for development
+package localkey
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage"
+)
+
+var _ objectstorage.KeyProvider = (*Provider)(nil)
+
+// list of errors
+var (
+	ErrInvalidKey   = errors.New("localkey: master key must be 32 bytes encoded in hex")
+	ErrKeyNotFound  = errors.New("localkey: master key not found")
+	ErrInvalidInput = errors.New("localkey: invalid encrypted key")
+)
+
+// KeySize of master key
+const KeySize = 32
+
+// Provider of local master key
+type Provider struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// New key provider from key file, the file contains the master key encoded in hex
+func New(filename string) (*Provider, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	return NewFromKey(key)
+}
+
+// NewFromKey return new key provider from master key
+func NewFromKey(key []byte) (*Provider, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// the id is derived from the key, so the object encrypted using other key can be detected
+	sum := sha256.Sum256(key)
+	p := Provider{
+		id:   "local/" + hex.EncodeToString(sum[:8]),
+		aead: aead,
+	}
+	return &p, nil
+}
+
+// GenerateKeyFile generate new master key and write it to file
+func GenerateKeyFile(filename string) error {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, []byte(hex.EncodeToString(key)+"\n"), 0600)
+}
+
+// KeyID return the id of master key
+func (p *Provider) KeyID() string {
+	return p.id
+}
+
+// Encrypt the data key, the result is {nonce}{encrypted_key}
+func (p *Provider) Encrypt(ctx context.Context, dataKey []byte) ([]byte, error) {
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return p.aead.Seal(nonce, nonce, dataKey, []byte(p.id)), nil
+}
+
+// Decrypt the data key
+func (p *Provider) Decrypt(ctx context.Context, keyID string, encryptedKey []byte) ([]byte, error) {
+	if keyID != p.id {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
+	}
+	if len(encryptedKey) < p.aead.NonceSize() {
+		return nil, ErrInvalidInput
+	}
+
+	nonce := encryptedKey[:p.aead.NonceSize()]
+	dataKey, err := p.aead.Open(nil, nonce, encryptedKey[p.aead.NonceSize():], []byte(p.id))
+	if err != nil {
+		return nil, ErrInvalidInput
+	}
+	return dataKey, nil
+}
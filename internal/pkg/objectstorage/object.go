@@ -0,0 +1,226 @@
+package objectstorage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+// list of object errors
+var (
+	ErrObjectNotFound = errors.New("objectstorage: object not found")
+	ErrEmptyPrefix    = errors.New("objectstorage: prefix cannot be empty")
+)
+
+// DefaultPageSize of List
+const DefaultPageSize = 1000
+
+// Object in the bucket
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+	MD5     []byte
+}
+
+// ListOptions struct
+type ListOptions struct {
+	// PageSize is the maximum number of objects returned, default to DefaultPageSize
+	PageSize int
+	// PageToken to get the next page, use NextPageToken of previous result
+	PageToken string
+}
+
+// ListResult struct
+type ListResult struct {
+	Objects []Object
+	// NextPageToken is empty if there is no next page
+	NextPageToken string
+}
+
+// List objects with prefix, the objects are sorted by key
+// the objects of resumable upload are not listed unless the prefix is the upload prefix.
+// The blob library does not pass the page token to the provider, so every page is listed from the start of prefix
+// and the objects before the page token are skipped. Use Walk to iterate all objects in one listing
+func (s *Storage) List(ctx context.Context, prefix string, listOptions *ListOptions) (*ListResult, error) {
+	pageSize := DefaultPageSize
+	var pageToken string
+	if listOptions != nil {
+		if listOptions.PageSize > 0 {
+			pageSize = listOptions.PageSize
+		}
+		pageToken = listOptions.PageToken
+	}
+
+	result := ListResult{}
+	err := s.list(ctx, prefix, func(obj *blob.ListObject) bool {
+		// the page token is the last key of previous page, as the keys are listed in lexicographical order
+		if obj.Key <= pageToken {
+			return true
+		}
+		if len(result.Objects) == pageSize {
+			result.NextPageToken = result.Objects[pageSize-1].Key
+			return false
+		}
+		result.Objects = append(result.Objects, newObject(obj))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Walk call fn for each object with prefix and key greater than startAfter, the objects are sorted by key
+// the bucket is listed once, the walk is stopped and the error is returned when fn return error
+func (s *Storage) Walk(ctx context.Context, prefix, startAfter string, fn func(obj Object) error) error {
+	var fnErr error
+	err := s.list(ctx, prefix, func(obj *blob.ListObject) bool {
+		if obj.Key <= startAfter {
+			return true
+		}
+		fnErr = fn(newObject(obj))
+		return fnErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
+
+func newObject(obj *blob.ListObject) Object {
+	return Object{
+		Key:     obj.Key,
+		Size:    obj.Size,
+		ModTime: obj.ModTime,
+		MD5:     obj.MD5,
+	}
+}
+
+// list call fn for each object with prefix until fn return false
+func (s *Storage) list(ctx context.Context, prefix string, fn func(obj *blob.ListObject) bool) error {
+	hideUploads := !strings.HasPrefix(prefix, uploadPrefix)
+	iter := s.storage.Bucket().List(&blob.ListOptions{Prefix: prefix})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hideUploads && strings.HasPrefix(obj.Key, uploadPrefix) {
+			continue
+		}
+		if !fn(obj) {
+			return nil
+		}
+	}
+}
+
+// Exists check whether the object exists
+func (s *Storage) Exists(ctx context.Context, key string) (bool, error) {
+	return s.storage.Bucket().Exists(ctx, key)
+}
+
+// Delete the object, ErrObjectNotFound is returned if the object does not exist
+func (s *Storage) Delete(ctx context.Context, key string) error {
+	return notFound(s.storage.Bucket().Delete(ctx, key))
+}
+
+// DeleteByPrefix delete all objects with prefix and return the number of deleted objects
+// prefix cannot be empty to avoid deleting all objects in the bucket
+func (s *Storage) DeleteByPrefix(ctx context.Context, prefix string) (int, error) {
+	if prefix == "" {
+		return 0, ErrEmptyPrefix
+	}
+
+	// collect the keys first, as deleting objects while listing is not supported by all providers
+	keys := []string{}
+	err := s.list(ctx, prefix, func(obj *blob.ListObject) bool {
+		keys = append(keys, obj.Key)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, key := range keys {
+		if err := s.Delete(ctx, key); err != nil {
+			// the object might be deleted by other process
+			if errors.Is(err, ErrObjectNotFound) {
+				continue
+			}
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Copy the object from srcKey to dstKey, the metadata of the object is copied
+func (s *Storage) Copy(ctx context.Context, dstKey, srcKey string) error {
+	return notFound(s.storage.Bucket().Copy(ctx, dstKey, srcKey, nil))
+}
+
+// Move the object from srcKey to dstKey
+// the object is copied then deleted, as object storage does not support rename
+func (s *Storage) Move(ctx context.Context, dstKey, srcKey string) error {
+	if err := s.Copy(ctx, dstKey, srcKey); err != nil {
+		return err
+	}
+	return s.Delete(ctx, srcKey)
+}
+
+// UpdateMetadata replace the metadata of the object
+// object storage does not support changing the metadata, so the object is rewritten with the new metadata
+// the content is copied as stored, so encrypted object is not decrypted and its encryption metadata is kept
+func (s *Storage) UpdateMetadata(ctx context.Context, key string, metadata map[string]string) error {
+	bucket := s.storage.Bucket()
+	attrs, err := bucket.Attributes(ctx, key)
+	if err != nil {
+		return notFound(err)
+	}
+
+	md := withoutEncryptionMetadata(metadata)
+	if isEncrypted(attrs.Metadata) {
+		for _, k := range encryptionMetadata {
+			md[k] = attrs.Metadata[k]
+		}
+	}
+
+	reader, err := bucket.NewReader(ctx, key, nil)
+	if err != nil {
+		return notFound(err)
+	}
+	defer reader.Close()
+
+	_, err = s.write(ctx, key, reader, &WriteOptions{
+		ContentType:        attrs.ContentType,
+		ContentDisposition: attrs.ContentDisposition,
+		ContentEncoding:    attrs.ContentEncoding,
+		ContentLanguage:    attrs.ContentLanguage,
+		ContentMD5:         attrs.MD5,
+		Metadata:           md,
+	})
+	return err
+}
+
+// IsNotFound check whether the error is caused by the object that does not exist
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrObjectNotFound) || gcerrors.Code(err) == gcerrors.NotFound
+}
+
+// notFound convert not found error from provider to ErrObjectNotFound
+func notFound(err error) error {
+	if err != nil && gcerrors.Code(err) == gcerrors.NotFound {
+		return ErrObjectNotFound
+	}
+	return err
+}
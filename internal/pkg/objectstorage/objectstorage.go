@@ -44,7 +44,14 @@ type StorageProvider interface {
 
 // Storage struct
 type Storage struct {
-	storage StorageProvider
+	storage     StorageProvider
+	keyProvider KeyProvider
+}
+
+// Options of storage
+type Options struct {
+	// KeyProvider to encrypt the uploaded object, the object is not encrypted if nil
+	KeyProvider KeyProvider
 }
 
 // ReadOptions struct
@@ -71,11 +78,58 @@ type WriteOptions struct {
 	ContentMD5 []byte
 	// Key-value associated with the blob
 	Metadata map[string]string
+	// Progress is called every time a chunk is written to the storage
+	Progress ProgressFunc `json:"-"`
+}
+
+// ProgressFunc receive the total bytes written
+type ProgressFunc func(written int64)
+
+// progressWriter report the total bytes written after each write
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	progress ProgressFunc
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	if p.progress != nil {
+		p.progress(p.written)
+	}
+	return n, err
+}
+
+func writerOptions(writeOptions *WriteOptions) *blob.WriterOptions {
+	if writeOptions == nil {
+		return nil
+	}
+	return &blob.WriterOptions{
+		BufferSize:         writeOptions.BufferSize,
+		ContentType:        writeOptions.ContentType,
+		ContentDisposition: writeOptions.ContentDisposition,
+		ContentEncoding:    writeOptions.ContentEncoding,
+		ContentLanguage:    writeOptions.ContentLanguage,
+		ContentMD5:         writeOptions.ContentMD5,
+		Metadata:           writeOptions.Metadata,
+	}
 }
 
 // New artifact
 func New(storage StorageProvider) *Storage {
-	return &Storage{storage}
+	return NewWithOptions(storage, nil)
+}
+
+// NewWithOptions return new storage with options
+func NewWithOptions(storage StorageProvider, opts *Options) *Storage {
+	s := Storage{
+		storage: storage,
+	}
+	if opts != nil {
+		s.keyProvider = opts.KeyProvider
+	}
+	return &s
 }
 
 // Attributes return information/attributes of object
@@ -99,6 +153,7 @@ func (s *Storage) UploadFile(ctx context.Context, filepath, key string, writeOpt
 	if err != nil {
 		return "", err
 	}
+	defer f.Close()
 
 	return s.upload(ctx, key, f, writeOptions)
 }
@@ -118,6 +173,60 @@ func (s *Storage) Download(ctx context.Context, key string, readOptions *ReadOpt
 	return s.download(ctx, key, readOptions)
 }
 
+// DownloadRange return the reader of content from offset with length, the content is read until the end if length is negative
+// the offset and length is the position in the content before encrypted, use ContentSize to get the size of the content
+func (s *Storage) DownloadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	bucket := s.storage.Bucket()
+	attrs, err := bucket.Attributes(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !isEncrypted(attrs.Metadata) {
+		return bucket.NewRangeReader(ctx, key, offset, length, nil)
+	}
+
+	// the encrypted chunk can only be decrypted from the beginning of the chunk
+	// so the reader start from the chunk of the offset and skip the content before the offset
+	chunkOffset := offset / chunkSize
+	skip := offset % chunkSize
+	reader, err := bucket.NewRangeReader(ctx, key, chunkOffset*encryptedChunkSize, -1, nil)
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := s.decryptFrom(ctx, reader, attrs.Metadata, uint32(chunkOffset))
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	if _, err := io.CopyN(ioutil.Discard, decrypted, skip); err != nil {
+		reader.Close()
+		return nil, err
+	}
+	if length >= 0 {
+		decrypted = io.LimitReader(decrypted, length)
+	}
+	return readCloser{Reader: decrypted, Closer: reader}, nil
+}
+
+// IsEncrypted check whether the object is encrypted by the storage
+// the encrypted object can only be read through the storage with key provider, so it cannot be downloaded using signed url
+func IsEncrypted(attrs *blob.Attributes) bool {
+	return isEncrypted(attrs.Metadata)
+}
+
+// ContentSize return the size of the content of object, the size of encrypted object is the size before encrypted
+func ContentSize(attrs *blob.Attributes) int64 {
+	if !isEncrypted(attrs.Metadata) {
+		return attrs.Size
+	}
+	// every chunk is encrypted with overhead, and the last chunk always exists even for empty content
+	chunks := (attrs.Size + encryptedChunkSize - 1) / encryptedChunkSize
+	if chunks == 0 {
+		return 0
+	}
+	return attrs.Size - chunks*chunkOverhead
+}
+
 // DownloadFile will download and create file from object storage
 func (s *Storage) DownloadFile(ctx context.Context, key, destination string, readOptions *ReadOptions) error {
 	reader, err := s.download(ctx, key, readOptions)
@@ -160,65 +269,109 @@ func (s *Storage) DownloadByte(ctx context.Context, key string, readOptions *Rea
 }
 
 // upload content to object storage
+// the content is streamed to the storage, the provider split the content into chunks of BufferSize
+// and upload them as multipart upload, so the content is never fully loaded into memory
 // the function return the path of uploaded object and error
 func (s *Storage) upload(ctx context.Context, key string, reader io.Reader, writeOptions *WriteOptions) (string, error) {
-	uploadPath := path.Join(s.storage.BucketURL(), key)
-	blobBucket := s.storage.Bucket()
+	// the encryption metadata is set by the storage, the metadata from the caller must not mark the content as encrypted
+	if writeOptions != nil && hasEncryptionMetadata(writeOptions.Metadata) {
+		opts := *writeOptions
+		opts.Metadata = withoutEncryptionMetadata(opts.Metadata)
+		writeOptions = &opts
+	}
 
-	var (
-		result []byte
-		err    error
-		opts   *blob.WriterOptions
-	)
+	if s.keyProvider != nil {
+		opts := WriteOptions{}
+		if writeOptions != nil {
+			opts = *writeOptions
+		}
+		// md5 of the content cannot be used to check the encrypted content
+		opts.ContentMD5 = nil
 
-	if writeOptions != nil {
-		opts = &blob.WriterOptions{
-			BufferSize:         writeOptions.BufferSize,
-			ContentType:        writeOptions.ContentType,
-			ContentDisposition: writeOptions.ContentDisposition,
-			ContentEncoding:    writeOptions.ContentEncoding,
-			ContentLanguage:    writeOptions.ContentLanguage,
-			ContentMD5:         writeOptions.ContentMD5,
-			Metadata:           writeOptions.Metadata,
+		var err error
+		reader, opts.Metadata, err = s.encrypt(ctx, reader, opts.Metadata)
+		if err != nil {
+			return "", err
 		}
+		writeOptions = &opts
 	}
 
-	result, err = ioutil.ReadAll(reader)
+	_, err := s.write(ctx, key, reader, writeOptions)
 	if err != nil {
 		return "", err
 	}
+	return path.Join(s.storage.BucketURL(), key), nil
+}
+
+// write stream the content to object storage and return the number of bytes written
+func (s *Storage) write(ctx context.Context, key string, reader io.Reader, writeOptions *WriteOptions) (int64, error) {
+	// the write is aborted by cancelling the context
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	nw, err := blobBucket.NewWriter(ctx, key, opts)
+	nw, err := s.storage.Bucket().NewWriter(ctx, key, writerOptions(writeOptions))
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 
-	_, err = nw.Write(result)
-	if err != nil {
-		return "", err
+	pw := &progressWriter{w: nw}
+	if writeOptions != nil {
+		pw.progress = writeOptions.Progress
+	}
+
+	if _, err := io.Copy(pw, reader); err != nil {
+		// abort the write, so incomplete object is not created
+		cancel()
+		nw.Close()
+		return 0, err
 	}
 
 	// writer is asynchronous
 	// need to close to make sure writer is error or not
 	if err := nw.Close(); err != nil {
-		return "", err
+		return 0, err
 	}
-	return uploadPath, err
+	return pw.written, nil
 }
 
-func (s *Storage) download(ctx context.Context, key string, readOptions *ReadOptions) (*blob.Reader, error) {
-	var (
-		opts *blob.ReaderOptions
-		err  error
-	)
-
+// download return the reader of object, the object is decrypted if it is encrypted
+func (s *Storage) download(ctx context.Context, key string, readOptions *ReadOptions) (io.ReadCloser, error) {
+	var opts *blob.ReaderOptions
 	if readOptions != nil {
 		opts = &blob.ReaderOptions{}
 	}
 
+	// check the attributes first, so the encrypted content is never returned as is
 	bucket := s.storage.Bucket()
+	attrs, err := bucket.Attributes(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := isEncrypted(attrs.Metadata)
+	if encrypted && s.keyProvider == nil {
+		return nil, ErrNoKeyProvider
+	}
+
 	reader, err := bucket.NewReader(ctx, key, opts)
-	return reader, err
+	if err != nil {
+		return nil, err
+	}
+	// object that uploaded before the encryption is enabled is not encrypted
+	if !encrypted {
+		return reader, nil
+	}
+
+	decrypted, err := s.decrypt(ctx, reader, attrs.Metadata)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return readCloser{Reader: decrypted, Closer: reader}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
 }
 
 // Name of provider
@@ -233,6 +386,17 @@ func (s *Storage) BucketName() string {
 	return s.storage.BucketName()
 }
 
+// Ping check whether the bucket is reachable
+// the check is done by asking the existence of a key that might not exists,
+// a missing key is not an error, but a connection or permission problem is
+func (s *Storage) Ping(ctx context.Context) error {
+	_, err := s.storage.Bucket().Exists(ctx, pingKey)
+	return err
+}
+
+// pingKey is the key used to check the bucket availability
+const pingKey = ".ping"
+
 // Close will close the object storage bucket and return error
 func (s *Storage) Close() error {
 	return s.storage.Close()
@@ -263,17 +427,5 @@ func (s *Stream) Reader(ctx context.Context, key string, readOptions *ReadOption
 
 // Writer return blob writer
 func (s *Stream) Writer(ctx context.Context, key string, writeOptions *WriteOptions) (*blob.Writer, error) {
-	var opts *blob.WriterOptions
-	if writeOptions != nil {
-		opts = &blob.WriterOptions{
-			BufferSize:         writeOptions.BufferSize,
-			ContentType:        writeOptions.ContentType,
-			ContentDisposition: writeOptions.ContentDisposition,
-			ContentEncoding:    writeOptions.ContentEncoding,
-			ContentLanguage:    writeOptions.ContentLanguage,
-			ContentMD5:         writeOptions.ContentMD5,
-			Metadata:           writeOptions.Metadata,
-		}
-	}
-	return s.bucket.NewWriter(ctx, key, opts)
+	return s.bucket.NewWriter(ctx, key, writerOptions(writeOptions))
 }
@@ -5,14 +5,18 @@ package objectstorage_test
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage"
 	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage/local"
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage/localkey"
 )
 
 // File struct
@@ -255,3 +259,375 @@ func TestDownloadFile(t *testing.T) {
 		os.Remove(c.Key)
 	}
 }
+
+func TestUploadProgress(t *testing.T) {
+	content := bytes.Repeat([]byte("haloha"), 10000)
+
+	var written int64
+	_, err := localStorage.Upload(context.TODO(), bytes.NewReader(content), "progress.txt", &objectstorage.WriteOptions{
+		Progress: func(n int64) {
+			written = n
+		},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer func() {
+		os.Remove("./testbucket/progress.txt")
+		os.Remove("./testbucket/progress.txt.attrs")
+	}()
+
+	if written != int64(len(content)) {
+		t.Errorf("expecting %d bytes written but got %d", len(content), written)
+		return
+	}
+}
+
+func TestResumableUpload(t *testing.T) {
+	defer os.RemoveAll("./testbucket/.uploads")
+
+	u, err := localStorage.CreateUpload(context.TODO(), "resumable.txt", &objectstorage.WriteOptions{ContentType: "text/plain"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// the parts can be uploaded in any order
+	if _, err := localStorage.UploadPart(context.TODO(), u.ID, 2, bytes.NewBufferString("world")); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := localStorage.CompleteUpload(context.TODO(), u.ID); !errors.Is(err, objectstorage.ErrMissingPart) {
+		t.Errorf("expecting error %v but got %v", objectstorage.ErrMissingPart, err)
+		return
+	}
+
+	// resume the upload from the missing part
+	u, err = localStorage.GetUpload(context.TODO(), u.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(u.Parts) != 1 || u.Parts[0].Number != 2 {
+		t.Errorf("expecting part 2 to be uploaded but got %+v", u.Parts)
+		return
+	}
+	if _, err := localStorage.UploadPart(context.TODO(), u.ID, 1, bytes.NewBufferString("hello ")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := localStorage.CompleteUpload(context.TODO(), u.ID); err != nil {
+		t.Error(err)
+		return
+	}
+	defer func() {
+		os.Remove("./testbucket/resumable.txt")
+		os.Remove("./testbucket/resumable.txt.attrs")
+	}()
+
+	b, err := localStorage.DownloadByte(context.TODO(), "resumable.txt", nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(b) != "hello world" {
+		t.Errorf("expecting hello world but got %s", string(b))
+		return
+	}
+
+	// the upload is removed after completed
+	if _, err := localStorage.GetUpload(context.TODO(), u.ID); !errors.Is(err, objectstorage.ErrUploadNotFound) {
+		t.Errorf("expecting error %v but got %v", objectstorage.ErrUploadNotFound, err)
+		return
+	}
+}
+
+func TestObjectOperations(t *testing.T) {
+	defer os.RemoveAll("./testbucket/operations")
+
+	for _, key := range []string{"operations/a.txt", "operations/b.txt", "operations/c.txt"} {
+		if _, err := localStorage.UploadByte(context.TODO(), []byte(key), key, nil); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	// list with pagination
+	keys := []string{}
+	listOptions := &objectstorage.ListOptions{PageSize: 2}
+	for {
+		result, err := localStorage.List(context.TODO(), "operations/", listOptions)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for _, obj := range result.Objects {
+			keys = append(keys, obj.Key)
+		}
+		if result.NextPageToken == "" {
+			break
+		}
+		listOptions.PageToken = result.NextPageToken
+	}
+	if !reflect.DeepEqual(keys, []string{"operations/a.txt", "operations/b.txt", "operations/c.txt"}) {
+		t.Errorf("unexpected list result %v", keys)
+		return
+	}
+
+	// walk after a key
+	keys = []string{}
+	err := localStorage.Walk(context.TODO(), "operations/", "operations/a.txt", func(obj objectstorage.Object) error {
+		keys = append(keys, obj.Key)
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(keys, []string{"operations/b.txt", "operations/c.txt"}) {
+		t.Errorf("unexpected walk result %v", keys)
+		return
+	}
+	errStop := errors.New("stop")
+	keys = []string{}
+	err = localStorage.Walk(context.TODO(), "operations/", "", func(obj objectstorage.Object) error {
+		keys = append(keys, obj.Key)
+		return errStop
+	})
+	if err != errStop || len(keys) != 1 {
+		t.Errorf("expecting walk to stop with error %v after one object but got %v and %v", errStop, err, keys)
+		return
+	}
+
+	if err := localStorage.Copy(context.TODO(), "operations/copy/a.txt", "operations/a.txt"); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := localStorage.Move(context.TODO(), "operations/move/b.txt", "operations/b.txt"); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := localStorage.Delete(context.TODO(), "operations/c.txt"); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := localStorage.Delete(context.TODO(), "operations/c.txt"); !errors.Is(err, objectstorage.ErrObjectNotFound) {
+		t.Errorf("expecting error %v but got %v", objectstorage.ErrObjectNotFound, err)
+		return
+	}
+
+	cases := []struct {
+		key    string
+		exists bool
+	}{
+		{key: "operations/a.txt", exists: true},
+		{key: "operations/copy/a.txt", exists: true},
+		{key: "operations/b.txt", exists: false},
+		{key: "operations/move/b.txt", exists: true},
+		{key: "operations/c.txt", exists: false},
+	}
+	for _, c := range cases {
+		exists, err := localStorage.Exists(context.TODO(), c.key)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if exists != c.exists {
+			t.Errorf("%s: expecting exists %v but got %v", c.key, c.exists, exists)
+			return
+		}
+	}
+
+	deleted, err := localStorage.DeleteByPrefix(context.TODO(), "operations/")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if deleted != 3 {
+		t.Errorf("expecting 3 objects deleted but got %d", deleted)
+		return
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	defer os.RemoveAll("./testbucket/encryption")
+
+	key := make([]byte, localkey.KeySize)
+	rand.Read(key)
+	keyProvider, err := localkey.NewFromKey(key)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	l, err := local.New(context.Background(), "./testbucket/", nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	encryptedStorage := objectstorage.NewWithOptions(l, &objectstorage.Options{KeyProvider: keyProvider})
+
+	large := make([]byte, 200*1024)
+	rand.Read(large)
+	cases := []struct {
+		key     string
+		content []byte
+	}{
+		{key: "encryption/empty.txt", content: []byte{}},
+		{key: "encryption/small.txt", content: []byte("haloha")},
+		{key: "encryption/large.bin", content: large},
+	}
+
+	for _, c := range cases {
+		_, err := encryptedStorage.Upload(context.TODO(), bytes.NewReader(c.content), c.key, &objectstorage.WriteOptions{
+			Metadata: map[string]string{"access_owner": "allowed:abc"},
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		// the stored content is encrypted
+		stream, err := localStorage.Stream(context.TODO(), c.key, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		reader, err := stream.Reader(context.TODO(), c.key, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		raw, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(c.content) > 0 && bytes.Contains(raw, c.content) {
+			t.Errorf("%s: content is not encrypted", c.key)
+			return
+		}
+		attrs, err := encryptedStorage.Attributes(context.TODO(), c.key)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if attrs.Metadata["access_owner"] != "allowed:abc" || attrs.Metadata[objectstorage.MetadataEncryptionKeyID] != keyProvider.KeyID() {
+			t.Errorf("%s: unexpected metadata %v", c.key, attrs.Metadata)
+			return
+		}
+
+		b, err := encryptedStorage.DownloadByte(context.TODO(), c.key, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !bytes.Equal(b, c.content) {
+			t.Errorf("%s: decrypted content doesn't match", c.key)
+			return
+		}
+		if size := objectstorage.ContentSize(attrs); size != int64(len(c.content)) {
+			t.Errorf("%s: expecting content size %d but got %d", c.key, len(c.content), size)
+			return
+		}
+
+		// the range is read from the middle of the chunk
+		offset, length := int64(len(c.content)/3), int64(len(c.content)/2)
+		rc, err := encryptedStorage.DownloadRange(context.TODO(), c.key, offset, length)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		b, err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !bytes.Equal(b, c.content[offset:offset+length]) {
+			t.Errorf("%s: decrypted range doesn't match", c.key)
+			return
+		}
+	}
+
+	// object that is not encrypted can still be downloaded
+	b, err := encryptedStorage.DownloadByte(context.TODO(), "testdownload.txt", nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(b) != "haloha" {
+		t.Error("content doesn't match")
+		return
+	}
+	rc, err := encryptedStorage.DownloadRange(context.TODO(), "testdownload.txt", 1, 3)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	b, err = ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(b) != "alo" {
+		t.Errorf("expecting range alo but got %s, %v", string(b), err)
+		return
+	}
+
+	// encrypted object cannot be downloaded without key provider
+	if _, err := localStorage.DownloadByte(context.TODO(), "encryption/small.txt", nil); !errors.Is(err, objectstorage.ErrNoKeyProvider) {
+		t.Errorf("expecting error %v but got %v", objectstorage.ErrNoKeyProvider, err)
+		return
+	}
+	if _, err := localStorage.DownloadRange(context.TODO(), "encryption/small.txt", 0, -1); !errors.Is(err, objectstorage.ErrNoKeyProvider) {
+		t.Errorf("expecting error %v but got %v", objectstorage.ErrNoKeyProvider, err)
+		return
+	}
+
+	// the encryption metadata from the caller is ignored, so the content is always encrypted by the storage
+	spoofed := map[string]string{
+		objectstorage.MetadataEncryptionAlgorithm: objectstorage.EncryptionAlgorithm,
+		objectstorage.MetadataEncryptionKeyID:     "spoofed",
+	}
+	spoofedCases := []struct {
+		storage     *objectstorage.Storage
+		expectKeyID string
+	}{
+		{storage: encryptedStorage, expectKeyID: keyProvider.KeyID()},
+		{storage: localStorage, expectKeyID: ""},
+	}
+	for _, c := range spoofedCases {
+		_, err := c.storage.UploadByte(context.TODO(), []byte("haloha"), "encryption/spoofed.txt", &objectstorage.WriteOptions{Metadata: spoofed})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		attrs, err := c.storage.Attributes(context.TODO(), "encryption/spoofed.txt")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if attrs.Metadata[objectstorage.MetadataEncryptionKeyID] != c.expectKeyID {
+			t.Errorf("expecting encryption key id %q but got %v", c.expectKeyID, attrs.Metadata)
+			return
+		}
+		b, err := c.storage.DownloadByte(context.TODO(), "encryption/spoofed.txt", nil)
+		if err != nil || string(b) != "haloha" {
+			t.Errorf("expecting content haloha but got %s, %v", string(b), err)
+			return
+		}
+	}
+
+	// object cannot be decrypted using other key
+	rand.Read(key)
+	otherKeyProvider, err := localkey.NewFromKey(key)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	otherStorage := objectstorage.NewWithOptions(l, &objectstorage.Options{KeyProvider: otherKeyProvider})
+	if _, err := otherStorage.DownloadByte(context.TODO(), "encryption/small.txt", nil); !errors.Is(err, localkey.ErrKeyNotFound) {
+		t.Errorf("expecting error %v but got %v", localkey.ErrKeyNotFound, err)
+		return
+	}
+}
@@ -0,0 +1,370 @@
+// Package replicate copy objects between two object storages, the storages can use different providers
+// every object is verified using md5 checksum, and the progress is saved in checkpoint file
+// so the replication can be resumed when it is stopped
+package replicate
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage"
+	"gocloud.dev/gcerrors"
+)
+
+// list of replicate errors
+var (
+	ErrNilStorage         = errors.New("replicate: storage cannot be nil")
+	ErrChecksumMismatch   = errors.New("replicate: checksum mismatch")
+	ErrCheckpointMismatch = errors.New("replicate: checkpoint belongs to different source, destination or prefix")
+)
+
+// DefaultConcurrency is the default number of objects copied concurrently
+const DefaultConcurrency = 4
+
+// checkpointInterval is the number of finished objects before the checkpoint is saved
+const checkpointInterval = 100
+
+// list of object status
+const (
+	StatusCopied  = "copied"
+	StatusSkipped = "skipped"
+	StatusFailed  = "failed"
+)
+
+// Options of replicator
+type Options struct {
+	// Prefix of objects to copy, all objects are copied if empty
+	Prefix string
+	// Concurrency is the number of objects copied concurrently, default to DefaultConcurrency
+	Concurrency int
+	// CheckpointFile to save the progress, the replication is not resumable if empty
+	CheckpointFile string
+	// OnObject is called every time an object is finished
+	OnObject func(key, status string, err error)
+}
+
+// Result of replication
+type Result struct {
+	Copied  int
+	Skipped int
+	Failed  int
+	// Bytes is the total size of copied objects
+	Bytes int64
+}
+
+// Replicator copy objects from source to destination
+type Replicator struct {
+	src  *objectstorage.Storage
+	dst  *objectstorage.Storage
+	opts Options
+}
+
+// Checkpoint of replication
+// all objects with key less than or equal to LastKey are already replicated
+type Checkpoint struct {
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Prefix      string    `json:"prefix"`
+	LastKey     string    `json:"last_key"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// New replicator
+func New(src, dst *objectstorage.Storage, opts *Options) (*Replicator, error) {
+	if src == nil || dst == nil {
+		return nil, ErrNilStorage
+	}
+
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultConcurrency
+	}
+
+	r := Replicator{
+		src:  src,
+		dst:  dst,
+		opts: o,
+	}
+	return &r, nil
+}
+
+type job struct {
+	seq int
+	obj objectstorage.Object
+}
+
+type done struct {
+	seq    int
+	key    string
+	status string
+	size   int64
+	err    error
+}
+
+// Run the replication, the replication is resumed from the checkpoint if exists
+// objects that are failed to copy are reported in the result, and the error of the first failed object is returned
+func (r *Replicator) Run(ctx context.Context) (*Result, error) {
+	checkpoint, err := r.loadCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan job)
+	dones := make(chan done)
+	listErr := make(chan error, 1)
+
+	// list the objects in lexicographical order in one pass, starting after the last key in checkpoint
+	go func() {
+		defer close(jobs)
+		seq := 0
+		listErr <- r.src.Walk(ctx, r.opts.Prefix, checkpoint.LastKey, func(obj objectstorage.Object) error {
+			select {
+			case jobs <- job{seq: seq, obj: obj}:
+				seq++
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < r.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				status, err := r.copy(ctx, j.obj)
+				select {
+				case dones <- done{seq: j.seq, key: j.obj.Key, status: status, size: j.obj.Size, err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(dones)
+	}()
+
+	var (
+		result   Result
+		firstErr error
+		// the checkpoint only move forward when all previous objects are finished without error
+		next     int
+		finished = make(map[int]done)
+		stalled  bool
+		count    int
+	)
+	for d := range dones {
+		switch d.status {
+		case StatusCopied:
+			result.Copied++
+			result.Bytes += d.size
+		case StatusSkipped:
+			result.Skipped++
+		case StatusFailed:
+			result.Failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("replicate: failed to copy %s: %w", d.key, d.err)
+			}
+		}
+		if r.opts.OnObject != nil {
+			r.opts.OnObject(d.key, d.status, d.err)
+		}
+
+		// the checkpoint can't move after a failed object, so only buffer the finished objects until then
+		if !stalled {
+			finished[d.seq] = d
+		}
+		for !stalled {
+			f, ok := finished[next]
+			if !ok {
+				break
+			}
+			if f.status == StatusFailed {
+				stalled = true
+				finished = nil
+				break
+			}
+			checkpoint.LastKey = f.key
+			delete(finished, next)
+			next++
+		}
+
+		count++
+		if count%checkpointInterval == 0 {
+			if err := r.saveCheckpoint(checkpoint); err != nil {
+				return &result, err
+			}
+		}
+	}
+
+	if err := r.saveCheckpoint(checkpoint); err != nil {
+		return &result, err
+	}
+	if err := <-listErr; err != nil {
+		return &result, err
+	}
+	return &result, firstErr
+}
+
+// copy the object from source to destination, the object is skipped if the destination already has the same content
+func (r *Replicator) copy(ctx context.Context, obj objectstorage.Object) (string, error) {
+	srcAttrs, err := r.src.Attributes(ctx, obj.Key)
+	if err != nil {
+		return StatusFailed, err
+	}
+
+	dstAttrs, err := r.dst.Attributes(ctx, obj.Key)
+	if err != nil && gcerrors.Code(err) != gcerrors.NotFound {
+		return StatusFailed, err
+	}
+	if err == nil && len(srcAttrs.MD5) > 0 && bytes.Equal(srcAttrs.MD5, dstAttrs.MD5) {
+		return StatusSkipped, nil
+	}
+
+	// the object is copied as stored using the stream, so encrypted object is not decrypted
+	// and is not encrypted again by the destination, the encryption metadata is copied with the object
+	srcStream, err := r.src.Stream(ctx, obj.Key, nil)
+	if err != nil {
+		return StatusFailed, err
+	}
+	reader, err := srcStream.Reader(ctx, obj.Key, nil)
+	if err != nil {
+		return StatusFailed, err
+	}
+	defer reader.Close()
+
+	// calculate the checksum while streaming the object, so the object is only read once
+	hash := md5.New()
+	writeOptions := &objectstorage.WriteOptions{
+		ContentType:        srcAttrs.ContentType,
+		ContentDisposition: srcAttrs.ContentDisposition,
+		ContentEncoding:    srcAttrs.ContentEncoding,
+		ContentLanguage:    srcAttrs.ContentLanguage,
+		ContentMD5:         srcAttrs.MD5,
+		Metadata:           srcAttrs.Metadata,
+	}
+	if err := r.write(ctx, obj.Key, io.TeeReader(reader, hash), writeOptions); err != nil {
+		return StatusFailed, err
+	}
+	checksum := hash.Sum(nil)
+
+	if len(srcAttrs.MD5) > 0 && !bytes.Equal(checksum, srcAttrs.MD5) {
+		return StatusFailed, ErrChecksumMismatch
+	}
+	dstAttrs, err = r.dst.Attributes(ctx, obj.Key)
+	if err != nil {
+		return StatusFailed, err
+	}
+	// some providers does not return md5, for example multipart upload in s3
+	if len(dstAttrs.MD5) > 0 && !bytes.Equal(checksum, dstAttrs.MD5) {
+		return StatusFailed, ErrChecksumMismatch
+	}
+	if dstAttrs.Size != srcAttrs.Size {
+		return StatusFailed, ErrChecksumMismatch
+	}
+	return StatusCopied, nil
+}
+
+// write the content to destination as is
+func (r *Replicator) write(ctx context.Context, key string, reader io.Reader, writeOptions *objectstorage.WriteOptions) error {
+	// the write is aborted by cancelling the context
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dstStream, err := r.dst.Stream(ctx, key, writeOptions)
+	if err != nil {
+		return err
+	}
+	writer, err := dstStream.Writer(ctx, key, writeOptions)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, reader); err != nil {
+		// abort the write, so incomplete object is not created
+		cancel()
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+func (r *Replicator) newCheckpoint() Checkpoint {
+	return Checkpoint{
+		Source:      r.src.Name() + "://" + r.src.BucketName(),
+		Destination: r.dst.Name() + "://" + r.dst.BucketName(),
+		Prefix:      r.opts.Prefix,
+	}
+}
+
+// loadCheckpoint return new checkpoint if the checkpoint file does not exist
+func (r *Replicator) loadCheckpoint() (Checkpoint, error) {
+	checkpoint := r.newCheckpoint()
+	if r.opts.CheckpointFile == "" {
+		return checkpoint, nil
+	}
+
+	data, err := ioutil.ReadFile(r.opts.CheckpointFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return checkpoint, nil
+		}
+		return checkpoint, err
+	}
+
+	saved := Checkpoint{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return checkpoint, fmt.Errorf("replicate: invalid checkpoint file: %w", err)
+	}
+	if saved.Source != checkpoint.Source || saved.Destination != checkpoint.Destination || saved.Prefix != checkpoint.Prefix {
+		return checkpoint, ErrCheckpointMismatch
+	}
+	return saved, nil
+}
+
+// saveCheckpoint write the checkpoint to temporary file and rename it, so the checkpoint file is never half written
+func (r *Replicator) saveCheckpoint(checkpoint Checkpoint) error {
+	if r.opts.CheckpointFile == "" {
+		return nil
+	}
+
+	checkpoint.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(r.opts.CheckpointFile), filepath.Base(r.opts.CheckpointFile)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.opts.CheckpointFile)
+}
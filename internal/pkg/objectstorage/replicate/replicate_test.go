@@ -0,0 +1,238 @@
+package replicate
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage"
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage/local"
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage/localkey"
+)
+
+func newLocalStorage(t *testing.T, dir string) *objectstorage.Storage {
+	return newEncryptedStorage(t, dir, nil)
+}
+
+func newEncryptedStorage(t *testing.T, dir string, keyProvider objectstorage.KeyProvider) *objectstorage.Storage {
+	l, err := local.New(context.Background(), dir+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return objectstorage.NewWithOptions(l, &objectstorage.Options{KeyProvider: keyProvider})
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "replicate")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	src := newLocalStorage(t, filepath.Join(dir, "src"))
+	defer src.Close()
+	dst := newLocalStorage(t, filepath.Join(dir, "dst"))
+	defer dst.Close()
+
+	keys := []string{"user/ktp/a.jpg", "user/ktp/b.jpg", "user/avatar/c.jpg"}
+	for _, key := range keys {
+		_, err := src.UploadByte(context.Background(), []byte(key), key, &objectstorage.WriteOptions{
+			ContentType: "image/jpeg",
+			Metadata:    map[string]string{"access_owner": "allowed:abc;priviledge:read"},
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	checkpointFile := filepath.Join(dir, "checkpoint.json")
+	cases := []struct {
+		name             string
+		removeCheckpoint bool
+		expect           Result
+	}{
+		{name: "copy", expect: Result{Copied: 3, Bytes: 45}},
+		// resumed from checkpoint, so nothing to copy
+		{name: "resume", expect: Result{}},
+		// the objects already exist in destination with the same checksum
+		{name: "skip", removeCheckpoint: true, expect: Result{Skipped: 3}},
+	}
+
+	for _, c := range cases {
+		if c.removeCheckpoint {
+			os.Remove(checkpointFile)
+		}
+
+		r, err := New(src, dst, &Options{Concurrency: 2, CheckpointFile: checkpointFile})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		result, err := r.Run(context.Background())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if *result != c.expect {
+			t.Errorf("%s: expecting result %+v but got %+v", c.name, c.expect, *result)
+			return
+		}
+	}
+
+	for _, key := range keys {
+		attrs, err := dst.Attributes(context.Background(), key)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if attrs.ContentType != "image/jpeg" || attrs.Metadata["access_owner"] != "allowed:abc;priviledge:read" {
+			t.Errorf("%s: attributes are not preserved, got %+v", key, attrs)
+			return
+		}
+	}
+
+	// checkpoint of different prefix cannot be used
+	r, err := New(src, dst, &Options{Prefix: "user/ktp/", CheckpointFile: checkpointFile})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := r.Run(context.Background()); err != ErrCheckpointMismatch {
+		t.Errorf("expecting error %v but got %v", ErrCheckpointMismatch, err)
+		return
+	}
+}
+
+func TestRunEncrypted(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "replicate")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	key := make([]byte, localkey.KeySize)
+	rand.Read(key)
+	keyProvider, err := localkey.NewFromKey(key)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	src := newEncryptedStorage(t, filepath.Join(dir, "src"), keyProvider)
+	defer src.Close()
+	dst := newEncryptedStorage(t, filepath.Join(dir, "dst"), keyProvider)
+	defer dst.Close()
+
+	content := []byte("user/ktp/a.jpg")
+	if _, err := src.UploadByte(context.Background(), content, "user/ktp/a.jpg", nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	r, err := New(src, dst, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	result, err := r.Run(context.Background())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result.Copied != 1 {
+		t.Errorf("expecting 1 object copied but got %+v", *result)
+		return
+	}
+
+	// the object is copied as stored, so the destination has the same encrypted content and encryption metadata
+	srcAttrs, err := src.Attributes(context.Background(), "user/ktp/a.jpg")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	dstAttrs, err := dst.Attributes(context.Background(), "user/ktp/a.jpg")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if dstAttrs.Size != srcAttrs.Size || dstAttrs.Metadata[objectstorage.MetadataEncryptionKey] != srcAttrs.Metadata[objectstorage.MetadataEncryptionKey] {
+		t.Errorf("expecting the same encrypted object but got %+v and %+v", srcAttrs, dstAttrs)
+		return
+	}
+	b, err := dst.DownloadByte(context.Background(), "user/ktp/a.jpg", nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(b, content) {
+		t.Errorf("expecting content %s but got %s", content, b)
+		return
+	}
+}
+
+func TestRunFailed(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "replicate")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	src := newLocalStorage(t, filepath.Join(dir, "src"))
+	defer src.Close()
+	dst := newLocalStorage(t, filepath.Join(dir, "dst"))
+	defer dst.Close()
+
+	keys := []string{"a.txt", "b.txt", "c.txt", "d.txt"}
+	for _, key := range keys {
+		if _, err := src.UploadByte(context.Background(), []byte(key), key, nil); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	// change the content without changing the checksum in attributes, so the copy is failed
+	if err := ioutil.WriteFile(filepath.Join(dir, "src", "b.txt"), []byte("corrupted"), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+
+	checkpointFile := filepath.Join(dir, "checkpoint.json")
+	r, err := New(src, dst, &Options{Concurrency: 2, CheckpointFile: checkpointFile})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	result, err := r.Run(context.Background())
+	if err == nil {
+		t.Error("expecting error when an object is failed to copy")
+		return
+	}
+	if result.Copied != 3 || result.Failed != 1 {
+		t.Errorf("expecting 3 copied and 1 failed but got %+v", *result)
+		return
+	}
+
+	// the checkpoint stop before the failed object, so it is copied again on the next run
+	checkpoint, err := r.loadCheckpoint()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if checkpoint.LastKey != "a.txt" {
+		t.Errorf("expecting checkpoint last key a.txt but got %s", checkpoint.LastKey)
+		return
+	}
+}
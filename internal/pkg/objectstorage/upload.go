@@ -0,0 +1,271 @@
+package objectstorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+// list of resumable upload error
+var (
+	ErrUploadNotFound = errors.New("objectstorage: upload not found")
+	ErrInvalidPart    = errors.New("objectstorage: invalid part number")
+	ErrMissingPart    = errors.New("objectstorage: upload has missing part")
+)
+
+// MaxPartNumber is the maximum number of parts in resumable upload
+const MaxPartNumber = 10000
+
+// the parts of resumable upload are stored as objects under uploadPrefix/{upload_id}/
+// so the resumable upload works for all providers, and the parts are combined when the upload is completed
+const (
+	uploadPrefix       = ".uploads/"
+	uploadManifestName = "upload.json"
+	uploadPartPrefix   = "part-"
+)
+
+var uploadIDRegexp = regexp.MustCompile("^[0-9a-f]{32}$")
+
+// Upload is a resumable upload
+// client upload the parts of the content across requests using the upload id, and complete the upload when all parts are uploaded
+type Upload struct {
+	ID           string        `json:"id"`
+	Key          string        `json:"key"`
+	WriteOptions *WriteOptions `json:"write_options"`
+	CreatedAt    time.Time     `json:"created_at"`
+	// Parts that already uploaded, client can resume the upload from the missing part
+	Parts []Part `json:"-"`
+}
+
+// Part of resumable upload
+type Part struct {
+	Number int
+	Size   int64
+}
+
+// CreateUpload create a new resumable upload to key
+func (s *Storage) CreateUpload(ctx context.Context, key string, writeOptions *WriteOptions) (*Upload, error) {
+	id, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+
+	u := Upload{
+		ID:           id,
+		Key:          key,
+		WriteOptions: writeOptions,
+		CreatedAt:    time.Now(),
+	}
+	manifest, err := json.Marshal(u)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.write(ctx, uploadManifestKey(id), bytes.NewReader(manifest), nil); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// GetUpload return the resumable upload with its uploaded parts
+func (s *Storage) GetUpload(ctx context.Context, uploadID string) (*Upload, error) {
+	if !uploadIDRegexp.MatchString(uploadID) {
+		return nil, ErrUploadNotFound
+	}
+
+	manifest, err := s.storage.Bucket().ReadAll(ctx, uploadManifestKey(uploadID))
+	if err != nil {
+		if gcerrors.Code(err) == gcerrors.NotFound {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+	u := Upload{}
+	if err := json.Unmarshal(manifest, &u); err != nil {
+		return nil, err
+	}
+
+	partPrefix := uploadPrefix + uploadID + "/" + uploadPartPrefix
+	err = s.list(ctx, partPrefix, func(obj *blob.ListObject) bool {
+		number, err := strconv.Atoi(strings.TrimPrefix(obj.Key, partPrefix))
+		if err == nil {
+			u.Parts = append(u.Parts, Part{Number: number, Size: obj.Size})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(u.Parts, func(i, j int) bool {
+		return u.Parts[i].Number < u.Parts[j].Number
+	})
+	return &u, nil
+}
+
+// UploadPart upload a part of resumable upload, part number starts from 1
+// uploading the same part number again replace the previous part, so the client can retry a failed part
+func (s *Storage) UploadPart(ctx context.Context, uploadID string, number int, reader io.Reader) (*Part, error) {
+	if number < 1 || number > MaxPartNumber {
+		return nil, ErrInvalidPart
+	}
+	if err := s.uploadExists(ctx, uploadID); err != nil {
+		return nil, err
+	}
+
+	size, err := s.write(ctx, uploadPartKey(uploadID, number), reader, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Part{Number: number, Size: size}, nil
+}
+
+// CompleteUpload combine all parts into the upload key and remove the parts
+// the function return the path of uploaded object and error
+func (s *Storage) CompleteUpload(ctx context.Context, uploadID string) (string, error) {
+	u, err := s.GetUpload(ctx, uploadID)
+	if err != nil {
+		return "", err
+	}
+	if len(u.Parts) == 0 {
+		return "", ErrMissingPart
+	}
+	for i, part := range u.Parts {
+		if part.Number != i+1 {
+			return "", fmt.Errorf("%w: part %d", ErrMissingPart, i+1)
+		}
+	}
+
+	pr := &partsReader{
+		ctx:      ctx,
+		bucket:   s.storage.Bucket(),
+		uploadID: uploadID,
+		parts:    u.Parts,
+	}
+	defer pr.Close()
+
+	uploadPath, err := s.upload(ctx, u.Key, pr, u.WriteOptions)
+	if err != nil {
+		return "", err
+	}
+	if err := s.AbortUpload(ctx, uploadID); err != nil {
+		return "", err
+	}
+	return uploadPath, nil
+}
+
+// AbortUpload remove the resumable upload and its parts
+func (s *Storage) AbortUpload(ctx context.Context, uploadID string) error {
+	if !uploadIDRegexp.MatchString(uploadID) {
+		return ErrUploadNotFound
+	}
+
+	_, err := s.DeleteByPrefix(ctx, uploadPrefix+uploadID+"/")
+	return err
+}
+
+func (s *Storage) uploadExists(ctx context.Context, uploadID string) error {
+	if !uploadIDRegexp.MatchString(uploadID) {
+		return ErrUploadNotFound
+	}
+	exists, err := s.storage.Bucket().Exists(ctx, uploadManifestKey(uploadID))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUploadNotFound
+	}
+	return nil
+}
+
+// partsReader read the parts sequentially, the part is only opened when the previous part is finished
+type partsReader struct {
+	ctx      context.Context
+	bucket   *blob.Bucket
+	uploadID string
+	parts    []Part
+	current  *blob.Reader
+}
+
+func (p *partsReader) Read(b []byte) (int, error) {
+	for {
+		if p.current == nil {
+			if len(p.parts) == 0 {
+				return 0, io.EOF
+			}
+			r, err := p.bucket.NewReader(p.ctx, uploadPartKey(p.uploadID, p.parts[0].Number), nil)
+			if err != nil {
+				return 0, err
+			}
+			p.current = r
+			p.parts = p.parts[1:]
+		}
+
+		n, err := p.current.Read(b)
+		if err == io.EOF {
+			p.current.Close()
+			p.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (p *partsReader) Close() error {
+	if p.current == nil {
+		return nil
+	}
+	return p.current.Close()
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func uploadManifestKey(uploadID string) string {
+	return uploadPrefix + uploadID + "/" + uploadManifestName
+}
+
+func uploadPartKey(uploadID string, number int) string {
+	return fmt.Sprintf("%s%s/%s%05d", uploadPrefix, uploadID, uploadPartPrefix, number)
+}
+
+// AbortExpiredUploads remove the resumable uploads created before expiry and return the number of removed uploads
+func (s *Storage) AbortExpiredUploads(ctx context.Context, expiry time.Duration) (int, error) {
+	deadline := time.Now().Add(-expiry)
+	ids := []string{}
+	err := s.list(ctx, uploadPrefix, func(obj *blob.ListObject) bool {
+		if strings.HasSuffix(obj.Key, "/"+uploadManifestName) && obj.ModTime.Before(deadline) {
+			ids = append(ids, strings.TrimSuffix(strings.TrimPrefix(obj.Key, uploadPrefix), "/"+uploadManifestName))
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		if err := s.AbortUpload(ctx, id); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
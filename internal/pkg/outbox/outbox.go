@@ -0,0 +1,169 @@
+// Package outbox implements transactional outbox to publish events to nsq
+// the event is inserted into the outbox table in the same transaction with the data changes,
+// then the relay publish the event to nsq and mark the event as sent.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/nsq"
+	"github.com/albertwidi/go-project-example/internal/pkg/sqldb"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrNoTransaction returned when writing event without transaction in the context
+var ErrNoTransaction = errors.New("outbox: event must be written inside a transaction")
+
+// Record of outbox table
+type Record struct {
+	ID        string         `db:"id"`
+	Topic     string         `db:"topic"`
+	Body      []byte         `db:"body"`
+	Attempts  int            `db:"attempts"`
+	LastError sql.NullString `db:"last_error"`
+	CreatedAt time.Time      `db:"created_at"`
+	SentAt    sql.NullTime   `db:"sent_at"`
+	ParkedAt  sql.NullTime   `db:"parked_at"`
+}
+
+// Options of outbox
+type Options struct {
+	// ProducerID is the producer id in the envelope, the default is the hostname
+	ProducerID string
+}
+
+// Outbox to write events into outbox table
+type Outbox struct {
+	db         *sqldb.DB
+	producerID string
+}
+
+// New outbox
+func New(db *sqldb.DB, opts *Options) *Outbox {
+	o := Outbox{db: db}
+	if opts != nil {
+		o.producerID = opts.ProducerID
+	}
+	// use the hostname as nsq.Producer does
+	if o.producerID == "" {
+		o.producerID, _ = os.Hostname()
+	}
+	return &o
+}
+
+// WriteOptions of event
+type WriteOptions struct {
+	// IdempotencyKey of the message, the id of envelope is used if empty
+	IdempotencyKey string
+}
+
+// Write the payload inside an envelope into outbox table
+// the context must hold a transaction from sqldb.WithTx, so the event is only published if the transaction is committed.
+//
+// The event might be published more than once, for example when the relay failed to mark the event as sent,
+// so the handler should use the idempotency key of the envelope.
+func (o *Outbox) Write(ctx context.Context, topic string, payload nsq.Payload, opts *WriteOptions) error {
+	if _, ok := o.db.TxFromContext(ctx); !ok {
+		return ErrNoTransaction
+	}
+
+	e, err := nsq.NewEnvelope(ctx, o.producerID, payload)
+	if err != nil {
+		return err
+	}
+	if opts != nil && opts.IdempotencyKey != "" {
+		e.IdempotencyKey = opts.IdempotencyKey
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	query := o.db.Rebind("INSERT INTO outbox(id, topic, body, attempts, created_at) VALUES(?, ?, ?, 0, ?)")
+	if _, err := o.db.ExecContext(ctx, query, e.ID, topic, body, e.Timestamp); err != nil {
+		return fmt.Errorf("outbox: failed to write event %s: %w", e.Type, err)
+	}
+	return nil
+}
+
+// withTx run fn in a new transaction
+func (o *Outbox) withTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return o.db.WithTx(ctx, nil, func(ctx context.Context, tx *sqlx.Tx) error {
+		return fn(ctx)
+	})
+}
+
+// lockPending select the pending events and lock them until the transaction is done,
+// the events that already locked by other relay are skipped.
+func (o *Outbox) lockPending(ctx context.Context, limit int) ([]Record, error) {
+	var records []Record
+	query := o.db.Rebind(`SELECT id, topic, body, attempts, last_error, created_at, sent_at, parked_at FROM outbox
+		WHERE sent_at IS NULL AND parked_at IS NULL ORDER BY created_at LIMIT ? FOR UPDATE SKIP LOCKED`)
+	err := o.db.SelectContext(sqldb.WithQueryName(ctx, "select_outbox_pending"), &records, query, limit)
+	return records, err
+}
+
+// markSent mark the events as sent
+func (o *Outbox) markSent(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In("UPDATE outbox SET sent_at = ?, attempts = attempts + 1 WHERE id IN (?)", time.Now(), ids)
+	if err != nil {
+		return err
+	}
+	_, err = o.db.ExecContext(sqldb.WithQueryName(ctx, "update_outbox_sent"), o.db.Rebind(query), args...)
+	return err
+}
+
+// markFailed record the failed attempt to publish the event
+func (o *Outbox) markFailed(ctx context.Context, id string, reason string) error {
+	query := o.db.Rebind("UPDATE outbox SET attempts = attempts + 1, last_error = ? WHERE id = ?")
+	_, err := o.db.ExecContext(sqldb.WithQueryName(ctx, "update_outbox_failed"), query, reason, id)
+	return err
+}
+
+// park record the last failed attempt and park the event, so the event is no longer published by the relay
+func (o *Outbox) park(ctx context.Context, id string, reason string) error {
+	query := o.db.Rebind("UPDATE outbox SET attempts = attempts + 1, last_error = ?, parked_at = ? WHERE id = ?")
+	_, err := o.db.ExecContext(sqldb.WithQueryName(ctx, "update_outbox_parked"), query, reason, time.Now(), id)
+	return err
+}
+
+// purge delete at most limit events that sent before the time and return the number of deleted events
+func (o *Outbox) purge(ctx context.Context, before time.Time, limit int) (int64, error) {
+	query := o.db.Rebind("DELETE FROM outbox WHERE id IN (SELECT id FROM outbox WHERE sent_at < ? LIMIT ?)")
+	result, err := o.db.ExecContext(sqldb.WithQueryName(ctx, "delete_outbox_sent"), query, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// stats of the events that not yet published
+type stats struct {
+	// Pending is the number of events waiting to be published
+	Pending int64 `db:"pending"`
+	// Oldest is the creation time of the oldest pending event
+	Oldest sql.NullTime `db:"oldest"`
+	// Parked is the number of events that reach the maximum attempts
+	Parked int64 `db:"parked"`
+}
+
+// pending return the stats of events that not yet published, the parked events are not counted as pending
+func (o *Outbox) pending(ctx context.Context) (stats, error) {
+	var result stats
+	query := `SELECT COUNT(CASE WHEN parked_at IS NULL THEN 1 END) AS pending,
+		MIN(CASE WHEN parked_at IS NULL THEN created_at END) AS oldest,
+		COUNT(parked_at) AS parked
+		FROM outbox WHERE sent_at IS NULL`
+	// read from leader, because the follower might not have the latest sent events
+	err := o.db.GetContext(sqldb.WithLeader(ctx), &result, query)
+	return result, err
+}
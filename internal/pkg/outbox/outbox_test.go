@@ -0,0 +1,34 @@
+package outbox
+
+import (
+	"os"
+	"testing"
+)
+
+func TestNewProducerID(t *testing.T) {
+	t.Parallel()
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	cases := []struct {
+		name   string
+		opts   *Options
+		expect string
+	}{
+		{name: "nil options", opts: nil, expect: hostname},
+		{name: "empty producer id", opts: &Options{}, expect: hostname},
+		{name: "with producer id", opts: &Options{ProducerID: "invoice-1"}, expect: "invoice-1"},
+	}
+
+	for _, c := range cases {
+		o := New(nil, c.opts)
+		if o.producerID != c.expect {
+			t.Errorf("%s: expecting producer id %s but got %s", c.name, c.expect, o.producerID)
+			return
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/log/logger"
+	"github.com/albertwidi/go-project-example/internal/pkg/router"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// list of default relay options
+const (
+	DefaultBatchSize    = 100
+	DefaultPollInterval = time.Second
+	DefaultMaxAttempts  = 100
+	DefaultRetention    = time.Hour * 24 * 7
+)
+
+// list of purge configuration
+const (
+	// purgeInterval is the minimum interval between the purge of sent events
+	purgeInterval = time.Hour
+	// purgeBatchSize is the maximum number of sent events deleted in a statement
+	purgeBatchSize = 1000
+)
+
+var (
+	// prometheus metrics
+	_outboxPendingGauge    *prometheus.GaugeVec
+	_outboxLagGauge        *prometheus.GaugeVec
+	_outboxParkedGauge     *prometheus.GaugeVec
+	_outboxPurgedCount     *prometheus.CounterVec
+	_outboxPublishedCount  *prometheus.CounterVec
+	_outboxRelayErrorCount *prometheus.CounterVec
+)
+
+// throwing fatal if prometheus metrics cannot be registered
+func init() {
+	_outboxPendingGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "outbox_pending_events",
+		Help: "number of events in outbox that not yet published",
+	}, []string{"relay"})
+	if err := prometheus.Register(_outboxPendingGauge); err != nil {
+		if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			err = fmt.Errorf("error when registering outboxPendingGauge. err: %w", err)
+			log.Fatal(err)
+		}
+	}
+
+	_outboxLagGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "outbox_lag_seconds",
+		Help: "age of the oldest event in outbox that not yet published",
+	}, []string{"relay"})
+	if err := prometheus.Register(_outboxLagGauge); err != nil {
+		if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			err = fmt.Errorf("error when registering outboxLagGauge. err: %w", err)
+			log.Fatal(err)
+		}
+	}
+
+	_outboxParkedGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "outbox_parked_events",
+		Help: "number of events in outbox that parked after reaching the maximum attempts",
+	}, []string{"relay"})
+	if err := prometheus.Register(_outboxParkedGauge); err != nil {
+		if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			err = fmt.Errorf("error when registering outboxParkedGauge. err: %w", err)
+			log.Fatal(err)
+		}
+	}
+
+	_outboxPurgedCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "outbox_purged_total",
+		Help: "number of sent events deleted from outbox",
+	}, []string{"relay"})
+	if err := prometheus.Register(_outboxPurgedCount); err != nil {
+		if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			err = fmt.Errorf("error when registering outboxPurgedCount. err: %w", err)
+			log.Fatal(err)
+		}
+	}
+
+	_outboxPublishedCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "outbox_published_total",
+		Help: "number of events published by outbox relay for each topic and status",
+	}, []string{"relay", "topic", "status"})
+	if err := prometheus.Register(_outboxPublishedCount); err != nil {
+		if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			err = fmt.Errorf("error when registering outboxPublishedCount. err: %w", err)
+			log.Fatal(err)
+		}
+	}
+
+	_outboxRelayErrorCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "outbox_relay_error_total",
+		Help: "number of error when relaying events from outbox",
+	}, []string{"relay"})
+	if err := prometheus.Register(_outboxRelayErrorCount); err != nil {
+		if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			err = fmt.Errorf("error when registering outboxRelayErrorCount. err: %w", err)
+			log.Fatal(err)
+		}
+	}
+}
+
+// store of outbox events
+type store interface {
+	withTx(ctx context.Context, fn func(ctx context.Context) error) error
+	lockPending(ctx context.Context, limit int) ([]Record, error)
+	markSent(ctx context.Context, ids []string) error
+	markFailed(ctx context.Context, id string, reason string) error
+	park(ctx context.Context, id string, reason string) error
+	purge(ctx context.Context, before time.Time, limit int) (int64, error)
+	pending(ctx context.Context) (stats, error)
+}
+
+// publisher of events, for example nsq.Producer
+type publisher interface {
+	Publish(topic string, body []byte) error
+}
+
+// RelayOptions of relay
+type RelayOptions struct {
+	// Name of the relay, used in metrics
+	Name string
+	// BatchSize is the maximum number of events published in a transaction
+	BatchSize int
+	// PollInterval is the interval to check the pending events in outbox
+	PollInterval time.Duration
+	// MaxAttempts is the number of failed attempts before the event is parked, the event is never parked if negative
+	MaxAttempts int
+	// Retention is the duration to keep the sent events before purged, the sent events are never purged if negative
+	Retention time.Duration
+	// Logger to log error when relaying events, error is not logged if logger is nil
+	Logger logger.Logger
+}
+
+// Relay publish the pending events in outbox to nsq
+// more than one relay can run at the same time, because the events locked by a relay are skipped by the others.
+type Relay struct {
+	store     store
+	publisher publisher
+	options   RelayOptions
+
+	lastPurge time.Time
+
+	stopOnce sync.Once
+	stopChan chan struct{}
+	doneChan chan struct{}
+}
+
+// NewRelay create relay of outbox
+func NewRelay(outbox *Outbox, producer publisher, opts *RelayOptions) *Relay {
+	return newRelay(outbox, producer, opts)
+}
+
+func newRelay(s store, p publisher, opts *RelayOptions) *Relay {
+	options := RelayOptions{}
+	if opts != nil {
+		options = *opts
+	}
+	if options.Name == "" {
+		options.Name = "outbox"
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = DefaultPollInterval
+	}
+	if options.MaxAttempts == 0 {
+		options.MaxAttempts = DefaultMaxAttempts
+	}
+	if options.Retention == 0 {
+		options.Retention = DefaultRetention
+	}
+
+	r := Relay{
+		store:     s,
+		publisher: p,
+		options:   options,
+		stopChan:  make(chan struct{}),
+		doneChan:  make(chan struct{}),
+	}
+	return &r
+}
+
+// Run the relay until shutdown
+// the middlewares are not used, the parameter is needed to run the relay as server.Runner.
+func (r *Relay) Run(middlewares ...router.MiddlewareFunc) error {
+	defer close(r.doneChan)
+
+	ticker := time.NewTicker(r.options.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.relayAll()
+		r.purgeSent()
+		r.updateLag()
+
+		select {
+		case <-r.stopChan:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown the relay and wait for the current batch to be published
+func (r *Relay) Shutdown(ctx context.Context) error {
+	r.stopOnce.Do(func() {
+		close(r.stopChan)
+	})
+
+	select {
+	case <-r.doneChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// relayAll relay the pending events batch by batch until no more events left or the relay is stopped
+func (r *Relay) relayAll() {
+	for {
+		n, err := r.relay(context.Background())
+		if err != nil {
+			_outboxRelayErrorCount.WithLabelValues(r.options.Name).Add(1)
+			if r.options.Logger != nil {
+				r.options.Logger.Errorf("outbox: %s: failed to relay events: %v", r.options.Name, err)
+			}
+			return
+		}
+		if n < r.options.BatchSize {
+			return
+		}
+
+		select {
+		case <-r.stopChan:
+			return
+		default:
+		}
+	}
+}
+
+// relay publish a batch of pending events and return the number of events in the batch
+//
+// The events are published in order, so the relay stops at the first event that failed to be published
+// and the rest of the batch is published in the next poll. The events that already published are still marked as sent.
+// The event that reach the maximum attempts is parked instead, so it does not block the events after it.
+func (r *Relay) relay(ctx context.Context) (int, error) {
+	var (
+		n          int
+		publishErr error
+	)
+
+	err := r.store.withTx(ctx, func(ctx context.Context) error {
+		records, err := r.store.lockPending(ctx, r.options.BatchSize)
+		if err != nil {
+			return err
+		}
+		n = len(records)
+
+		sent := make([]string, 0, len(records))
+		for _, record := range records {
+			if err := r.publisher.Publish(record.Topic, record.Body); err != nil {
+				if r.options.MaxAttempts > 0 && record.Attempts+1 >= r.options.MaxAttempts {
+					_outboxPublishedCount.WithLabelValues(r.options.Name, record.Topic, "parked").Add(1)
+					if err := r.store.park(ctx, record.ID, err.Error()); err != nil {
+						return err
+					}
+					if r.options.Logger != nil {
+						r.options.Logger.Errorf("outbox: %s: event %s to %s is parked after %d attempts: %v", r.options.Name, record.ID, record.Topic, record.Attempts+1, err)
+					}
+					continue
+				}
+				_outboxPublishedCount.WithLabelValues(r.options.Name, record.Topic, "failed").Add(1)
+				publishErr = fmt.Errorf("outbox: failed to publish event %s to %s: %w", record.ID, record.Topic, err)
+				if err := r.store.markFailed(ctx, record.ID, err.Error()); err != nil {
+					return err
+				}
+				break
+			}
+			_outboxPublishedCount.WithLabelValues(r.options.Name, record.Topic, "sent").Add(1)
+			sent = append(sent, record.ID)
+		}
+		return r.store.markSent(ctx, sent)
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, publishErr
+}
+
+// purgeSent delete the events that sent before the retention, the purge is done at most once in purgeInterval
+func (r *Relay) purgeSent() {
+	if r.options.Retention < 0 || time.Since(r.lastPurge) < purgeInterval {
+		return
+	}
+	r.lastPurge = time.Now()
+
+	before := time.Now().Add(-r.options.Retention)
+	for {
+		n, err := r.store.purge(context.Background(), before, purgeBatchSize)
+		if err != nil {
+			_outboxRelayErrorCount.WithLabelValues(r.options.Name).Add(1)
+			if r.options.Logger != nil {
+				r.options.Logger.Errorf("outbox: %s: failed to purge sent events: %v", r.options.Name, err)
+			}
+			return
+		}
+		_outboxPurgedCount.WithLabelValues(r.options.Name).Add(float64(n))
+		if n < purgeBatchSize {
+			return
+		}
+
+		select {
+		case <-r.stopChan:
+			return
+		default:
+		}
+	}
+}
+
+// updateLag update the metrics of pending and parked events
+func (r *Relay) updateLag() {
+	st, err := r.store.pending(context.Background())
+	if err != nil {
+		_outboxRelayErrorCount.WithLabelValues(r.options.Name).Add(1)
+		if r.options.Logger != nil {
+			r.options.Logger.Errorf("outbox: %s: failed to check pending events: %v", r.options.Name, err)
+		}
+		return
+	}
+
+	var lag time.Duration
+	if st.Pending > 0 && st.Oldest.Valid {
+		lag = time.Since(st.Oldest.Time)
+	}
+	_outboxPendingGauge.WithLabelValues(r.options.Name).Set(float64(st.Pending))
+	_outboxLagGauge.WithLabelValues(r.options.Name).Set(lag.Seconds())
+	_outboxParkedGauge.WithLabelValues(r.options.Name).Set(float64(st.Parked))
+}
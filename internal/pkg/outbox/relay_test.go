@@ -0,0 +1,301 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeStore struct {
+	mu      sync.Mutex
+	records []Record
+	failed  map[string]string
+}
+
+func (fs *fakeStore) withTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fn(ctx)
+}
+
+func (fs *fakeStore) lockPending(ctx context.Context, limit int) ([]Record, error) {
+	var records []Record
+	for _, r := range fs.records {
+		if r.SentAt.Valid || r.ParkedAt.Valid {
+			continue
+		}
+		records = append(records, r)
+		if len(records) == limit {
+			break
+		}
+	}
+	return records, nil
+}
+
+func (fs *fakeStore) markSent(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		for i := range fs.records {
+			if fs.records[i].ID == id {
+				fs.records[i].SentAt.Valid = true
+				fs.records[i].SentAt.Time = time.Now()
+			}
+		}
+	}
+	return nil
+}
+
+func (fs *fakeStore) markFailed(ctx context.Context, id string, reason string) error {
+	if fs.failed == nil {
+		fs.failed = make(map[string]string)
+	}
+	fs.failed[id] = reason
+	fs.update(id, func(r *Record) {
+		r.Attempts++
+	})
+	return nil
+}
+
+func (fs *fakeStore) park(ctx context.Context, id string, reason string) error {
+	fs.update(id, func(r *Record) {
+		r.Attempts++
+		r.ParkedAt.Valid = true
+		r.ParkedAt.Time = time.Now()
+	})
+	return nil
+}
+
+func (fs *fakeStore) purge(ctx context.Context, before time.Time, limit int) (int64, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var (
+		n       int64
+		records []Record
+	)
+	for _, r := range fs.records {
+		if r.SentAt.Valid && r.SentAt.Time.Before(before) && n < int64(limit) {
+			n++
+			continue
+		}
+		records = append(records, r)
+	}
+	fs.records = records
+	return n, nil
+}
+
+func (fs *fakeStore) update(id string, fn func(r *Record)) {
+	for i := range fs.records {
+		if fs.records[i].ID == id {
+			fn(&fs.records[i])
+		}
+	}
+}
+
+func (fs *fakeStore) pending(ctx context.Context) (stats, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var st stats
+	for _, r := range fs.records {
+		if r.SentAt.Valid {
+			continue
+		}
+		if r.ParkedAt.Valid {
+			st.Parked++
+			continue
+		}
+		if st.Pending == 0 {
+			st.Oldest.Valid = true
+			st.Oldest.Time = r.CreatedAt
+		}
+		st.Pending++
+	}
+	return st, nil
+}
+
+type fakePublisher struct {
+	mu        sync.Mutex
+	published []string
+	fail      map[string]bool
+}
+
+func (fp *fakePublisher) Publish(topic string, body []byte) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	if fp.fail[string(body)] {
+		return errors.New("nsqd is not available")
+	}
+	fp.published = append(fp.published, string(body))
+	return nil
+}
+
+func newFakeStore(ids ...string) *fakeStore {
+	fs := fakeStore{}
+	for _, id := range ids {
+		fs.records = append(fs.records, Record{ID: id, Topic: "invoice", Body: []byte(id), CreatedAt: time.Now()})
+	}
+	return &fs
+}
+
+func TestRelay(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		records       []string
+		fail          map[string]bool
+		batchSize     int
+		maxAttempts   int
+		expectN       int
+		expectError   bool
+		expectSent    []string
+		expectFailed  []string
+		expectPending int64
+		expectParked  int64
+	}{
+		{
+			name:       "publish all events in batch",
+			records:    []string{"1", "2", "3"},
+			batchSize:  10,
+			expectN:    3,
+			expectSent: []string{"1", "2", "3"},
+		},
+		{
+			name:          "publish events up to batch size",
+			records:       []string{"1", "2", "3"},
+			batchSize:     2,
+			expectN:       2,
+			expectSent:    []string{"1", "2"},
+			expectPending: 1,
+		},
+		{
+			name:          "stop at the first failed event",
+			records:       []string{"1", "2", "3"},
+			fail:          map[string]bool{"2": true},
+			batchSize:     10,
+			expectN:       3,
+			expectError:   true,
+			expectSent:    []string{"1"},
+			expectFailed:  []string{"2"},
+			expectPending: 2,
+		},
+		{
+			name:         "park the event after max attempts",
+			records:      []string{"1", "2", "3"},
+			fail:         map[string]bool{"2": true},
+			batchSize:    10,
+			maxAttempts:  1,
+			expectN:      3,
+			expectSent:   []string{"1", "3"},
+			expectParked: 1,
+		},
+	}
+
+	for _, c := range cases {
+		fs := newFakeStore(c.records...)
+		fp := &fakePublisher{fail: c.fail}
+		r := newRelay(fs, fp, &RelayOptions{BatchSize: c.batchSize, MaxAttempts: c.maxAttempts})
+
+		n, err := r.relay(context.Background())
+		if (err != nil) != c.expectError {
+			t.Errorf("%s: expecting error %v but got %v", c.name, c.expectError, err)
+			return
+		}
+		if n != c.expectN {
+			t.Errorf("%s: expecting %d events in batch but got %d", c.name, c.expectN, n)
+			return
+		}
+		if len(fp.published) != len(c.expectSent) {
+			t.Errorf("%s: expecting published %v but got %v", c.name, c.expectSent, fp.published)
+			return
+		}
+		for i := range c.expectSent {
+			if fp.published[i] != c.expectSent[i] {
+				t.Errorf("%s: expecting published %v but got %v", c.name, c.expectSent, fp.published)
+				return
+			}
+		}
+		for _, id := range c.expectFailed {
+			if _, ok := fs.failed[id]; !ok {
+				t.Errorf("%s: expecting event %s to be marked as failed", c.name, id)
+				return
+			}
+		}
+		st, _ := fs.pending(context.Background())
+		if st.Pending != c.expectPending {
+			t.Errorf("%s: expecting %d pending events but got %d", c.name, c.expectPending, st.Pending)
+			return
+		}
+		if st.Parked != c.expectParked {
+			t.Errorf("%s: expecting %d parked events but got %d", c.name, c.expectParked, st.Parked)
+			return
+		}
+	}
+}
+
+func TestRelayRunAndShutdown(t *testing.T) {
+	t.Parallel()
+
+	fs := newFakeStore("1", "2", "3", "4", "5")
+	fp := &fakePublisher{}
+	r := newRelay(fs, fp, &RelayOptions{BatchSize: 2, PollInterval: time.Millisecond * 10})
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- r.Run()
+	}()
+
+	// all events should be published in the first poll, as the batch is repeated until no more events left
+	deadline := time.After(time.Second)
+	for {
+		st, _ := fs.pending(context.Background())
+		if st.Pending == 0 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Errorf("expecting no pending events but got %d", st.Pending)
+			return
+		case <-time.After(time.Millisecond * 5):
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := r.Shutdown(ctx); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := <-errChan; err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestRelayPurge(t *testing.T) {
+	t.Parallel()
+
+	fs := newFakeStore("1", "2", "3")
+	fs.records[0].SentAt.Valid = true
+	fs.records[0].SentAt.Time = time.Now().Add(-time.Hour * 2)
+	fs.records[1].SentAt.Valid = true
+	fs.records[1].SentAt.Time = time.Now()
+	r := newRelay(fs, &fakePublisher{}, &RelayOptions{Retention: time.Hour})
+
+	// only the event sent before the retention is purged, and the pending event is kept
+	r.purgeSent()
+	if len(fs.records) != 2 || fs.records[0].ID != "2" || fs.records[1].ID != "3" {
+		t.Errorf("expecting events 2 and 3 left but got %+v", fs.records)
+		return
+	}
+
+	// the sent events are not purged again until the purge interval
+	fs.records[0].SentAt.Time = time.Now().Add(-time.Hour * 2)
+	r.purgeSent()
+	if len(fs.records) != 2 {
+		t.Errorf("expecting 2 events left but got %d", len(fs.records))
+		return
+	}
+}
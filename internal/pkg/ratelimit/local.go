@@ -0,0 +1,157 @@
+package ratelimit
+
+// in-process limiter, the state is not shared between processes
+// use it as fallback of redis limiter or for single instance service
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// takeToken refill the bucket and take one token, the same algorithm as tokenBucketScript
+func takeToken(tokens float64, ts, now int64, limit Limit) (float64, Result) {
+	rate := float64(limit.Rate)
+	period := float64(milliseconds(limit.Period))
+	burst := float64(limit.Burst)
+
+	tokens = math.Min(burst, tokens+math.Max(0, float64(now-ts))*rate/period)
+	if tokens >= 1 {
+		tokens--
+		return tokens, Result{Allowed: true, Remaining: int(tokens)}
+	}
+	retry := math.Ceil((1 - tokens) * period / rate)
+	return tokens, Result{RetryAfter: time.Duration(retry) * time.Millisecond}
+}
+
+// slide remove the requests outside of the window and record the request if allowed,
+// the same algorithm as slidingWindowScript. requests must be sorted
+func slide(requests []int64, now int64, limit Limit) ([]int64, Result) {
+	period := milliseconds(limit.Period)
+	// remove requests with time <= now - period
+	i := sort.Search(len(requests), func(i int) bool {
+		return requests[i] > now-period
+	})
+	requests = requests[i:]
+
+	if len(requests) < limit.Rate {
+		requests = append(requests, now)
+		sort.Slice(requests, func(i, j int) bool { return requests[i] < requests[j] })
+		return requests, Result{Allowed: true, Remaining: limit.Rate - len(requests)}
+	}
+	retry := requests[0] + period - now
+	return requests, Result{RetryAfter: time.Duration(retry) * time.Millisecond}
+}
+
+type bucket struct {
+	tokens float64
+	ts     int64
+}
+
+// LocalTokenBucket is in-process token bucket limiter
+type LocalTokenBucket struct {
+	limit Limit
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewLocalTokenBucket create in-process token bucket limiter
+func NewLocalTokenBucket(limit Limit, opts *Options) (*LocalTokenBucket, error) {
+	limit, err := limit.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	o := opts.withDefault()
+	tb := LocalTokenBucket{
+		limit:   limit,
+		now:     o.Now,
+		buckets: make(map[string]*bucket),
+	}
+	return &tb, nil
+}
+
+// Allow take one token from the bucket of key
+func (tb *LocalTokenBucket) Allow(ctx context.Context, key string) (Result, error) {
+	now := tb.now()
+	nowMilli := unixMilli(now)
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	b, ok := tb.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(tb.limit.Burst), ts: nowMilli}
+		tb.buckets[key] = b
+	}
+
+	var result Result
+	b.tokens, result = takeToken(b.tokens, b.ts, nowMilli, tb.limit)
+	b.ts = nowMilli
+
+	// remove the full buckets, as it is the same with new bucket
+	refill := time.Duration(float64(tb.limit.Period) * float64(tb.limit.Burst) / float64(tb.limit.Rate))
+	if now.Sub(tb.lastSweep) > refill {
+		for k, b := range tb.buckets {
+			if nowMilli-b.ts > milliseconds(refill) {
+				delete(tb.buckets, k)
+			}
+		}
+		tb.lastSweep = now
+	}
+	return result, nil
+}
+
+// LocalSlidingWindow is in-process sliding window limiter
+type LocalSlidingWindow struct {
+	limit Limit
+	now   func() time.Time
+
+	mu        sync.Mutex
+	windows   map[string][]int64
+	lastSweep time.Time
+}
+
+// NewLocalSlidingWindow create in-process sliding window limiter
+func NewLocalSlidingWindow(limit Limit, opts *Options) (*LocalSlidingWindow, error) {
+	limit, err := limit.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	o := opts.withDefault()
+	sw := LocalSlidingWindow{
+		limit:   limit,
+		now:     o.Now,
+		windows: make(map[string][]int64),
+	}
+	return &sw, nil
+}
+
+// Allow record the request of key if it is allowed
+func (sw *LocalSlidingWindow) Allow(ctx context.Context, key string) (Result, error) {
+	now := sw.now()
+	nowMilli := unixMilli(now)
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	var result Result
+	sw.windows[key], result = slide(sw.windows[key], nowMilli, sw.limit)
+
+	// remove the windows without request in the last period
+	if now.Sub(sw.lastSweep) > sw.limit.Period {
+		for k, requests := range sw.windows {
+			if len(requests) == 0 || nowMilli-requests[len(requests)-1] > milliseconds(sw.limit.Period) {
+				delete(sw.windows, k)
+			}
+		}
+		sw.lastSweep = now
+	}
+	return result, nil
+}
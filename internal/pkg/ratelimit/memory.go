@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis/memory"
+)
+
+// RegisterMemoryScripts register the limiter scripts to in-memory redis, as it can't run lua script
+func RegisterMemoryScripts(m *memory.Memory) {
+	m.RegisterScript(tokenBucketScript, func(ctx context.Context, r redis.Redis, keys []string, args []interface{}) (interface{}, error) {
+		limit := Limit{
+			Burst:  args[0].(int),
+			Rate:   args[1].(int),
+			Period: time.Duration(args[2].(int64)) * time.Millisecond,
+		}
+		now := args[3].(int64)
+
+		state, err := r.HMGet(ctx, keys[0], "tokens", "ts")
+		if err != nil {
+			return nil, err
+		}
+		tokens, err := strconv.ParseFloat(state[0], 64)
+		if err != nil {
+			tokens = float64(limit.Burst)
+		}
+		ts, err := strconv.ParseInt(state[1], 10, 64)
+		if err != nil {
+			ts = now
+		}
+
+		tokens, result := takeToken(tokens, ts, now, limit)
+		if _, err := r.HMSet(ctx, keys[0], map[string]interface{}{
+			"tokens": strconv.FormatFloat(tokens, 'f', -1, 64),
+			"ts":     now,
+		}); err != nil {
+			return nil, err
+		}
+		refill := milliseconds(limit.Period) * int64(limit.Burst) / int64(limit.Rate)
+		if _, err := r.Expire(ctx, keys[0], ceilSeconds(refill)); err != nil {
+			return nil, err
+		}
+		return resultReply(result), nil
+	})
+
+	m.RegisterScript(slidingWindowScript, func(ctx context.Context, r redis.Redis, keys []string, args []interface{}) (interface{}, error) {
+		rate := args[0].(int)
+		period := args[1].(int64)
+		now := args[2].(int64)
+		member := args[3].(string)
+
+		if _, err := r.ZRemRangeByScore(ctx, keys[0], "-inf", strconv.FormatInt(now-period, 10)); err != nil {
+			return nil, err
+		}
+		requests, err := r.ZRangeByScore(ctx, keys[0], "-inf", "+inf")
+		if err != nil {
+			return nil, err
+		}
+
+		if len(requests) < rate {
+			if _, err := r.ZAdd(ctx, keys[0], redis.ZMember{Member: member, Score: float64(now)}); err != nil {
+				return nil, err
+			}
+			if _, err := r.Expire(ctx, keys[0], ceilSeconds(period)); err != nil {
+				return nil, err
+			}
+			return resultReply(Result{Allowed: true, Remaining: rate - len(requests) - 1}), nil
+		}
+		retry := int64(requests[0].Score) + period - now
+		return resultReply(Result{RetryAfter: time.Duration(retry) * time.Millisecond}), nil
+	})
+}
+
+// resultReply convert result to {allowed, remaining, retry_after_ms} reply
+func resultReply(result Result) []interface{} {
+	allowed := int64(0)
+	if result.Allowed {
+		allowed = 1
+	}
+	return []interface{}{allowed, int64(result.Remaining), milliseconds(result.RetryAfter)}
+}
+
+func ceilSeconds(ms int64) int {
+	return int((ms + 999) / 1000)
+}
@@ -0,0 +1,138 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	requestcontext "github.com/albertwidi/go-project-example/internal/pkg/context"
+	"github.com/albertwidi/go-project-example/internal/pkg/http/response"
+	"github.com/albertwidi/go-project-example/internal/pkg/router"
+)
+
+// KeyFunc return the key to limit the request, the request is not limited if the key is empty
+type KeyFunc func(rctx *requestcontext.RequestContext) string
+
+// KeyByIP limit the request by the remote address of the connection
+// X-Forwarded-For is not used, because it can be set by the client to bypass the limit.
+// Use KeyByForwardedIP when the service is behind a proxy.
+func KeyByIP(rctx *requestcontext.RequestContext) string {
+	return remoteIP(rctx.Request())
+}
+
+// KeyByForwardedIP limit the request by client ip in X-Forwarded-For
+// the header is only used when the request comes from the trusted proxies, and the client ip is
+// the last address in the header that is not a trusted proxy, as the addresses before it can be set by the client.
+// The trusted proxies can be ip or cidr, for example 10.0.0.0/8.
+func KeyByForwardedIP(trustedProxies ...string) (KeyFunc, error) {
+	trusted := make([]*net.IPNet, 0, len(trustedProxies))
+	for _, proxy := range trustedProxies {
+		cidr := proxy
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("ratelimit: invalid trusted proxy %s: %w", proxy, err)
+		}
+		trusted = append(trusted, ipnet)
+	}
+
+	isTrusted := func(addr string) bool {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return false
+		}
+		for _, ipnet := range trusted {
+			if ipnet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(rctx *requestcontext.RequestContext) string {
+		ip := remoteIP(rctx.Request())
+		if !isTrusted(ip) {
+			return ip
+		}
+
+		var forwarded []string
+		for _, header := range rctx.RequestHeader()["X-Forwarded-For"] {
+			forwarded = append(forwarded, strings.Split(header, ",")...)
+		}
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			addr := strings.TrimSpace(forwarded[i])
+			if addr == "" {
+				continue
+			}
+			ip = addr
+			if !isTrusted(addr) {
+				break
+			}
+		}
+		return ip
+	}, nil
+}
+
+// remoteIP return the ip of the remote address
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByHeader limit the request by the value of header
+func KeyByHeader(header string) KeyFunc {
+	return func(rctx *requestcontext.RequestContext) string {
+		return rctx.RequestHeader().Get(header)
+	}
+}
+
+// Middleware limit the request per handler and key
+// the request is rejected with 429 status code when it is limited,
+// and the request is allowed when the limiter returns error so the service is still available
+func Middleware(limiter Limiter, keyFunc KeyFunc) router.MiddlewareFunc {
+	return func(next router.HandlerFunc) router.HandlerFunc {
+		return func(rctx *requestcontext.RequestContext) error {
+			key := keyFunc(rctx)
+			if key == "" {
+				return next(rctx)
+			}
+
+			result, err := limiter.Allow(rctx.Context(), rctx.RequestHandler()+":"+key)
+			if err != nil {
+				return next(rctx)
+			}
+
+			header := rctx.ResponseWriter().Header()
+			header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			if result.Allowed {
+				return next(rctx)
+			}
+
+			retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+			header.Set("Retry-After", strconv.Itoa(retryAfter))
+			header.Set("Content-Type", "application/json")
+
+			resp := rctx.JSON()
+			resp.ResponseStatus = response.StatusRetry
+			resp.ResponseRetry = &response.JSONRetryResponse{
+				RetryMin: retryAfter,
+				RetryMax: retryAfter,
+			}
+			resp.WriteHeader(http.StatusTooManyRequests)
+			_, err = resp.Write()
+			return err
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	requestcontext "github.com/albertwidi/go-project-example/internal/pkg/context"
+)
+
+func TestKeyByIP(t *testing.T) {
+	t.Parallel()
+
+	keyByForwardedIP, err := KeyByForwardedIP("10.0.0.0/8", "192.168.1.1")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	cases := []struct {
+		name            string
+		remoteAddr      string
+		forwarded       []string
+		expect          string
+		expectForwarded string
+	}{
+		{
+			name:            "without forwarded header",
+			remoteAddr:      "1.1.1.1:1234",
+			expect:          "1.1.1.1",
+			expectForwarded: "1.1.1.1",
+		},
+		{
+			name:            "forwarded header from untrusted address is ignored",
+			remoteAddr:      "1.1.1.1:1234",
+			forwarded:       []string{"2.2.2.2"},
+			expect:          "1.1.1.1",
+			expectForwarded: "1.1.1.1",
+		},
+		{
+			name:            "forwarded header from trusted proxy",
+			remoteAddr:      "10.1.1.1:1234",
+			forwarded:       []string{"2.2.2.2"},
+			expect:          "10.1.1.1",
+			expectForwarded: "2.2.2.2",
+		},
+		{
+			name:            "spoofed address before the client address is ignored",
+			remoteAddr:      "10.1.1.1:1234",
+			forwarded:       []string{"3.3.3.3, 2.2.2.2, 192.168.1.1"},
+			expect:          "10.1.1.1",
+			expectForwarded: "2.2.2.2",
+		},
+		{
+			name:            "multiple forwarded headers",
+			remoteAddr:      "192.168.1.1:1234",
+			forwarded:       []string{"3.3.3.3", "2.2.2.2"},
+			expect:          "192.168.1.1",
+			expectForwarded: "2.2.2.2",
+		},
+		{
+			name:            "all addresses are trusted proxies",
+			remoteAddr:      "10.1.1.1:1234",
+			forwarded:       []string{"10.2.2.2, 10.3.3.3"},
+			expect:          "10.1.1.1",
+			expectForwarded: "10.2.2.2",
+		},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = c.remoteAddr
+		for _, forwarded := range c.forwarded {
+			req.Header.Add("X-Forwarded-For", forwarded)
+		}
+		rctx := requestcontext.New(requestcontext.Constructor{HTTPRequest: req})
+
+		if key := KeyByIP(rctx); key != c.expect {
+			t.Errorf("%s: expecting key %s but got %s", c.name, c.expect, key)
+			return
+		}
+		if key := keyByForwardedIP(rctx); key != c.expectForwarded {
+			t.Errorf("%s: expecting forwarded key %s but got %s", c.name, c.expectForwarded, key)
+			return
+		}
+	}
+
+	if _, err := KeyByForwardedIP("not an ip"); err == nil {
+		t.Error("expecting error for invalid trusted proxy")
+		return
+	}
+}
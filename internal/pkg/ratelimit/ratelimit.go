@@ -0,0 +1,99 @@
+// Package ratelimit provide token bucket and sliding window rate limiter backed by redis.Redis
+// and in-process limiter to be used as fallback when redis is not available
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// list of ratelimit errors
+var (
+	ErrInvalidLimit = errors.New("ratelimit: rate and period must be greater than zero")
+	ErrNilRedis     = errors.New("ratelimit: redis is nil")
+)
+
+// DefaultKeyPrefix of redis key
+const DefaultKeyPrefix = "ratelimit:"
+
+// Limit of requests
+type Limit struct {
+	// Rate is the number of requests allowed in Period
+	Rate   int
+	Period time.Duration
+	// Burst is the maximum number of requests allowed at once, only used by token bucket
+	// default to Rate
+	Burst int
+}
+
+// PerSecond return limit of rate per second
+func PerSecond(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Second}
+}
+
+// PerMinute return limit of rate per minute
+func PerMinute(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Minute}
+}
+
+// PerHour return limit of rate per hour
+func PerHour(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Hour}
+}
+
+// validate the limit and set the default burst
+func (l Limit) validate() (Limit, error) {
+	if l.Rate <= 0 || l.Period <= 0 {
+		return l, ErrInvalidLimit
+	}
+	if l.Burst <= 0 {
+		l.Burst = l.Rate
+	}
+	return l, nil
+}
+
+// Result of limiter
+type Result struct {
+	Allowed bool
+	// Remaining is the number of requests allowed after this request
+	Remaining int
+	// RetryAfter is the duration to wait until the next request is allowed, zero if the request is allowed
+	RetryAfter time.Duration
+}
+
+// Limiter limit the requests by key
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Result, error)
+}
+
+// Options of limiter
+type Options struct {
+	KeyPrefix string
+	// Fallback limiter is used when redis returns error, the error is returned if fallback is nil
+	Fallback Limiter
+	// Now return the current time, default to time.Now
+	Now func() time.Time
+}
+
+func (o *Options) withDefault() Options {
+	opts := Options{}
+	if o != nil {
+		opts = *o
+	}
+	if opts.KeyPrefix == "" {
+		opts.KeyPrefix = DefaultKeyPrefix
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return opts
+}
+
+func milliseconds(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
+
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
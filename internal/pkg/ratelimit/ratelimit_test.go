@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis/memory"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func TestLimiter(t *testing.T) {
+	t.Parallel()
+
+	c := &clock{now: time.Now()}
+	m := memory.New(&memory.Options{Clock: c})
+	RegisterMemoryScripts(m)
+
+	limit := Limit{Rate: 2, Period: time.Second * 10}
+	opts := &Options{Now: c.Now}
+
+	tb, err := NewTokenBucket(m, limit, opts)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	sw, err := NewSlidingWindow(m, limit, opts)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	localTB, err := NewLocalTokenBucket(limit, opts)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	localSW, err := NewLocalSlidingWindow(limit, opts)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	cases := []struct {
+		name    string
+		limiter Limiter
+	}{
+		{name: "token_bucket", limiter: tb},
+		{name: "sliding_window", limiter: sw},
+		{name: "local_token_bucket", limiter: localTB},
+		{name: "local_sliding_window", limiter: localSW},
+	}
+
+	for _, cs := range cases {
+		c.now = time.Now()
+		expect := []Result{
+			{Allowed: true, Remaining: 1},
+			{Allowed: true, Remaining: 0},
+			{Allowed: false, RetryAfter: time.Second * 5},
+		}
+		if cs.name == "sliding_window" || cs.name == "local_sliding_window" {
+			// the first request is out of window after 10 seconds
+			expect[2].RetryAfter = time.Second * 10
+		}
+
+		for i, e := range expect {
+			result, err := cs.limiter.Allow(context.Background(), "key")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if result != e {
+				t.Errorf("%s: request %d: expecting %+v but got %+v", cs.name, i, e, result)
+				return
+			}
+		}
+
+		// the request is allowed again after waiting
+		c.now = c.now.Add(time.Second * 10)
+		result, err := cs.limiter.Allow(context.Background(), "key")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !result.Allowed {
+			t.Errorf("%s: expecting request to be allowed after waiting", cs.name)
+			return
+		}
+	}
+}
+
+func TestFallback(t *testing.T) {
+	t.Parallel()
+
+	local, err := NewLocalTokenBucket(PerMinute(1), nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// memory redis without registered scripts always return error
+	tb, err := NewTokenBucket(memory.New(nil), PerMinute(1), &Options{Fallback: local})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for i, allowed := range []bool{true, false} {
+		result, err := tb.Allow(context.Background(), "key")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if result.Allowed != allowed {
+			t.Errorf("request %d: expecting allowed %v but got %v", i, allowed, result.Allowed)
+			return
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+)
+
+// list of limiter scripts, all scripts return {allowed, remaining, retry_after_ms}
+var (
+	// tokenBucketScript refill the bucket based on the elapsed time since the last request
+	// KEYS[1]: bucket key, ARGV: burst, rate, period_ms, now_ms
+	tokenBucketScript = redis.NewScript(`
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local period = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / period)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) * period / rate)
+end
+
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * period / rate))
+return {allowed, math.floor(tokens), retry}`)
+
+	// slidingWindowScript store the time of each request in sorted set
+	// KEYS[1]: window key, ARGV: rate, period_ms, now_ms, member
+	slidingWindowScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - period)
+local count = redis.call("ZCARD", KEYS[1])
+if count < rate then
+	redis.call("ZADD", KEYS[1], now, ARGV[4])
+	redis.call("PEXPIRE", KEYS[1], period)
+	return {1, rate - count - 1, 0}
+end
+
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+return {0, 0, tonumber(oldest[2]) + period - now}`)
+)
+
+// TokenBucket limiter backed by redis
+// the bucket is refilled with Rate tokens every Period, up to Burst tokens
+type TokenBucket struct {
+	redis redis.Redis
+	limit Limit
+	opts  Options
+}
+
+// NewTokenBucket create token bucket limiter
+func NewTokenBucket(r redis.Redis, limit Limit, opts *Options) (*TokenBucket, error) {
+	if r == nil {
+		return nil, ErrNilRedis
+	}
+	limit, err := limit.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	tb := TokenBucket{
+		redis: r,
+		limit: limit,
+		opts:  opts.withDefault(),
+	}
+	return &tb, nil
+}
+
+// Allow take one token from the bucket of key
+func (tb *TokenBucket) Allow(ctx context.Context, key string) (Result, error) {
+	now := tb.opts.Now()
+	result, err := toResult(tb.redis.Eval(ctx, tokenBucketScript,
+		[]string{tb.opts.KeyPrefix + "tb:" + key},
+		tb.limit.Burst, tb.limit.Rate, milliseconds(tb.limit.Period), unixMilli(now),
+	))
+	if err != nil && tb.opts.Fallback != nil {
+		return tb.opts.Fallback.Allow(ctx, key)
+	}
+	return result, err
+}
+
+// SlidingWindow limiter backed by redis
+// at most Rate requests are allowed in any window of Period
+type SlidingWindow struct {
+	redis redis.Redis
+	limit Limit
+	opts  Options
+}
+
+// NewSlidingWindow create sliding window limiter
+func NewSlidingWindow(r redis.Redis, limit Limit, opts *Options) (*SlidingWindow, error) {
+	if r == nil {
+		return nil, ErrNilRedis
+	}
+	limit, err := limit.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	sw := SlidingWindow{
+		redis: r,
+		limit: limit,
+		opts:  opts.withDefault(),
+	}
+	return &sw, nil
+}
+
+// Allow record the request of key if it is allowed
+func (sw *SlidingWindow) Allow(ctx context.Context, key string) (Result, error) {
+	now := unixMilli(sw.opts.Now())
+	// member must be unique, as requests might come at the same millisecond
+	member, err := uniqueMember(now)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result, err := toResult(sw.redis.Eval(ctx, slidingWindowScript,
+		[]string{sw.opts.KeyPrefix + "sw:" + key},
+		sw.limit.Rate, milliseconds(sw.limit.Period), now, member,
+	))
+	if err != nil && sw.opts.Fallback != nil {
+		return sw.opts.Fallback.Allow(ctx, key)
+	}
+	return result, err
+}
+
+func uniqueMember(now int64) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(now, 10) + "-" + hex.EncodeToString(b), nil
+}
+
+// toResult convert {allowed, remaining, retry_after_ms} reply to result
+func toResult(reply interface{}, err error) (Result, error) {
+	values, err := redis.Values(reply, err)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(values) != 3 {
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply %v", values)
+	}
+
+	ints := make([]int, len(values))
+	for i, v := range values {
+		if ints[i], err = redis.Int(v, nil); err != nil {
+			return Result{}, err
+		}
+	}
+	return Result{
+		Allowed:    ints[0] == 1,
+		Remaining:  ints[1],
+		RetryAfter: time.Duration(ints[2]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,354 @@
+// Package lock is a distributed lock on top of redis.Redis using the redlock algorithm
+// the lock is obtained when the majority of redis instances accept the lock
+//
+// every obtained lock has a fencing token, the token is always increasing for the same key.
+// pass the token to the storage so it can reject writes from the holder of an expired lock.
+// the token is counted only in the first redis instance, so the lock is not obtained when the first instance is down
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+)
+
+// list of lock errors
+var (
+	ErrNotObtained = errors.New("lock: not obtained")
+	ErrLeaseLost   = errors.New("lock: lease is lost")
+	ErrNoRedis     = errors.New("lock: redis is empty")
+	ErrInvalidTTL  = errors.New("lock: ttl is less than minimum ttl")
+	ErrNoToken     = errors.New("lock: failed to get fencing token")
+)
+
+// list of default options
+const (
+	DefaultKeyPrefix  = "lock:"
+	DefaultRetryCount = 3
+	DefaultRetryDelay = time.Millisecond * 50
+	// MinTTL is the minimum ttl of the lock, the lock with shorter ttl is expired before it can be used
+	MinTTL = time.Millisecond * 100
+	// driftFactor is the clock drift between redis instances, relative to the lock ttl
+	driftFactor = 0.01
+)
+
+// list of lock scripts, the lock and fencing key share the same hash tag so they are in the same cluster slot
+var (
+	obtainScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0`)
+
+	refreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// Options of locker
+type Options struct {
+	KeyPrefix string
+	// RetryCount is the number of retry when the lock is not obtained, use -1 to disable retry
+	RetryCount int
+	// RetryDelay is the delay between retry, random jitter up to the delay is added
+	RetryDelay time.Duration
+}
+
+// Locker obtain lock from redis instances
+type Locker struct {
+	rds    []redis.Redis
+	quorum int
+	opts   Options
+}
+
+// New locker, the redis instances must be independent of each other
+// use one redis instance if the safety of redlock is not needed.
+// The first redis instance hold the fencing token counter, it must be persistent for the token to be always increasing
+func New(rds []redis.Redis, opts *Options) (*Locker, error) {
+	if len(rds) == 0 {
+		return nil, ErrNoRedis
+	}
+
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.KeyPrefix == "" {
+		o.KeyPrefix = DefaultKeyPrefix
+	}
+	if o.RetryCount < 0 {
+		o.RetryCount = 0
+	} else if o.RetryCount == 0 {
+		o.RetryCount = DefaultRetryCount
+	}
+	if o.RetryDelay <= 0 {
+		o.RetryDelay = DefaultRetryDelay
+	}
+
+	l := Locker{
+		rds:    rds,
+		quorum: len(rds)/2 + 1,
+		opts:   o,
+	}
+	return &l, nil
+}
+
+// keys return the lock key and the fencing key
+func (l *Locker) keys(key string) []string {
+	lockKey := l.opts.KeyPrefix + "{" + key + "}"
+	return []string{lockKey, lockKey + ":fencing"}
+}
+
+// Obtain the lock for ttl, ErrNotObtained is returned if the lock is held by others
+func (l *Locker) Obtain(ctx context.Context, key string, ttl time.Duration) (*Lease, error) {
+	if ttl < MinTTL {
+		return nil, ErrInvalidTTL
+	}
+	value, err := randomValue()
+	if err != nil {
+		return nil, err
+	}
+	keys := l.keys(key)
+
+	for attempt := 0; attempt <= l.opts.RetryCount; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(l.opts.RetryDelay + jitter(l.opts.RetryDelay)):
+			}
+		}
+
+		start := time.Now()
+		var (
+			mu       sync.Mutex
+			acquired int
+		)
+		l.each(func(r redis.Redis) {
+			n, err := redis.Int(r.Eval(ctx, obtainScript, keys[:1], value, milliseconds(ttl)))
+			if err != nil || n == 0 {
+				return
+			}
+			mu.Lock()
+			acquired++
+			mu.Unlock()
+		})
+
+		if acquired >= l.quorum {
+			// the token is taken from one counter, the max of counters in the majority is not always increasing
+			// because the majority of the next lock might be different
+			token, err := l.rds[0].Increment(ctx, keys[1])
+			if err != nil {
+				l.release(ctx, keys, value)
+				return nil, fmt.Errorf("%w: %v", ErrNoToken, err)
+			}
+
+			validity := ttl - time.Since(start) - drift(ttl)
+			if validity > 0 {
+				lease := Lease{
+					locker:     l,
+					key:        key,
+					keys:       keys,
+					value:      value,
+					token:      int64(token),
+					validUntil: start.Add(validity),
+				}
+				return &lease, nil
+			}
+		}
+
+		// release the partially obtained lock, so other can obtain the lock
+		l.release(ctx, keys, value)
+	}
+	return nil, ErrNotObtained
+}
+
+// WithLock run fn while holding the lock, the lock is refreshed in background until fn returns
+// ctx of fn is cancelled when the lock can't be refreshed, ErrLeaseLost is returned in that case
+func (l *Locker) WithLock(ctx context.Context, key string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	// the lock is refreshed every ttl/3, reject the ttl before the lock is obtained
+	if ttl < MinTTL {
+		return ErrInvalidTTL
+	}
+	lease, err := l.Obtain(ctx, key, ttl)
+	if err != nil {
+		return err
+	}
+
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	lost := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := lease.Refresh(fnCtx, ttl); err != nil {
+					close(lost)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err = fn(fnCtx)
+	close(done)
+	lease.Release(context.Background())
+
+	select {
+	case <-lost:
+		if err == nil {
+			err = ErrLeaseLost
+		}
+	default:
+	}
+	return err
+}
+
+// each run fn for each redis concurrently and wait until all finished
+func (l *Locker) each(fn func(r redis.Redis)) {
+	var wg sync.WaitGroup
+	wg.Add(len(l.rds))
+	for _, r := range l.rds {
+		go func(r redis.Redis) {
+			defer wg.Done()
+			fn(r)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// release the lock in all redis, return the number of redis releasing the lock
+func (l *Locker) release(ctx context.Context, keys []string, value string) int {
+	var (
+		mu       sync.Mutex
+		released int
+	)
+	l.each(func(r redis.Redis) {
+		n, err := redis.Int(r.Eval(ctx, releaseScript, keys[:1], value))
+		if err != nil || n == 0 {
+			return
+		}
+		mu.Lock()
+		released++
+		mu.Unlock()
+	})
+	return released
+}
+
+// Lease of obtained lock
+type Lease struct {
+	locker *Locker
+	key    string
+	keys   []string
+	value  string
+	token  int64
+
+	mu         sync.Mutex
+	validUntil time.Time
+}
+
+// Key of the lock
+func (ls *Lease) Key() string {
+	return ls.key
+}
+
+// Token return the fencing token of the lease
+func (ls *Lease) Token() int64 {
+	return ls.token
+}
+
+// ValidUntil return the time until the lease is valid
+func (ls *Lease) ValidUntil() time.Time {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.validUntil
+}
+
+// Refresh extend the lease to ttl, ErrLeaseLost is returned if the lease is expired or taken by others
+func (ls *Lease) Refresh(ctx context.Context, ttl time.Duration) error {
+	if ttl < MinTTL {
+		return ErrInvalidTTL
+	}
+	start := time.Now()
+	var (
+		mu        sync.Mutex
+		refreshed int
+	)
+	ls.locker.each(func(r redis.Redis) {
+		n, err := redis.Int(r.Eval(ctx, refreshScript, ls.keys[:1], ls.value, milliseconds(ttl)))
+		if err != nil || n == 0 {
+			return
+		}
+		mu.Lock()
+		refreshed++
+		mu.Unlock()
+	})
+
+	validity := ttl - time.Since(start) - drift(ttl)
+	if refreshed < ls.locker.quorum || validity <= 0 {
+		return ErrLeaseLost
+	}
+
+	ls.mu.Lock()
+	ls.validUntil = start.Add(validity)
+	ls.mu.Unlock()
+	return nil
+}
+
+// Release the lease, ErrLeaseLost is returned if the lease is already expired
+func (ls *Lease) Release(ctx context.Context) error {
+	released := ls.locker.release(ctx, ls.keys, ls.value)
+
+	ls.mu.Lock()
+	ls.validUntil = time.Time{}
+	ls.mu.Unlock()
+
+	if released < ls.locker.quorum {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func randomValue() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func jitter(d time.Duration) time.Duration {
+	b := make([]byte, 1)
+	rand.Read(b)
+	return d * time.Duration(b[0]) / 255
+}
+
+func drift(ttl time.Duration) time.Duration {
+	return time.Duration(float64(ttl)*driftFactor) + time.Millisecond*2
+}
+
+func milliseconds(d time.Duration) int64 {
+	return int64(math.Ceil(float64(d) / float64(time.Millisecond)))
+}
@@ -0,0 +1,206 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis/memory"
+)
+
+func newMemoryRedis(n int) []redis.Redis {
+	rds := make([]redis.Redis, n)
+	for i := range rds {
+		m := memory.New(nil)
+		RegisterMemoryScripts(m)
+		rds[i] = m
+	}
+	return rds
+}
+
+func TestObtain(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newMemoryRedis(3)
+	locker, err := New(rds, &Options{RetryCount: -1})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	lease, err := locker.Obtain(ctx, "key", time.Second*10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := locker.Obtain(ctx, "key", time.Second*10); err != ErrNotObtained {
+		t.Errorf("expecting error %v but got %v", ErrNotObtained, err)
+		return
+	}
+	if err := lease.Refresh(ctx, time.Second*10); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := lease.Release(ctx); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// the lock is obtained with the majority, and the fencing token is increased
+	if _, err := rds[0].Set(ctx, "lock:{key}", "other"); err != nil {
+		t.Error(err)
+		return
+	}
+	next, err := locker.Obtain(ctx, "key", time.Second*10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if next.Token() <= lease.Token() {
+		t.Errorf("expecting token greater than %d but got %d", lease.Token(), next.Token())
+		return
+	}
+	if err := lease.Refresh(ctx, time.Second*10); err != ErrLeaseLost {
+		t.Errorf("expecting error %v but got %v", ErrLeaseLost, err)
+		return
+	}
+}
+
+func TestWithLock(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	locker, err := New(newMemoryRedis(1), &Options{RetryCount: -1})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	errFn := errors.New("fn error")
+	err = locker.WithLock(ctx, "key", time.Second*10, func(ctx context.Context) error {
+		if _, err := locker.Obtain(ctx, "key", time.Second*10); err != ErrNotObtained {
+			t.Errorf("expecting error %v but got %v", ErrNotObtained, err)
+		}
+		return errFn
+	})
+	if err != errFn {
+		t.Errorf("expecting error %v but got %v", errFn, err)
+		return
+	}
+
+	// the lock is released after fn returns
+	lease, err := locker.Obtain(ctx, "key", time.Second*10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	lease.Release(ctx)
+}
+
+func TestInvalidTTL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	locker, err := New(newMemoryRedis(1), &Options{RetryCount: -1})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, ttl := range []time.Duration{-time.Second, 0, time.Nanosecond, MinTTL - 1} {
+		if _, err := locker.Obtain(ctx, "key", ttl); err != ErrInvalidTTL {
+			t.Errorf("ttl %v: expecting error %v but got %v", ttl, ErrInvalidTTL, err)
+			return
+		}
+
+		called := false
+		err := locker.WithLock(ctx, "key", ttl, func(ctx context.Context) error {
+			called = true
+			return nil
+		})
+		if err != ErrInvalidTTL {
+			t.Errorf("ttl %v: expecting error %v but got %v", ttl, ErrInvalidTTL, err)
+			return
+		}
+		if called {
+			t.Errorf("ttl %v: fn should not be called", ttl)
+			return
+		}
+	}
+
+	lease, err := locker.Obtain(ctx, "key", MinTTL)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := lease.Refresh(ctx, 0); err != ErrInvalidTTL {
+		t.Errorf("expecting error %v but got %v", ErrInvalidTTL, err)
+		return
+	}
+	lease.Release(ctx)
+}
+
+// noTokenRedis fail to increment the fencing token
+type noTokenRedis struct {
+	redis.Redis
+}
+
+func (r noTokenRedis) Increment(ctx context.Context, key string) (int, error) {
+	return 0, errors.New("increment failed")
+}
+
+func TestObtainNoToken(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newMemoryRedis(3)
+	rds[0] = noTokenRedis{rds[0]}
+	locker, err := New(rds, &Options{RetryCount: -1})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := locker.Obtain(ctx, "key", time.Second*10); !errors.Is(err, ErrNoToken) {
+		t.Errorf("expecting error %v but got %v", ErrNoToken, err)
+		return
+	}
+	// the lock is released when the token can't be taken
+	for i, r := range rds {
+		if v, _ := r.Get(ctx, "lock:{key}"); v != "" {
+			t.Errorf("redis %d: expecting lock to be released but got %s", i, v)
+			return
+		}
+	}
+}
+
+func TestTTLSeconds(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		ms        interface{}
+		expect    int
+		expectErr bool
+	}{
+		{ms: int64(1000), expect: 1},
+		{ms: int64(1001), expect: 2},
+		{ms: int64(100), expect: 1},
+		{ms: 1000, expectErr: true},
+		{ms: "1000", expectErr: true},
+	}
+
+	for _, c := range cases {
+		ttl, err := ttlSeconds(c.ms)
+		if (err != nil) != c.expectErr {
+			t.Errorf("ms %v: expecting error %v but got %v", c.ms, c.expectErr, err)
+			return
+		}
+		if ttl != c.expect {
+			t.Errorf("ms %v: expecting ttl %d but got %d", c.ms, c.expect, ttl)
+			return
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis/memory"
+)
+
+// RegisterMemoryScripts register the lock scripts to in-memory redis, as it can't run lua script
+// the lock ttl is rounded up to second because in-memory redis expire the key in second
+func RegisterMemoryScripts(m *memory.Memory) {
+	m.RegisterScript(obtainScript, func(ctx context.Context, r redis.Redis, keys []string, args []interface{}) (interface{}, error) {
+		ttl, err := ttlSeconds(args[1])
+		if err != nil {
+			return nil, err
+		}
+		ok, err := r.SetNX(ctx, keys[0], args[0], ttl)
+		return int64(ok), err
+	})
+
+	m.RegisterScript(refreshScript, func(ctx context.Context, r redis.Redis, keys []string, args []interface{}) (interface{}, error) {
+		if !holding(ctx, r, keys[0], args[0]) {
+			return int64(0), nil
+		}
+		ttl, err := ttlSeconds(args[1])
+		if err != nil {
+			return nil, err
+		}
+		n, err := r.Expire(ctx, keys[0], ttl)
+		return int64(n), err
+	})
+
+	m.RegisterScript(releaseScript, func(ctx context.Context, r redis.Redis, keys []string, args []interface{}) (interface{}, error) {
+		if !holding(ctx, r, keys[0], args[0]) {
+			return int64(0), nil
+		}
+		n, err := r.Delete(ctx, keys[0])
+		return int64(n), err
+	})
+}
+
+// holding return true if the lock is held with the value
+func holding(ctx context.Context, r redis.Redis, key string, value interface{}) bool {
+	v, ok := value.(string)
+	if !ok {
+		return false
+	}
+	current, err := r.Get(ctx, key)
+	return err == nil && current == v
+}
+
+// ttlSeconds convert ttl in milliseconds to seconds, rounded up
+func ttlSeconds(ms interface{}) (int, error) {
+	v, ok := ms.(int64)
+	if !ok {
+		return 0, fmt.Errorf("lock: invalid ttl type %T, expecting int64", ms)
+	}
+	return int((v + 999) / 1000), nil
+}
@@ -0,0 +1,278 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+)
+
+// Set key and value
+func (m *Memory) Set(ctx context.Context, key string, value interface{}) (string, error) {
+	defer m.lock()()
+	m.state.data[key] = &entry{kind: kindString, str: toString(value)}
+	return "OK", nil
+}
+
+// SetNX set key and value only if key is not exist, the key is expired in `expire` seconds
+func (m *Memory) SetNX(ctx context.Context, key string, value interface{}, expire int) (int, error) {
+	defer m.lock()()
+	if m.exists(key) {
+		return 0, nil
+	}
+
+	e := &entry{kind: kindString, str: toString(value)}
+	if expire > 0 {
+		e.expireAt = m.now().Add(time.Duration(expire) * time.Second)
+	}
+	m.state.data[key] = e
+	return 1, nil
+}
+
+// SetEX set key and value, the key is expired in `expire` seconds
+func (m *Memory) SetEX(ctx context.Context, key string, value interface{}, expire int) (string, error) {
+	if expire <= 0 {
+		return "", errors.New("ERR invalid expire time in setex")
+	}
+
+	defer m.lock()()
+	m.state.data[key] = &entry{
+		kind:     kindString,
+		str:      toString(value),
+		expireAt: m.now().Add(time.Duration(expire) * time.Second),
+	}
+	return "OK", nil
+}
+
+// Get string value
+func (m *Memory) Get(ctx context.Context, key string) (string, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindString)
+	if err != nil {
+		return "", err
+	}
+	if e == nil {
+		return "", redis.ErrNil
+	}
+	return e.str, nil
+}
+
+// Delete key
+func (m *Memory) Delete(ctx context.Context, key string) (int, error) {
+	defer m.lock()()
+	if !m.exists(key) {
+		return 0, nil
+	}
+	delete(m.state.data, key)
+	return 1, nil
+}
+
+// Increment key
+func (m *Memory) Increment(ctx context.Context, key string) (int, error) {
+	return m.IncrementBy(ctx, key, 1)
+}
+
+// IncrementBy key
+func (m *Memory) IncrementBy(ctx context.Context, key string, amount int) (int, error) {
+	defer m.lock()()
+	e, err := m.getOrCreate(key, kindString)
+	if err != nil {
+		return 0, err
+	}
+
+	value := 0
+	if e.str != "" {
+		value, err = strconv.Atoi(e.str)
+		if err != nil {
+			return 0, errNotInteger
+		}
+	}
+	value += amount
+	e.str = strconv.Itoa(value)
+	return value, nil
+}
+
+// Expire to set TTL to key, the key is deleted if duration <= 0
+func (m *Memory) Expire(ctx context.Context, key string, duration int) (int, error) {
+	defer m.lock()()
+	if !m.exists(key) {
+		return 0, nil
+	}
+	if duration <= 0 {
+		delete(m.state.data, key)
+		return 1, nil
+	}
+	m.state.data[key].expireAt = m.now().Add(time.Duration(duration) * time.Second)
+	return 1, nil
+}
+
+// TTL return the remaining time to live of a key in seconds
+// return -1 if the key has no expiration and -2 if the key does not exist
+func (m *Memory) TTL(ctx context.Context, key string) (int, error) {
+	defer m.lock()()
+	if !m.exists(key) {
+		return -2, nil
+	}
+	e := m.state.data[key]
+	if e.expireAt.IsZero() {
+		return -1, nil
+	}
+	// rounded the same way as redis
+	ttl := e.expireAt.Sub(m.now())
+	return int((ttl + 500*time.Millisecond) / time.Second), nil
+}
+
+// Persist remove the expiration of a key
+func (m *Memory) Persist(ctx context.Context, key string) (int, error) {
+	defer m.lock()()
+	if !m.exists(key) {
+		return 0, nil
+	}
+	e := m.state.data[key]
+	if e.expireAt.IsZero() {
+		return 0, nil
+	}
+	e.expireAt = time.Time{}
+	return 1, nil
+}
+
+// MSet keys and values
+func (m *Memory) MSet(ctx context.Context, pairs ...interface{}) (string, error) {
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return "", errors.New("ERR wrong number of arguments for 'mset' command")
+	}
+
+	defer m.lock()()
+	for i := 0; i < len(pairs); i += 2 {
+		m.state.data[toString(pairs[i])] = &entry{kind: kindString, str: toString(pairs[i+1])}
+	}
+	return "OK", nil
+}
+
+// MGet keys, empty string is returned for key that is not exist
+func (m *Memory) MGet(ctx context.Context, keys ...string) ([]string, error) {
+	defer m.lock()()
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		// redis return nil for key with other type
+		if e, err := m.get(key, kindString); err == nil && e != nil {
+			values[i] = e.str
+		}
+	}
+	return values, nil
+}
+
+// HSet field and value based on key, return 1 if the field is new
+func (m *Memory) HSet(ctx context.Context, key, field string, value interface{}) (int, error) {
+	defer m.lock()()
+	e, err := m.getOrCreate(key, kindHash)
+	if err != nil {
+		return 0, err
+	}
+
+	_, ok := e.hash[field]
+	e.hash[field] = toString(value)
+	if ok {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+// HSetEX key and value and sets the expiration to the given `expire` seconds
+func (m *Memory) HSetEX(ctx context.Context, key, field string, value interface{}, expire int) (int, error) {
+	if _, err := m.HSet(ctx, key, field, value); err != nil {
+		return 0, err
+	}
+	return m.Expire(ctx, key, expire)
+}
+
+// HGet key and value
+func (m *Memory) HGet(ctx context.Context, key, field string) (string, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindHash)
+	if err != nil {
+		return "", err
+	}
+	if e == nil {
+		return "", redis.ErrNil
+	}
+
+	value, ok := e.hash[field]
+	if !ok {
+		return "", redis.ErrNil
+	}
+	return value, nil
+}
+
+// HGetAll key and value
+func (m *Memory) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindHash)
+	if err != nil {
+		return nil, err
+	}
+
+	kv := make(map[string]string)
+	if e == nil {
+		return kv, nil
+	}
+	for k, v := range e.hash {
+		kv[k] = v
+	}
+	return kv, nil
+}
+
+// HMSet function
+func (m *Memory) HMSet(ctx context.Context, key string, kv map[string]interface{}) (string, error) {
+	defer m.lock()()
+	e, err := m.getOrCreate(key, kindHash)
+	if err != nil {
+		return "", err
+	}
+
+	for k, v := range kv {
+		e.hash[k] = toString(v)
+	}
+	return "OK", nil
+}
+
+// HMGet keys and value, empty string is returned for field that is not exist
+func (m *Memory) HMGet(ctx context.Context, key string, fields ...string) ([]string, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindHash)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, len(fields))
+	if e == nil {
+		return values, nil
+	}
+	for i, field := range fields {
+		values[i] = e.hash[field]
+	}
+	return values, nil
+}
+
+// HDel fields of a key, the key is deleted when there is no field left
+func (m *Memory) HDel(ctx context.Context, key string, fields ...string) (int, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindHash)
+	if err != nil || e == nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, field := range fields {
+		if _, ok := e.hash[field]; ok {
+			delete(e.hash, field)
+			deleted++
+		}
+	}
+	if len(e.hash) == 0 {
+		delete(m.state.data, key)
+	}
+	return deleted, nil
+}
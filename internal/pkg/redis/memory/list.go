@@ -0,0 +1,182 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+)
+
+// listIndex convert negative index to positive index
+func listIndex(index, length int) int {
+	if index < 0 {
+		return length + index
+	}
+	return index
+}
+
+// LLen get the length of the list
+func (m *Memory) LLen(ctx context.Context, key string) (int, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindList)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	return len(e.list), nil
+}
+
+// LIndex to get value from a certain list index, negative index is counted from the tail
+func (m *Memory) LIndex(ctx context.Context, key string, index int) (string, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindList)
+	if err != nil {
+		return "", err
+	}
+	if e == nil {
+		return "", redis.ErrNil
+	}
+
+	index = listIndex(index, len(e.list))
+	if index < 0 || index >= len(e.list) {
+		return "", redis.ErrNil
+	}
+	return e.list[index], nil
+}
+
+// LSet to set value to some index
+func (m *Memory) LSet(ctx context.Context, key, value string, index int) (int, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindList)
+	if err != nil {
+		return 0, err
+	}
+	if e == nil {
+		return 0, errNoSuchKey
+	}
+
+	index = listIndex(index, len(e.list))
+	if index < 0 || index >= len(e.list) {
+		return 0, errIndexOutOfRange
+	}
+	e.list[index] = value
+	return 1, nil
+}
+
+// LPush prepend values to the list
+func (m *Memory) LPush(ctx context.Context, key string, values ...interface{}) (int, error) {
+	defer m.lock()()
+	e, err := m.getOrCreate(key, kindList)
+	if err != nil {
+		return 0, err
+	}
+	return lpush(e, values), nil
+}
+
+// LPushX prepend values to the list, only if the list is exist
+func (m *Memory) LPushX(ctx context.Context, key string, values ...interface{}) (int, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindList)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	return lpush(e, values), nil
+}
+
+// lpush insert each value to the head of the list, so the last value become the first element
+func lpush(e *entry, values []interface{}) int {
+	list := make([]string, 0, len(values)+len(e.list))
+	for i := len(values) - 1; i >= 0; i-- {
+		list = append(list, toString(values[i]))
+	}
+	e.list = append(list, e.list...)
+	return len(e.list)
+}
+
+// LPop removes and get the first element in the list
+func (m *Memory) LPop(ctx context.Context, key string) (string, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindList)
+	if err != nil {
+		return "", err
+	}
+	if e == nil {
+		return "", redis.ErrNil
+	}
+
+	value := e.list[0]
+	e.list = e.list[1:]
+	if len(e.list) == 0 {
+		delete(m.state.data, key)
+	}
+	return value, nil
+}
+
+// LRem removes `count` occurrences of value from the list
+// count > 0 removes from head to tail, count < 0 removes from tail to head and count = 0 removes all
+func (m *Memory) LRem(ctx context.Context, key, value string, count int) (int, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindList)
+	if err != nil || e == nil {
+		return 0, err
+	}
+
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+
+	remove := make(map[int]struct{})
+	if count >= 0 {
+		for i := 0; i < len(e.list) && (limit == 0 || len(remove) < limit); i++ {
+			if e.list[i] == value {
+				remove[i] = struct{}{}
+			}
+		}
+	} else {
+		for i := len(e.list) - 1; i >= 0 && len(remove) < limit; i-- {
+			if e.list[i] == value {
+				remove[i] = struct{}{}
+			}
+		}
+	}
+
+	list := make([]string, 0, len(e.list)-len(remove))
+	for i, v := range e.list {
+		if _, ok := remove[i]; !ok {
+			list = append(list, v)
+		}
+	}
+	e.list = list
+	if len(e.list) == 0 {
+		delete(m.state.data, key)
+	}
+	return len(remove), nil
+}
+
+// LTrim trim the list so it only contains elements from start to stop, inclusive
+func (m *Memory) LTrim(ctx context.Context, key string, start, stop int) (string, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindList)
+	if err != nil {
+		return "", err
+	}
+	if e == nil {
+		return "OK", nil
+	}
+
+	length := len(e.list)
+	start = listIndex(start, length)
+	stop = listIndex(stop, length)
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+
+	if start > stop || start >= length {
+		delete(m.state.data, key)
+		return "OK", nil
+	}
+	e.list = append([]string(nil), e.list[start:stop+1]...)
+	return "OK", nil
+}
@@ -0,0 +1,259 @@
+// Package memory is an in-memory implementation of redis.Redis
+// to be used in test and local development without running a redis server
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+)
+
+// list of error, the message is the same with redis error
+var (
+	ErrWrongType       = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNotInteger      = errors.New("ERR value is not an integer or out of range")
+	errNotFloat        = errors.New("ERR value is not a valid float")
+	errNoSuchKey       = errors.New("ERR no such key")
+	errIndexOutOfRange = errors.New("ERR index out of range")
+	errSyntax          = errors.New("ERR syntax error")
+)
+
+var _ redis.Redis = (*Memory)(nil)
+
+// Clock to get the current time, used to expire keys
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ManualClock is a clock that only moves when Set or Add is called
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManualClock return a manual clock starting from t
+func NewManualClock(t time.Time) *ManualClock {
+	return &ManualClock{now: t}
+}
+
+// Now return the current time of the clock
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set the current time of the clock
+func (c *ManualClock) Set(t time.Time) {
+	c.mu.Lock()
+	c.now = t
+	c.mu.Unlock()
+}
+
+// Add duration to the current time of the clock
+func (c *ManualClock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// Options of memory redis
+type Options struct {
+	// Clock to expire keys, default to system clock
+	Clock Clock
+}
+
+// Memory redis
+type Memory struct {
+	state *state
+	// locked is true when the memory is used inside a script or transaction,
+	// the lock is already held by the script or transaction
+	locked bool
+}
+
+// state is shared between memory and its script view
+type state struct {
+	mu          sync.Mutex
+	clock       Clock
+	data        map[string]*entry
+	scripts     map[string]ScriptFunc
+	subscribers map[string]map[*subscription]struct{}
+}
+
+type kind int
+
+// kind of value in memory
+const (
+	kindString kind = iota + 1
+	kindHash
+	kindList
+	kindSet
+	kindZSet
+)
+
+type entry struct {
+	kind     kind
+	str      string
+	hash     map[string]string
+	list     []string
+	set      map[string]struct{}
+	zset     map[string]float64
+	expireAt time.Time
+}
+
+// New in-memory redis
+func New(memOpts *Options) *Memory {
+	opts := Options{}
+	if memOpts != nil {
+		opts = *memOpts
+	}
+	if opts.Clock == nil {
+		opts.Clock = systemClock{}
+	}
+
+	m := Memory{
+		state: &state{
+			clock:       opts.Clock,
+			data:        make(map[string]*entry),
+			scripts:     make(map[string]ScriptFunc),
+			subscribers: make(map[string]map[*subscription]struct{}),
+		},
+	}
+	return &m
+}
+
+// lock the state and return the unlock function
+// usage: defer m.lock()()
+func (m *Memory) lock() func() {
+	if m.locked {
+		return func() {}
+	}
+	m.state.mu.Lock()
+	return m.state.mu.Unlock
+}
+
+// view return memory that doesn't lock the state, the caller must hold the lock
+func (m *Memory) view() *Memory {
+	return &Memory{state: m.state, locked: true}
+}
+
+func (m *Memory) now() time.Time {
+	return m.state.clock.Now()
+}
+
+// get the entry of key with the expected kind, nil is returned if the key is not exist or expired
+func (m *Memory) get(key string, k kind) (*entry, error) {
+	e, ok := m.state.data[key]
+	if !ok {
+		return nil, nil
+	}
+	if !e.expireAt.IsZero() && !m.now().Before(e.expireAt) {
+		delete(m.state.data, key)
+		return nil, nil
+	}
+	if e.kind != k {
+		return nil, ErrWrongType
+	}
+	return e, nil
+}
+
+// getOrCreate the entry of key with the expected kind
+func (m *Memory) getOrCreate(key string, k kind) (*entry, error) {
+	e, err := m.get(key, k)
+	if err != nil || e != nil {
+		return e, err
+	}
+
+	e = &entry{kind: k}
+	switch k {
+	case kindHash:
+		e.hash = make(map[string]string)
+	case kindSet:
+		e.set = make(map[string]struct{})
+	case kindZSet:
+		e.zset = make(map[string]float64)
+	}
+	m.state.data[key] = e
+	return e, nil
+}
+
+// exists return true if the key is exist and not expired
+func (m *Memory) exists(key string) bool {
+	e, ok := m.state.data[key]
+	if !ok {
+		return false
+	}
+	if !e.expireAt.IsZero() && !m.now().Before(e.expireAt) {
+		delete(m.state.data, key)
+		return false
+	}
+	return true
+}
+
+// FlushAll remove all keys
+func (m *Memory) FlushAll() {
+	defer m.lock()()
+	m.state.data = make(map[string]*entry)
+}
+
+// Ping the memory
+func (m *Memory) Ping(ctx context.Context) (string, error) {
+	return "PONG", nil
+}
+
+// Close all subscriptions
+func (m *Memory) Close() error {
+	defer m.lock()()
+	for _, subs := range m.state.subscribers {
+		for s := range subs {
+			s.close()
+		}
+	}
+	m.state.subscribers = make(map[string]map[*subscription]struct{})
+	return nil
+}
+
+// IsErrNil return true if error is nil reply
+func (m *Memory) IsErrNil(err error) bool {
+	return errors.Is(err, redis.ErrNil)
+}
+
+// IsResponseOK return true if result value of command is ok
+func (m *Memory) IsResponseOK(result string) bool {
+	return result == "OK"
+}
+
+// toString convert value to string the same way as redis client
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
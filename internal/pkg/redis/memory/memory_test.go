@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+)
+
+func TestExpire(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := NewManualClock(time.Now())
+	m := New(&Options{Clock: clock})
+
+	if _, err := m.SetEX(ctx, "key", "value", 10); err != nil {
+		t.Error(err)
+		return
+	}
+
+	cases := []struct {
+		after     time.Duration
+		expectTTL int
+		expectErr error
+	}{
+		{after: 0, expectTTL: 10},
+		{after: time.Second * 4, expectTTL: 6},
+		{after: time.Second * 6, expectTTL: -2, expectErr: redis.ErrNil},
+	}
+
+	for _, c := range cases {
+		clock.Add(c.after)
+
+		ttl, err := m.TTL(ctx, "key")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if ttl != c.expectTTL {
+			t.Errorf("expecting ttl %d but got %d", c.expectTTL, ttl)
+			return
+		}
+
+		_, err = m.Get(ctx, "key")
+		if err != c.expectErr {
+			t.Errorf("expecting error %v but got %v", c.expectErr, err)
+			return
+		}
+	}
+
+	if _, err := m.Get(ctx, "key"); !m.IsErrNil(err) {
+		t.Errorf("expecting nil error but got %v", err)
+		return
+	}
+}
+
+func TestList(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	m := New(nil)
+
+	if _, err := m.LPush(ctx, "list", "c", "b", "a"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	cases := []struct {
+		index     int
+		expect    string
+		expectErr error
+	}{
+		{index: 0, expect: "a"},
+		{index: 2, expect: "c"},
+		{index: -1, expect: "c"},
+		{index: -3, expect: "a"},
+		{index: 3, expectErr: redis.ErrNil},
+		{index: -4, expectErr: redis.ErrNil},
+	}
+
+	for _, c := range cases {
+		value, err := m.LIndex(ctx, "list", c.index)
+		if err != c.expectErr {
+			t.Errorf("index %d: expecting error %v but got %v", c.index, c.expectErr, err)
+			return
+		}
+		if value != c.expect {
+			t.Errorf("index %d: expecting %s but got %s", c.index, c.expect, value)
+			return
+		}
+	}
+
+	if _, err := m.LTrim(ctx, "list", 1, -1); err != nil {
+		t.Error(err)
+		return
+	}
+	if value, _ := m.LPop(ctx, "list"); value != "b" {
+		t.Errorf("expecting b but got %s", value)
+		return
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	m := New(nil)
+
+	results, err := m.Transaction(ctx,
+		redis.NewCommand(redis.CommandIncrement, "counter"),
+		redis.NewCommand(redis.CommandHSet, "key", "field", "value"),
+		redis.NewCommand(redis.CommandGet, "key"),
+		redis.NewCommand(redis.CommandGet, "missing"),
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if n, err := redis.Int(results[0].Value, results[0].Err); n != 1 || err != nil {
+		t.Errorf("expecting 1 but got %d, error %v", n, err)
+		return
+	}
+	if _, err := redis.String(results[2].Value, results[2].Err); err != ErrWrongType {
+		t.Errorf("expecting wrong type error but got %v", err)
+		return
+	}
+	if _, err := redis.String(results[3].Value, results[3].Err); !m.IsErrNil(err) {
+		t.Errorf("expecting nil error but got %v", err)
+		return
+	}
+
+	value, err := m.HGetAll(ctx, "key")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(value, map[string]string{"field": "value"}) {
+		t.Errorf("unexpected hash value %v", value)
+		return
+	}
+}
@@ -0,0 +1,416 @@
+package memory
+
+// the replies of pipeline and transaction are converted to the same types as redigo replies,
+// so the reply helpers in redis package work for both implementation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+)
+
+// Pipeline execute all commands sequentially
+// error of each command is returned in the result
+func (m *Memory) Pipeline(ctx context.Context, commands ...redis.Command) ([]redis.Result, error) {
+	results := make([]redis.Result, len(commands))
+	for i, cmd := range commands {
+		value, err := m.do(ctx, cmd)
+		results[i] = redis.Result{Value: value, Err: err}
+	}
+	return results, nil
+}
+
+// Transaction execute all commands atomically
+func (m *Memory) Transaction(ctx context.Context, commands ...redis.Command) ([]redis.Result, error) {
+	defer m.lock()()
+	v := m.view()
+
+	results := make([]redis.Result, len(commands))
+	for i, cmd := range commands {
+		value, err := v.do(ctx, cmd)
+		results[i] = redis.Result{Value: value, Err: err}
+	}
+	return results, nil
+}
+
+// do execute a command and convert the result to redigo reply
+func (m *Memory) do(ctx context.Context, cmd redis.Command) (interface{}, error) {
+	args := commandArgs(cmd.Args)
+
+	switch strings.ToUpper(cmd.Name) {
+	case redis.CommandPing:
+		return status(m.Ping(ctx))
+	case redis.CommandSet:
+		if err := args.require(2); err != nil {
+			return nil, err
+		}
+		return status(m.Set(ctx, args.string(0), cmd.Args[1]))
+	case redis.CommandSetNX:
+		if err := args.require(2); err != nil {
+			return nil, err
+		}
+		return integer(m.SetNX(ctx, args.string(0), cmd.Args[1], 0))
+	case redis.CommandSetEX:
+		if err := args.require(3); err != nil {
+			return nil, err
+		}
+		expire, err := args.int(1)
+		if err != nil {
+			return nil, err
+		}
+		return status(m.SetEX(ctx, args.string(0), cmd.Args[2], expire))
+	case redis.CommandGet:
+		if err := args.require(1); err != nil {
+			return nil, err
+		}
+		return bulk(m.Get(ctx, args.string(0)))
+	case redis.CommandDelete:
+		if err := args.require(1); err != nil {
+			return nil, err
+		}
+		deleted := 0
+		for i := range args {
+			n, _ := m.Delete(ctx, args.string(i))
+			deleted += n
+		}
+		return int64(deleted), nil
+	case redis.CommandIncrement:
+		if err := args.require(1); err != nil {
+			return nil, err
+		}
+		return integer(m.Increment(ctx, args.string(0)))
+	case redis.CommandIncrementBy:
+		if err := args.require(2); err != nil {
+			return nil, err
+		}
+		amount, err := args.int(1)
+		if err != nil {
+			return nil, err
+		}
+		return integer(m.IncrementBy(ctx, args.string(0), amount))
+	case redis.CommandExpire:
+		if err := args.require(2); err != nil {
+			return nil, err
+		}
+		duration, err := args.int(1)
+		if err != nil {
+			return nil, err
+		}
+		return integer(m.Expire(ctx, args.string(0), duration))
+	case redis.CommandTTL:
+		if err := args.require(1); err != nil {
+			return nil, err
+		}
+		return integer(m.TTL(ctx, args.string(0)))
+	case redis.CommandPersist:
+		if err := args.require(1); err != nil {
+			return nil, err
+		}
+		return integer(m.Persist(ctx, args.string(0)))
+	case redis.CommandMSet:
+		return status(m.MSet(ctx, cmd.Args...))
+	case redis.CommandMGet:
+		if err := args.require(1); err != nil {
+			return nil, err
+		}
+		// MGet return empty string for missing key, use get to return nil instead
+		values := make([]interface{}, len(args))
+		for i := range args {
+			if s, err := m.Get(ctx, args.string(i)); err == nil {
+				values[i] = []byte(s)
+			}
+		}
+		return values, nil
+	case redis.CommandHSet:
+		if err := args.require(3); err != nil {
+			return nil, err
+		}
+		return integer(m.HSet(ctx, args.string(0), args.string(1), cmd.Args[2]))
+	case redis.CommandHGet:
+		if err := args.require(2); err != nil {
+			return nil, err
+		}
+		return bulk(m.HGet(ctx, args.string(0), args.string(1)))
+	case redis.CommandHGetAll:
+		if err := args.require(1); err != nil {
+			return nil, err
+		}
+		kv, err := m.HGetAll(ctx, args.string(0))
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, 0, len(kv)*2)
+		for k, v := range kv {
+			values = append(values, []byte(k), []byte(v))
+		}
+		return values, nil
+	case redis.CommandHMSet:
+		if err := args.require(3); err != nil {
+			return nil, err
+		}
+		if len(args)%2 != 1 {
+			return nil, wrongArgs(cmd.Name)
+		}
+		kv := make(map[string]interface{})
+		for i := 1; i < len(args); i += 2 {
+			kv[args.string(i)] = cmd.Args[i+1]
+		}
+		return status(m.HMSet(ctx, args.string(0), kv))
+	case redis.CommandHMGet:
+		if err := args.require(2); err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(args)-1)
+		for i := 1; i < len(args); i++ {
+			if s, err := m.HGet(ctx, args.string(0), args.string(i)); err == nil {
+				values[i-1] = []byte(s)
+			} else if !m.IsErrNil(err) {
+				return nil, err
+			}
+		}
+		return values, nil
+	case redis.CommandHDel:
+		if err := args.require(2); err != nil {
+			return nil, err
+		}
+		return integer(m.HDel(ctx, args.string(0), args.strings(1)...))
+	case redis.CommandLLen:
+		if err := args.require(1); err != nil {
+			return nil, err
+		}
+		return integer(m.LLen(ctx, args.string(0)))
+	case redis.CommandLIndex:
+		if err := args.require(2); err != nil {
+			return nil, err
+		}
+		index, err := args.int(1)
+		if err != nil {
+			return nil, err
+		}
+		return bulk(m.LIndex(ctx, args.string(0), index))
+	case redis.CommandLSET:
+		if err := args.require(3); err != nil {
+			return nil, err
+		}
+		index, err := args.int(1)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := m.LSet(ctx, args.string(0), args.string(2), index); err != nil {
+			return nil, err
+		}
+		return "OK", nil
+	case redis.CommandLPush:
+		if err := args.require(2); err != nil {
+			return nil, err
+		}
+		return integer(m.LPush(ctx, args.string(0), cmd.Args[1:]...))
+	case redis.CommandLPushX:
+		if err := args.require(2); err != nil {
+			return nil, err
+		}
+		return integer(m.LPushX(ctx, args.string(0), cmd.Args[1:]...))
+	case redis.CommandLPop:
+		if err := args.require(1); err != nil {
+			return nil, err
+		}
+		return bulk(m.LPop(ctx, args.string(0)))
+	case redis.CommandLRem:
+		if err := args.require(3); err != nil {
+			return nil, err
+		}
+		count, err := args.int(1)
+		if err != nil {
+			return nil, err
+		}
+		return integer(m.LRem(ctx, args.string(0), args.string(2), count))
+	case redis.CommandLTrim:
+		if err := args.require(3); err != nil {
+			return nil, err
+		}
+		start, err := args.int(1)
+		if err != nil {
+			return nil, err
+		}
+		stop, err := args.int(2)
+		if err != nil {
+			return nil, err
+		}
+		return status(m.LTrim(ctx, args.string(0), start, stop))
+	case redis.CommandSAdd:
+		if err := args.require(2); err != nil {
+			return nil, err
+		}
+		return integer(m.SAdd(ctx, args.string(0), cmd.Args[1:]...))
+	case redis.CommandSRem:
+		if err := args.require(2); err != nil {
+			return nil, err
+		}
+		return integer(m.SRem(ctx, args.string(0), cmd.Args[1:]...))
+	case redis.CommandSMembers:
+		if err := args.require(1); err != nil {
+			return nil, err
+		}
+		return array(m.SMembers(ctx, args.string(0)))
+	case redis.CommandSIsMember:
+		if err := args.require(2); err != nil {
+			return nil, err
+		}
+		ok, err := m.SIsMember(ctx, args.string(0), cmd.Args[1])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case redis.CommandSCard:
+		if err := args.require(1); err != nil {
+			return nil, err
+		}
+		return integer(m.SCard(ctx, args.string(0)))
+	case redis.CommandZAdd:
+		if err := args.require(3); err != nil {
+			return nil, err
+		}
+		if len(args)%2 != 1 {
+			return nil, errSyntax
+		}
+		members := make([]redis.ZMember, 0, len(args)/2)
+		for i := 1; i < len(args); i += 2 {
+			score, err := strconv.ParseFloat(args.string(i), 64)
+			if err != nil {
+				return nil, errNotFloat
+			}
+			members = append(members, redis.ZMember{Member: args.string(i + 1), Score: score})
+		}
+		return integer(m.ZAdd(ctx, args.string(0), members...))
+	case redis.CommandZRem:
+		if err := args.require(2); err != nil {
+			return nil, err
+		}
+		return integer(m.ZRem(ctx, args.string(0), args.strings(1)...))
+	case redis.CommandZScore:
+		if err := args.require(2); err != nil {
+			return nil, err
+		}
+		score, err := m.ZScore(ctx, args.string(0), args.string(1))
+		if err != nil {
+			if m.IsErrNil(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return []byte(strconv.FormatFloat(score, 'g', -1, 64)), nil
+	case redis.CommandZCard:
+		if err := args.require(1); err != nil {
+			return nil, err
+		}
+		return integer(m.ZCard(ctx, args.string(0)))
+	case redis.CommandZRangeBy:
+		if err := args.require(3); err != nil {
+			return nil, err
+		}
+		members, err := m.ZRangeByScore(ctx, args.string(0), args.string(1), args.string(2))
+		if err != nil {
+			return nil, err
+		}
+		withScores := len(args) > 3 && strings.EqualFold(args.string(3), "WITHSCORES")
+		values := make([]interface{}, 0, len(members)*2)
+		for _, member := range members {
+			values = append(values, []byte(member.Member))
+			if withScores {
+				values = append(values, []byte(strconv.FormatFloat(member.Score, 'g', -1, 64)))
+			}
+		}
+		return values, nil
+	case redis.CommandZRemRangeBy:
+		if err := args.require(3); err != nil {
+			return nil, err
+		}
+		return integer(m.ZRemRangeByScore(ctx, args.string(0), args.string(1), args.string(2)))
+	case redis.CommandPublish:
+		if err := args.require(2); err != nil {
+			return nil, err
+		}
+		return integer(m.Publish(ctx, args.string(0), cmd.Args[1]))
+	}
+	return nil, fmt.Errorf("ERR unknown command '%s'", cmd.Name)
+}
+
+// commandArgs is the arguments of command converted to string
+type commandArgs []interface{}
+
+func (a commandArgs) require(n int) error {
+	if len(a) < n {
+		return errors.New("ERR wrong number of arguments")
+	}
+	return nil
+}
+
+func (a commandArgs) string(i int) string {
+	return toString(a[i])
+}
+
+func (a commandArgs) strings(from int) []string {
+	s := make([]string, 0, len(a)-from)
+	for i := from; i < len(a); i++ {
+		s = append(s, a.string(i))
+	}
+	return s
+}
+
+func (a commandArgs) int(i int) (int, error) {
+	v, err := strconv.Atoi(a.string(i))
+	if err != nil {
+		return 0, errNotInteger
+	}
+	return v, nil
+}
+
+func wrongArgs(name string) error {
+	return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(name))
+}
+
+// status reply is returned as string by redigo
+func status(s string, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// integer reply is returned as int64 by redigo
+func integer(n int, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return int64(n), nil
+}
+
+// bulk reply is returned as []byte by redigo, and nil for nil reply
+func bulk(s string, err error) (interface{}, error) {
+	if err != nil {
+		if errors.Is(err, redis.ErrNil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+// array reply is returned as []interface{} by redigo
+func array(s []string, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(s))
+	for i, v := range s {
+		values[i] = []byte(v)
+	}
+	return values, nil
+}
@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+)
+
+// messageBufferSize is the size of messages channel in subscription
+// message is dropped when the buffer is full, the same as slow subscriber in redis
+const messageBufferSize = 100
+
+// Publish message to a channel, return the number of subscribers receiving the message
+func (m *Memory) Publish(ctx context.Context, channel string, message interface{}) (int, error) {
+	defer m.lock()()
+	msg := redis.Message{Channel: channel, Payload: []byte(toString(message))}
+
+	received := 0
+	for s := range m.state.subscribers[channel] {
+		if s.send(msg) {
+			received++
+		}
+	}
+	return received, nil
+}
+
+// Subscribe to channels
+func (m *Memory) Subscribe(ctx context.Context, channels ...string) (redis.Subscription, error) {
+	defer m.lock()()
+	s := &subscription{
+		state:    m.state,
+		channels: channels,
+		messages: make(chan redis.Message, messageBufferSize),
+	}
+	for _, channel := range channels {
+		subs, ok := m.state.subscribers[channel]
+		if !ok {
+			subs = make(map[*subscription]struct{})
+			m.state.subscribers[channel] = subs
+		}
+		subs[s] = struct{}{}
+	}
+	return s, nil
+}
+
+// subscription of memory pub/sub
+type subscription struct {
+	state    *state
+	channels []string
+
+	mu       sync.Mutex
+	closed   bool
+	messages chan redis.Message
+}
+
+// send message without blocking, return false if the message is dropped
+func (s *subscription) send(msg redis.Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+
+	select {
+	case s.messages <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// close the messages channel, the caller must remove the subscription from state
+func (s *subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.messages)
+}
+
+// Messages return channel of messages
+func (s *subscription) Messages() <-chan redis.Message {
+	return s.messages
+}
+
+// Close unsubscribe all channels
+func (s *subscription) Close() error {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	for _, channel := range s.channels {
+		subs := s.state.subscribers[channel]
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(s.state.subscribers, channel)
+		}
+	}
+	s.close()
+	return nil
+}
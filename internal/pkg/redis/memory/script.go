@@ -0,0 +1,32 @@
+package memory
+
+import (
+	"context"
+	"errors"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+)
+
+// ErrNoScript returned when the script is not registered
+var ErrNoScript = errors.New("NOSCRIPT No matching script. Please use EVAL.")
+
+// ScriptFunc is the go implementation of a lua script
+// r is locked for the whole function, so the script is executed atomically like in redis
+// r must not be used outside of the function
+type ScriptFunc func(ctx context.Context, r redis.Redis, keys []string, args []interface{}) (interface{}, error)
+
+// RegisterScript register the go implementation of a lua script, as memory can't run lua
+func (m *Memory) RegisterScript(script *redis.Script, fn ScriptFunc) {
+	defer m.lock()()
+	m.state.scripts[script.Hash()] = fn
+}
+
+// Eval run the registered implementation of the script
+func (m *Memory) Eval(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (interface{}, error) {
+	defer m.lock()()
+	fn, ok := m.state.scripts[script.Hash()]
+	if !ok {
+		return nil, ErrNoScript
+	}
+	return fn(ctx, m.view(), keys, args)
+}
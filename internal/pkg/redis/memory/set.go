@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"context"
+	"sort"
+)
+
+// SAdd add members to a set, return the number of new members
+func (m *Memory) SAdd(ctx context.Context, key string, members ...interface{}) (int, error) {
+	defer m.lock()()
+	e, err := m.getOrCreate(key, kindSet)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, member := range members {
+		s := toString(member)
+		if _, ok := e.set[s]; !ok {
+			e.set[s] = struct{}{}
+			added++
+		}
+	}
+	return added, nil
+}
+
+// SRem remove members from a set, the key is deleted when the set is empty
+func (m *Memory) SRem(ctx context.Context, key string, members ...interface{}) (int, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindSet)
+	if err != nil || e == nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, member := range members {
+		s := toString(member)
+		if _, ok := e.set[s]; ok {
+			delete(e.set, s)
+			removed++
+		}
+	}
+	if len(e.set) == 0 {
+		delete(m.state.data, key)
+	}
+	return removed, nil
+}
+
+// SMembers return all members of a set, sorted to make the result deterministic
+func (m *Memory) SMembers(ctx context.Context, key string) ([]string, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindSet)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []string{}
+	if e == nil {
+		return members, nil
+	}
+	for member := range e.set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+// SIsMember return true if member is a member of the set
+func (m *Memory) SIsMember(ctx context.Context, key string, member interface{}) (bool, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindSet)
+	if err != nil || e == nil {
+		return false, err
+	}
+	_, ok := e.set[toString(member)]
+	return ok, nil
+}
+
+// SCard return the number of members in a set
+func (m *Memory) SCard(ctx context.Context, key string) (int, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindSet)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	return len(e.set), nil
+}
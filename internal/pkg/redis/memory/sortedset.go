@@ -0,0 +1,181 @@
+package memory
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+)
+
+// scoreBound is the min or max score of range, exclusive if prefixed with (
+type scoreBound struct {
+	score     float64
+	exclusive bool
+}
+
+func parseScoreBound(s string) (scoreBound, error) {
+	b := scoreBound{}
+	if strings.HasPrefix(s, "(") {
+		b.exclusive = true
+		s = s[1:]
+	}
+
+	switch strings.ToLower(s) {
+	case "-inf":
+		b.score = math.Inf(-1)
+	case "+inf", "inf":
+		b.score = math.Inf(1)
+	default:
+		score, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return b, errNotFloat
+		}
+		b.score = score
+	}
+	return b, nil
+}
+
+// inRange return true if score is between min and max
+func inRange(score float64, min, max scoreBound) bool {
+	if score < min.score || (min.exclusive && score == min.score) {
+		return false
+	}
+	if score > max.score || (max.exclusive && score == max.score) {
+		return false
+	}
+	return true
+}
+
+// rangeByScore return members between min and max, ordered by score and then member
+func rangeByScore(e *entry, min, max string) ([]redis.ZMember, error) {
+	minBound, err := parseScoreBound(min)
+	if err != nil {
+		return nil, err
+	}
+	maxBound, err := parseScoreBound(max)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []redis.ZMember{}
+	for member, score := range e.zset {
+		if inRange(score, minBound, maxBound) {
+			members = append(members, redis.ZMember{Member: member, Score: score})
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Score != members[j].Score {
+			return members[i].Score < members[j].Score
+		}
+		return members[i].Member < members[j].Member
+	})
+	return members, nil
+}
+
+// ZAdd add members with score to a sorted set, return the number of new members
+func (m *Memory) ZAdd(ctx context.Context, key string, members ...redis.ZMember) (int, error) {
+	defer m.lock()()
+	e, err := m.getOrCreate(key, kindZSet)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, member := range members {
+		if _, ok := e.zset[member.Member]; !ok {
+			added++
+		}
+		e.zset[member.Member] = member.Score
+	}
+	return added, nil
+}
+
+// ZRem remove members from a sorted set, the key is deleted when the sorted set is empty
+func (m *Memory) ZRem(ctx context.Context, key string, members ...string) (int, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindZSet)
+	if err != nil || e == nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, member := range members {
+		if _, ok := e.zset[member]; ok {
+			delete(e.zset, member)
+			removed++
+		}
+	}
+	if len(e.zset) == 0 {
+		delete(m.state.data, key)
+	}
+	return removed, nil
+}
+
+// ZScore return the score of a member in a sorted set
+func (m *Memory) ZScore(ctx context.Context, key, member string) (float64, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindZSet)
+	if err != nil {
+		return 0, err
+	}
+	if e == nil {
+		return 0, redis.ErrNil
+	}
+
+	score, ok := e.zset[member]
+	if !ok {
+		return 0, redis.ErrNil
+	}
+	return score, nil
+}
+
+// ZCard return the number of members in a sorted set
+func (m *Memory) ZCard(ctx context.Context, key string) (int, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindZSet)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	return len(e.zset), nil
+}
+
+// ZRangeByScore return members with score between min and max, ordered from the lowest score
+func (m *Memory) ZRangeByScore(ctx context.Context, key, min, max string) ([]redis.ZMember, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindZSet)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		// still validate the bounds like redis does
+		if _, err := rangeByScore(&entry{}, min, max); err != nil {
+			return nil, err
+		}
+		return []redis.ZMember{}, nil
+	}
+	return rangeByScore(e, min, max)
+}
+
+// ZRemRangeByScore remove members with score between min and max
+func (m *Memory) ZRemRangeByScore(ctx context.Context, key, min, max string) (int, error) {
+	defer m.lock()()
+	e, err := m.get(key, kindZSet)
+	if err != nil || e == nil {
+		return 0, err
+	}
+
+	members, err := rangeByScore(e, min, max)
+	if err != nil {
+		return 0, err
+	}
+	for _, member := range members {
+		delete(e.zset, member.Member)
+	}
+	if len(e.zset) == 0 {
+		delete(m.state.data, key)
+	}
+	return len(members), nil
+}
@@ -0,0 +1,347 @@
+package redigo
+
+// connect to redis cluster, the command is routed to the node serving the slot of the key
+// the slots map is loaded from CLUSTER SLOTS and updated when MOVED redirection is received
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// list of cluster constants
+const (
+	// SlotCount is the number of hash slots in redis cluster
+	SlotCount = 16384
+	// maxRedirects is the maximum number of MOVED/ASK redirection or reconnection for a command
+	maxRedirects = 3
+	// minRefreshInterval is the minimum interval between slots refresh
+	minRefreshInterval = time.Millisecond * 100
+)
+
+// ClusterConfig of redis cluster
+type ClusterConfig struct {
+	// Addresses of seed nodes, used to load the cluster slots
+	Addresses []string
+}
+
+// NewCluster create redis connection to redis cluster
+// the cluster slots are loaded from the seed nodes, error is returned if no seed node is reachable
+func NewCluster(ctx context.Context, clusterConfig ClusterConfig, config *Config) (*Redigo, error) {
+	if len(clusterConfig.Addresses) == 0 {
+		return nil, errors.New("redigo: cluster addresses is empty")
+	}
+	if config == nil {
+		config = &Config{}
+	}
+
+	c := &cluster{
+		seeds:  append([]string(nil), clusterConfig.Addresses...),
+		config: config,
+		pools:  make(map[string]*redigo.Pool),
+	}
+	if err := c.refresh(ctx); err != nil {
+		c.close()
+		return nil, err
+	}
+
+	r := Redigo{
+		conn: c,
+	}
+	return &r, nil
+}
+
+type cluster struct {
+	seeds  []string
+	config *Config
+
+	mu    sync.RWMutex
+	slots [SlotCount]string
+	pools map[string]*redigo.Pool
+
+	refreshMu   sync.Mutex
+	lastRefresh time.Time
+	refreshing  int32
+}
+
+// Slot return the hash slot of key
+// only the hash tag is hashed if the key contains {hash_tag}, so keys with the same hash tag are in the same slot
+func Slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % SlotCount)
+}
+
+// crc16 implementation of CRC16-CCITT (XMODEM) used by redis cluster
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// redirection of MOVED and ASK error
+type redirection struct {
+	ask  bool
+	slot int
+	addr string
+}
+
+// parseRedirection parse MOVED and ASK error, for example: MOVED 3999 127.0.0.1:6381
+func parseRedirection(err error) (redirection, bool) {
+	e, ok := err.(redigo.Error)
+	if !ok {
+		return redirection{}, false
+	}
+
+	fields := strings.Fields(string(e))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return redirection{}, false
+	}
+	slot, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return redirection{}, false
+	}
+	return redirection{ask: fields[0] == "ASK", slot: slot, addr: fields[2]}, true
+}
+
+// pool return connection pool of the node, the pool is created if not exist
+func (c *cluster) pool(addr string) *redigo.Pool {
+	c.mu.RLock()
+	p, ok := c.pools[addr]
+	c.mu.RUnlock()
+	if ok {
+		return p
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.pools[addr]; ok {
+		return p
+	}
+	p = newPool(c.config, func() (redigo.Conn, error) {
+		return dial(addr, c.config)
+	}, nil)
+	c.pools[addr] = p
+	return p
+}
+
+// node return the address of node serving the key
+// the first seed node is returned for empty key or unknown slot
+func (c *cluster) node(key string) string {
+	slot := 0
+	if key != "" {
+		slot = Slot(key)
+	}
+
+	c.mu.RLock()
+	addr := c.slots[slot]
+	c.mu.RUnlock()
+	if addr == "" {
+		return c.seeds[0]
+	}
+	return addr
+}
+
+func (c *cluster) setSlot(slot int, addr string) {
+	if slot < 0 || slot >= SlotCount {
+		return
+	}
+	c.mu.Lock()
+	c.slots[slot] = addr
+	c.mu.Unlock()
+}
+
+// refresh load the slots from CLUSTER SLOTS of the known nodes
+func (c *cluster) refresh(ctx context.Context) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	if time.Since(c.lastRefresh) < minRefreshInterval {
+		return nil
+	}
+
+	// ask the nodes serving slots first, as the seed nodes might be removed from the cluster
+	c.mu.RLock()
+	addrs := make([]string, 0, len(c.pools)+len(c.seeds))
+	for addr := range c.pools {
+		addrs = append(addrs, addr)
+	}
+	c.mu.RUnlock()
+	addrs = append(addrs, c.seeds...)
+
+	var lastErr error
+	for _, addr := range addrs {
+		slots, err := c.loadSlots(ctx, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		c.mu.Lock()
+		c.slots = slots
+		c.mu.Unlock()
+		c.lastRefresh = time.Now()
+		return nil
+	}
+	return fmt.Errorf("redigo: failed to load cluster slots: %w", lastErr)
+}
+
+// refreshAsync refresh the slots in background, only one refresh is running at the same time
+func (c *cluster) refreshAsync() {
+	if !atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&c.refreshing, 0)
+		c.refresh(context.Background())
+	}()
+}
+
+// loadSlots from CLUSTER SLOTS, the reply is list of [start, end, [host, port, id], replicas...]
+func (c *cluster) loadSlots(ctx context.Context, addr string) ([SlotCount]string, error) {
+	var slots [SlotCount]string
+
+	conn, err := c.pool(addr).GetContext(ctx)
+	if err != nil {
+		return slots, err
+	}
+	defer conn.Close()
+
+	resp, err := redigo.Values(conn.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		return slots, err
+	}
+	if len(resp) == 0 {
+		return slots, errors.New("redigo: cluster has no slots")
+	}
+
+	for _, r := range resp {
+		values, err := redigo.Values(r, nil)
+		if err != nil || len(values) < 3 {
+			return slots, fmt.Errorf("redigo: unexpected cluster slots reply %v", r)
+		}
+		start, err := redigo.Int(values[0], nil)
+		if err != nil {
+			return slots, err
+		}
+		end, err := redigo.Int(values[1], nil)
+		if err != nil {
+			return slots, err
+		}
+		master, err := redigo.Values(values[2], nil)
+		if err != nil || len(master) < 2 {
+			return slots, fmt.Errorf("redigo: unexpected cluster node reply %v", values[2])
+		}
+		host, err := redigo.String(master[0], nil)
+		if err != nil {
+			return slots, err
+		}
+		port, err := redigo.Int(master[1], nil)
+		if err != nil {
+			return slots, err
+		}
+		// empty host means the node that answer the command
+		if host == "" {
+			host, _, _ = net.SplitHostPort(addr)
+		}
+
+		nodeAddr := net.JoinHostPort(host, strconv.Itoa(port))
+		for slot := start; slot <= end && slot < SlotCount; slot++ {
+			slots[slot] = nodeAddr
+		}
+	}
+	return slots, nil
+}
+
+// do follow MOVED and ASK redirection, and reload the slots when the node is unreachable
+// the command is not applied when redirected, so it is always safe to send the command again to the other node.
+func (c *cluster) do(ctx context.Context, key string, readOnly bool, fn func(conn redigo.Conn) (interface{}, error)) (interface{}, error) {
+	addr := c.node(key)
+	asking := false
+
+	for attempt := 0; ; attempt++ {
+		resp, sent, err := c.doNode(ctx, addr, asking, fn)
+		if err == nil || attempt >= maxRedirects || ctx.Err() != nil {
+			return resp, err
+		}
+
+		if r, ok := parseRedirection(err); ok {
+			addr = r.addr
+			asking = r.ask
+			// MOVED means the slot is permanently moved, other slots might be moved too
+			if !r.ask {
+				c.setSlot(r.slot, r.addr)
+				c.refreshAsync()
+			}
+			continue
+		}
+		// the command might be applied when the connection failed after the command is sent,
+		// so only send it again when the command is not sent yet or the command is read only
+		if isConnError(err) && (!sent || readOnly) {
+			// the node might be failed and replaced by its replica
+			if rerr := c.refresh(ctx); rerr != nil {
+				return resp, err
+			}
+			addr = c.node(key)
+			asking = false
+			continue
+		}
+		return resp, err
+	}
+}
+
+// doNode call fn with connection to the node, sent is false if the error happened before fn is called
+func (c *cluster) doNode(ctx context.Context, addr string, asking bool, fn func(conn redigo.Conn) (interface{}, error)) (resp interface{}, sent bool, err error) {
+	conn, err := c.pool(addr).GetContext(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer conn.Close()
+
+	if asking {
+		if _, err := conn.Do("ASKING"); err != nil {
+			return nil, false, err
+		}
+	}
+	resp, err = fn(conn)
+	return resp, true, err
+}
+
+func (c *cluster) get(ctx context.Context, key string) (redigo.Conn, error) {
+	return c.pool(c.node(key)).GetContext(ctx)
+}
+
+func (c *cluster) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []string
+	for addr, p := range c.pools {
+		if err := p.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", addr, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("redigo: failed to close cluster connections: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package redigo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+func TestSlot(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		key    string
+		expect int
+	}{
+		{key: "123456789", expect: 12739},
+		{key: "foo", expect: 12182},
+		{key: "bar", expect: 5061},
+		{key: "{foo}.bar", expect: 12182},
+		{key: "user:{foo}", expect: 12182},
+	}
+
+	for _, c := range cases {
+		slot := Slot(c.key)
+		if slot != c.expect {
+			t.Errorf("key %s: expecting slot %d but got %d", c.key, c.expect, slot)
+			return
+		}
+	}
+
+	// empty hash tag, the whole key is hashed
+	if Slot("{}foo") == Slot("foo") {
+		t.Error("empty hash tag should not be used as hash tag")
+		return
+	}
+}
+
+func TestParseRedirection(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		err    error
+		expect redirection
+		ok     bool
+	}{
+		{err: redigo.Error("MOVED 3999 127.0.0.1:6381"), expect: redirection{slot: 3999, addr: "127.0.0.1:6381"}, ok: true},
+		{err: redigo.Error("ASK 3999 127.0.0.1:6381"), expect: redirection{ask: true, slot: 3999, addr: "127.0.0.1:6381"}, ok: true},
+		{err: redigo.Error("ERR unknown command")},
+		{err: errors.New("MOVED 3999 127.0.0.1:6381")},
+		{err: nil},
+	}
+
+	for _, c := range cases {
+		r, ok := parseRedirection(c.err)
+		if ok != c.ok {
+			t.Errorf("%v: expecting ok %v but got %v", c.err, c.ok, ok)
+			return
+		}
+		if r != c.expect {
+			t.Errorf("%v: expecting %+v but got %+v", c.err, c.expect, r)
+			return
+		}
+	}
+}
+
+// newFakeCluster create cluster with the fake connection for each node address
+// the slots is not refreshed, as the last refresh is set to now
+func newFakeCluster(seed string, conns map[string]*fakeConn) *cluster {
+	c := &cluster{
+		seeds:       []string{seed},
+		config:      &Config{},
+		pools:       make(map[string]*redigo.Pool),
+		lastRefresh: time.Now(),
+	}
+	for addr, conn := range conns {
+		conn := conn
+		c.pools[addr] = newPool(c.config, func() (redigo.Conn, error) {
+			return conn, nil
+		}, nil)
+	}
+	return c
+}
+
+func TestClusterRedirection(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		reply         error
+		expectNode1   []string
+		expectNode2   []string
+		expectMovedTo string
+	}{
+		{
+			name:          "moved",
+			reply:         redigo.Error("MOVED 12182 node2:6379"),
+			expectNode1:   []string{"INCR foo"},
+			expectNode2:   []string{"INCR foo"},
+			expectMovedTo: "node2:6379",
+		},
+		{
+			name:          "ask",
+			reply:         redigo.Error("ASK 12182 node2:6379"),
+			expectNode1:   []string{"INCR foo"},
+			expectNode2:   []string{"ASKING", "INCR foo"},
+			expectMovedTo: "node1:6379",
+		},
+	}
+
+	for _, c := range cases {
+		reply := c.reply
+		node1 := &fakeConn{reply: func(cmd string, args ...interface{}) (interface{}, error) {
+			return nil, reply
+		}}
+		node2 := &fakeConn{}
+		cl := newFakeCluster("node1:6379", map[string]*fakeConn{"node1:6379": node1, "node2:6379": node2})
+		rdg := Redigo{conn: cl}
+
+		if _, err := rdg.do(context.Background(), "INCR", "foo"); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			return
+		}
+		if !reflect.DeepEqual(node1.Commands(), c.expectNode1) {
+			t.Errorf("%s: expecting node1 commands %v but got %v", c.name, c.expectNode1, node1.Commands())
+			return
+		}
+		if !reflect.DeepEqual(node2.Commands(), c.expectNode2) {
+			t.Errorf("%s: expecting node2 commands %v but got %v", c.name, c.expectNode2, node2.Commands())
+			return
+		}
+		// only MOVED change the slot
+		if addr := cl.node("foo"); addr != c.expectMovedTo {
+			t.Errorf("%s: expecting slot served by %s but got %s", c.name, c.expectMovedTo, addr)
+			return
+		}
+	}
+}
+
+func TestClusterConnError(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		cmd         string
+		expectError bool
+		expect      []string
+	}{
+		{
+			cmd:    "GET",
+			expect: []string{"GET foo", "GET foo"},
+		},
+		// the command might be applied, so it is not sent again
+		{
+			cmd:         "INCR",
+			expectError: true,
+			expect:      []string{"INCR foo"},
+		},
+	}
+
+	for _, c := range cases {
+		failed := false
+		node := &fakeConn{reply: func(cmd string, args ...interface{}) (interface{}, error) {
+			if !failed {
+				failed = true
+				return nil, errors.New("connection reset by peer")
+			}
+			return "OK", nil
+		}}
+		cl := newFakeCluster("node1:6379", map[string]*fakeConn{"node1:6379": node})
+		rdg := Redigo{conn: cl}
+
+		_, err := rdg.do(context.Background(), c.cmd, "foo")
+		if (err != nil) != c.expectError {
+			t.Errorf("%s: expecting error %v but got %v", c.cmd, c.expectError, err)
+			return
+		}
+		if !reflect.DeepEqual(node.Commands(), c.expect) {
+			t.Errorf("%s: expecting commands %v but got %v", c.cmd, c.expect, node.Commands())
+			return
+		}
+	}
+}
+
+func TestClusterDialError(t *testing.T) {
+	t.Parallel()
+
+	dialed := 0
+	node := &fakeConn{}
+	cl := newFakeCluster("node1:6379", nil)
+	// the first dial failed, so the command is not sent and safe to be sent again
+	cl.pools["node1:6379"] = newPool(cl.config, func() (redigo.Conn, error) {
+		dialed++
+		if dialed == 1 {
+			return nil, errors.New("connection refused")
+		}
+		return node, nil
+	}, nil)
+	rdg := Redigo{conn: cl}
+
+	if _, err := rdg.do(context.Background(), "INCR", "foo"); err != nil {
+		t.Error(err)
+		return
+	}
+	expect := []string{"INCR foo"}
+	if !reflect.DeepEqual(node.Commands(), expect) {
+		t.Errorf("expecting commands %v but got %v", expect, node.Commands())
+		return
+	}
+}
@@ -116,13 +116,7 @@ func (rdg *Redigo) HSet(ctx context.Context, key, field string, value interface{
 
 // HSetEX key and value and sets the expiration to the given `expire` seconds
 func (rdg *Redigo) HSetEX(ctx context.Context, key, field string, value interface{}, expire int) (int, error) {
-	conn, err := rdg.getConn(ctx)
-	if err != nil {
-		return 0, err
-	}
-	defer conn.Close()
-
-	resp, err := redigo.Int(conn.Do(redis.CommandHSet, key, field, value))
+	resp, err := redigo.Int(rdg.do(ctx, redis.CommandHSet, key, field, value))
 	if err != nil && !rdg.IsErrNil(err) {
 		return resp, err
 	}
@@ -210,3 +204,22 @@ func (rdg *Redigo) HDel(ctx context.Context, key string, fields ...string) (int,
 	}
 	return resp, err
 }
+
+// TTL return the remaining time to live of a key in seconds
+// return -1 if the key has no expiration and -2 if the key does not exist
+func (rdg *Redigo) TTL(ctx context.Context, key string) (int, error) {
+	resp, err := redigo.Int(rdg.do(ctx, redis.CommandTTL, key))
+	if err != nil && !rdg.IsErrNil(err) {
+		return 0, err
+	}
+	return resp, err
+}
+
+// Persist remove the expiration of a key
+func (rdg *Redigo) Persist(ctx context.Context, key string) (int, error) {
+	resp, err := redigo.Int(rdg.do(ctx, redis.CommandPersist, key))
+	if err != nil && !rdg.IsErrNil(err) {
+		return 0, err
+	}
+	return resp, err
+}
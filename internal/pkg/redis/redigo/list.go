@@ -27,11 +27,14 @@ func (rdg *Redigo) LIndex(ctx context.Context, key string, index int) (string, e
 
 // LSet to set value to some index
 func (rdg *Redigo) LSet(ctx context.Context, key, value string, index int) (int, error) {
-	result, err := redigo.Int(rdg.do(ctx, redis.CommandLSET, index, value))
-	if err != nil && !rdg.IsErrNil(err) {
+	result, err := redigo.String(rdg.do(ctx, redis.CommandLSET, key, index, value))
+	if err != nil {
 		return 0, err
 	}
-	return result, err
+	if !rdg.IsResponseOK(result) {
+		return 0, redis.ErrResponseNotOK
+	}
+	return 1, nil
 }
 
 // LPush prepend values to the list
@@ -1,3 +1,108 @@
 package redigo
 
 // implement redis pipelining using redigo conn.Send
+
+import (
+	"context"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// Pipeline send all commands in one round trip
+// error of each command is returned in the result, the error is returned if the connection is failed
+// in redis cluster, the commands are grouped and sent to the node serving the keys
+func (rdg *Redigo) Pipeline(ctx context.Context, commands ...redis.Command) ([]redis.Result, error) {
+	// group the commands by node, keep the order of the nodes to make the behavior deterministic
+	var nodes []string
+	groups := make(map[string][]int)
+	for i, cmd := range commands {
+		node := rdg.conn.node(commandKey(cmd.Name, cmd.Args))
+		if _, ok := groups[node]; !ok {
+			nodes = append(nodes, node)
+		}
+		groups[node] = append(groups[node], i)
+	}
+
+	results := make([]redis.Result, len(commands))
+	for _, node := range nodes {
+		indexes := groups[node]
+		first := commands[indexes[0]]
+
+		// the pipeline is only sent again on connection error if all commands are read only
+		readOnly := true
+		for _, i := range indexes {
+			readOnly = readOnly && isReadOnly(commands[i].Name)
+		}
+
+		_, err := rdg.conn.do(ctx, commandKey(first.Name, first.Args), readOnly, func(conn redigo.Conn) (interface{}, error) {
+			for _, i := range indexes {
+				if err := conn.Send(commands[i].Name, commands[i].Args...); err != nil {
+					return nil, err
+				}
+			}
+			if err := conn.Flush(); err != nil {
+				return nil, err
+			}
+
+			for _, i := range indexes {
+				resp, err := conn.Receive()
+				if isConnError(err) {
+					return nil, err
+				}
+				results[i] = redis.Result{Value: resp, Err: err}
+			}
+			return nil, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// command is redirected when the slot is moved, send it again outside of pipeline
+		for _, i := range indexes {
+			if _, ok := parseRedirection(results[i].Err); ok {
+				resp, err := rdg.do(ctx, commands[i].Name, commands[i].Args...)
+				results[i] = redis.Result{Value: resp, Err: err}
+			}
+		}
+	}
+	return results, nil
+}
+
+// Transaction send all commands in MULTI/EXEC, so all commands are executed atomically
+// in redis cluster, all keys must be in the same slot
+func (rdg *Redigo) Transaction(ctx context.Context, commands ...redis.Command) ([]redis.Result, error) {
+	var key string
+	for _, cmd := range commands {
+		if key = commandKey(cmd.Name, cmd.Args); key != "" {
+			break
+		}
+	}
+
+	resp, err := redigo.Values(rdg.conn.do(ctx, key, false, func(conn redigo.Conn) (interface{}, error) {
+		if err := conn.Send(redis.CommandMulti); err != nil {
+			return nil, err
+		}
+		for _, cmd := range commands {
+			if err := conn.Send(cmd.Name, cmd.Args...); err != nil {
+				return nil, err
+			}
+		}
+		// Do flush all commands and return the reply of EXEC
+		// or the first error of the queued commands, for example MOVED
+		return conn.Do(redis.CommandExec)
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]redis.Result, len(resp))
+	for i, value := range resp {
+		if e, ok := value.(redigo.Error); ok {
+			results[i] = redis.Result{Err: e}
+			continue
+		}
+		results[i] = redis.Result{Value: value}
+	}
+	return results, nil
+}
@@ -0,0 +1,104 @@
+package redigo
+
+import (
+	"context"
+	"sync"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// messageBufferSize is the size of messages channel in subscription
+const messageBufferSize = 100
+
+// Publish message to a channel, return the number of subscribers receiving the message
+func (rdg *Redigo) Publish(ctx context.Context, channel string, message interface{}) (int, error) {
+	resp, err := redigo.Int(rdg.do(ctx, redis.CommandPublish, channel, message))
+	if err != nil && !rdg.IsErrNil(err) {
+		return 0, err
+	}
+	return resp, err
+}
+
+// Subscribe to channels, the subscription hold a connection until it is closed
+func (rdg *Redigo) Subscribe(ctx context.Context, channels ...string) (redis.Subscription, error) {
+	// published message is broadcasted to all nodes in redis cluster, so subscribe to any node
+	conn, err := rdg.getConn(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]interface{}, len(channels))
+	for i, channel := range channels {
+		args[i] = channel
+	}
+
+	psc := redigo.PubSubConn{Conn: conn}
+	if err := psc.Subscribe(args...); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	s := &subscription{
+		conn:     psc,
+		messages: make(chan redis.Message, messageBufferSize),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go s.receive()
+	return s, nil
+}
+
+// subscription of redigo pub/sub connection
+type subscription struct {
+	conn      redigo.PubSubConn
+	messages  chan redis.Message
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// receive messages until all channels are unsubscribed or the connection is failed
+func (s *subscription) receive() {
+	defer close(s.stopped)
+	defer close(s.messages)
+	defer s.conn.Close()
+
+	for {
+		switch v := s.conn.Receive().(type) {
+		case redigo.Message:
+			select {
+			case s.messages <- redis.Message{Channel: v.Channel, Payload: v.Data}:
+			case <-s.done:
+				return
+			}
+		case redigo.Subscription:
+			if v.Count == 0 {
+				return
+			}
+		case error:
+			return
+		}
+	}
+}
+
+// Messages return channel of messages
+func (s *subscription) Messages() <-chan redis.Message {
+	return s.messages
+}
+
+// Close unsubscribe all channels and wait until the connection is closed
+func (s *subscription) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		select {
+		case <-s.stopped:
+			// connection is already closed because of error
+		default:
+			err = s.conn.Unsubscribe()
+		}
+		close(s.done)
+		<-s.stopped
+	})
+	return err
+}
@@ -3,6 +3,10 @@ package redigo
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/albertwidi/go-project-example/internal/pkg/redis"
 
 	redigo "github.com/gomodule/redigo/redis"
@@ -10,44 +14,155 @@ import (
 
 // Redigo redis
 type Redigo struct {
-	pool *redigo.Pool
+	conn connector
+}
+
+// connector get connection to redis node, implemented by single node, sentinel and cluster
+type connector interface {
+	// do call fn with connection to the node serving the key, key is empty for command without key
+	// the connector is responsible to retry fn on redirection or failover.
+	// The command might be applied when the connection failed after the command is sent,
+	// so fn is only retried on connection error if the command is not sent yet or the command is read only.
+	do(ctx context.Context, key string, readOnly bool, fn func(conn redigo.Conn) (interface{}, error)) (interface{}, error)
+	// get connection to the node serving the key, the connection must be closed by the caller
+	get(ctx context.Context, key string) (redigo.Conn, error)
+	// node return the address of node serving the key
+	node(key string) string
+	close() error
 }
 
 // Config of connection
 type Config struct {
 	MaxActive int
 	MaxIdle   int
-	Timeout   int
+	// Timeout to connect to redis in second
+	Timeout int
 }
 
 // New redis connection using redigo library
 func New(ctx context.Context, address string, config *Config) (*Redigo, error) {
-	pool := &redigo.Pool{
-		Dial: func() (redigo.Conn, error) {
-			return redigo.Dial("tcp", address)
-		},
+	if config == nil {
+		config = &Config{}
 	}
 
 	r := Redigo{
-		pool: pool,
+		conn: &single{
+			pool: newPool(config, func() (redigo.Conn, error) {
+				return dial(address, config)
+			}, nil),
+		},
 	}
 	return &r, nil
 }
 
-// getConn return the connection of redigo
-func (rdg *Redigo) getConn(ctx context.Context) (redigo.Conn, error) {
-	return rdg.pool.GetContext(ctx)
+// newPool create connection pool based on the configuration
+func newPool(config *Config, dial func() (redigo.Conn, error), testOnBorrow func(redigo.Conn, time.Time) error) *redigo.Pool {
+	return &redigo.Pool{
+		MaxActive:    config.MaxActive,
+		MaxIdle:      config.MaxIdle,
+		Wait:         config.MaxActive > 0,
+		Dial:         dial,
+		TestOnBorrow: testOnBorrow,
+	}
 }
 
-func (rdg *Redigo) do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
-	conn, err := rdg.getConn(ctx)
+func dial(address string, config *Config) (redigo.Conn, error) {
+	var opts []redigo.DialOption
+	if config.Timeout > 0 {
+		opts = append(opts, redigo.DialConnectTimeout(time.Duration(config.Timeout)*time.Second))
+	}
+	return redigo.Dial("tcp", address, opts...)
+}
+
+// single redis node
+type single struct {
+	pool *redigo.Pool
+}
+
+func (s *single) do(ctx context.Context, key string, readOnly bool, fn func(conn redigo.Conn) (interface{}, error)) (interface{}, error) {
+	conn, err := s.get(ctx, key)
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close()
+	return fn(conn)
+}
+
+func (s *single) get(ctx context.Context, key string) (redigo.Conn, error) {
+	return s.pool.GetContext(ctx)
+}
+
+func (s *single) node(key string) string {
+	return ""
+}
 
-	resp, err := conn.Do(cmd, args...)
-	return resp, err
+func (s *single) close() error {
+	return s.pool.Close()
+}
+
+// getConn return the connection of redigo to the node serving the key
+func (rdg *Redigo) getConn(ctx context.Context, key string) (redigo.Conn, error) {
+	return rdg.conn.get(ctx, key)
+}
+
+func (rdg *Redigo) do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	return rdg.conn.do(ctx, commandKey(cmd, args), isReadOnly(cmd), func(conn redigo.Conn) (interface{}, error) {
+		return conn.Do(cmd, args...)
+	})
+}
+
+// readOnlyCommands is the commands that safe to be sent again, as the commands don't change the data
+var readOnlyCommands = map[string]bool{
+	redis.CommandPing:      true,
+	redis.CommandGet:       true,
+	redis.CommandMGet:      true,
+	redis.CommandHGet:      true,
+	redis.CommandHGetAll:   true,
+	redis.CommandHMGet:     true,
+	redis.CommandLLen:      true,
+	redis.CommandLIndex:    true,
+	redis.CommandTTL:       true,
+	redis.CommandSMembers:  true,
+	redis.CommandSIsMember: true,
+	redis.CommandSCard:     true,
+	redis.CommandZScore:    true,
+	redis.CommandZCard:     true,
+	redis.CommandZRangeBy:  true,
+}
+
+// isReadOnly return true if the command doesn't change the data
+func isReadOnly(cmd string) bool {
+	return readOnlyCommands[strings.ToUpper(cmd)]
+}
+
+// commandKey return the key of command used to route the command to the right node
+// the first argument is the key for all commands, except commands without key
+func commandKey(cmd string, args []interface{}) string {
+	switch strings.ToUpper(cmd) {
+	case redis.CommandPing, redis.CommandPublish, redis.CommandSubscribe, redis.CommandMulti, redis.CommandExec:
+		return ""
+	}
+	if len(args) == 0 {
+		return ""
+	}
+
+	switch key := args[0].(type) {
+	case string:
+		return key
+	case []byte:
+		return string(key)
+	default:
+		return fmt.Sprint(key)
+	}
+}
+
+// isConnError return true if the error is not returned by redis server, for example network error
+func isConnError(err error) bool {
+	if err == nil {
+		return false
+	}
+	_, ok := err.(redigo.Error)
+	return !ok
 }
 
 // Ping the redis
@@ -58,12 +173,12 @@ func (rdg *Redigo) Ping(ctx context.Context) (string, error) {
 
 // Close all redis connection
 func (rdg *Redigo) Close() error {
-	return rdg.pool.Close()
+	return rdg.conn.close()
 }
 
 // IsErrNil return true if error is nil
 func (rdg *Redigo) IsErrNil(err error) bool {
-	if !errors.Is(err, redigo.ErrNil) {
+	if !errors.Is(err, redigo.ErrNil) && !errors.Is(err, redis.ErrNil) {
 		return false
 	}
 	return true
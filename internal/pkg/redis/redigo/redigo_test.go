@@ -0,0 +1,123 @@
+package redigo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// fakeConn is redigo connection that record the commands
+// and reply the commands using the reply function
+type fakeConn struct {
+	mu       sync.Mutex
+	commands []string
+	reply    func(cmd string, args ...interface{}) (interface{}, error)
+	closed   bool
+}
+
+func (fc *fakeConn) Close() error {
+	fc.mu.Lock()
+	fc.closed = true
+	fc.mu.Unlock()
+	return nil
+}
+
+func (fc *fakeConn) Err() error {
+	return nil
+}
+
+func (fc *fakeConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	// empty command is sent by the pool to flush the connection
+	if cmd == "" {
+		return nil, nil
+	}
+	fc.mu.Lock()
+	fc.commands = append(fc.commands, strings.TrimSpace(fmt.Sprintln(append([]interface{}{cmd}, args...)...)))
+	fc.mu.Unlock()
+	if fc.reply == nil {
+		return "OK", nil
+	}
+	return fc.reply(cmd, args...)
+}
+
+func (fc *fakeConn) Send(cmd string, args ...interface{}) error {
+	return nil
+}
+
+func (fc *fakeConn) Flush() error {
+	return nil
+}
+
+func (fc *fakeConn) Receive() (interface{}, error) {
+	return nil, nil
+}
+
+func (fc *fakeConn) Commands() []string {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return append([]string(nil), fc.commands...)
+}
+
+// fakeConnector always return the same connection
+type fakeConnector struct {
+	conn *fakeConn
+}
+
+func (f *fakeConnector) do(ctx context.Context, key string, readOnly bool, fn func(conn redigo.Conn) (interface{}, error)) (interface{}, error) {
+	return fn(f.conn)
+}
+
+func (f *fakeConnector) get(ctx context.Context, key string) (redigo.Conn, error) {
+	return f.conn, nil
+}
+
+func (f *fakeConnector) node(key string) string {
+	return ""
+}
+
+func (f *fakeConnector) close() error {
+	return nil
+}
+
+func TestLSet(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		reply       interface{}
+		replyErr    error
+		expect      int
+		expectError bool
+	}{
+		{reply: "OK", expect: 1},
+		{replyErr: redigo.Error("ERR index out of range"), expectError: true},
+		{replyErr: redigo.Error("ERR no such key"), expectError: true},
+	}
+
+	for _, c := range cases {
+		conn := &fakeConn{reply: func(cmd string, args ...interface{}) (interface{}, error) {
+			return c.reply, c.replyErr
+		}}
+		rdg := Redigo{conn: &fakeConnector{conn: conn}}
+
+		result, err := rdg.LSet(context.Background(), "list", "value", 2)
+		if (err != nil) != c.expectError {
+			t.Errorf("expecting error %v but got %v", c.expectError, err)
+			return
+		}
+		if result != c.expect {
+			t.Errorf("expecting result %d but got %d", c.expect, result)
+			return
+		}
+
+		// the key must be sent as the first argument
+		commands := conn.Commands()
+		if len(commands) != 1 || commands[0] != "LSET list 2 value" {
+			t.Errorf("expecting LSET list 2 value but got %v", commands)
+			return
+		}
+	}
+}
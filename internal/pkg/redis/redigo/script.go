@@ -0,0 +1,35 @@
+package redigo
+
+import (
+	"context"
+	"strings"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// Eval run lua script with EVALSHA, the script is loaded with EVAL if it is not cached yet
+// use the reply helpers in redis package to convert the result
+func (rdg *Redigo) Eval(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (interface{}, error) {
+	evalArgs := make([]interface{}, 0, len(keys)+len(args)+2)
+	evalArgs = append(evalArgs, script.Hash(), len(keys))
+	for _, key := range keys {
+		evalArgs = append(evalArgs, key)
+	}
+	evalArgs = append(evalArgs, args...)
+
+	// in redis cluster, all keys of the script must be in the same slot
+	var key string
+	if len(keys) > 0 {
+		key = keys[0]
+	}
+
+	return rdg.conn.do(ctx, key, false, func(conn redigo.Conn) (interface{}, error) {
+		resp, err := conn.Do(redis.CommandEvalSHA, evalArgs...)
+		if e, ok := err.(redigo.Error); ok && strings.HasPrefix(string(e), "NOSCRIPT ") {
+			args := append([]interface{}{script.Source()}, evalArgs[1:]...)
+			resp, err = conn.Do(redis.CommandEval, args...)
+		}
+		return resp, err
+	})
+}
@@ -0,0 +1,228 @@
+package redigo
+
+// connect to redis master through redis sentinel
+// the master address is resolved from sentinel every time a new connection is created,
+// and all pooled connections are discarded when failover is detected
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// roleCheckInterval is the minimum idle time of pooled connection before its role is checked
+const roleCheckInterval = time.Second
+
+// SentinelConfig of redis sentinel
+type SentinelConfig struct {
+	// MasterName is the name of master monitored by sentinel
+	MasterName string
+	// Addresses of sentinel nodes
+	Addresses []string
+}
+
+// NewSentinel create redis connection to the master monitored by sentinel
+func NewSentinel(ctx context.Context, sentinelConfig SentinelConfig, config *Config) (*Redigo, error) {
+	if sentinelConfig.MasterName == "" {
+		return nil, errors.New("redigo: sentinel master name is empty")
+	}
+	if len(sentinelConfig.Addresses) == 0 {
+		return nil, errors.New("redigo: sentinel addresses is empty")
+	}
+	if config == nil {
+		config = &Config{}
+	}
+
+	s := &sentinel{
+		masterName: sentinelConfig.MasterName,
+		addresses:  append([]string(nil), sentinelConfig.Addresses...),
+		config:     config,
+	}
+	s.pool = newPool(config, s.dial, s.testOnBorrow)
+
+	r := Redigo{
+		conn: s,
+	}
+	return &r, nil
+}
+
+type sentinel struct {
+	masterName string
+	config     *Config
+	pool       *redigo.Pool
+
+	mu        sync.Mutex
+	addresses []string
+	// generation is increased every time failover is detected,
+	// connection from older generation is discarded by the pool
+	generation uint64
+}
+
+// sentinelConn is connection to master with the generation when the connection is created
+type sentinelConn struct {
+	redigo.Conn
+	generation uint64
+}
+
+// masterAddr ask the sentinels for the master address
+// the sentinel that answered is moved to the front, so it is asked first next time
+func (s *sentinel) masterAddr() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var lastErr error
+	for i, address := range s.addresses {
+		addr, err := s.queryMaster(address)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if i > 0 {
+			s.addresses[0], s.addresses[i] = s.addresses[i], s.addresses[0]
+		}
+		return addr, nil
+	}
+	return "", fmt.Errorf("redigo: failed to get master %s from sentinel: %w", s.masterName, lastErr)
+}
+
+func (s *sentinel) queryMaster(address string) (string, error) {
+	conn, err := dial(address, s.config)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	resp, err := redigo.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", s.masterName))
+	if err != nil {
+		return "", err
+	}
+	if len(resp) != 2 {
+		return "", fmt.Errorf("redigo: unexpected sentinel reply %v", resp)
+	}
+	return net.JoinHostPort(resp[0], resp[1]), nil
+}
+
+// dial the current master, the role is checked as sentinel might return the old master during failover
+func (s *sentinel) dial() (redigo.Conn, error) {
+	generation := atomic.LoadUint64(&s.generation)
+	addr, err := s.masterAddr()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dial(addr, s.config)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMaster(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &sentinelConn{Conn: conn, generation: generation}, nil
+}
+
+func (s *sentinel) testOnBorrow(conn redigo.Conn, lastUsed time.Time) error {
+	sc, ok := conn.(*sentinelConn)
+	if !ok {
+		return nil
+	}
+	if sc.generation != atomic.LoadUint64(&s.generation) {
+		return errors.New("redigo: connection is created before failover")
+	}
+	if time.Since(lastUsed) < roleCheckInterval {
+		return nil
+	}
+	return checkMaster(conn)
+}
+
+// checkMaster return error if the role of connected node is not master
+func checkMaster(conn redigo.Conn) error {
+	resp, err := redigo.Values(conn.Do("ROLE"))
+	if err != nil {
+		return err
+	}
+	if len(resp) == 0 {
+		return errors.New("redigo: empty role reply")
+	}
+	role, err := redigo.String(resp[0], nil)
+	if err != nil {
+		return err
+	}
+	if role != "master" {
+		return fmt.Errorf("redigo: expecting master but got %s", role)
+	}
+	return nil
+}
+
+// failover discard all pooled connections
+func (s *sentinel) failover() {
+	atomic.AddUint64(&s.generation, 1)
+}
+
+// isFailoverError return true if the error might be caused by failover,
+// the old master become replica and reject write, or the old master is down
+func isFailoverError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if _, ok := err.(redigo.Error); ok {
+		return isReadOnlyError(err)
+	}
+	return true
+}
+
+// isReadOnlyError return true if the write is rejected because the node is a replica
+func isReadOnlyError(err error) bool {
+	e, ok := err.(redigo.Error)
+	return ok && strings.HasPrefix(string(e), "READONLY ")
+}
+
+// do retry once with connection to the new master when failover is detected
+// the command rejected by READONLY is not applied, so it is always safe to send the command again,
+// but other errors might happen after the command is applied, so only the read only command is sent again.
+func (s *sentinel) do(ctx context.Context, key string, readOnly bool, fn func(conn redigo.Conn) (interface{}, error)) (interface{}, error) {
+	var (
+		resp interface{}
+		err  error
+	)
+	for attempt := 0; attempt < 2; attempt++ {
+		var conn redigo.Conn
+		conn, err = s.get(ctx, key)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		resp, err = fn(conn)
+		conn.Close()
+		if !isFailoverError(err) {
+			return resp, err
+		}
+		s.failover()
+		if !readOnly && !isReadOnlyError(err) {
+			return resp, err
+		}
+	}
+	return resp, err
+}
+
+func (s *sentinel) get(ctx context.Context, key string) (redigo.Conn, error) {
+	return s.pool.GetContext(ctx)
+}
+
+func (s *sentinel) node(key string) string {
+	return ""
+}
+
+func (s *sentinel) close() error {
+	return s.pool.Close()
+}
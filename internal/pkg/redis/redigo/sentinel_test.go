@@ -0,0 +1,100 @@
+package redigo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// newFakeSentinel create sentinel that dial the fake connections in order
+func newFakeSentinel(conns ...*fakeConn) *sentinel {
+	s := &sentinel{config: &Config{}}
+	dialed := 0
+	s.pool = newPool(s.config, func() (redigo.Conn, error) {
+		if dialed >= len(conns) {
+			return nil, errors.New("connection refused")
+		}
+		conn := conns[dialed]
+		dialed++
+		return &sentinelConn{Conn: conn, generation: atomic.LoadUint64(&s.generation)}, nil
+	}, s.testOnBorrow)
+	return s
+}
+
+func TestSentinelFailover(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name             string
+		cmd              string
+		reply            error
+		expectError      bool
+		expectOld        []string
+		expectNew        []string
+		expectGeneration uint64
+	}{
+		{
+			name:             "write rejected by replica is sent to the new master",
+			cmd:              "INCR",
+			reply:            redigo.Error("READONLY You can't write against a read only replica."),
+			expectOld:        []string{"INCR foo"},
+			expectNew:        []string{"INCR foo"},
+			expectGeneration: 1,
+		},
+		{
+			name:             "read is sent again after connection error",
+			cmd:              "GET",
+			reply:            errors.New("connection reset by peer"),
+			expectOld:        []string{"GET foo"},
+			expectNew:        []string{"GET foo"},
+			expectGeneration: 1,
+		},
+		{
+			name:             "write is not sent again after connection error",
+			cmd:              "INCR",
+			reply:            errors.New("connection reset by peer"),
+			expectError:      true,
+			expectOld:        []string{"INCR foo"},
+			expectGeneration: 1,
+		},
+		{
+			name:        "other redis error is returned",
+			cmd:         "INCR",
+			reply:       redigo.Error("WRONGTYPE Operation against a key holding the wrong kind of value"),
+			expectError: true,
+			expectOld:   []string{"INCR foo"},
+		},
+	}
+
+	for _, c := range cases {
+		reply := c.reply
+		oldMaster := &fakeConn{reply: func(cmd string, args ...interface{}) (interface{}, error) {
+			return nil, reply
+		}}
+		newMaster := &fakeConn{}
+		s := newFakeSentinel(oldMaster, newMaster)
+		rdg := Redigo{conn: s}
+
+		_, err := rdg.do(context.Background(), c.cmd, "foo")
+		if (err != nil) != c.expectError {
+			t.Errorf("%s: expecting error %v but got %v", c.name, c.expectError, err)
+			return
+		}
+		if !reflect.DeepEqual(oldMaster.Commands(), c.expectOld) {
+			t.Errorf("%s: expecting old master commands %v but got %v", c.name, c.expectOld, oldMaster.Commands())
+			return
+		}
+		if !reflect.DeepEqual(newMaster.Commands(), c.expectNew) {
+			t.Errorf("%s: expecting new master commands %v but got %v", c.name, c.expectNew, newMaster.Commands())
+			return
+		}
+		if generation := atomic.LoadUint64(&s.generation); generation != c.expectGeneration {
+			t.Errorf("%s: expecting generation %d but got %d", c.name, c.expectGeneration, generation)
+			return
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package redigo
+
+import (
+	"context"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// SAdd add members to a set
+func (rdg *Redigo) SAdd(ctx context.Context, key string, members ...interface{}) (int, error) {
+	args := make([]interface{}, len(members)+1)
+	args[0] = key
+	copy(args[1:], members)
+
+	resp, err := redigo.Int(rdg.do(ctx, redis.CommandSAdd, args...))
+	if err != nil && !rdg.IsErrNil(err) {
+		return 0, err
+	}
+	return resp, err
+}
+
+// SRem remove members from a set
+func (rdg *Redigo) SRem(ctx context.Context, key string, members ...interface{}) (int, error) {
+	args := make([]interface{}, len(members)+1)
+	args[0] = key
+	copy(args[1:], members)
+
+	resp, err := redigo.Int(rdg.do(ctx, redis.CommandSRem, args...))
+	if err != nil && !rdg.IsErrNil(err) {
+		return 0, err
+	}
+	return resp, err
+}
+
+// SMembers return all members of a set
+func (rdg *Redigo) SMembers(ctx context.Context, key string) ([]string, error) {
+	resp, err := redigo.Strings(rdg.do(ctx, redis.CommandSMembers, key))
+	if err != nil && !rdg.IsErrNil(err) {
+		return nil, err
+	}
+	return resp, err
+}
+
+// SIsMember return true if member is a member of a set
+func (rdg *Redigo) SIsMember(ctx context.Context, key string, member interface{}) (bool, error) {
+	resp, err := redigo.Bool(rdg.do(ctx, redis.CommandSIsMember, key, member))
+	if err != nil && !rdg.IsErrNil(err) {
+		return false, err
+	}
+	return resp, err
+}
+
+// SCard return the number of members in a set
+func (rdg *Redigo) SCard(ctx context.Context, key string) (int, error) {
+	resp, err := redigo.Int(rdg.do(ctx, redis.CommandSCard, key))
+	if err != nil && !rdg.IsErrNil(err) {
+		return 0, err
+	}
+	return resp, err
+}
@@ -0,0 +1,85 @@
+package redigo
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// ZAdd add members with score to a sorted set
+func (rdg *Redigo) ZAdd(ctx context.Context, key string, members ...redis.ZMember) (int, error) {
+	args := make([]interface{}, 0, len(members)*2+1)
+	args = append(args, key)
+	for _, member := range members {
+		args = append(args, member.Score, member.Member)
+	}
+
+	resp, err := redigo.Int(rdg.do(ctx, redis.CommandZAdd, args...))
+	if err != nil && !rdg.IsErrNil(err) {
+		return 0, err
+	}
+	return resp, err
+}
+
+// ZRem remove members from a sorted set
+func (rdg *Redigo) ZRem(ctx context.Context, key string, members ...string) (int, error) {
+	args := make([]interface{}, len(members)+1)
+	args[0] = key
+	for i, member := range members {
+		args[i+1] = member
+	}
+
+	resp, err := redigo.Int(rdg.do(ctx, redis.CommandZRem, args...))
+	if err != nil && !rdg.IsErrNil(err) {
+		return 0, err
+	}
+	return resp, err
+}
+
+// ZScore return the score of a member in a sorted set
+func (rdg *Redigo) ZScore(ctx context.Context, key, member string) (float64, error) {
+	resp, err := redigo.Float64(rdg.do(ctx, redis.CommandZScore, key, member))
+	if err != nil && !rdg.IsErrNil(err) {
+		return 0, err
+	}
+	return resp, err
+}
+
+// ZCard return the number of members in a sorted set
+func (rdg *Redigo) ZCard(ctx context.Context, key string) (int, error) {
+	resp, err := redigo.Int(rdg.do(ctx, redis.CommandZCard, key))
+	if err != nil && !rdg.IsErrNil(err) {
+		return 0, err
+	}
+	return resp, err
+}
+
+// ZRangeByScore return members with score between min and max, ordered from the lowest score
+// min and max can be -inf, +inf or exclusive by using ( prefix, for example (10
+func (rdg *Redigo) ZRangeByScore(ctx context.Context, key, min, max string) ([]redis.ZMember, error) {
+	resp, err := redigo.Strings(rdg.do(ctx, redis.CommandZRangeBy, key, min, max, "WITHSCORES"))
+	if err != nil && !rdg.IsErrNil(err) {
+		return nil, err
+	}
+
+	members := make([]redis.ZMember, 0, len(resp)/2)
+	for i := 0; i+1 < len(resp); i += 2 {
+		score, err := strconv.ParseFloat(resp[i+1], 64)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, redis.ZMember{Member: resp[i], Score: score})
+	}
+	return members, err
+}
+
+// ZRemRangeByScore remove members with score between min and max
+func (rdg *Redigo) ZRemRangeByScore(ctx context.Context, key, min, max string) (int, error) {
+	resp, err := redigo.Int(rdg.do(ctx, redis.CommandZRemRangeBy, key, min, max))
+	if err != nil && !rdg.IsErrNil(err) {
+		return 0, err
+	}
+	return resp, err
+}
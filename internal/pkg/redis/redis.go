@@ -10,11 +10,14 @@ import (
 // error list
 var (
 	ErrResponseNotOK = errors.New("redis: response is not ok")
+	// ErrNil returned by reply helpers when the reply is nil
+	ErrNil = errors.New("redis: nil reply")
 )
 
 // Redis interface
 type Redis interface {
 	Close() error
+	Ping(ctx context.Context) (string, error)
 	IsErrNil(err error) bool
 	IsResponseOK(result string) bool
 	Set(ctx context.Context, key string, value interface{}) (string, error)
@@ -42,6 +45,44 @@ type Redis interface {
 	LPop(ctx context.Context, key string) (string, error)
 	LRem(ctx context.Context, key, value string, count int) (int, error)
 	LTrim(ctd context.Context, key string, start, stop int) (string, error)
+	TTL(ctx context.Context, key string) (int, error)
+	Persist(ctx context.Context, key string) (int, error)
+	SAdd(ctx context.Context, key string, members ...interface{}) (int, error)
+	SRem(ctx context.Context, key string, members ...interface{}) (int, error)
+	SMembers(ctx context.Context, key string) ([]string, error)
+	SIsMember(ctx context.Context, key string, member interface{}) (bool, error)
+	SCard(ctx context.Context, key string) (int, error)
+	ZAdd(ctx context.Context, key string, members ...ZMember) (int, error)
+	ZRem(ctx context.Context, key string, members ...string) (int, error)
+	ZScore(ctx context.Context, key, member string) (float64, error)
+	ZCard(ctx context.Context, key string) (int, error)
+	ZRangeByScore(ctx context.Context, key, min, max string) ([]ZMember, error)
+	ZRemRangeByScore(ctx context.Context, key, min, max string) (int, error)
+	Eval(ctx context.Context, script *Script, keys []string, args ...interface{}) (interface{}, error)
+	Publish(ctx context.Context, channel string, message interface{}) (int, error)
+	Subscribe(ctx context.Context, channels ...string) (Subscription, error)
+	Pipeline(ctx context.Context, commands ...Command) ([]Result, error)
+	Transaction(ctx context.Context, commands ...Command) ([]Result, error)
+}
+
+// Subscription of pub/sub channels
+type Subscription interface {
+	// Messages return channel of messages, the channel is closed when the subscription is closed
+	Messages() <-chan Message
+	// Close unsubscribe all channels and close the connection
+	Close() error
+}
+
+// Message received from pub/sub channel
+type Message struct {
+	Channel string
+	Payload []byte
+}
+
+// ZMember is a member of sorted set with its score
+type ZMember struct {
+	Member string
+	Score  float64
 }
 
 // list of redis command
@@ -71,4 +112,23 @@ const (
 	CommandLPop        = "LPOP"
 	CommandLRem        = "LREM"
 	CommandLTrim       = "LTRIM"
+	CommandTTL         = "TTL"
+	CommandPersist     = "PERSIST"
+	CommandSAdd        = "SADD"
+	CommandSRem        = "SREM"
+	CommandSMembers    = "SMEMBERS"
+	CommandSIsMember   = "SISMEMBER"
+	CommandSCard       = "SCARD"
+	CommandZAdd        = "ZADD"
+	CommandZRem        = "ZREM"
+	CommandZScore      = "ZSCORE"
+	CommandZCard       = "ZCARD"
+	CommandZRangeBy    = "ZRANGEBYSCORE"
+	CommandZRemRangeBy = "ZREMRANGEBYSCORE"
+	CommandEval        = "EVAL"
+	CommandEvalSHA     = "EVALSHA"
+	CommandPublish     = "PUBLISH"
+	CommandSubscribe   = "SUBSCRIBE"
+	CommandMulti       = "MULTI"
+	CommandExec        = "EXEC"
 )
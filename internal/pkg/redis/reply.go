@@ -0,0 +1,112 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Command is a redis command with its arguments, used in pipeline and transaction
+type Command struct {
+	Name string
+	Args []interface{}
+}
+
+// NewCommand create a new command
+func NewCommand(name string, args ...interface{}) Command {
+	return Command{Name: name, Args: args}
+}
+
+// Result of a command in pipeline and transaction
+// use the reply helpers to convert the value, for example redis.String(result.Value, result.Err)
+type Result struct {
+	Value interface{}
+	Err   error
+}
+
+// String convert reply to string
+func String(reply interface{}, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	switch reply := reply.(type) {
+	case []byte:
+		return string(reply), nil
+	case string:
+		return reply, nil
+	case int64:
+		return strconv.FormatInt(reply, 10), nil
+	case nil:
+		return "", ErrNil
+	case error:
+		return "", reply
+	}
+	return "", fmt.Errorf("redis: unexpected type %T for string", reply)
+}
+
+// Int convert reply to int
+func Int(reply interface{}, err error) (int, error) {
+	if err != nil {
+		return 0, err
+	}
+	switch reply := reply.(type) {
+	case int64:
+		return int(reply), nil
+	case int:
+		return reply, nil
+	case []byte:
+		return strconv.Atoi(string(reply))
+	case string:
+		return strconv.Atoi(reply)
+	case nil:
+		return 0, ErrNil
+	case error:
+		return 0, reply
+	}
+	return 0, fmt.Errorf("redis: unexpected type %T for int", reply)
+}
+
+// Strings convert array reply to strings
+func Strings(reply interface{}, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	switch reply := reply.(type) {
+	case []interface{}:
+		result := make([]string, len(reply))
+		for i, v := range reply {
+			// nil value in array is converted to empty string
+			if v == nil {
+				continue
+			}
+			s, err := String(v, nil)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = s
+		}
+		return result, nil
+	case []string:
+		return reply, nil
+	case nil:
+		return nil, ErrNil
+	case error:
+		return nil, reply
+	}
+	return nil, fmt.Errorf("redis: unexpected type %T for strings", reply)
+}
+
+// Values convert array reply to list of values
+func Values(reply interface{}, err error) ([]interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	switch reply := reply.(type) {
+	case []interface{}:
+		return reply, nil
+	case nil:
+		return nil, ErrNil
+	case error:
+		return nil, reply
+	}
+	return nil, fmt.Errorf("redis: unexpected type %T for values", reply)
+}
@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReply(t *testing.T) {
+	t.Parallel()
+
+	errReply := errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	cases := []struct {
+		reply     interface{}
+		expectStr string
+		expectInt int
+		expectErr error
+	}{
+		{reply: []byte("10"), expectStr: "10", expectInt: 10},
+		{reply: int64(5), expectStr: "5", expectInt: 5},
+		{reply: nil, expectErr: ErrNil},
+		{reply: errReply, expectErr: errReply},
+	}
+
+	for _, c := range cases {
+		s, err := String(c.reply, nil)
+		if err != c.expectErr {
+			t.Errorf("reply %v: expecting error %v but got %v", c.reply, c.expectErr, err)
+			return
+		}
+		if s != c.expectStr {
+			t.Errorf("reply %v: expecting string %s but got %s", c.reply, c.expectStr, s)
+			return
+		}
+
+		i, err := Int(c.reply, nil)
+		if err != c.expectErr {
+			t.Errorf("reply %v: expecting error %v but got %v", c.reply, c.expectErr, err)
+			return
+		}
+		if i != c.expectInt {
+			t.Errorf("reply %v: expecting int %d but got %d", c.reply, c.expectInt, i)
+			return
+		}
+	}
+
+	values, err := Strings([]interface{}{[]byte("a"), nil, int64(1)}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(values) != 3 || values[0] != "a" || values[1] != "" || values[2] != "1" {
+		t.Errorf("unexpected strings %v", values)
+		return
+	}
+}
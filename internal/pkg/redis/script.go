@@ -0,0 +1,32 @@
+package redis
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+)
+
+// Script is a lua script with its SHA1 hash
+// Eval use EVALSHA first and fallback to EVAL when the script is not cached in redis
+type Script struct {
+	src  string
+	hash string
+}
+
+// NewScript create a new lua script
+func NewScript(src string) *Script {
+	h := sha1.Sum([]byte(src))
+	return &Script{
+		src:  src,
+		hash: hex.EncodeToString(h[:]),
+	}
+}
+
+// Source return the source of the script
+func (s *Script) Source() string {
+	return s.src
+}
+
+// Hash return the SHA1 hash of the script
+func (s *Script) Hash() string {
+	return s.hash
+}
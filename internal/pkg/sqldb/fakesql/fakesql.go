@@ -0,0 +1,266 @@
+// Package fakesql is a fake database/sql driver for testing
+// all statements are recorded, and the result of each statement is defined by the handlers.
+package fakesql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// list of statement recorded for transaction
+const (
+	StatementBegin    = "BEGIN"
+	StatementCommit   = "COMMIT"
+	StatementRollback = "ROLLBACK"
+)
+
+// Statement executed to the fake database
+type Statement struct {
+	// Conn is the id of connection that execute the statement
+	Conn  int
+	Query string
+	Args  []driver.Value
+}
+
+// Rows is the result of query
+type Rows struct {
+	Columns []string
+	Values  [][]driver.Value
+}
+
+// ExecFunc handle exec statement
+type ExecFunc func(args []driver.Value) (driver.Result, error)
+
+// QueryFunc handle query statement
+type QueryFunc func(args []driver.Value) (*Rows, error)
+
+type handler struct {
+	match string
+	exec  ExecFunc
+	query QueryFunc
+}
+
+// DB is the fake database
+type DB struct {
+	mu         sync.Mutex
+	statements []Statement
+	handlers   []handler
+	conns      int
+}
+
+// New fake database
+func New() *DB {
+	return &DB{}
+}
+
+// Open the fake database with driver name, the driver name is used by sqlx to choose the bind type
+func (db *DB) Open(driverName string) *sqlx.DB {
+	return sqlx.NewDb(sql.OpenDB(&connector{db: db}), driverName)
+}
+
+// Exec handle the exec statement that contains match, including BEGIN, COMMIT and ROLLBACK
+// the first handler that match the statement is used, and the statement return 1 row affected if no handler match.
+func (db *DB) Exec(match string, fn ExecFunc) {
+	db.mu.Lock()
+	db.handlers = append(db.handlers, handler{match: match, exec: fn})
+	db.mu.Unlock()
+}
+
+// Query handle the query statement that contains match
+// the first handler that match the statement is used, and the statement return no rows if no handler match.
+func (db *DB) Query(match string, fn QueryFunc) {
+	db.mu.Lock()
+	db.handlers = append(db.handlers, handler{match: match, query: fn})
+	db.mu.Unlock()
+}
+
+// Statements return all executed statements
+func (db *DB) Statements() []Statement {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	statements := make([]Statement, len(db.statements))
+	copy(statements, db.statements)
+	return statements
+}
+
+// Queries return the query of all executed statements
+func (db *DB) Queries() []string {
+	statements := db.Statements()
+	queries := make([]string, len(statements))
+	for i, s := range statements {
+		queries[i] = s.Query
+	}
+	return queries
+}
+
+// Reset the recorded statements
+func (db *DB) Reset() {
+	db.mu.Lock()
+	db.statements = nil
+	db.mu.Unlock()
+}
+
+func (db *DB) record(conn int, query string, args []driver.Value) handler {
+	query = normalize(query)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.statements = append(db.statements, Statement{Conn: conn, Query: query, Args: args})
+	for _, h := range db.handlers {
+		if strings.Contains(query, h.match) {
+			return h
+		}
+	}
+	return handler{}
+}
+
+func (db *DB) exec(conn int, query string, args []driver.Value) (driver.Result, error) {
+	h := db.record(conn, query, args)
+	if h.exec == nil {
+		return driver.RowsAffected(1), nil
+	}
+	return h.exec(args)
+}
+
+func (db *DB) query(conn int, query string, args []driver.Value) (driver.Rows, error) {
+	h := db.record(conn, query, args)
+	if h.query == nil {
+		return &rows{}, nil
+	}
+	r, err := h.query(args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{columns: r.Columns, values: r.Values}, nil
+}
+
+// normalize collapse the whitespaces in query, so the query can be matched easily
+func normalize(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+type connector struct {
+	db *DB
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.db.mu.Lock()
+	c.db.conns++
+	id := c.db.conns
+	c.db.mu.Unlock()
+	return &conn{db: c.db, id: id}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return nil, driver.ErrBadConn
+}
+
+type conn struct {
+	db *DB
+	id int
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if _, err := c.db.exec(c.id, StatementBegin, nil); err != nil {
+		return nil, err
+	}
+	return &tx{conn: c}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.db.exec(c.id, query, values(args))
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.db.query(c.id, query, values(args))
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	v := make([]driver.Value, len(args))
+	for i, arg := range args {
+		v[i] = arg.Value
+	}
+	return v
+}
+
+type tx struct {
+	conn *conn
+}
+
+func (t *tx) Commit() error {
+	_, err := t.conn.db.exec(t.conn.id, StatementCommit, nil)
+	return err
+}
+
+func (t *tx) Rollback() error {
+	_, err := t.conn.db.exec(t.conn.id, StatementRollback, nil)
+	return err
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.db.exec(s.conn.id, s.query, args)
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.db.query(s.conn.id, s.query, args)
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+	next    int
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,135 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/log/logger"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opencensus.io/trace"
+)
+
+// list of database role serving the query
+const (
+	RoleLeader   = "leader"
+	RoleFollower = "follower"
+	RoleTx       = "tx"
+)
+
+var (
+	// prometheus metrics
+	_sqldbQueryDurationHist *prometheus.HistogramVec
+)
+
+// throwing fatal if prometheus metrics cannot be registered
+func init() {
+	_sqldbQueryDurationHist = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "sqldb_query_duration_seconds",
+		Help: "duration of sql query for each database, role and query name",
+	}, []string{"db", "role", "query"})
+	if err := prometheus.Register(_sqldbQueryDurationHist); err != nil {
+		if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			err = fmt.Errorf("error when registering sqldbQueryDurationHist. err: %w", err)
+			log.Fatal(err)
+		}
+	}
+}
+
+type queryNameKey struct{}
+
+// WithQueryName return a context to name the query in metrics and tracing
+// by default the name is the query type and the table, for example select_users
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queryNameKey{}, name)
+}
+
+// observe run fn and record the span, metrics and slow query log of the query
+func (db *DB) observe(ctx context.Context, method, role, query string, args []interface{}, fn func(ctx context.Context) error) error {
+	c := db.current()
+	name, ok := ctx.Value(queryNameKey{}).(string)
+	if !ok {
+		name = normalizeQueryName(query)
+	}
+
+	ctx, span := trace.StartSpan(ctx, "sqldb/"+method)
+	defer span.End()
+	span.AddAttributes(
+		trace.StringAttribute("db", c.options.Name),
+		trace.StringAttribute("role", role),
+		trace.StringAttribute("query", name),
+	)
+
+	start := time.Now()
+	err := fn(ctx)
+	duration := time.Since(start)
+
+	_sqldbQueryDurationHist.WithLabelValues(c.options.Name, role, name).Observe(duration.Seconds())
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+	}
+
+	if c.options.Logger != nil && c.options.SlowQueryThreshold > 0 && duration > c.options.SlowQueryThreshold {
+		c.options.Logger.Warnw("sqldb: slow query", logger.KV{
+			"db":       c.options.Name,
+			"role":     role,
+			"name":     name,
+			"query":    query,
+			"args":     args,
+			"duration": duration.String(),
+		})
+	}
+	return err
+}
+
+// roleOf return the role of the connection
+func (c *conns) roleOf(conn *sqlx.DB) string {
+	if conn == c.leader {
+		return RoleLeader
+	}
+	return RoleFollower
+}
+
+// normalizeQueryName return the query type and the first table in the query
+// for example, SELECT id FROM users WHERE id = $1 is select_users
+func normalizeQueryName(query string) string {
+	fields := strings.Fields(strings.ToLower(query))
+	if len(fields) == 0 {
+		return "unknown"
+	}
+
+	var (
+		op    = fields[0]
+		table string
+	)
+	tableAfter := func(keyword string) string {
+		for i := 1; i < len(fields)-1; i++ {
+			if fields[i] == keyword {
+				return fields[i+1]
+			}
+		}
+		return ""
+	}
+
+	switch op {
+	case "select", "delete":
+		table = tableAfter("from")
+	case "insert":
+		table = tableAfter("into")
+	case "update":
+		if len(fields) > 1 {
+			table = fields[1]
+		}
+	}
+
+	name := op
+	if table = strings.Trim(table, "`\"(),;"); table != "" {
+		name = op + "_" + table
+	}
+	return name
+}
@@ -0,0 +1,26 @@
+package sqldb
+
+import "testing"
+
+func TestNormalizeQueryName(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		query  string
+		expect string
+	}{
+		{query: "SELECT id, name FROM users WHERE id = $1", expect: "select_users"},
+		{query: "\n\tINSERT INTO invoices_details (\n\tinvoice_id\n) VALUES ($1)", expect: "insert_invoices_details"},
+		{query: "UPDATE properties SET name = ? WHERE id = ?", expect: "update_properties"},
+		{query: "DELETE FROM `images` WHERE id = ?", expect: "delete_images"},
+		{query: "SAVEPOINT sqldb_savepoint_1", expect: "savepoint"},
+		{query: "", expect: "unknown"},
+	}
+
+	for _, c := range cases {
+		if name := normalizeQueryName(c.query); name != c.expect {
+			t.Errorf("query %s: expecting %s but got %s", c.query, c.expect, name)
+			return
+		}
+	}
+}
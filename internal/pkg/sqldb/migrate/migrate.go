@@ -0,0 +1,440 @@
+// Package migrate run sql schema migrations from a directory
+//
+// The migration files are named {version}_{name}.up.sql and {version}_{name}.down.sql,
+// for example 20191017070146_users.up.sql. The applied versions are recorded in a tracking table.
+//
+// Each migration is executed in a transaction, this means the migration is validated and applied atomically
+// for database that support transactional DDL like postgres. MySQL commit DDL implicitly,
+// so a failed migration might be applied partially, and the migrations cannot be validated without applying them.
+// MySQL connection need multiStatements=true to execute migration with more than one statement.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultTableName is the default table to record the applied migrations
+const DefaultTableName = "schema_migrations"
+
+var (
+	// ErrNoMigration returned when there is no migration to rollback
+	ErrNoMigration = errors.New("migrate: no migration to rollback")
+	// ErrValidateNotSupported returned when validating migrations of database that commit DDL implicitly
+	ErrValidateNotSupported = errors.New("migrate: validate is not supported for mysql, as DDL is committed implicitly")
+
+	fileRegex  = regexp.MustCompile(`^([0-9]+)_(.+)\.(up|down)\.sql$`)
+	tableRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Migration is a schema change of a database
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// String return the migration in version_name format
+func (m Migration) String() string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+// Status of migration in the database
+type Status struct {
+	Migration Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Load migrations from directory, the migrations are sorted by version
+func Load(dir string) ([]Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make(map[int64]*Migration)
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		matches := fileRegex.FindStringSubmatch(file.Name())
+		if matches == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: invalid version of %s: %w", file.Name(), err)
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := migrations[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			migrations[version] = m
+		}
+		if m.Name != matches[2] {
+			return nil, fmt.Errorf("migrate: version %d is used by %s and %s", version, m.Name, matches[2])
+		}
+
+		if matches[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	list := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migrate: up migration of %s is empty", m)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+	return list, nil
+}
+
+// Options of migrator
+type Options struct {
+	// TableName to record the applied migrations
+	TableName string
+}
+
+// Migrator to run migrations to a database
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+	table      string
+}
+
+// New migrator, only postgres and mysql are supported
+func New(db *sqlx.DB, migrations []Migration, migrateOpts *Options) (*Migrator, error) {
+	opts := Options{}
+	if migrateOpts != nil {
+		opts = *migrateOpts
+	}
+	if opts.TableName == "" {
+		opts.TableName = DefaultTableName
+	}
+	if !tableRegex.MatchString(opts.TableName) {
+		return nil, fmt.Errorf("migrate: invalid table name %s", opts.TableName)
+	}
+
+	switch db.DriverName() {
+	case "postgres", "mysql":
+	default:
+		return nil, fmt.Errorf("migrate: driver %s is not supported", db.DriverName())
+	}
+
+	m := Migrator{
+		db:         db,
+		migrations: migrations,
+		table:      opts.TableName,
+	}
+	return &m, nil
+}
+
+// Up apply n pending migrations, all pending migrations are applied if n <= 0
+// all pending migrations are validated in a transaction first before applied one by one,
+// except for mysql as the validation will apply the DDL.
+func (m *Migrator) Up(ctx context.Context, n int) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		pending, err := m.pending(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if n > 0 && n < len(pending) {
+			pending = pending[:n]
+		}
+		if m.transactionalDDL() {
+			if err := m.validate(ctx, conn, pending); err != nil {
+				return err
+			}
+		}
+
+		for _, migration := range pending {
+			if err := m.up(ctx, conn, migration); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rollback n applied migrations from the latest version, one migration is rolled back if n <= 0
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	if n <= 0 {
+		n = 1
+	}
+
+	var rolledBack []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			return ErrNoMigration
+		}
+		if n > len(applied) {
+			n = len(applied)
+		}
+
+		for _, migration := range applied[:n] {
+			if err := m.down(ctx, conn, migration); err != nil {
+				return err
+			}
+			rolledBack = append(rolledBack, migration)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Redo rollback and apply the latest applied migration
+func (m *Migrator) Redo(ctx context.Context) (Migration, error) {
+	var migration Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			return ErrNoMigration
+		}
+		migration = applied[0]
+
+		if err := m.down(ctx, conn, migration); err != nil {
+			return err
+		}
+		return m.up(ctx, conn, migration)
+	})
+	return migration, err
+}
+
+// Validate all pending migrations in a transaction without applying them
+// ErrValidateNotSupported is returned for mysql, because mysql commit DDL implicitly.
+func (m *Migrator) Validate(ctx context.Context) error {
+	if !m.transactionalDDL() {
+		return ErrValidateNotSupported
+	}
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		pending, err := m.pending(ctx, conn)
+		if err != nil {
+			return err
+		}
+		return m.validate(ctx, conn, pending)
+	})
+}
+
+// Status return the status of all migrations
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var status []Status
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			appliedAt, ok := versions[migration.Version]
+			status = append(status, Status{
+				Migration: migration,
+				Applied:   ok,
+				AppliedAt: appliedAt,
+			})
+		}
+		return nil
+	})
+	return status, err
+}
+
+// transactionalDDL return true if the DDL can be rolled back in a transaction
+func (m *Migrator) transactionalDDL() bool {
+	return m.db.DriverName() != "mysql"
+}
+
+// withLock run fn with advisory lock, so only one migrator can run at a time
+// advisory lock is held by a connection, so all queries must use the same connection
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var lockQuery, unlockQuery string
+	var lockArg interface{}
+	switch m.db.DriverName() {
+	case "postgres":
+		h := fnv.New64a()
+		h.Write([]byte("migrate/" + m.table))
+		lockQuery, unlockQuery = "SELECT pg_advisory_lock($1)", "SELECT pg_advisory_unlock($1)"
+		lockArg = int64(h.Sum64())
+	case "mysql":
+		lockQuery, unlockQuery = "SELECT GET_LOCK(?, -1)", "SELECT RELEASE_LOCK(?)"
+		lockArg = "migrate/" + m.table
+	}
+
+	if _, err := conn.ExecContext(ctx, lockQuery, lockArg); err != nil {
+		return fmt.Errorf("migrate: failed to acquire lock: %w", err)
+	}
+	defer func() {
+		// use a new context as the lock need to be released even if the context is cancelled
+		if _, unlockErr := conn.ExecContext(context.Background(), unlockQuery, lockArg); unlockErr != nil && err == nil {
+			err = fmt.Errorf("migrate: failed to release lock: %w", unlockErr)
+		}
+	}()
+
+	if err := m.createTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func (m *Migrator) createTable(ctx context.Context, conn *sql.Conn) error {
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version bigint PRIMARY KEY,
+	name varchar(255) NOT NULL,
+	applied_at timestamp NOT NULL
+)`, m.table)
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("migrate: failed to create table %s: %w", m.table, err)
+	}
+	return nil
+}
+
+// appliedVersions return the applied versions and the applied time
+func (m *Migrator) appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT version, applied_at FROM %s", m.table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+	return versions, rows.Err()
+}
+
+// pending return migrations that is not applied yet, sorted by version
+func (m *Migrator) pending(ctx context.Context, conn *sql.Conn) ([]Migration, error) {
+	versions, err := m.appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := versions[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// applied return applied migrations, sorted from the latest version
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) ([]Migration, error) {
+	versions, err := m.appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]Migration)
+	for _, migration := range m.migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	var applied []Migration
+	for version := range versions {
+		migration, ok := byVersion[version]
+		if !ok {
+			return nil, fmt.Errorf("migrate: applied version %d is not found in migration files", version)
+		}
+		applied = append(applied, migration)
+	}
+	sort.Slice(applied, func(i, j int) bool {
+		return applied[i].Version > applied[j].Version
+	})
+	return applied, nil
+}
+
+// validate execute migrations in a transaction and always rollback the transaction
+func (m *Migrator) validate(ctx context.Context, conn *sql.Conn, migrations []Migration) error {
+	if len(migrations) == 0 {
+		return nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, migration := range migrations {
+		if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+			return fmt.Errorf("migrate: invalid migration %s: %w", migration, err)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) up(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	insert := sqlx.Rebind(sqlx.BindType(m.db.DriverName()), fmt.Sprintf("INSERT INTO %s (version, name, applied_at) VALUES (?, ?, ?)", m.table))
+	return m.exec(ctx, conn, migration.Up, insert, migration.Version, migration.Name, time.Now())
+}
+
+func (m *Migrator) down(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	if migration.Down == "" {
+		return fmt.Errorf("migrate: down migration of %s is empty", migration)
+	}
+	remove := sqlx.Rebind(sqlx.BindType(m.db.DriverName()), fmt.Sprintf("DELETE FROM %s WHERE version = ?", m.table))
+	return m.exec(ctx, conn, migration.Down, remove, migration.Version)
+}
+
+// exec run the migration and record the version in one transaction
+func (m *Migrator) exec(ctx context.Context, conn *sql.Conn, migration, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migration); err != nil {
+		return fmt.Errorf("migrate: failed to migrate version %v: %w", args[0], err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("migrate: failed to record version %v: %w", args[0], err)
+	}
+	return tx.Commit()
+}
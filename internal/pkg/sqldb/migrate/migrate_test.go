@@ -0,0 +1,476 @@
+package migrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/sqldb/fakesql"
+)
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"20191017070146_users.up.sql":         "CREATE TABLE users(id int);",
+		"20191017070146_users.down.sql":       "DROP TABLE users;",
+		"20190613042222_sms_history.up.sql":   "CREATE TABLE sms_history(id int);",
+		"20190613042222_sms_history.down.sql": "DROP TABLE sms_history;",
+		"README.md":                           "not a migration",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	migrations, err := Load(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expect := []Migration{
+		{Version: 20190613042222, Name: "sms_history", Up: "CREATE TABLE sms_history(id int);", Down: "DROP TABLE sms_history;"},
+		{Version: 20191017070146, Name: "users", Up: "CREATE TABLE users(id int);", Down: "DROP TABLE users;"},
+	}
+	if len(migrations) != len(expect) {
+		t.Errorf("expecting %d migrations but got %d", len(expect), len(migrations))
+		return
+	}
+	for i := range expect {
+		if migrations[i] != expect[i] {
+			t.Errorf("expecting migration %+v but got %+v", expect[i], migrations[i])
+			return
+		}
+	}
+
+	// up migration is required
+	if err := ioutil.WriteFile(filepath.Join(dir, "20200101000000_orders.down.sql"), []byte("DROP TABLE orders;"), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := Load(dir); err == nil {
+		t.Error("expecting error when up migration is empty")
+		return
+	}
+}
+
+var testMigrations = []Migration{
+	{Version: 1, Name: "users", Up: "CREATE TABLE users(id int);", Down: "DROP TABLE users;"},
+	{Version: 2, Name: "users_bio", Up: "CREATE TABLE users_bio(id int);", Down: "DROP TABLE users_bio;"},
+	{Version: 3, Name: "orders", Up: "CREATE TABLE orders(id int);", Down: "DROP TABLE orders;"},
+}
+
+// fakeDatabase record the applied versions in schema_migrations
+type fakeDatabase struct {
+	*fakesql.DB
+	mu      sync.Mutex
+	applied map[int64]time.Time
+}
+
+func newFakeDatabase(applied ...int64) *fakeDatabase {
+	fd := fakeDatabase{DB: fakesql.New(), applied: make(map[int64]time.Time)}
+	for _, version := range applied {
+		fd.applied[version] = time.Now()
+	}
+
+	fd.Query("SELECT version, applied_at FROM schema_migrations", func(args []driver.Value) (*fakesql.Rows, error) {
+		fd.mu.Lock()
+		defer fd.mu.Unlock()
+		rows := fakesql.Rows{Columns: []string{"version", "applied_at"}}
+		for version, appliedAt := range fd.applied {
+			rows.Values = append(rows.Values, []driver.Value{version, appliedAt})
+		}
+		return &rows, nil
+	})
+	fd.Exec("INSERT INTO schema_migrations", func(args []driver.Value) (driver.Result, error) {
+		fd.mu.Lock()
+		fd.applied[args[0].(int64)] = args[2].(time.Time)
+		fd.mu.Unlock()
+		return driver.RowsAffected(1), nil
+	})
+	fd.Exec("DELETE FROM schema_migrations", func(args []driver.Value) (driver.Result, error) {
+		fd.mu.Lock()
+		delete(fd.applied, args[0].(int64))
+		fd.mu.Unlock()
+		return driver.RowsAffected(1), nil
+	})
+	return &fd
+}
+
+func (fd *fakeDatabase) versions() []int64 {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	var versions []int64
+	for version := range fd.applied {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+	return versions
+}
+
+// count the executed statements that contain the query
+func (fd *fakeDatabase) count(query string) int {
+	var n int
+	for _, q := range fd.Queries() {
+		if strings.Contains(q, query) {
+			n++
+		}
+	}
+	return n
+}
+
+func equalVersions(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func migrationVersions(migrations []Migration) []int64 {
+	versions := make([]int64, len(migrations))
+	for i, m := range migrations {
+		versions[i] = m.Version
+	}
+	return versions
+}
+
+func TestUp(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name           string
+		driver         string
+		applied        []int64
+		n              int
+		expectApplied  []int64
+		expectVersions []int64
+		// number of execution of the up migration of version 3, including validation
+		expectExecuted int
+	}{
+		{
+			name:           "apply all pending migrations",
+			driver:         "postgres",
+			applied:        []int64{1},
+			expectApplied:  []int64{2, 3},
+			expectVersions: []int64{1, 2, 3},
+			expectExecuted: 2,
+		},
+		{
+			name:           "apply n pending migrations",
+			driver:         "postgres",
+			n:              1,
+			expectApplied:  []int64{1},
+			expectVersions: []int64{1},
+			expectExecuted: 0,
+		},
+		{
+			name:           "mysql is not validated before applied",
+			driver:         "mysql",
+			applied:        []int64{1, 2},
+			expectApplied:  []int64{3},
+			expectVersions: []int64{1, 2, 3},
+			expectExecuted: 1,
+		},
+	}
+
+	for _, c := range cases {
+		fd := newFakeDatabase(c.applied...)
+		m, err := New(fd.Open(c.driver), testMigrations, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		applied, err := m.Up(context.Background(), c.n)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			return
+		}
+		if !equalVersions(migrationVersions(applied), c.expectApplied) {
+			t.Errorf("%s: expecting applied %v but got %v", c.name, c.expectApplied, migrationVersions(applied))
+			return
+		}
+		if !equalVersions(fd.versions(), c.expectVersions) {
+			t.Errorf("%s: expecting versions %v but got %v", c.name, c.expectVersions, fd.versions())
+			return
+		}
+		if n := fd.count("CREATE TABLE orders"); n != c.expectExecuted {
+			t.Errorf("%s: expecting up migration to be executed %d times but got %d", c.name, c.expectExecuted, n)
+			return
+		}
+	}
+}
+
+func TestUpInvalid(t *testing.T) {
+	t.Parallel()
+
+	fd := newFakeDatabase(1)
+	fd.Exec("CREATE TABLE orders", func(args []driver.Value) (driver.Result, error) {
+		return nil, errors.New("syntax error")
+	})
+	m, err := New(fd.Open("postgres"), testMigrations, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// the validation failed, so no migration is applied
+	applied, err := m.Up(context.Background(), 0)
+	if err == nil {
+		t.Error("expecting error when migration is invalid")
+		return
+	}
+	if len(applied) != 0 {
+		t.Errorf("expecting no migration applied but got %v", applied)
+		return
+	}
+	if !equalVersions(fd.versions(), []int64{1}) {
+		t.Errorf("expecting versions [1] but got %v", fd.versions())
+		return
+	}
+}
+
+func TestDown(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name             string
+		applied          []int64
+		n                int
+		expectRolledBack []int64
+		expectVersions   []int64
+		expectError      error
+	}{
+		{
+			name:             "rollback the latest migration",
+			applied:          []int64{1, 2, 3},
+			expectRolledBack: []int64{3},
+			expectVersions:   []int64{1, 2},
+		},
+		{
+			name:             "rollback n migrations from the latest",
+			applied:          []int64{1, 2, 3},
+			n:                2,
+			expectRolledBack: []int64{3, 2},
+			expectVersions:   []int64{1},
+		},
+		{
+			name:             "rollback more than applied",
+			applied:          []int64{1},
+			n:                5,
+			expectRolledBack: []int64{1},
+		},
+		{
+			name:        "no migration to rollback",
+			expectError: ErrNoMigration,
+		},
+	}
+
+	for _, c := range cases {
+		fd := newFakeDatabase(c.applied...)
+		m, err := New(fd.Open("postgres"), testMigrations, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		rolledBack, err := m.Down(context.Background(), c.n)
+		if !errors.Is(err, c.expectError) {
+			t.Errorf("%s: expecting error %v but got %v", c.name, c.expectError, err)
+			return
+		}
+		if !equalVersions(migrationVersions(rolledBack), c.expectRolledBack) {
+			t.Errorf("%s: expecting rolled back %v but got %v", c.name, c.expectRolledBack, migrationVersions(rolledBack))
+			return
+		}
+		if !equalVersions(fd.versions(), c.expectVersions) {
+			t.Errorf("%s: expecting versions %v but got %v", c.name, c.expectVersions, fd.versions())
+			return
+		}
+	}
+}
+
+func TestRedo(t *testing.T) {
+	t.Parallel()
+
+	fd := newFakeDatabase(1, 2)
+	m, err := New(fd.Open("postgres"), testMigrations, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	migration, err := m.Redo(context.Background())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if migration.Version != 2 {
+		t.Errorf("expecting version 2 to be redone but got %d", migration.Version)
+		return
+	}
+	if fd.count("DROP TABLE users_bio") != 1 || fd.count("CREATE TABLE users_bio") != 1 {
+		t.Errorf("expecting down and up migration of version 2 to be executed, got %v", fd.Queries())
+		return
+	}
+	if !equalVersions(fd.versions(), []int64{1, 2}) {
+		t.Errorf("expecting versions [1 2] but got %v", fd.versions())
+		return
+	}
+}
+
+func TestStatus(t *testing.T) {
+	t.Parallel()
+
+	fd := newFakeDatabase(1, 3)
+	m, err := New(fd.Open("postgres"), testMigrations, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	status, err := m.Status(context.Background())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expect := []bool{true, false, true}
+	if len(status) != len(expect) {
+		t.Errorf("expecting %d status but got %d", len(expect), len(status))
+		return
+	}
+	for i := range expect {
+		if status[i].Applied != expect[i] {
+			t.Errorf("expecting %s applied %v but got %v", status[i].Migration, expect[i], status[i].Applied)
+			return
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	// postgres validate the pending migrations in a transaction without recording them
+	fd := newFakeDatabase(1)
+	m, err := New(fd.Open("postgres"), testMigrations, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := m.Validate(context.Background()); err != nil {
+		t.Error(err)
+		return
+	}
+	if fd.count("CREATE TABLE orders") != 1 || fd.count(fakesql.StatementRollback) != 1 || fd.count(fakesql.StatementCommit) != 0 {
+		t.Errorf("expecting migrations to be executed and rolled back, got %v", fd.Queries())
+		return
+	}
+	if !equalVersions(fd.versions(), []int64{1}) {
+		t.Errorf("expecting versions [1] but got %v", fd.versions())
+		return
+	}
+
+	// mysql commit DDL implicitly, so validate should not execute anything
+	fd = newFakeDatabase(1)
+	m, err = New(fd.Open("mysql"), testMigrations, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := m.Validate(context.Background()); !errors.Is(err, ErrValidateNotSupported) {
+		t.Errorf("expecting error %v but got %v", ErrValidateNotSupported, err)
+		return
+	}
+	if len(fd.Queries()) != 0 {
+		t.Errorf("expecting no statement executed but got %v", fd.Queries())
+		return
+	}
+}
+
+func TestLock(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		driver string
+		lock   string
+		unlock string
+	}{
+		{driver: "postgres", lock: "SELECT pg_advisory_lock($1)", unlock: "SELECT pg_advisory_unlock($1)"},
+		{driver: "mysql", lock: "SELECT GET_LOCK(?, -1)", unlock: "SELECT RELEASE_LOCK(?)"},
+	}
+
+	for _, c := range cases {
+		fd := newFakeDatabase()
+		m, err := New(fd.Open(c.driver), testMigrations, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err := m.Up(context.Background(), 0); err != nil {
+			t.Error(err)
+			return
+		}
+
+		// the lock is acquired first and released last in the same connection
+		statements := fd.Statements()
+		first, last := statements[0], statements[len(statements)-1]
+		if first.Query != c.lock || last.Query != c.unlock {
+			t.Errorf("%s: expecting lock and unlock as the first and last statement, got %v", c.driver, fd.Queries())
+			return
+		}
+		if len(first.Args) != 1 || first.Args[0] != last.Args[0] {
+			t.Errorf("%s: expecting the same lock key but got %v and %v", c.driver, first.Args, last.Args)
+			return
+		}
+		for _, s := range statements {
+			if s.Conn != first.Conn {
+				t.Errorf("%s: expecting all statements in connection %d but %s is in %d", c.driver, first.Conn, s.Query, s.Conn)
+				return
+			}
+		}
+	}
+
+	// nothing is executed when the lock cannot be acquired
+	fd := newFakeDatabase()
+	fd.Exec("pg_advisory_lock", func(args []driver.Value) (driver.Result, error) {
+		return nil, errors.New("lock timeout")
+	})
+	m, err := New(fd.Open("postgres"), testMigrations, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := m.Up(context.Background(), 0); err == nil {
+		t.Error("expecting error when the lock cannot be acquired")
+		return
+	}
+	if len(fd.Queries()) != 1 {
+		t.Errorf("expecting only the lock statement executed but got %v", fd.Queries())
+		return
+	}
+}
@@ -0,0 +1,231 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/log/logger"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// list of balancer to choose follower
+const (
+	// BalancerRoundRobin choose follower one by one
+	BalancerRoundRobin = "round_robin"
+	// BalancerLeastConnections choose follower with the least connections in use
+	BalancerLeastConnections = "least_conn"
+)
+
+// DefaultLagCheckInterval is the default interval to check replication lag of followers
+const DefaultLagCheckInterval = time.Second * 5
+
+// LagFunc return the replication lag of a follower
+type LagFunc func(ctx context.Context, follower *sqlx.DB) (time.Duration, error)
+
+// PostgresLagFunc return replication lag of postgres follower based on the last replayed transaction
+// please note that the lag will keep increasing when there is no write in the leader
+func PostgresLagFunc(ctx context.Context, follower *sqlx.DB) (time.Duration, error) {
+	var seconds float64
+	query := "SELECT COALESCE(EXTRACT(EPOCH FROM (now() - pg_last_xact_replay_timestamp())), 0)"
+	if err := follower.GetContext(ctx, &seconds, query); err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// WrapOptions to list options when wrapping leader and followers
+type WrapOptions struct {
+	// Name of the database, used in metrics, tracing and slow query log
+	Name string
+	// Logger to log slow query, slow query is not logged if logger is nil
+	Logger logger.Logger
+	// SlowQueryThreshold is the minimum duration of a query to be logged as slow query
+	SlowQueryThreshold time.Duration
+	// Balancer to choose follower when there are more than one follower
+	// default to round robin
+	Balancer string
+	// MaxReplicationLag is the maximum lag of follower before the follower is skipped
+	// the lag is not checked if the value is 0
+	MaxReplicationLag time.Duration
+	// LagCheckInterval is the interval to check the replication lag
+	LagCheckInterval time.Duration
+	// LagFunc to check the replication lag, default to PostgresLagFunc for postgres driver
+	LagFunc LagFunc
+	// DisableFallback disable the query to leader when the connection to follower failed
+	DisableFallback bool
+}
+
+// Validate wrap options and set the default value
+func (wo *WrapOptions) Validate(driver string) error {
+	switch wo.Balancer {
+	case "":
+		wo.Balancer = BalancerRoundRobin
+	case BalancerRoundRobin, BalancerLeastConnections:
+	default:
+		return fmt.Errorf("sqldb: balancer %s is not supported", wo.Balancer)
+	}
+
+	if wo.MaxReplicationLag > 0 {
+		if wo.LagCheckInterval <= 0 {
+			wo.LagCheckInterval = DefaultLagCheckInterval
+		}
+		if wo.LagFunc == nil && driver == "postgres" {
+			wo.LagFunc = PostgresLagFunc
+		}
+		if wo.LagFunc == nil {
+			return fmt.Errorf("sqldb: lag function is needed to check replication lag for driver %s", driver)
+		}
+	}
+	return nil
+}
+
+// follower connection and its replication status
+type follower struct {
+	db *sqlx.DB
+	// lagging is 1 if the replication lag is more than the maximum lag
+	lagging int32
+}
+
+func (f *follower) isLagging() bool {
+	return atomic.LoadInt32(&f.lagging) == 1
+}
+
+// pickFollower choose follower based on the balancer
+// leader is returned if all followers are lagging
+func (c *conns) pickFollower() *sqlx.DB {
+	var available []*follower
+	for _, f := range c.followers {
+		if !f.isLagging() {
+			available = append(available, f)
+		}
+	}
+
+	switch len(available) {
+	case 0:
+		return c.leader
+	case 1:
+		return available[0].db
+	}
+
+	switch c.options.Balancer {
+	case BalancerLeastConnections:
+		picked := available[0]
+		inUse := picked.db.Stats().InUse
+		for _, f := range available[1:] {
+			if n := f.db.Stats().InUse; n < inUse {
+				picked = f
+				inUse = n
+			}
+		}
+		return picked.db
+	default:
+		n := atomic.AddUint64(&c.counter, 1)
+		return available[(n-1)%uint64(len(available))].db
+	}
+}
+
+// shouldFallback return true if the query need to be retried to the leader
+func (c *conns) shouldFallback(ctx context.Context, follower *sqlx.DB, err error) bool {
+	if err == nil || c.options.DisableFallback || follower == c.leader {
+		return false
+	}
+	// don't retry if the context is already done
+	if ctx.Err() != nil {
+		return false
+	}
+	// only retry when the follower is not reachable, other errors like syntax error
+	// or no rows will return the same error from leader
+	return isConnError(err)
+}
+
+// isConnError return true if the error is caused by the connection to database
+func isConnError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// monitorLag check the replication lag of all followers periodically
+func (c *conns) monitorLag() {
+	ticker := time.NewTicker(c.options.LagCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		c.checkLag()
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *conns) checkLag() {
+	for _, f := range c.followers {
+		if f.db == c.leader {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.options.LagCheckInterval)
+		lag, err := c.options.LagFunc(ctx, f.db)
+		cancel()
+
+		// follower is considered lagging when the lag cannot be checked
+		if err != nil || lag > c.options.MaxReplicationLag {
+			atomic.StoreInt32(&f.lagging, 1)
+			continue
+		}
+		atomic.StoreInt32(&f.lagging, 0)
+	}
+}
+
+type routingKey struct{}
+
+// routing state inside context
+type routing struct {
+	leader bool
+	// readYourWrites will route the read to leader after the first write
+	readYourWrites bool
+	written        int32
+}
+
+// WithLeader return a context to force all queries using the context to leader
+func WithLeader(ctx context.Context) context.Context {
+	return context.WithValue(ctx, routingKey{}, &routing{leader: true})
+}
+
+// WithReadYourWrites return a context to route all queries using the context to leader
+// after a write is executed with the same context, for example in a single request
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, routingKey{}, &routing{readYourWrites: true})
+}
+
+// readFromLeader return true if the query should be routed to leader based on the context
+func readFromLeader(ctx context.Context) bool {
+	r, ok := ctx.Value(routingKey{}).(*routing)
+	if !ok {
+		return false
+	}
+	if r.leader {
+		return true
+	}
+	return r.readYourWrites && atomic.LoadInt32(&r.written) == 1
+}
+
+// markWrite mark the context as written, so the next read is routed to leader
+func markWrite(ctx context.Context) {
+	r, ok := ctx.Value(routingKey{}).(*routing)
+	if !ok || !r.readYourWrites {
+		return
+	}
+	atomic.StoreInt32(&r.written, 1)
+}
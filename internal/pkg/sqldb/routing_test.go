@@ -0,0 +1,164 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+func TestPickFollower(t *testing.T) {
+	t.Parallel()
+
+	// sqlx.Open doesn't connect to the database
+	var conns []*sqlx.DB
+	for i := 0; i < 3; i++ {
+		conn, err := sqlx.Open("postgres", "postgres://localhost:5432/test")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+
+	db, err := WrapFollowers(context.Background(), conns[0], conns[1:], nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	cases := []struct {
+		lagging []int32
+		expect  []*sqlx.DB
+	}{
+		{
+			lagging: []int32{0, 0},
+			expect:  []*sqlx.DB{conns[1], conns[2], conns[1]},
+		},
+		{
+			lagging: []int32{1, 0},
+			expect:  []*sqlx.DB{conns[2], conns[2]},
+		},
+		{
+			lagging: []int32{1, 1},
+			expect:  []*sqlx.DB{conns[0]},
+		},
+	}
+
+	for _, c := range cases {
+		db.conns.counter = 0
+		for i, lagging := range c.lagging {
+			db.conns.followers[i].lagging = lagging
+		}
+		for i, expect := range c.expect {
+			if db.Follower() != expect {
+				t.Errorf("lagging %v: expecting follower %d to be different", c.lagging, i)
+				return
+			}
+		}
+	}
+}
+
+func TestReadFromLeader(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	if readFromLeader(ctx) {
+		t.Error("expecting empty context to read from follower")
+		return
+	}
+
+	if !readFromLeader(WithLeader(ctx)) {
+		t.Error("expecting leader context to read from leader")
+		return
+	}
+
+	ctx = WithReadYourWrites(ctx)
+	if readFromLeader(ctx) {
+		t.Error("expecting read your writes context to read from follower before write")
+		return
+	}
+	markWrite(ctx)
+	if !readFromLeader(ctx) {
+		t.Error("expecting read your writes context to read from leader after write")
+		return
+	}
+}
+
+func TestShouldFallback(t *testing.T) {
+	t.Parallel()
+
+	leader, err := sqlx.Open("postgres", "postgres://localhost:5432/test")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	follower, err := sqlx.Open("postgres", "postgres://localhost:5433/test")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	db, err := WrapFollowers(context.Background(), leader, []*sqlx.DB{follower}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer db.Close()
+
+	cases := []struct {
+		err    error
+		expect bool
+	}{
+		{err: nil, expect: false},
+		{err: sql.ErrNoRows, expect: false},
+		{err: &pq.Error{Code: "42601"}, expect: false},
+		{err: &pq.Error{Code: "23505"}, expect: false},
+		{err: driver.ErrBadConn, expect: true},
+		{err: fmt.Errorf("select users: %w", driver.ErrBadConn), expect: true},
+		{err: mysql.ErrInvalidConn, expect: true},
+		{err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, expect: true},
+	}
+
+	for _, c := range cases {
+		if db.conns.shouldFallback(context.Background(), follower, c.err) != c.expect {
+			t.Errorf("error %v: expecting fallback %v", c.err, c.expect)
+			return
+		}
+	}
+
+	// never fallback when the query is already to leader
+	if db.conns.shouldFallback(context.Background(), leader, driver.ErrBadConn) {
+		t.Error("expecting no fallback when the query is to leader")
+		return
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	t.Parallel()
+
+	leader, err := sqlx.Open("postgres", "postgres://localhost:5432/test")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	db, err := WrapFollowers(context.Background(), leader, nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := db.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+	// second close should not panic
+	db.Close()
+}
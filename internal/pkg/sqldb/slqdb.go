@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -18,26 +20,87 @@ var (
 )
 
 // DB struct to hold all database connections
+// the connections can be replaced using Swap, so the users of DB use the new connections without getting a new DB
 type DB struct {
-	driver   string
-	leader   *sqlx.DB
-	follower *sqlx.DB
+	mu    sync.RWMutex
+	conns *conns
+}
+
+// conns is the leader and followers connections of DB
+type conns struct {
+	driver    string
+	leader    *sqlx.DB
+	followers []*follower
+	options   WrapOptions
+	// counter for round robin balancer
+	counter   uint64
+	stopChan  chan struct{}
+	closeOnce sync.Once
 }
 
 // Wrap leader and follower sqlx object to one DB object
 // this is for easier usage, so user doesn't have to specify leader or follower
 // all exec is going to leader, all query is going to follower
 func Wrap(ctx context.Context, leader, follower *sqlx.DB) (*DB, error) {
-	if leader.DriverName() != follower.DriverName() {
-		return nil, fmt.Errorf("sqldb: leader and follower driver is not matched. leader = %s follower = %s", leader.DriverName(), follower.DriverName())
+	return WrapFollowers(ctx, leader, []*sqlx.DB{follower}, nil)
+}
+
+// WrapFollowers wrap leader and more than one followers to one DB object
+// the follower for each query is choosen by the balancer in options
+// query is going to leader when no follower is available
+func WrapFollowers(ctx context.Context, leader *sqlx.DB, followers []*sqlx.DB, wrapOpts *WrapOptions) (*DB, error) {
+	opts := WrapOptions{}
+	if wrapOpts != nil {
+		opts = *wrapOpts
+	}
+	if err := opts.Validate(leader.DriverName()); err != nil {
+		return nil, err
 	}
 
-	db := DB{
+	c := conns{
 		driver:   leader.DriverName(),
 		leader:   leader,
-		follower: follower,
+		options:  opts,
+		stopChan: make(chan struct{}),
+	}
+	for _, f := range followers {
+		if leader.DriverName() != f.DriverName() {
+			return nil, fmt.Errorf("sqldb: leader and follower driver is not matched. leader = %s follower = %s", leader.DriverName(), f.DriverName())
+		}
+		c.followers = append(c.followers, &follower{db: f})
 	}
-	return &db, nil
+	// use leader as follower if no follower is given
+	if len(c.followers) == 0 {
+		c.followers = append(c.followers, &follower{db: leader})
+	}
+
+	if opts.MaxReplicationLag > 0 {
+		go c.monitorLag()
+	}
+	return &DB{conns: &c}, nil
+}
+
+// current return the current connections
+func (db *DB) current() *conns {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.conns
+}
+
+// Swap replace the connections with the connections of next, and return a DB holding the replaced connections
+// the queries that already use the replaced connections are not interrupted, so close the returned DB after they are finished.
+// The driver of next must be the same, and next should not be used after swapped.
+func (db *DB) Swap(next *DB) (*DB, error) {
+	nc := next.current()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if nc.driver != db.conns.driver {
+		return nil, fmt.Errorf("sqldb: cannot swap database with different driver. current = %s next = %s", db.conns.driver, nc.driver)
+	}
+	old := db.conns
+	db.conns = nc
+	return &DB{conns: old}, nil
 }
 
 // ConnectOptions to list options when connect to the db
@@ -93,101 +156,159 @@ func connectWithRetry(ctx context.Context, driver, dsn string, retry int) (*sqlx
 	return sqlxdb, err
 }
 
-// Close all database connection to leader and replica
+// Close all database connection to leader and followers
+// followers are still closed when closing leader return error
 func (db *DB) Close() error {
-	if err := db.leader.Close(); err != nil {
-		return err
+	c := db.current()
+	c.closeOnce.Do(func() {
+		close(c.stopChan)
+	})
+
+	var errs []string
+	if err := c.leader.Close(); err != nil {
+		errs = append(errs, fmt.Sprintf("failed to close leader: %v", err))
 	}
-	if err := db.follower.Close(); err != nil {
-		return err
+	for _, f := range c.followerConns() {
+		if f == c.leader {
+			continue
+		}
+		if err := f.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to close follower: %v", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("sqldb: %s", strings.Join(errs, ", "))
 	}
 	return nil
 }
 
 // Leader return leader database connection
 func (db *DB) Leader() *sqlx.DB {
-	return db.leader
+	return db.current().leader
 }
 
-// Follower return follower database connection
+// Follower return follower database connection choosen by the balancer
 func (db *DB) Follower() *sqlx.DB {
-	return db.follower
+	return db.current().pickFollower()
+}
+
+// Followers return all follower database connections
+func (db *DB) Followers() []*sqlx.DB {
+	return db.current().followerConns()
+}
+
+func (c *conns) followerConns() []*sqlx.DB {
+	followers := make([]*sqlx.DB, len(c.followers))
+	for i, f := range c.followers {
+		followers[i] = f.db
+	}
+	return followers
 }
 
 // SetMaxIdleConns to sql database
 func (db *DB) SetMaxIdleConns(n int) {
 	db.Leader().SetMaxIdleConns(n)
-	db.Follower().SetMaxIdleConns(n)
+	for _, f := range db.Followers() {
+		f.SetMaxIdleConns(n)
+	}
 }
 
 // SetMaxOpenConns to sql database
 func (db *DB) SetMaxOpenConns(n int) {
 	db.Leader().SetMaxOpenConns(n)
-	db.Follower().SetMaxOpenConns(n)
+	for _, f := range db.Followers() {
+		f.SetMaxOpenConns(n)
+	}
 }
 
 // SetConnMaxLifetime to sql database
 func (db *DB) SetConnMaxLifetime(t time.Duration) {
 	db.Leader().SetConnMaxLifetime(t)
-	db.Follower().SetConnMaxLifetime(t)
+	for _, f := range db.Followers() {
+		f.SetConnMaxLifetime(t)
+	}
 }
 
 // Get return one value in destination using relfection
 func (db *DB) Get(dest interface{}, query string, args ...interface{}) error {
-	return db.follower.Get(dest, query, args...)
+	return db.GetContext(context.Background(), dest, query, args...)
 }
 
 // Select return more than one value in destintion using reflection
 func (db *DB) Select(dest interface{}, query string, args ...interface{}) error {
-	return db.follower.Select(dest, query, args...)
+	return db.SelectContext(context.Background(), dest, query, args...)
 }
 
 // Query function
 func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	return db.follower.Query(query, args...)
+	return db.QueryContext(context.Background(), query, args...)
 }
 
 // NamedQuery function
 func (db *DB) NamedQuery(query string, arg interface{}) (*sqlx.Rows, error) {
-	return db.follower.NamedQuery(query, arg)
+	c := db.current()
+	var (
+		ctx  = context.Background()
+		rows *sqlx.Rows
+		args = []interface{}{arg}
+	)
+
+	follower := c.pickFollower()
+	err := db.observe(ctx, "named_query", c.roleOf(follower), query, args, func(ctx context.Context) (err error) {
+		rows, err = follower.NamedQueryContext(ctx, query, arg)
+		return err
+	})
+	if c.shouldFallback(ctx, follower, err) {
+		err = db.observe(ctx, "named_query", RoleLeader, query, args, func(ctx context.Context) (err error) {
+			rows, err = c.leader.NamedQueryContext(ctx, query, arg)
+			return err
+		})
+	}
+	return rows, err
 }
 
 // QueryRow function
+// the query is not going to leader when follower return error, because the error is returned on scan
 func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
-	return db.follower.QueryRow(query, args...)
+	return db.QueryRowContext(context.Background(), query, args...)
 }
 
 // Exec function
 func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
-	return db.leader.Exec(query, args...)
+	return db.ExecContext(context.Background(), query, args...)
 }
 
 // NamedExec execute query with named parameter
 func (db *DB) NamedExec(query string, arg interface{}) (sql.Result, error) {
-	return db.leader.NamedExec(query, arg)
+	return db.NamedExecContext(context.Background(), query, arg)
 }
 
 // Begin return sql transaction object, begin a transaction
 func (db *DB) Begin() (*sql.Tx, error) {
-	return db.leader.Begin()
+	c := db.current()
+	return c.leader.Begin()
 }
 
 // Beginx return sqlx transaction object, begin a transaction
 func (db *DB) Beginx() (*sqlx.Tx, error) {
-	return db.leader.Beginx()
+	c := db.current()
+	return c.leader.Beginx()
 }
 
 // Rebind query
 func (db *DB) Rebind(query string) string {
-	return sqlx.Rebind(sqlx.BindType(db.driver), query)
+	c := db.current()
+	return sqlx.Rebind(sqlx.BindType(c.driver), query)
 }
 
 // Named return named query and parameters
-func (db *DB) Named(query string, arg interface{}) (string, interface{}, error) {
+func (db *DB) Named(query string, arg interface{}) (string, []interface{}, error) {
 	return sqlx.Named(query, arg)
 }
 
 // BindNamed return named query wrapped with bind
-func (db *DB) BindNamed(query string, arg interface{}) (string, interface{}, error) {
-	return sqlx.BindNamed(sqlx.BindType(db.driver), query, arg)
+func (db *DB) BindNamed(query string, arg interface{}) (string, []interface{}, error) {
+	c := db.current()
+	return sqlx.BindNamed(sqlx.BindType(c.driver), query, arg)
 }
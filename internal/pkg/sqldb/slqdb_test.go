@@ -0,0 +1,52 @@
+package sqldb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/sqldb/fakesql"
+)
+
+func TestSwap(t *testing.T) {
+	t.Parallel()
+
+	db, current := newFakeDB(t)
+	next, nextFake := newFakeDB(t)
+
+	old, err := db.Swap(next)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// the db that already retrieved is using the new connections
+	if _, err := db.ExecContext(context.Background(), "UPDATE users SET name = 'a'"); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(current.Statements()) != 0 || len(nextFake.Statements()) != 1 {
+		t.Errorf("expecting the statement executed to the new database, got %v and %v", current.Queries(), nextFake.Queries())
+		return
+	}
+	if old.Leader() == db.Leader() {
+		t.Error("expecting the old database to hold the replaced connections")
+		return
+	}
+	if err := old.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := db.ExecContext(context.Background(), "UPDATE users SET name = 'b'"); err != nil {
+		t.Errorf("expecting the new connections still open after the old database is closed, got %v", err)
+		return
+	}
+
+	mysql, err := WrapFollowers(context.Background(), fakesql.New().Open("mysql"), nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := db.Swap(mysql); err == nil {
+		t.Error("expecting error when swapping database with different driver")
+		return
+	}
+}
@@ -6,31 +6,146 @@ import (
 )
 
 // GetContext function
+// the query is going to leader if the context is set to leader or the follower return error
+// the query is executed in the transaction if the context holds a transaction from WithTx
 func (db *DB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
-	return db.follower.GetContext(ctx, dest, query, args...)
+	c := db.current()
+	if tx, ok := db.TxFromContext(ctx); ok {
+		return db.observe(ctx, "get", RoleTx, query, args, func(ctx context.Context) error {
+			return tx.GetContext(ctx, dest, query, args...)
+		})
+	}
+
+	conn := c.leader
+	if !readFromLeader(ctx) {
+		conn = c.pickFollower()
+	}
+	err := db.observe(ctx, "get", c.roleOf(conn), query, args, func(ctx context.Context) error {
+		return conn.GetContext(ctx, dest, query, args...)
+	})
+	if c.shouldFallback(ctx, conn, err) {
+		return db.observe(ctx, "get", RoleLeader, query, args, func(ctx context.Context) error {
+			return c.leader.GetContext(ctx, dest, query, args...)
+		})
+	}
+	return err
 }
 
 // SelectContext fuction
 func (db *DB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
-	return db.follower.SelectContext(ctx, dest, query, args...)
+	c := db.current()
+	if tx, ok := db.TxFromContext(ctx); ok {
+		return db.observe(ctx, "select", RoleTx, query, args, func(ctx context.Context) error {
+			return tx.SelectContext(ctx, dest, query, args...)
+		})
+	}
+
+	conn := c.leader
+	if !readFromLeader(ctx) {
+		conn = c.pickFollower()
+	}
+	err := db.observe(ctx, "select", c.roleOf(conn), query, args, func(ctx context.Context) error {
+		return conn.SelectContext(ctx, dest, query, args...)
+	})
+	if c.shouldFallback(ctx, conn, err) {
+		return db.observe(ctx, "select", RoleLeader, query, args, func(ctx context.Context) error {
+			return c.leader.SelectContext(ctx, dest, query, args...)
+		})
+	}
+	return err
 }
 
 // QueryContext function
 func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	return db.follower.QueryContext(ctx, query, args...)
+	c := db.current()
+	var rows *sql.Rows
+
+	if tx, ok := db.TxFromContext(ctx); ok {
+		err := db.observe(ctx, "query", RoleTx, query, args, func(ctx context.Context) (err error) {
+			rows, err = tx.QueryContext(ctx, query, args...)
+			return err
+		})
+		return rows, err
+	}
+
+	conn := c.leader
+	if !readFromLeader(ctx) {
+		conn = c.pickFollower()
+	}
+	err := db.observe(ctx, "query", c.roleOf(conn), query, args, func(ctx context.Context) (err error) {
+		rows, err = conn.QueryContext(ctx, query, args...)
+		return err
+	})
+	if c.shouldFallback(ctx, conn, err) {
+		err = db.observe(ctx, "query", RoleLeader, query, args, func(ctx context.Context) (err error) {
+			rows, err = c.leader.QueryContext(ctx, query, args...)
+			return err
+		})
+	}
+	return rows, err
 }
 
 // QueryRowContext function
+// the query is not going to leader when follower return error, because the error is returned on scan
 func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
-	return db.follower.QueryRowContext(ctx, query, args...)
+	c := db.current()
+	var row *sql.Row
+
+	if tx, ok := db.TxFromContext(ctx); ok {
+		db.observe(ctx, "query_row", RoleTx, query, args, func(ctx context.Context) error {
+			row = tx.QueryRowContext(ctx, query, args...)
+			return nil
+		})
+		return row
+	}
+
+	conn := c.leader
+	if !readFromLeader(ctx) {
+		conn = c.pickFollower()
+	}
+	db.observe(ctx, "query_row", c.roleOf(conn), query, args, func(ctx context.Context) error {
+		row = conn.QueryRowContext(ctx, query, args...)
+		return nil
+	})
+	return row
 }
 
 // ExecContext function
 func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	return db.leader.ExecContext(ctx, query, args...)
+	c := db.current()
+	var result sql.Result
+
+	markWrite(ctx)
+	role := RoleLeader
+	exec := c.leader.ExecContext
+	if tx, ok := db.TxFromContext(ctx); ok {
+		role = RoleTx
+		exec = tx.ExecContext
+	}
+
+	err := db.observe(ctx, "exec", role, query, args, func(ctx context.Context) (err error) {
+		result, err = exec(ctx, query, args...)
+		return err
+	})
+	return result, err
 }
 
 // NamedExecContext function
 func (db *DB) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
-	return db.leader.NamedExecContext(ctx, query, arg)
+	c := db.current()
+	var result sql.Result
+
+	markWrite(ctx)
+	role := RoleLeader
+	exec := c.leader.NamedExecContext
+	if tx, ok := db.TxFromContext(ctx); ok {
+		role = RoleTx
+		exec = tx.NamedExecContext
+	}
+
+	err := db.observe(ctx, "named_exec", role, query, []interface{}{arg}, func(ctx context.Context) (err error) {
+		result, err = exec(ctx, query, arg)
+		return err
+	})
+	return result, err
 }
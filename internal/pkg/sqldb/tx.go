@@ -0,0 +1,181 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.opencensus.io/trace"
+)
+
+// DefaultTxRetryBackoff is the default backoff before retrying a transaction
+const DefaultTxRetryBackoff = time.Millisecond * 50
+
+// TxOptions to list options when running function in transaction
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	// MaxRetry is the maximum retry when the transaction failed because of serialization failure or deadlock
+	MaxRetry int
+	// RetryBackoff is multiplied by the number of attempt before retrying
+	RetryBackoff time.Duration
+}
+
+// TxFunc is the function to run in transaction
+// the context passed to the function holds the transaction, use the context for all queries in the transaction
+type TxFunc func(ctx context.Context, tx *sqlx.Tx) error
+
+type txKey struct{}
+
+// txState is the transaction stored in context
+type txState struct {
+	db        *DB
+	tx        *sqlx.Tx
+	savepoint int
+}
+
+// WithTx run fn in a transaction, the transaction is committed if fn return nil and rolled back otherwise
+//
+// The transaction is stored in the context passed to fn, so all context queries from DB using that context
+// are executed in the transaction. WithTx with a context that already holds a transaction creates a savepoint,
+// so a function that use WithTx can be composed with other functions in a bigger transaction.
+// Retry only happens in the outermost transaction, as the whole transaction need to be retried.
+//
+// The transaction is not safe for concurrent use, don't use the context in more than one goroutine.
+func (db *DB) WithTx(ctx context.Context, txOpts *TxOptions, fn TxFunc) error {
+	c := db.current()
+	opts := TxOptions{}
+	if txOpts != nil {
+		opts = *txOpts
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = DefaultTxRetryBackoff
+	}
+
+	ctx, span := trace.StartSpan(ctx, "sqldb/tx")
+	defer span.End()
+	span.AddAttributes(trace.StringAttribute("db", c.options.Name))
+
+	if state, ok := db.txState(ctx); ok {
+		span.AddAttributes(trace.BoolAttribute("savepoint", true))
+		return state.withSavepoint(ctx, fn)
+	}
+
+	var (
+		err      error
+		attempts int64
+	)
+	for attempt := 0; attempt <= opts.MaxRetry; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(opts.RetryBackoff * time.Duration(attempt)):
+			}
+		}
+
+		attempts++
+		err = db.runTx(ctx, opts, fn)
+		if err == nil || !IsRetryableTxError(err) {
+			break
+		}
+	}
+	span.AddAttributes(trace.Int64Attribute("attempts", attempts))
+	if err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+	}
+	return err
+}
+
+func (db *DB) runTx(ctx context.Context, opts TxOptions, fn TxFunc) (err error) {
+	c := db.current()
+	tx, err := c.leader.BeginTxx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+				err = fmt.Errorf("sqldb: failed to rollback: %v: %w", rbErr, err)
+			}
+		}
+	}()
+
+	state := &txState{db: db, tx: tx}
+	if err = fn(context.WithValue(ctx, txKey{}, state), tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// withSavepoint run fn inside a savepoint of the current transaction
+func (state *txState) withSavepoint(ctx context.Context, fn TxFunc) (err error) {
+	state.savepoint++
+	savepoint := fmt.Sprintf("sqldb_savepoint_%d", state.savepoint)
+
+	if _, err := state.tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			state.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint)
+			panic(p)
+		}
+		if err != nil {
+			if _, rbErr := state.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); rbErr != nil {
+				err = fmt.Errorf("sqldb: failed to rollback to savepoint: %v: %w", rbErr, err)
+			}
+		}
+	}()
+
+	if err = fn(ctx, state.tx); err != nil {
+		return err
+	}
+	_, err = state.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint)
+	return err
+}
+
+// txState return the transaction of this DB from context
+func (db *DB) txState(ctx context.Context) (*txState, bool) {
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok || state.db != db {
+		return nil, false
+	}
+	return state, true
+}
+
+// TxFromContext return the transaction from context
+func (db *DB) TxFromContext(ctx context.Context) (*sqlx.Tx, bool) {
+	state, ok := db.txState(ctx)
+	if !ok {
+		return nil, false
+	}
+	return state.tx, true
+}
+
+// IsRetryableTxError return true if the transaction failed because of serialization failure or deadlock
+func IsRetryableTxError(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// serialization_failure and deadlock_detected
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		// ER_LOCK_DEADLOCK
+		return mysqlErr.Number == 1213
+	}
+	return false
+}
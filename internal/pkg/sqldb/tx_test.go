@@ -0,0 +1,260 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/pkg/sqldb/fakesql"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+func TestIsRetryableTxError(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		err    error
+		expect bool
+	}{
+		{err: &pq.Error{Code: "40001"}, expect: true},
+		{err: &pq.Error{Code: "40P01"}, expect: true},
+		{err: fmt.Errorf("create invoice: %w", &pq.Error{Code: "40001"}), expect: true},
+		{err: &pq.Error{Code: "23505"}, expect: false},
+		{err: &mysql.MySQLError{Number: 1213}, expect: true},
+		{err: &mysql.MySQLError{Number: 1062}, expect: false},
+		{err: errors.New("something wrong"), expect: false},
+	}
+
+	for _, c := range cases {
+		if IsRetryableTxError(c.err) != c.expect {
+			t.Errorf("error %v: expecting retryable %v", c.err, c.expect)
+			return
+		}
+	}
+}
+
+func TestTxFromContext(t *testing.T) {
+	t.Parallel()
+
+	db1, db2 := &DB{}, &DB{}
+	ctx := context.WithValue(context.Background(), txKey{}, &txState{db: db1})
+
+	if _, ok := db1.TxFromContext(ctx); !ok {
+		t.Error("expecting transaction of db1 in context")
+		return
+	}
+	if _, ok := db2.TxFromContext(ctx); ok {
+		t.Error("expecting no transaction of db2 in context")
+		return
+	}
+}
+
+func newFakeDB(t *testing.T) (*DB, *fakesql.DB) {
+	fake := fakesql.New()
+	db, err := WrapFollowers(context.Background(), fake.Open("postgres"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, fake
+}
+
+func compareQueries(expect, got []string) error {
+	if len(expect) != len(got) {
+		return fmt.Errorf("expecting queries %v but got %v", expect, got)
+	}
+	for i := range expect {
+		if expect[i] != got[i] {
+			return fmt.Errorf("expecting queries %v but got %v", expect, got)
+		}
+	}
+	return nil
+}
+
+func TestWithTx(t *testing.T) {
+	t.Parallel()
+
+	errInsert := errors.New("failed to insert")
+
+	cases := []struct {
+		name        string
+		fn          TxFunc
+		expectError error
+		expect      []string
+	}{
+		{
+			name: "commit when no error",
+			fn: func(ctx context.Context, tx *sqlx.Tx) error {
+				_, err := tx.ExecContext(ctx, "INSERT INTO users(id) VALUES(1)")
+				return err
+			},
+			expect: []string{"BEGIN", "INSERT INTO users(id) VALUES(1)", "COMMIT"},
+		},
+		{
+			name: "rollback on error",
+			fn: func(ctx context.Context, tx *sqlx.Tx) error {
+				if _, err := tx.ExecContext(ctx, "INSERT INTO users(id) VALUES(1)"); err != nil {
+					return err
+				}
+				return errInsert
+			},
+			expectError: errInsert,
+			expect:      []string{"BEGIN", "INSERT INTO users(id) VALUES(1)", "ROLLBACK"},
+		},
+	}
+
+	for _, c := range cases {
+		db, fake := newFakeDB(t)
+		err := db.WithTx(context.Background(), nil, c.fn)
+		if !errors.Is(err, c.expectError) {
+			t.Errorf("%s: expecting error %v but got %v", c.name, c.expectError, err)
+			return
+		}
+		if err := compareQueries(c.expect, fake.Queries()); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			return
+		}
+	}
+}
+
+func TestWithTxPanic(t *testing.T) {
+	t.Parallel()
+
+	db, fake := newFakeDB(t)
+	func() {
+		defer func() {
+			if p := recover(); p == nil {
+				t.Error("expecting panic to be propagated")
+			}
+		}()
+		db.WithTx(context.Background(), nil, func(ctx context.Context, tx *sqlx.Tx) error {
+			tx.ExecContext(ctx, "INSERT INTO users(id) VALUES(1)")
+			panic("something wrong")
+		})
+	}()
+
+	if err := compareQueries([]string{"BEGIN", "INSERT INTO users(id) VALUES(1)", "ROLLBACK"}, fake.Queries()); err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestWithTxSavepoint(t *testing.T) {
+	t.Parallel()
+
+	db, fake := newFakeDB(t)
+	errNested := errors.New("nested failed")
+
+	err := db.WithTx(context.Background(), nil, func(ctx context.Context, tx *sqlx.Tx) error {
+		if _, err := db.ExecContext(ctx, "INSERT INTO users(id) VALUES(1)"); err != nil {
+			return err
+		}
+		// the nested transaction is rolled back to the savepoint, the outer transaction is still committed
+		err := db.WithTx(ctx, nil, func(ctx context.Context, tx *sqlx.Tx) error {
+			if _, err := db.ExecContext(ctx, "INSERT INTO users_bio(id) VALUES(1)"); err != nil {
+				return err
+			}
+			return errNested
+		})
+		if !errors.Is(err, errNested) {
+			return fmt.Errorf("expecting nested error but got %v", err)
+		}
+		return db.WithTx(ctx, nil, func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := db.ExecContext(ctx, "INSERT INTO users_bio(id) VALUES(2)")
+			return err
+		})
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expect := []string{
+		"BEGIN",
+		"INSERT INTO users(id) VALUES(1)",
+		"SAVEPOINT sqldb_savepoint_1",
+		"INSERT INTO users_bio(id) VALUES(1)",
+		"ROLLBACK TO SAVEPOINT sqldb_savepoint_1",
+		"SAVEPOINT sqldb_savepoint_2",
+		"INSERT INTO users_bio(id) VALUES(2)",
+		"RELEASE SAVEPOINT sqldb_savepoint_2",
+		"COMMIT",
+	}
+	if err := compareQueries(expect, fake.Queries()); err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestWithTxRetry(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		err         error
+		failures    int
+		maxRetry    int
+		expectError bool
+		expectBegin int
+	}{
+		{
+			name:        "retry on serialization failure",
+			err:         &pq.Error{Code: "40001"},
+			failures:    2,
+			maxRetry:    2,
+			expectBegin: 3,
+		},
+		{
+			name:        "stop retry after max retry",
+			err:         &pq.Error{Code: "40P01"},
+			failures:    3,
+			maxRetry:    1,
+			expectError: true,
+			expectBegin: 2,
+		},
+		{
+			name:        "no retry on other error",
+			err:         &pq.Error{Code: "23505"},
+			failures:    1,
+			maxRetry:    2,
+			expectError: true,
+			expectBegin: 1,
+		},
+	}
+
+	for _, c := range cases {
+		db, fake := newFakeDB(t)
+		failures := c.failures
+		fake.Exec("UPDATE users", func(args []driver.Value) (driver.Result, error) {
+			if failures > 0 {
+				failures--
+				return nil, c.err
+			}
+			return driver.RowsAffected(1), nil
+		})
+
+		err := db.WithTx(context.Background(), &TxOptions{MaxRetry: c.maxRetry, RetryBackoff: time.Millisecond}, func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := db.ExecContext(ctx, "UPDATE users SET name = 'test'")
+			return err
+		})
+		if (err != nil) != c.expectError {
+			t.Errorf("%s: expecting error %v but got %v", c.name, c.expectError, err)
+			return
+		}
+
+		var begin int
+		for _, q := range fake.Queries() {
+			if q == fakesql.StatementBegin {
+				begin++
+			}
+		}
+		if begin != c.expectBegin {
+			t.Errorf("%s: expecting %d transactions but got %d", c.name, c.expectBegin, begin)
+			return
+		}
+	}
+}
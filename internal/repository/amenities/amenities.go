@@ -2,16 +2,21 @@ package amenities
 
 import (
 	"context"
-	"github.com/lib/pq"
+	"database/sql"
+	"errors"
 	"time"
 
+	"github.com/lib/pq"
+
 	entity "github.com/albertwidi/go-project-example/internal/entity/amenities"
+	"github.com/albertwidi/go-project-example/internal/pkg/cache"
 	"github.com/albertwidi/go-project-example/internal/pkg/sqldb"
 )
 
 // Repository of amenities
 type Repository struct {
-	db *sqldb.DB
+	db    *sqldb.DB
+	cache *cache.Cache
 }
 
 // Amenities struct
@@ -27,29 +32,77 @@ type Amenities struct {
 	IsTest    bool        `db:"is_test"`
 }
 
-// New amenities repo
-func New() *Repository {
-	r := Repository{}
+// New amenities repo, cache is optional
+func New(db *sqldb.DB, c *cache.Cache) *Repository {
+	r := Repository{
+		db:    db,
+		cache: c,
+	}
 	return &r
 }
 
 // Create a new amenities
 func (r Repository) Create(ctx context.Context, amenities entity.Amenities) error {
-	return nil
+	// the amenities might be cached as not found
+	return r.cache.Invalidate(ctx, amenities.ID)
 }
 
-// Get amenities
+const (
+	getAmenitiesQuery = `
+SELECT id, name, type, image_path, created_at, updated_at, is_deleted, is_test
+FROM amenities
+WHERE id = $1
+	AND is_deleted = false
+`
+)
+
+// Get amenities, the amenities that does not exist is not returned
 func (r Repository) Get(ctx context.Context, amenitiesID ...string) ([]entity.Amenities, error) {
 	a := []entity.Amenities{}
+	for _, id := range amenitiesID {
+		amenities := Amenities{}
+		err := r.cache.Get(ctx, id, &amenities, func(ctx context.Context) (interface{}, error) {
+			return r.get(ctx, id)
+		})
+		if err != nil {
+			if errors.Is(err, cache.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		a = append(a, entity.Amenities{
+			ID:        amenities.ID,
+			Name:      amenities.Name,
+			Type:      entity.Type(amenities.Type),
+			ImagePath: amenities.ImagePath,
+			CreatedAt: amenities.CreatedAt,
+			UpdatedAt: amenities.UpdatedAt.Time,
+			IsDeleted: amenities.IsDeleted,
+			IsTest:    amenities.IsTest,
+		})
+	}
+	return a, nil
+}
+
+func (r Repository) get(ctx context.Context, amenitiesID string) (Amenities, error) {
+	a := Amenities{}
+	err := r.db.GetContext(ctx, &a, getAmenitiesQuery, amenitiesID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return a, cache.ErrNotFound
+		}
+		return a, err
+	}
 	return a, nil
 }
 
 // Update amenities
 func (r Repository) Update(ctx context.Context, amenities entity.Amenities) error {
-	return nil
+	return r.cache.Invalidate(ctx, amenities.ID)
 }
 
 // Delete the amenities
 func (r Repository) Delete(ctx context.Context, amenitiesID string) error {
-	return nil
+	return r.cache.Invalidate(ctx, amenitiesID)
 }
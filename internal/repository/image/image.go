@@ -45,3 +45,37 @@ func (r Repository) GetTempPath(ctx context.Context, id string) (string, error)
 	}
 	return out, err
 }
+
+func createReferenceKey(filePath string) string {
+	return strings.Join([]string{"image_ref", filePath}, ":")
+}
+
+// AddReference add the owner as reference of the image file and return the number of references
+// the image is stored once for the same content, so the file is only deleted when it has no reference
+func (r Repository) AddReference(ctx context.Context, filePath, owner string) (int, error) {
+	key := createReferenceKey(filePath)
+	if _, err := r.redis.SAdd(ctx, key, owner); err != nil {
+		return 0, err
+	}
+	return r.redis.SCard(ctx, key)
+}
+
+// RemoveReference remove the owner from the references of the image file and return the number of references left
+func (r Repository) RemoveReference(ctx context.Context, filePath, owner string) (int, error) {
+	key := createReferenceKey(filePath)
+	if _, err := r.redis.SRem(ctx, key, owner); err != nil {
+		return 0, err
+	}
+	return r.redis.SCard(ctx, key)
+}
+
+// HasReference check whether the owner is the reference of the image file
+func (r Repository) HasReference(ctx context.Context, filePath, owner string) (bool, error) {
+	return r.redis.SIsMember(ctx, createReferenceKey(filePath), owner)
+}
+
+// DeleteReferences remove all references of the image file
+func (r Repository) DeleteReferences(ctx context.Context, filePath string) error {
+	_, err := r.redis.Delete(ctx, createReferenceKey(filePath))
+	return err
+}
@@ -6,6 +6,7 @@ import (
 
 	invoiceentity "github.com/albertwidi/go-project-example/internal/entity/invoice"
 	"github.com/albertwidi/go-project-example/internal/pkg/sqldb"
+	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 )
 
@@ -147,86 +148,64 @@ INSERT INTO invoices_details (
 )
 
 // Create a new invoice
+// invoice and invoice details are created in one transaction,
+// the transaction in the context is used if Create is called inside sqldb.WithTx
 func (r *Repository) Create(ctx context.Context, invoice *invoiceentity.Invoice) error {
-	var details []string
+	return r.db.WithTx(ctx, nil, func(ctx context.Context, tx *sqlx.Tx) error {
+		var details []string
 
-	// create database transaction for creating invoice and invoice detail
-	tx, err := r.db.Leader().BeginTxx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// create the detail first
-	for idx, invD := range invoice.Details {
-		invoiceDetail := Detail{
-			InvoiceID:    invD.InvoiceID,
-			Amount:       invD.Amount,
-			Discount:     invD.Discount,
-			ItemName:     invD.ItemName,
-			ItemQuantity: invD.ItemQuantity,
-			Description:  invD.Description,
-			CreatedAt:    time.Now(),
-			CreatedBy:    invD.CreatedBy,
-			IsTest:       invD.IsTest,
-		}
-		qDetail, args, err := r.db.BindNamed(createNewInvoiceDetailQuery, invoiceDetail)
-		if err != nil {
-			return err
-		}
+		// create the detail first
+		for idx, invD := range invoice.Details {
+			invoiceDetail := Detail{
+				InvoiceID:    invD.InvoiceID,
+				Amount:       invD.Amount,
+				Discount:     invD.Discount,
+				ItemName:     invD.ItemName,
+				ItemQuantity: invD.ItemQuantity,
+				Description:  invD.Description,
+				CreatedAt:    time.Now(),
+				CreatedBy:    invD.CreatedBy,
+				IsTest:       invD.IsTest,
+			}
+			qDetail, args, err := r.db.BindNamed(createNewInvoiceDetailQuery, invoiceDetail)
+			if err != nil {
+				return err
+			}
 
-		rows, err := tx.QueryContext(ctx, qDetail, args)
-		if err != nil {
-			return err
-		}
-		// only return 1 result: ID
-		if rows.Next() {
+			// only return 1 result: ID
 			var id string
-			if err := rows.Scan(&id); err != nil {
+			if err := tx.QueryRowxContext(ctx, qDetail, args...).Scan(&id); err != nil {
 				return err
 			}
 			details = append(details, id)
 			// set invoice details id
 			invoice.Details[idx].ID = id
 		}
-	}
 
-	// insert the invoice
-	inv := Invoice{
-		Number:        invoice.Number,
-		OrderID:       invoice.OrderID,
-		InvoiceFrom:   invoice.InvoiceFrom,
-		InvoiceTo:     invoice.InvoiceTo,
-		Type:          invoice.Type,
-		Total:         invoice.Total,
-		DiscountTotal: invoice.DiscountTotal,
-		GrandTotal:    invoice.GrandTotal,
-		Details:       details,
-		Status:        invoice.Status,
-		Description:   invoice.Description,
-		DueDate:       invoice.DueDate,
-		CreatedAt:     time.Now(),
-		CreatedBy:     invoice.CreatedBy,
-		IsTest:        invoice.IsTest,
-	}
-	qInv, args, err := r.db.BindNamed(createNewInvoiceQuery, inv)
-	if err != nil {
-		return err
-	}
-	rows, err := tx.QueryContext(ctx, qInv, args)
-	if err != nil {
-		return err
-	}
-	if rows.Next() {
-		if err := rows.Scan(invoice.ID); err != nil {
+		// insert the invoice
+		inv := Invoice{
+			Number:        invoice.Number,
+			OrderID:       invoice.OrderID,
+			InvoiceFrom:   invoice.InvoiceFrom,
+			InvoiceTo:     invoice.InvoiceTo,
+			Type:          invoice.Type,
+			Total:         invoice.Total,
+			DiscountTotal: invoice.DiscountTotal,
+			GrandTotal:    invoice.GrandTotal,
+			Details:       details,
+			Status:        invoice.Status,
+			Description:   invoice.Description,
+			DueDate:       invoice.DueDate,
+			CreatedAt:     time.Now(),
+			CreatedBy:     invoice.CreatedBy,
+			IsTest:        invoice.IsTest,
+		}
+		qInv, args, err := r.db.BindNamed(createNewInvoiceQuery, inv)
+		if err != nil {
 			return err
 		}
-	}
-	return tx.Commit()
+		return tx.QueryRowxContext(ctx, qInv, args...).Scan(&invoice.ID)
+	})
 }
 
 const (
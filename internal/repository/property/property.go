@@ -4,25 +4,29 @@ import (
 	"context"
 
 	entity "github.com/albertwidi/go-project-example/internal/entity/property"
+	"github.com/albertwidi/go-project-example/internal/pkg/cache"
 	"github.com/albertwidi/go-project-example/internal/pkg/sqldb"
 )
 
 // Repository of property
 type Repository struct {
-	db *sqldb.DB
+	db    *sqldb.DB
+	cache *cache.Cache
 }
 
-// New property repository
-func New(db *sqldb.DB) *Repository {
+// New property repository, cache is optional
+func New(db *sqldb.DB, c *cache.Cache) *Repository {
 	r := Repository{
-		db: db,
+		db:    db,
+		cache: c,
 	}
 	return &r
 }
 
 // Create new property
 func (r Repository) Create(ctx context.Context, property entity.Property, detail entity.Detail, addressMap entity.AddressMap, pricings []entity.Pricing) error {
-	return nil
+	// the property might be cached as not found
+	return r.cache.Invalidate(ctx, property.ID)
 }
 
 // Update property
@@ -42,5 +46,5 @@ func (r Repository) UpdateAddress(ctx context.Context) error {
 
 // Delete property
 func (r Repository) Delete(ctx context.Context, id string) error {
-	return nil
+	return r.cache.Invalidate(ctx, id)
 }
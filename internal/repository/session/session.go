@@ -5,15 +5,31 @@
 
 package session
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	sessionentity "github.com/albertwidi/go-project-example/internal/entity/session"
+	userentity "github.com/albertwidi/go-project-example/internal/entity/user"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+)
 
 // Repository struct
 type Repository struct {
+	redis redis.Redis
 }
 
 // New session repository
-func New() {
+func New(redis redis.Redis) *Repository {
+	r := Repository{
+		redis: redis,
+	}
+	return &r
+}
 
+func createSessionKey(userhash userentity.Hash) string {
+	return strings.Join([]string{"user", string(userhash)}, ":")
 }
 
 // Create a new session
@@ -26,3 +42,27 @@ func (r *Repository) Create(ctx context.Context) error {
 func (r *Repository) SaveUserInfo(ctx context.Context) error {
 	return nil
 }
+
+// Save the session of user
+func (r *Repository) Save(ctx context.Context, userhash userentity.Hash, sessionid string, data sessionentity.Session) error {
+	out, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = r.redis.HSet(ctx, createSessionKey(userhash), sessionid, string(out))
+	return err
+}
+
+// Get the session of user
+func (r *Repository) Get(ctx context.Context, userhash userentity.Hash, sessionid string) (sessionentity.Session, error) {
+	sess := sessionentity.Session{}
+	out, err := r.redis.HGet(ctx, createSessionKey(userhash), sessionid)
+	if err != nil {
+		if r.redis.IsErrNil(err) {
+			return sess, sessionentity.ErrSessionNotFound
+		}
+		return sess, err
+	}
+	err = json.Unmarshal([]byte(out), &sess)
+	return sess, err
+}
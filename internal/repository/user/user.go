@@ -4,6 +4,7 @@ import (
 	"context"
 
 	userentity "github.com/albertwidi/go-project-example/internal/entity/user"
+	"github.com/albertwidi/go-project-example/internal/pkg/cache"
 	"github.com/albertwidi/go-project-example/internal/pkg/redis"
 	"github.com/albertwidi/go-project-example/internal/pkg/sqldb"
 )
@@ -12,19 +13,25 @@ import (
 type Repository struct {
 	db    *sqldb.DB
 	redis redis.Redis
+	cache *cache.Cache
 }
 
-// New repository of user
-func New(db *sqldb.DB, redis redis.Redis) *Repository {
+// New repository of user, cache is optional
+func New(db *sqldb.DB, redis redis.Redis, c *cache.Cache) *Repository {
 	r := Repository{
 		db:    db,
 		redis: redis,
+		cache: c,
 	}
 	return &r
 }
 
 // Create user
 func (r *Repository) Create(ctx context.Context, user userentity.User) (string, error) {
+	// the user might be cached as not found
+	if err := r.cache.Invalidate(ctx, user.ID); err != nil {
+		return "", err
+	}
 	return "", nil
 }
 
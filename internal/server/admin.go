@@ -2,17 +2,44 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"net"
 	"net/http"
+	"time"
 
+	"github.com/albertwidi/go-project-example/internal/kothak"
+	requestctx "github.com/albertwidi/go-project-example/internal/pkg/context"
 	"github.com/albertwidi/go-project-example/internal/pkg/router"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// HealthChecker to check the health of resources used by the application
+type HealthChecker interface {
+	HealthCheck(ctx context.Context, timeout time.Duration) kothak.Health
+}
+
+// Reloader to reload the application resources
+type Reloader interface {
+	Reload(ctx context.Context) (interface{}, error)
+}
+
+// ReloaderFunc is an adapter to allow a function to be used as Reloader
+type ReloaderFunc func(ctx context.Context) (interface{}, error)
+
+// Reload call the reloader function
+func (rf ReloaderFunc) Reload(ctx context.Context) (interface{}, error) {
+	return rf(ctx)
+}
+
+// healthCheckTimeout is the maximum time for health check to finish
+const healthCheckTimeout = time.Second * 3
+
 type adminServer struct {
-	address    string
-	httpServer *http.Server
-	listener   net.Listener
+	address       string
+	httpServer    *http.Server
+	listener      net.Listener
+	healthChecker HealthChecker
+	reloader      Reloader
 }
 
 func (s *Server) newAdminServer(address string) (*adminServer, error) {
@@ -45,4 +72,64 @@ func (adm *adminServer) Shutdown(ctx context.Context) error {
 
 func (adm *adminServer) registerHandler(r *router.Router) {
 	r.Handle("/metrics", promhttp.Handler())
+	r.Get("/healthz", adm.healthz)
+	r.Get("/readyz", adm.readyz)
+	r.Post("/reload", adm.reload)
+}
+
+// healthz is the liveness check of the application
+// the status code is always 200 as long as the server is able to respond,
+// the health of resources is only informational
+func (adm *adminServer) healthz(rctx *requestctx.RequestContext) error {
+	health := adm.checkHealth(rctx.Context())
+	return writeHealth(rctx, http.StatusOK, health)
+}
+
+// readyz is the readiness check of the application
+// the status code is 503 if one of the resources is not healthy,
+// so the orchestrator stop sending traffic to the application
+func (adm *adminServer) readyz(rctx *requestctx.RequestContext) error {
+	health := adm.checkHealth(rctx.Context())
+	statusCode := http.StatusOK
+	if !health.Healthy {
+		statusCode = http.StatusServiceUnavailable
+	}
+	return writeHealth(rctx, statusCode, health)
+}
+
+func (adm *adminServer) checkHealth(ctx context.Context) kothak.Health {
+	// nothing to check, the application is healthy
+	if adm.healthChecker == nil {
+		return kothak.Health{Healthy: true, Resources: []kothak.ResourceHealth{}}
+	}
+	return adm.healthChecker.HealthCheck(ctx, healthCheckTimeout)
+}
+
+// reload the application resources
+func (adm *adminServer) reload(rctx *requestctx.RequestContext) error {
+	if adm.reloader == nil {
+		return writeJSON(rctx, http.StatusNotImplemented, map[string]string{"error": "reload is not supported"})
+	}
+
+	result, err := adm.reloader.Reload(rctx.Context())
+	if err != nil {
+		return writeJSON(rctx, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return writeJSON(rctx, http.StatusOK, result)
+}
+
+func writeHealth(rctx *requestctx.RequestContext, statusCode int, health kothak.Health) error {
+	return writeJSON(rctx, statusCode, health)
+}
+
+func writeJSON(rctx *requestctx.RequestContext, statusCode int, v interface{}) error {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w := rctx.ResponseWriter()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_, err = w.Write(out)
+	return err
 }
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/albertwidi/go-project-example/internal/kothak"
+	"github.com/albertwidi/go-project-example/internal/pkg/router"
+)
+
+// fakeHealthChecker return the health and record the timeout
+type fakeHealthChecker struct {
+	health  kothak.Health
+	timeout time.Duration
+}
+
+func (f *fakeHealthChecker) HealthCheck(ctx context.Context, timeout time.Duration) kothak.Health {
+	f.timeout = timeout
+	return f.health
+}
+
+func TestHealthHandler(t *testing.T) {
+	t.Parallel()
+
+	healthy := kothak.Health{
+		Healthy: true,
+		Resources: []kothak.ResourceHealth{
+			{Name: "users", Kind: kothak.KindSQLDB, Role: kothak.RoleLeader, Healthy: true},
+			{Name: "users", Kind: kothak.KindSQLDB, Role: kothak.RoleFollower, Healthy: true},
+		},
+	}
+	unhealthy := kothak.Health{
+		Healthy: false,
+		Resources: []kothak.ResourceHealth{
+			{Name: "users", Kind: kothak.KindSQLDB, Role: kothak.RoleLeader, Healthy: true},
+			{Name: "users", Kind: kothak.KindSQLDB, Role: kothak.RoleFollower, Healthy: false, Error: "connection refused"},
+		},
+	}
+
+	cases := []struct {
+		name         string
+		path         string
+		health       *kothak.Health
+		expectStatus int
+		expect       kothak.Health
+	}{
+		{
+			name:         "healthz healthy",
+			path:         "/healthz",
+			health:       &healthy,
+			expectStatus: http.StatusOK,
+			expect:       healthy,
+		},
+		{
+			name:         "healthz is ok when a resource is down",
+			path:         "/healthz",
+			health:       &unhealthy,
+			expectStatus: http.StatusOK,
+			expect:       unhealthy,
+		},
+		{
+			name:         "readyz healthy",
+			path:         "/readyz",
+			health:       &healthy,
+			expectStatus: http.StatusOK,
+			expect:       healthy,
+		},
+		{
+			name:         "readyz is unavailable when a resource is down",
+			path:         "/readyz",
+			health:       &unhealthy,
+			expectStatus: http.StatusServiceUnavailable,
+			expect:       unhealthy,
+		},
+		{
+			name:         "readyz without health checker",
+			path:         "/readyz",
+			expectStatus: http.StatusOK,
+			expect:       kothak.Health{Healthy: true, Resources: []kothak.ResourceHealth{}},
+		},
+	}
+
+	for _, c := range cases {
+		adm := adminServer{}
+		checker := &fakeHealthChecker{}
+		if c.health != nil {
+			checker.health = *c.health
+			adm.healthChecker = checker
+		}
+		r := router.New("", nil)
+		adm.registerHandler(r)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, c.path, nil))
+		if w.Code != c.expectStatus {
+			t.Errorf("%s: expecting status %d but got %d", c.name, c.expectStatus, w.Code)
+			return
+		}
+
+		health := kothak.Health{}
+		if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			return
+		}
+		if health.Healthy != c.expect.Healthy || len(health.Resources) != len(c.expect.Resources) {
+			t.Errorf("%s: expecting health %+v but got %+v", c.name, c.expect, health)
+			return
+		}
+		for i := range health.Resources {
+			if health.Resources[i] != c.expect.Resources[i] {
+				t.Errorf("%s: expecting resource %+v but got %+v", c.name, c.expect.Resources[i], health.Resources[i])
+				return
+			}
+		}
+		if c.health != nil && checker.timeout != healthCheckTimeout {
+			t.Errorf("%s: expecting health check timeout %v but got %v", c.name, healthCheckTimeout, checker.timeout)
+			return
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package imageproxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	imageentity "github.com/albertwidi/go-project-example/internal/entity/image"
+	sessionentity "github.com/albertwidi/go-project-example/internal/entity/session"
+	requestctx "github.com/albertwidi/go-project-example/internal/pkg/context"
+	"github.com/albertwidi/go-project-example/internal/pkg/http/response"
+	"github.com/albertwidi/go-project-example/internal/pkg/router"
+	"github.com/albertwidi/go-project-example/internal/xerrors"
+)
+
+func (s *Server) registerHandlers(r *router.Router) {
+	downloadPath := strings.TrimRight(s.options.DownloadPath, "/")
+	// the image path is in image_path query, or in the url path after the download path
+	for _, path := range []string{downloadPath, downloadPath + "/{image_path:.+}"} {
+		r.Get(path, s.serveImage)
+		r.Head(path, s.serveImage)
+	}
+}
+
+// serveImage stream the image from object storage
+// range request, conditional request and HEAD request are handled by http.ServeContent
+func (s *Server) serveImage(rctx *requestctx.RequestContext) error {
+	req := rctx.Request()
+	imagePath := req.URL.Query().Get("image_path")
+	if imagePath == "" {
+		imagePath = s.router.Vars(req)["image_path"]
+	}
+	if imagePath == "" {
+		err := xerrors.New(errors.New("imageproxy: image path cannot be empty"), xerrors.KindBadRequest)
+		return writeError(rctx, err, false)
+	}
+
+	subject, err := s.options.Subject(rctx.Context(), sessionentity.FromContext(rctx.Context()))
+	if err != nil {
+		return writeError(rctx, err, false)
+	}
+	obj, err := s.images.Stat(rctx.Context(), imagePath, subject)
+	if err != nil {
+		return writeError(rctx, err, subject.UserHash != "")
+	}
+
+	header := rctx.ResponseWriter().Header()
+	if obj.ContentType != "" {
+		header.Set("Content-Type", obj.ContentType)
+	}
+	// the checksum is the md5 of the image, so it is used as strong etag
+	if obj.Checksum != "" {
+		header.Set("ETag", `"`+obj.Checksum+`"`)
+	}
+	header.Set("Cache-Control", s.cacheControl(obj.Temporary))
+	header.Set("X-Content-Type-Options", "nosniff")
+
+	reader := &objectReader{
+		size: obj.Size,
+		open: func(offset int64) (io.ReadCloser, error) {
+			return s.images.ReadRange(rctx.Context(), obj, offset, -1)
+		},
+	}
+	defer reader.Close()
+	http.ServeContent(rctx.ResponseWriter(), req, "", obj.ModTime, reader)
+	return nil
+}
+
+// cacheControl return the cache control of the image
+// the image is private, so only the browser is allowed to cache the image
+func (s *Server) cacheControl(temporary bool) string {
+	// the temporary path expires, so the image is always revalidated
+	if temporary || s.options.MaxAge < 0 {
+		return "private, no-cache"
+	}
+	return fmt.Sprintf("private, max-age=%d", int64(s.options.MaxAge.Seconds()))
+}
+
+// writeError write the error as json response
+// forbidden is returned instead of unauthorized when the user is authenticated but not permitted to access the image
+func writeError(rctx *requestctx.RequestContext, err error, authenticated bool) error {
+	xerr := xerrors.XUnwrap(err)
+	if xerr == nil {
+		xerr = xerrors.XUnwrap(xerrors.New(err, xerrors.KindInternalError))
+	}
+
+	resp := rctx.JSON()
+	resp.SetHeader("Content-Type", "application/json")
+	if authenticated && errors.Is(err, imageentity.ErrPermissionDenied) {
+		resp.WriteHeader(http.StatusForbidden)
+	}
+
+	message := http.StatusText(http.StatusInternalServerError)
+	if xerr.Kind() != xerrors.KindInternalError {
+		message = err.Error()
+	}
+	_, writeErr := resp.Error(xerr, &response.JSONError{Title: "image", Message: message}).Write()
+	return writeErr
+}
@@ -0,0 +1,65 @@
+package imageproxy
+
+import (
+	"errors"
+	"io"
+)
+
+// objectReader is a reader of image that only open the reader from object storage when read
+// so http.ServeContent is able to seek to the requested range without downloading the whole image
+type objectReader struct {
+	open   func(offset int64) (io.ReadCloser, error)
+	size   int64
+	offset int64
+	reader io.ReadCloser
+}
+
+func (r *objectReader) Read(b []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.reader == nil {
+		reader, err := r.open(r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.reader = reader
+	}
+
+	n, err := r.reader.Read(b)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *objectReader) Seek(offset int64, whence int) (int64, error) {
+	var position int64
+	switch whence {
+	case io.SeekStart:
+		position = offset
+	case io.SeekCurrent:
+		position = r.offset + offset
+	case io.SeekEnd:
+		position = r.size + offset
+	default:
+		return 0, errors.New("imageproxy: invalid whence")
+	}
+	if position < 0 {
+		return 0, errors.New("imageproxy: negative position")
+	}
+
+	// the reader is opened again from the new position on the next read
+	if position != r.offset && r.reader != nil {
+		r.reader.Close()
+		r.reader = nil
+	}
+	r.offset = position
+	return position, nil
+}
+
+// Close the reader of object storage
+func (r *objectReader) Close() error {
+	if r.reader == nil {
+		return nil
+	}
+	return r.reader.Close()
+}
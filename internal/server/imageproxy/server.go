@@ -0,0 +1,108 @@
+// Package imageproxy serve the private image from object storage
+// the image is streamed from object storage, and the access of the image is checked using the session of the request
+
+package imageproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	imageentity "github.com/albertwidi/go-project-example/internal/entity/image"
+	sessionentity "github.com/albertwidi/go-project-example/internal/entity/session"
+	userentity "github.com/albertwidi/go-project-example/internal/entity/user"
+	"github.com/albertwidi/go-project-example/internal/pkg/router"
+	imageusecase "github.com/albertwidi/go-project-example/internal/usecase/image"
+)
+
+// DefaultMaxAge of image in the browser cache
+const DefaultMaxAge = time.Hour
+
+// SubjectFunc return the subject of image access from the session
+// the session is nil if the request has no session
+type SubjectFunc func(ctx context.Context, sess *sessionentity.Session) (imageentity.Subject, error)
+
+// Options of image proxy server
+type Options struct {
+	// DownloadPath is the path of private image download, must be the same with the private download path of objstoragepath
+	DownloadPath string
+	// MaxAge of image in the browser cache, the image is always revalidated if negative
+	MaxAge time.Duration
+	// Subject to resolve the subject from session, only the user hash of authenticated session is used by default
+	Subject SubjectFunc
+	// Middlewares run before serving the image, the session of the request must be set by one of the middlewares
+	Middlewares []router.MiddlewareFunc
+}
+
+type imageUsecase interface {
+	Stat(ctx context.Context, imagePath string, subject imageentity.Subject) (*imageusecase.Object, error)
+	ReadRange(ctx context.Context, obj *imageusecase.Object, offset, length int64) (io.ReadCloser, error)
+}
+
+// Server of image proxy
+type Server struct {
+	address    string
+	httpServer *http.Server
+	listener   net.Listener
+	router     *router.Router
+	images     imageUsecase
+	options    Options
+}
+
+// New image proxy server
+func New(address string, images imageUsecase, opts *Options) (*Server, error) {
+	if opts == nil || opts.DownloadPath == "" {
+		return nil, errors.New("imageproxy: download path cannot be empty")
+	}
+	options := *opts
+	if options.MaxAge == 0 {
+		options.MaxAge = DefaultMaxAge
+	}
+	if options.Subject == nil {
+		options.Subject = sessionSubject
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := Server{
+		address:    address,
+		listener:   listener,
+		httpServer: &http.Server{},
+		images:     images,
+		options:    options,
+	}
+	return &s, nil
+}
+
+// Run image proxy server
+func (s *Server) Run(middlewares ...router.MiddlewareFunc) error {
+	s.httpServer.Handler = s.newRouter(middlewares...)
+	return s.httpServer.Serve(s.listener)
+}
+
+func (s *Server) newRouter(middlewares ...router.MiddlewareFunc) *router.Router {
+	s.router = router.New(s.address, nil)
+	s.router.Use(s.options.Middlewares...)
+	s.router.Use(middlewares...)
+	s.registerHandlers(s.router)
+	return s.router
+}
+
+// Shutdown image proxy server
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
+
+// sessionSubject is the default subject of the session
+func sessionSubject(ctx context.Context, sess *sessionentity.Session) (imageentity.Subject, error) {
+	if sess == nil || !sess.Authenticated {
+		return imageentity.Subject{}, nil
+	}
+	return imageentity.Subject{UserHash: userentity.Hash(sess.HashID)}, nil
+}
@@ -0,0 +1,245 @@
+package imageproxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	imageentity "github.com/albertwidi/go-project-example/internal/entity/image"
+	sessionentity "github.com/albertwidi/go-project-example/internal/entity/session"
+	"github.com/albertwidi/go-project-example/internal/objstoragepath"
+	requestctx "github.com/albertwidi/go-project-example/internal/pkg/context"
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage"
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage/local"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis/lock"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis/memory"
+	"github.com/albertwidi/go-project-example/internal/pkg/router"
+	imagerepo "github.com/albertwidi/go-project-example/internal/repository/image"
+	imageusecase "github.com/albertwidi/go-project-example/internal/usecase/image"
+)
+
+func TestServeImage(t *testing.T) {
+	t.Parallel()
+
+	bucket, err := local.New(context.Background(), "./testServeImage/", &local.Options{DeleteOnClose: true})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	storage := objectstorage.New(bucket)
+	defer os.RemoveAll("./testServeImage")
+	defer storage.Close()
+
+	objPath, err := objstoragepath.New(&objstoragepath.Config{
+		Private: objstoragepath.DownloadConfig{
+			DownloadProto: "http://",
+			DownloadHost:  "localhost",
+			DownloadPort:  ":9000",
+			DownloadPath:  "/image",
+		},
+	}, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	m := memory.New(nil)
+	lock.RegisterMemoryScripts(m)
+	locker, err := lock.New([]redis.Redis{m}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	usecase, err := imageusecase.New(storage, imagerepo.New(memory.New(nil)), objPath, locker, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 16; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 16), G: uint8(y * 16), B: 100, A: 255})
+		}
+	}
+	buff := bytes.Buffer{}
+	if err := jpeg.Encode(&buff, img, nil); err != nil {
+		t.Error(err)
+		return
+	}
+	uploaded, err := usecase.Upload(context.Background(), &buff, imageentity.FileInfo{
+		FileName: "room.jpg",
+		UserHash: "eUjks",
+		Mode:     imageentity.ModePrivate,
+		Group:    imageentity.GroupPropertyRoom,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	content, err := usecase.Download(context.Background(), uploaded.FilePath, imageentity.Subject{UserHash: "eUjks"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	checksum := md5.Sum(content)
+	etag := `"` + hex.EncodeToString(checksum[:]) + `"`
+
+	temporaryPath, err := usecase.GenerateTemporaryPath(context.Background(), uploaded.FilePath, time.Minute)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// the session is set by the session middleware
+	sessionMiddleware := func(next router.HandlerFunc) router.HandlerFunc {
+		return func(rctx *requestctx.RequestContext) error {
+			if userHash := rctx.RequestHeader().Get("X-User-Hash"); userHash != "" {
+				sess := sessionentity.Session{HashID: userHash, Authenticated: true}
+				rctx = rctx.WithContext(sessionentity.WithSession(rctx.Context(), &sess))
+			}
+			return next(rctx)
+		}
+	}
+	s, err := New("127.0.0.1:0", usecase, &Options{DownloadPath: "/image", Middlewares: []router.MiddlewareFunc{sessionMiddleware}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer s.listener.Close()
+	handler := s.newRouter()
+
+	cases := []struct {
+		name         string
+		method       string
+		path         string
+		header       map[string]string
+		expectStatus int
+		expectBody   []byte
+		expectCache  string
+	}{
+		{
+			name:         "owner",
+			method:       http.MethodGet,
+			path:         "/image/" + uploaded.FilePath,
+			header:       map[string]string{"X-User-Hash": "eUjks"},
+			expectStatus: http.StatusOK,
+			expectBody:   content,
+			expectCache:  "private, max-age=3600",
+		},
+		{
+			name:         "owner query",
+			method:       http.MethodGet,
+			path:         "/image?image_path=" + url.QueryEscape(uploaded.FilePath),
+			header:       map[string]string{"X-User-Hash": "eUjks"},
+			expectStatus: http.StatusOK,
+			expectBody:   content,
+			expectCache:  "private, max-age=3600",
+		},
+		{
+			name:         "head",
+			method:       http.MethodHead,
+			path:         "/image/" + uploaded.FilePath,
+			header:       map[string]string{"X-User-Hash": "eUjks"},
+			expectStatus: http.StatusOK,
+			expectBody:   []byte{},
+		},
+		{
+			name:         "not modified",
+			method:       http.MethodGet,
+			path:         "/image/" + uploaded.FilePath,
+			header:       map[string]string{"X-User-Hash": "eUjks", "If-None-Match": etag},
+			expectStatus: http.StatusNotModified,
+			expectBody:   []byte{},
+		},
+		{
+			name:         "range",
+			method:       http.MethodGet,
+			path:         "/image/" + uploaded.FilePath,
+			header:       map[string]string{"X-User-Hash": "eUjks", "Range": "bytes=10-29"},
+			expectStatus: http.StatusPartialContent,
+			expectBody:   content[10:30],
+		},
+		{
+			name:         "temporary",
+			method:       http.MethodGet,
+			path:         "/image?image_path=" + url.QueryEscape(temporaryPath),
+			expectStatus: http.StatusOK,
+			expectBody:   content,
+			expectCache:  "private, no-cache",
+		},
+		{
+			name:         "other user",
+			method:       http.MethodGet,
+			path:         "/image/" + uploaded.FilePath,
+			header:       map[string]string{"X-User-Hash": "qRstu"},
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			name:         "anonymous",
+			method:       http.MethodGet,
+			path:         "/image/" + uploaded.FilePath,
+			expectStatus: http.StatusUnauthorized,
+		},
+		{
+			name:         "not found",
+			method:       http.MethodGet,
+			path:         "/image/property/room/notfound.jpg",
+			header:       map[string]string{"X-User-Hash": "eUjks"},
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			name:         "temporary not found",
+			method:       http.MethodGet,
+			path:         "/image?image_path=" + url.QueryEscape("temporary:/image/notfound"),
+			expectStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		for k, v := range c.header {
+			req.Header.Set(k, v)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		resp := recorder.Result()
+		if resp.StatusCode != c.expectStatus {
+			t.Errorf("%s: expecting status %d but got %d", c.name, c.expectStatus, resp.StatusCode)
+			return
+		}
+		if c.expectBody == nil {
+			continue
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !bytes.Equal(body, c.expectBody) {
+			t.Errorf("%s: body is different, expecting %d bytes but got %d bytes", c.name, len(c.expectBody), len(body))
+			return
+		}
+		if etagHeader := resp.Header.Get("ETag"); etagHeader != etag {
+			t.Errorf("%s: expecting etag %s but got %s", c.name, etag, etagHeader)
+			return
+		}
+		if c.expectCache != "" && resp.Header.Get("Cache-Control") != c.expectCache {
+			t.Errorf("%s: expecting cache control %s but got %s", c.name, c.expectCache, resp.Header.Get("Cache-Control"))
+			return
+		}
+	}
+}
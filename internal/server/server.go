@@ -18,10 +18,18 @@ type Runner interface {
 	Shutdown(ctx context.Context) error
 }
 
+// Stopper is a background process that is stopped after all servers are shutdown, for example message consumer
+// so the process is able to finish its work while no new request is coming
+type Stopper interface {
+	Shutdown(ctx context.Context) error
+}
+
 // Server configuration
 type Server struct {
-	runners []Runner
-	errChan chan error
+	runners  []Runner
+	stoppers []Stopper
+	admin    *adminServer
+	errChan  chan error
 
 	// prometheus vector object for metrics
 	countervec      *prometheus.CounterVec
@@ -42,15 +50,33 @@ func (s *Server) Run() chan error {
 }
 
 // Shutdown the server
-// TODO: check whether one of the runners return error when shutting down
+// the runners are shutdown first, then the stoppers are stopped within the same deadline.
+// The first error is returned, but all runners and stoppers are still shutdown.
 func (s *Server) Shutdown(ctx context.Context) error {
 	// send nil error to get the server out of the loop
-	s.errChan <- nil
+	select {
+	case s.errChan <- nil:
+	default:
+	}
 
+	var err error
 	for _, r := range s.runners {
-		r.Shutdown(ctx)
+		if e := r.Shutdown(ctx); e != nil && err == nil {
+			err = e
+		}
+	}
+	for _, st := range s.stoppers {
+		if e := st.Shutdown(ctx); e != nil && err == nil {
+			err = e
+		}
 	}
-	return nil
+	return err
+}
+
+// AddStopper add background process to be stopped when the server shutdown
+// this function must be called before Shutdown
+func (s *Server) AddStopper(stoppers ...Stopper) {
+	s.stoppers = append(s.stoppers, stoppers...)
 }
 
 // New server
@@ -104,10 +130,23 @@ func New(adminServerAddress string, runners ...Runner) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+	s.admin = adm
 	s.runners = append(s.runners, adm)
 	return &s, nil
 }
 
+// SetHealthChecker set the health checker used by admin server
+// to serve /healthz and /readyz, this function must be called before Run
+func (s *Server) SetHealthChecker(checker HealthChecker) {
+	s.admin.healthChecker = checker
+}
+
+// SetReloader set the reloader used by admin server
+// to serve /reload, this function must be called before Run
+func (s *Server) SetReloader(reloader Reloader) {
+	s.admin.reloader = reloader
+}
+
 // Metrics is a middleware for metrics monitoring
 func (s *Server) Metrics(next router.HandlerFunc) router.HandlerFunc {
 	return func(rctx *requestctx.RequestContext) error {
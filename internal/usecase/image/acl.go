@@ -0,0 +1,231 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	imageentity "github.com/albertwidi/go-project-example/internal/entity/image"
+	"github.com/albertwidi/go-project-example/internal/xerrors"
+	"gocloud.dev/blob"
+)
+
+// acl return the access control list and the attributes of the image
+func (u *Usecase) acl(ctx context.Context, key string) (*imageentity.ACL, *blob.Attributes, error) {
+	attrs, err := u.privateStorage.Attributes(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if encoded, ok := attrs.Metadata[metadataACL]; ok {
+		acl, err := imageentity.DecodeACL(encoded)
+		if err != nil {
+			return nil, nil, xerrors.New(err, xerrors.KindInternalError)
+		}
+		return acl, attrs, nil
+	}
+
+	// image that uploaded before the access control list exists
+	acl, err := imageentity.ACLFromAccess(imageentity.Access(attrs.Metadata["access_owner"]), imageentity.Access(attrs.Metadata["access_admin"]))
+	if err != nil {
+		return nil, nil, xerrors.New(err, xerrors.KindInternalError)
+	}
+	return acl, attrs, nil
+}
+
+// referencePermissions is the permissions of user uploading the same content as the owner
+// the reference can only read the image and remove its own reference, see Delete.
+var referencePermissions = []imageentity.Permission{imageentity.PermissionRead, imageentity.PermissionDelete}
+
+// permissions return the permissions of the subject to the image
+// the same image is shared by all users uploading the same content, the references have the reference permissions
+// in addition to the permissions granted to them.
+func (u *Usecase) permissions(ctx context.Context, key string, subject imageentity.Subject) (*imageentity.ACL, *blob.Attributes, []imageentity.Permission, error) {
+	acl, attrs, err := u.acl(ctx, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if subject.UserHash != "" && subject.UserHash != acl.Owner {
+		isReference, err := u.imageRepo.HasReference(ctx, key, string(subject.UserHash))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if isReference {
+			permissions := append([]imageentity.Permission{}, referencePermissions...)
+			for _, p := range acl.Permissions(subject, time.Now()) {
+				if !hasPermission(permissions, p) {
+					permissions = append(permissions, p)
+				}
+			}
+			return acl, attrs, permissions, nil
+		}
+	}
+	return acl, attrs, acl.Permissions(subject, time.Now()), nil
+}
+
+// authorize check whether the subject has the permission to the image
+// the access control list of the original image is used for its variants
+func (u *Usecase) authorize(ctx context.Context, filePath string, subject imageentity.Subject, permission imageentity.Permission) (*imageentity.ACL, *blob.Attributes, error) {
+	acl, attrs, permissions, err := u.permissions(ctx, originalKey(filePath), subject)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !hasPermission(permissions, permission) {
+		return nil, nil, xerrors.New(fmt.Errorf("%w, %s is required", imageentity.ErrPermissionDenied, permission), xerrors.KindUnauthorized)
+	}
+	return acl, attrs, nil
+}
+
+func hasPermission(permissions []imageentity.Permission, permission imageentity.Permission) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Share the private image with the principal, the grant expires after expiry and never expires if expiry is zero
+// the subject can only grant the permissions it has, and the existing grant of the principal is replaced.
+// Only the owner can share without expiry, the grant shared by others expires at the latest when the permissions of the sharer expire.
+func (u *Usecase) Share(ctx context.Context, filePath string, subject imageentity.Subject, principal imageentity.Principal, permissions []imageentity.Permission, expiry time.Duration) error {
+	if expiry < 0 {
+		return fmt.Errorf("image: expiry cannot be negative, got %s", expiry)
+	}
+	for _, p := range subject.Principals() {
+		if p == principal {
+			return xerrors.New(imageentity.ErrShareToSelf, xerrors.KindBadRequest)
+		}
+	}
+	key := originalKey(filePath)
+
+	return u.withLock(ctx, key, func() error {
+		acl, attrs, granted, err := u.permissions(ctx, key, subject)
+		if err != nil {
+			return err
+		}
+		if !hasPermission(granted, imageentity.PermissionShare) {
+			return xerrors.New(fmt.Errorf("%w, %s is required", imageentity.ErrPermissionDenied, imageentity.PermissionShare), xerrors.KindUnauthorized)
+		}
+		for _, p := range permissions {
+			if !hasPermission(granted, p) {
+				return xerrors.New(fmt.Errorf("%w, cannot share %s permission", imageentity.ErrPermissionDenied, p), xerrors.KindUnauthorized)
+			}
+		}
+
+		isOwner := subject.UserHash != "" && subject.UserHash == acl.Owner
+		if !isOwner && expiry == 0 {
+			return xerrors.New(fmt.Errorf("%w, only owner can share without expiry", imageentity.ErrPermissionDenied), xerrors.KindUnauthorized)
+		}
+
+		now := time.Now()
+		grant := imageentity.Grant{Principal: principal, Permissions: permissions, IssuedBy: subject.UserHash}
+		if expiry > 0 {
+			expiresAt := now.Add(expiry)
+			// the principal cannot keep the permissions longer than the sharer
+			limit := acl.Expiry(subject, append([]imageentity.Permission{imageentity.PermissionShare}, permissions...), now)
+			if limit != nil && limit.Before(expiresAt) {
+				expiresAt = *limit
+			}
+			grant.ExpiresAt = &expiresAt
+		}
+		if err := acl.Grant(grant, now); err != nil {
+			return xerrors.New(err, xerrors.KindBadRequest)
+		}
+		return u.updateACL(ctx, key, attrs, acl)
+	})
+}
+
+// Revoke the permissions of the principal to the private image
+// the owner can revoke all grants of the principal, while other users can only revoke the grants they issued.
+func (u *Usecase) Revoke(ctx context.Context, filePath string, subject imageentity.Subject, principal imageentity.Principal) error {
+	if subject.UserHash == "" {
+		return xerrors.New(fmt.Errorf("%w, only owner or issuer can revoke the grant", imageentity.ErrPermissionDenied), xerrors.KindUnauthorized)
+	}
+	key := originalKey(filePath)
+
+	return u.withLock(ctx, key, func() error {
+		acl, attrs, err := u.acl(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		if subject.UserHash == acl.Owner {
+			if !acl.Revoke(principal) {
+				return nil
+			}
+		} else if !acl.RevokeIssued(principal, subject.UserHash) {
+			return xerrors.New(fmt.Errorf("%w, only owner or issuer can revoke the grant", imageentity.ErrPermissionDenied), xerrors.KindUnauthorized)
+		}
+		return u.updateACL(ctx, key, attrs, acl)
+	})
+}
+
+// addGrants add the grants of the user uploading the same content as the existing image
+// the grants are issued by the user, and only allow the principal to read the image as the user is only a reference of the image.
+func (u *Usecase) addGrants(ctx context.Context, key string, info imageentity.FileInfo) error {
+	if len(info.Grants) == 0 {
+		return nil
+	}
+	acl, attrs, err := u.acl(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, grant := range info.Grants {
+		grant.IssuedBy = info.UserHash
+		if info.UserHash != acl.Owner {
+			if !hasPermission(grant.Permissions, imageentity.PermissionRead) {
+				continue
+			}
+			grant.Permissions = []imageentity.Permission{imageentity.PermissionRead}
+		}
+		if err := acl.Grant(grant, now); err != nil {
+			return err
+		}
+	}
+	return u.updateACL(ctx, key, attrs, acl)
+}
+
+// UpdateTags replace the tags of the private image
+func (u *Usecase) UpdateTags(ctx context.Context, filePath string, subject imageentity.Subject, tags string) error {
+	if len(strings.Split(tags, ",")) > 5 {
+		return imageentity.ErrTooManyTags
+	}
+	key := originalKey(filePath)
+
+	return u.withLock(ctx, key, func() error {
+		_, attrs, err := u.authorize(ctx, key, subject, imageentity.PermissionWrite)
+		if err != nil {
+			return err
+		}
+		metadata := copyMetadata(attrs.Metadata)
+		metadata["tags"] = tags
+		return u.privateStorage.UpdateMetadata(ctx, key, metadata)
+	})
+}
+
+// updateACL store the access control list to the metadata of the image
+func (u *Usecase) updateACL(ctx context.Context, key string, attrs *blob.Attributes, acl *imageentity.ACL) error {
+	encoded, err := acl.Encode()
+	if err != nil {
+		return err
+	}
+	metadata := copyMetadata(attrs.Metadata)
+	metadata[metadataACL] = encoded
+	// the legacy access is replaced by the access control list
+	delete(metadata, "access_owner")
+	delete(metadata, "access_admin")
+	return u.privateStorage.UpdateMetadata(ctx, key, metadata)
+}
+
+func copyMetadata(metadata map[string]string) map[string]string {
+	md := make(map[string]string, len(metadata)+1)
+	for k, v := range metadata {
+		md[k] = v
+	}
+	return md
+}
@@ -0,0 +1,155 @@
+package image
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	imageentity "github.com/albertwidi/go-project-example/internal/entity/image"
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage"
+)
+
+// list of content metadata
+const (
+	metadataACL    = "acl"
+	metadataSHA256 = "content_sha256"
+	metadataMD5    = "content_md5"
+)
+
+// referenceLockTTL is the maximum time to hold the lock of image references
+const referenceLockTTL = time.Second * 30
+
+// content of image that is spooled to local file
+type content struct {
+	file   *os.File
+	md5    []byte
+	sha256 string
+}
+
+// spool write the image to temporary file while calculating its checksum
+// the hash is needed before uploading to find the existing image with the same content,
+// and the image is not kept in memory
+func spool(reader io.Reader) (*content, error) {
+	f, err := ioutil.TempFile("", "image-*")
+	if err != nil {
+		return nil, err
+	}
+
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, md5Hash, sha256Hash), reader); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	c := content{
+		file:   f,
+		md5:    md5Hash.Sum(nil),
+		sha256: hex.EncodeToString(sha256Hash.Sum(nil)),
+	}
+	return &c, nil
+}
+
+// Close and remove the temporary file
+func (c *content) Close() error {
+	c.file.Close()
+	return os.Remove(c.file.Name())
+}
+
+// contentKey return the canonical path of image, the path is {group}/{sha256}
+func contentKey(group imageentity.Group, hash string) string {
+	return path.Join(string(group), hash)
+}
+
+// store the image by its content hash and add the user as the reference of the image
+// the image and its variants are only uploaded if the same content does not exist in the group
+func (u *Usecase) store(ctx context.Context, reader io.Reader, group imageentity.Group, info imageentity.FileInfo) (string, map[imageentity.Variant]string, error) {
+	br := bufio.NewReaderSize(reader, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return "", nil, err
+	}
+	format, err := detectFormat(head, info.Header)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var source io.ReadCloser = ioutil.NopCloser(br)
+	if stripMetadataGroups[group] {
+		source = stripMetadata(br, format)
+	}
+	defer source.Close()
+
+	c, err := spool(source)
+	if err != nil {
+		return "", nil, err
+	}
+	defer c.Close()
+
+	key := contentKey(group, c.sha256)
+	variants := make(map[imageentity.Variant]string, len(u.variants))
+	for variant := range u.variants {
+		variants[variant] = variantKey(key, variant)
+	}
+
+	err = u.withLock(ctx, key, func() error {
+		exists, err := u.addReference(ctx, key, string(info.UserHash))
+		if err != nil {
+			return err
+		}
+		if exists {
+			return u.addGrants(ctx, key, info)
+		}
+		// the original image is uploaded last, so the variants always exist when the original image exists
+		err = u.uploadVariants(ctx, c, key, format, info)
+		if err == nil {
+			var writeOptions *objectstorage.WriteOptions
+			writeOptions, err = privateWriteOptions(info, c)
+			if err == nil {
+				writeOptions.ContentType = format.ContentType()
+				_, err = u.privateStorage.Upload(ctx, c.file, key, writeOptions)
+			}
+		}
+		if err != nil {
+			// remove the reference, so the image is uploaded again on the next upload
+			u.imageRepo.RemoveReference(ctx, key, string(info.UserHash))
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return key, variants, nil
+}
+
+// addReference add the owner as reference of the image and return whether the image already exists
+func (u *Usecase) addReference(ctx context.Context, key, owner string) (bool, error) {
+	if _, err := u.imageRepo.AddReference(ctx, key, owner); err != nil {
+		return false, err
+	}
+	return u.privateStorage.Exists(ctx, key)
+}
+
+// withLock run fn while holding the lock of the image
+func (u *Usecase) withLock(ctx context.Context, key string, fn func() error) error {
+	lease, err := u.locker.Obtain(ctx, "image:"+key, referenceLockTTL)
+	if err != nil {
+		return err
+	}
+	defer lease.Release(ctx)
+	return fn()
+}
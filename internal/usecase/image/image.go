@@ -3,9 +3,10 @@ package image
 //go:generate mockgen -source=image.go -destination=mock/image_mock.go -package=image
 
 import (
+	"bufio"
 	"context"
+	"crypto/md5"
 	"crypto/sha1"
-	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -18,6 +19,7 @@ import (
 	userentity "github.com/albertwidi/go-project-example/internal/entity/user"
 	"github.com/albertwidi/go-project-example/internal/objstoragepath"
 	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis/lock"
 	"github.com/albertwidi/go-project-example/internal/xerrors"
 	guuid "github.com/google/uuid"
 )
@@ -28,18 +30,64 @@ type Usecase struct {
 	privateStorage *objectstorage.Storage
 	imageRepo      imageRepository
 	objPath        *objstoragepath.ObjectStoragePath
+	// locker to make sure the references of the same content is not changed concurrently
+	locker locker
+	// variants of private image that generated on upload
+	variants map[imageentity.Variant]imageentity.Manipulation
+}
+
+// Options of image usecase
+type Options struct {
+	// Variants of private image, DefaultVariants is used if nil
+	// use empty map to disable the variants
+	Variants map[imageentity.Variant]imageentity.Manipulation
 }
 
 type imageRepository interface {
 	SaveTempPath(ctx context.Context, id, originalPath string, expiryTime time.Duration) error
 	GetTempPath(ctx context.Context, id string) (string, error)
+	AddReference(ctx context.Context, filePath, owner string) (int, error)
+	RemoveReference(ctx context.Context, filePath, owner string) (int, error)
+	HasReference(ctx context.Context, filePath, owner string) (bool, error)
+	DeleteReferences(ctx context.Context, filePath string) error
 }
 
-// New image usecase
-func New(privateStorage *objectstorage.Storage, imageRepo imageRepository, objStoragePath *objstoragepath.ObjectStoragePath) (*Usecase, error) {
+type locker interface {
+	Obtain(ctx context.Context, key string, ttl time.Duration) (*lock.Lease, error)
+}
+
+// ErrNilLocker returned when the usecase is created without locker
+var ErrNilLocker = errors.New("image: locker cannot be nil")
+
+// New image usecase, options are optional
+// the locker is required, because the references of the same content can be changed by concurrent requests
+func New(privateStorage *objectstorage.Storage, imageRepo imageRepository, objStoragePath *objstoragepath.ObjectStoragePath, locker locker, opts *Options) (*Usecase, error) {
+	if locker == nil {
+		return nil, ErrNilLocker
+	}
+
+	variants := DefaultVariants
+	if opts != nil && opts.Variants != nil {
+		variants = opts.Variants
+	}
+	for variant, manipulation := range variants {
+		if variant == imageentity.VariantOriginal {
+			return nil, fmt.Errorf("image: variant cannot be %s", variant)
+		}
+		if manipulation.Format == "" {
+			continue
+		}
+		if err := manipulation.Format.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
 	u := Usecase{
 		privateStorage: privateStorage,
 		imageRepo:      imageRepo,
+		objPath:        objStoragePath,
+		locker:         locker,
+		variants:       variants,
 	}
 	return &u, nil
 }
@@ -65,6 +113,8 @@ type Image struct {
 	FilePath     string
 	DownloadPath string
 	DownloadLink string
+	// Variants of the image, only exists for private image
+	Variants map[imageentity.Variant]Image
 }
 
 // Upload image
@@ -78,14 +128,11 @@ func (u *Usecase) Upload(ctx context.Context, reader io.Reader, info imageentity
 	}
 
 	var (
-		filePath string
-		err      error
-		// file naming
-		rename   bool
-		fileName string
+		filePath     string
+		variantPaths map[imageentity.Variant]string
+		err          error
 	)
 
-	fileName = info.FileName
 	group := info.Group
 	if group == imageentity.GroupEmpty {
 		group = imageentity.GroupMixed
@@ -95,42 +142,47 @@ func (u *Usecase) Upload(ctx context.Context, reader io.Reader, info imageentity
 		return image, err
 	}
 
-	// sometimes image needs rename to avoid naming collission in the bucket
-	// TODO: it might be better to append the image name with timestamp on the server or special_id
-	if rename {
-		fileName = path.Join(info.FileName, time.Now().String())
-		fileName = base64.RawStdEncoding.EncodeToString([]byte(fileName))
-	}
-
 	if info.Mode == imageentity.ModePrivate {
-		key := path.Join(string(group), info.FileName)
-		writeOptions := &objectstorage.WriteOptions{
-			Metadata: map[string]string{
-				"access_owner": string(imageentity.CreateAccess([]string{string(info.UserHash)}, []string{"read"})),
-				"access_admin": string(imageentity.CreateAccess([]string{"all"}, []string{"read", "write"})),
-				"tags":         info.Tags,
-			},
+		// the image is stored by its content hash, so the same image is only stored once
+		// and images with the same file name never overwrite each other
+		filePath, variantPaths, err = u.store(ctx, reader, group, info)
+		if err != nil {
+			return image, err
 		}
+	}
 
-		filePath, err = u.privateStorage.Upload(ctx, reader, key, writeOptions)
+	image, err = u.generateImage(ctx, info, filePath)
+	if err != nil {
+		return image, err
+	}
+	if len(variantPaths) > 0 {
+		image.Variants = make(map[imageentity.Variant]Image, len(variantPaths))
+	}
+	for variant, variantPath := range variantPaths {
+		image.Variants[variant], err = u.generateImage(ctx, info, variantPath)
 		if err != nil {
 			return image, err
 		}
+	}
+	return image, nil
+}
 
-		// always generate temporary image path if user hash is empty
-		if info.UserHash == "" {
-			filePath, err = u.GenerateTemporaryPath(ctx, filePath, time.Minute*30)
-			if err != nil {
-				return image, err
-			}
+// generateImage return the download information of the image
+func (u *Usecase) generateImage(ctx context.Context, info imageentity.FileInfo, filePath string) (Image, error) {
+	var err error
+	// always generate temporary image path if user hash is empty
+	if info.Mode == imageentity.ModePrivate && info.UserHash == "" {
+		filePath, err = u.GenerateTemporaryPath(ctx, filePath, time.Minute*30)
+		if err != nil {
+			return Image{}, err
 		}
 	}
 
 	img, err := u.objPath.Generate(info.Mode, filePath)
 	if err != nil {
-		return image, err
+		return Image{}, err
 	}
-	image = Image{
+	image := Image{
 		Proto:        img.Proto,
 		Host:         img.Host,
 		FilePath:     img.FilePath,
@@ -140,97 +192,307 @@ func (u *Usecase) Upload(ctx context.Context, reader io.Reader, info imageentity
 	return image, nil
 }
 
-// Download image
-// download usecase never use a public storage
-// as public storage being served via CDN and local filesystem in LOCAL
-// to download temporary filepath, use format: temporary:{id}
-func (u *Usecase) Download(ctx context.Context, imagePath string, userHash userentity.Hash, admin bool) ([]byte, error) {
-	var (
-		err error
-	)
-
-	prefix, filepath, err := u.GetImageFilePath(ctx, imagePath)
+// privateWriteOptions return the write options of private image, the access control list of the image is stored in metadata
+func privateWriteOptions(info imageentity.FileInfo, c *content) (*objectstorage.WriteOptions, error) {
+	acl := imageentity.NewACL(info.UserHash)
+	for _, grant := range info.Grants {
+		grant.IssuedBy = info.UserHash
+		if err := acl.Grant(grant, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	encodedACL, err := acl.Encode()
 	if err != nil {
 		return nil, err
 	}
 
-	// if the image path is not temporary, then we need to check the access previledge
-	if prefix != prefixTemporary {
-		attr, err := u.privateStorage.Attributes(ctx, filepath)
+	writeOptions := objectstorage.WriteOptions{
+		ContentMD5: c.md5,
+		Metadata: map[string]string{
+			metadataACL:    encodedACL,
+			"tags":         info.Tags,
+			"uploaded_by":  string(info.UserHash),
+			metadataSHA256: c.sha256,
+			metadataMD5:    hex.EncodeToString(c.md5),
+		},
+	}
+	return &writeOptions, nil
+}
+
+// temporaryPrefix is the prefix of image that is not yet committed to its group
+// the image under this prefix is removed by CollectGarbage when expired
+const temporaryPrefix = "tmp/"
+
+// UploadTemporary upload private image to temporary prefix and return the key of the image
+// the image need to be committed using Commit, otherwise it will be removed by CollectGarbage
+func (u *Usecase) UploadTemporary(ctx context.Context, reader io.Reader, info imageentity.FileInfo) (string, error) {
+	if len(strings.Split(info.Tags, ",")) > 5 {
+		return "", imageentity.ErrTooManyTags
+	}
+
+	// the image is processed when committed, only the content is checked here
+	br := bufio.NewReaderSize(reader, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if _, err := detectFormat(head, info.Header); err != nil {
+		return "", err
+	}
+
+	c, err := spool(br)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+
+	key := path.Join(temporaryPrefix, guuid.New().String(), path.Base(info.FileName))
+	writeOptions, err := privateWriteOptions(info, c)
+	if err != nil {
+		return "", err
+	}
+	if _, err := u.privateStorage.Upload(ctx, c.file, key, writeOptions); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Commit process the temporary image and store it to its group, then return the canonical path of the image
+// the temporary image is removed after committed
+func (u *Usecase) Commit(ctx context.Context, temporaryKey string, group imageentity.Group) (string, error) {
+	if !strings.HasPrefix(temporaryKey, temporaryPrefix) {
+		return "", fmt.Errorf("image: not a temporary image, got %s", temporaryKey)
+	}
+	if err := group.Validate(); err != nil {
+		return "", err
+	}
+
+	attrs, err := u.privateStorage.Attributes(ctx, temporaryKey)
+	if err != nil {
+		return "", err
+	}
+	reader, err := u.privateStorage.Download(ctx, temporaryKey, nil)
+	if err != nil {
+		return "", err
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	// the image is stored the same way as Upload, so the metadata is stripped and the variants are generated
+	info := imageentity.FileInfo{
+		UserHash: userentity.Hash(attrs.Metadata["uploaded_by"]),
+		Mode:     imageentity.ModePrivate,
+		Group:    group,
+		Tags:     attrs.Metadata["tags"],
+	}
+	// keep the grants issued by the uploader of the temporary image
+	if encoded, ok := attrs.Metadata[metadataACL]; ok {
+		acl, err := imageentity.DecodeACL(encoded)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
+		for _, grant := range acl.Grants {
+			if grant.IssuedBy != "" && grant.IssuedBy == info.UserHash {
+				info.Grants = append(info.Grants, grant)
+			}
+		}
+	}
+	key, _, err := u.store(ctx, reader, group, info)
+	if err != nil {
+		return "", err
+	}
+	if err := u.privateStorage.Delete(ctx, temporaryKey); err != nil && !errors.Is(err, objectstorage.ErrObjectNotFound) {
+		return "", err
+	}
+	return key, nil
+}
+
+// Delete the private image
+// the subject that is a reference of the image only remove its reference, and the image is deleted when there is no reference left
+// other subject with delete permission, for example admin, delete the image for all references
+func (u *Usecase) Delete(ctx context.Context, filePath string, subject imageentity.Subject) error {
+	filePath = originalKey(filePath)
 
-		var (
-			access  []string
-			granted bool
-		)
-
-		// choose one, so we don't have to do things twice
-		if admin {
-			accessData := attr.Metadata["access_admin"]
-			access = strings.Split(accessData, ";")
-		} else {
-			accessData := attr.Metadata["access_owner"]
-			access = strings.Split(accessData, ";")
+	return u.withLock(ctx, filePath, func() error {
+		acl, attrs, err := u.authorize(ctx, filePath, subject, imageentity.PermissionDelete)
+		if err != nil {
+			return err
 		}
 
-		for _, acc := range access {
-			detail := strings.Split(acc, ":")
-			if len(detail) < 2 {
-				return nil, xerrors.New(imageentity.ErrInvalidAccessAttribute, xerrors.KindInternalError)
+		isReference := false
+		if subject.UserHash != "" {
+			var err error
+			isReference, err = u.imageRepo.HasReference(ctx, filePath, string(subject.UserHash))
+			if err != nil {
+				return err
 			}
+		}
 
-			switch detail[0] {
-			case "allowed":
-				// allow immediately if admin
-				if admin && detail[1] == "all" {
-					granted = true
-					break
-				}
-
-				if detail[1] == string(userHash) {
-					granted = true
-					break
+		if isReference {
+			references, err := u.imageRepo.RemoveReference(ctx, filePath, string(subject.UserHash))
+			if err != nil {
+				return err
+			}
+			if references > 0 {
+				// the principals cannot access the image through the removed reference
+				if !acl.RevokeIssuer(subject.UserHash) {
+					return nil
 				}
+				return u.updateACL(ctx, filePath, attrs, acl)
+			}
+		} else if err := u.imageRepo.DeleteReferences(ctx, filePath); err != nil {
+			return err
+		}
 
-			case "priviledge":
-				// not yet implemented
-				// priviledge restrict access of read/write or deletion of the object
+		keys := []string{filePath}
+		for variant := range u.variants {
+			keys = append(keys, variantKey(filePath, variant))
+		}
+		for _, key := range keys {
+			if err := u.privateStorage.Delete(ctx, key); err != nil && !errors.Is(err, objectstorage.ErrObjectNotFound) {
+				return err
 			}
+		}
+		return nil
+	})
+}
+
+// CollectGarbage remove the temporary images and resumable uploads that are older than expiry
+// and return the number of removed images and uploads
+func (u *Usecase) CollectGarbage(ctx context.Context, expiry time.Duration) (int, error) {
+	deadline := time.Now().Add(-expiry)
+	deleted := 0
 
-			if granted {
-				break
+	listOptions := &objectstorage.ListOptions{}
+	for {
+		result, err := u.privateStorage.List(ctx, temporaryPrefix, listOptions)
+		if err != nil {
+			return deleted, err
+		}
+
+		for _, obj := range result.Objects {
+			if !obj.ModTime.Before(deadline) {
+				continue
 			}
+			if err := u.privateStorage.Delete(ctx, obj.Key); err != nil && !errors.Is(err, objectstorage.ErrObjectNotFound) {
+				return deleted, err
+			}
+			deleted++
 		}
-		if !granted {
-			return nil, errors.New("image: user is not permitted to view this image/file")
+
+		if result.NextPageToken == "" {
+			break
 		}
+		listOptions.PageToken = result.NextPageToken
 	}
 
-	out, err := u.privateStorage.DownloadByte(ctx, filepath, nil)
-	return out, err
+	aborted, err := u.privateStorage.AbortExpiredUploads(ctx, expiry)
+	return deleted + aborted, err
+}
+
+// Object is the private image to be downloaded
+type Object struct {
+	Key         string
+	ContentType string
+	// Size of the image, the size of encrypted image is the size before encrypted
+	Size    int64
+	ModTime time.Time
+	// Checksum is the md5 of the image in hex, empty if the image is uploaded before the checksum is stored
+	Checksum string
+	// Temporary is true if the image is accessed using temporary path
+	Temporary bool
+}
+
+// Stat return the private image of the image path if the subject is allowed to read the image
+// to stat temporary filepath, use format: temporary:{id}
+func (u *Usecase) Stat(ctx context.Context, imagePath string, subject imageentity.Subject) (*Object, error) {
+	prefix, filepath, err := u.GetImageFilePath(ctx, imagePath)
+	if err != nil {
+		if errors.Is(err, imageentity.ErrTempPathNotFound) {
+			return nil, xerrors.New(err, xerrors.KindNotFound)
+		}
+		return nil, err
+	}
+
+	attr, err := u.privateStorage.Attributes(ctx, filepath)
+	if err != nil {
+		if objectstorage.IsNotFound(err) {
+			return nil, xerrors.New(imageentity.ErrImageNotFound, xerrors.KindNotFound)
+		}
+		return nil, err
+	}
+
+	// the temporary path is generated for the user that is allowed to read the image
+	if prefix != prefixTemporary {
+		if _, _, err := u.authorize(ctx, filepath, subject, imageentity.PermissionRead); err != nil {
+			return nil, err
+		}
+	}
+
+	obj := Object{
+		Key:         filepath,
+		ContentType: attr.ContentType,
+		Size:        objectstorage.ContentSize(attr),
+		ModTime:     attr.ModTime,
+		Checksum:    attr.Metadata[metadataMD5],
+		Temporary:   prefix == prefixTemporary,
+	}
+	return &obj, nil
+}
+
+// ReadRange return the reader of the image from offset with length, the image is read until the end if length is negative
+// the object must be retrieved using Stat, so the permission is already checked
+func (u *Usecase) ReadRange(ctx context.Context, obj *Object, offset, length int64) (io.ReadCloser, error) {
+	return u.privateStorage.DownloadRange(ctx, obj.Key, offset, length)
+}
+
+// Download image
+// download usecase never use a public storage
+// as public storage being served via CDN and local filesystem in LOCAL
+// to download temporary filepath, use format: temporary:{id}
+func (u *Usecase) Download(ctx context.Context, imagePath string, subject imageentity.Subject) ([]byte, error) {
+	obj, err := u.Stat(ctx, imagePath, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := u.privateStorage.DownloadByte(ctx, obj.Key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// image that uploaded before the checksum is stored is not checked
+	if obj.Checksum != "" {
+		sum := md5.Sum(out)
+		if hex.EncodeToString(sum[:]) != obj.Checksum {
+			return nil, xerrors.New(imageentity.ErrChecksumMismatch, xerrors.KindInternalError)
+		}
+	}
+	return out, nil
 }
 
 // GenerateSignedURL for generating temporary path to download image directly from object storage provider
 // this method is different from temporary as we are not serving the download from our server
+// the encrypted image can only be decrypted by our server, so temporary url is used for encrypted image
 func (u *Usecase) GenerateSignedURL(ctx context.Context, filePath string, expiry time.Duration) (string, error) {
-	var (
-		url string
-		err error
-	)
-
 	// use temporary url if the storage is local
 	if u.privateStorage.Name() == objectstorage.StorageLocal {
-		url, err = u.GenerateTemporaryURL(ctx, filePath, expiry)
-	} else {
-		url, err = u.privateStorage.SignedURL(ctx, filePath, expiry)
+		return u.GenerateTemporaryURL(ctx, filePath, expiry)
 	}
 
+	attrs, err := u.privateStorage.Attributes(ctx, filePath)
 	if err != nil {
 		return "", err
 	}
+	if objectstorage.IsEncrypted(attrs) {
+		return u.GenerateTemporaryURL(ctx, filePath, expiry)
+	}
 
+	url, err := u.privateStorage.SignedURL(ctx, filePath, expiry)
+	if err != nil {
+		return "", err
+	}
 	return url, nil
 }
 
@@ -292,7 +554,12 @@ func (u *Usecase) GetImageFilePath(ctx context.Context, imagePath string) (prefi
 	switch s[0] {
 	case prefixTemporary:
 		prefix = prefixTemporary
-		filePath, err = u.filepathFromTemporaryPath(ctx, s[1])
+		// the temporary path is temporary:{download_path}/{id}, see GenerateTemporaryPath
+		id := s[1]
+		if i := strings.LastIndex(id, "/"); i >= 0 {
+			id = id[i+1:]
+		}
+		filePath, err = u.filepathFromTemporaryPath(ctx, id)
 		return
 	case prefixFile:
 		prefix = prefixFile
@@ -1,18 +1,41 @@
 package image_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
 	"io"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	imageentity "github.com/albertwidi/go-project-example/internal/entity/image"
+	userentity "github.com/albertwidi/go-project-example/internal/entity/user"
+	"github.com/albertwidi/go-project-example/internal/objstoragepath"
 	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage"
 	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage/local"
+	"github.com/albertwidi/go-project-example/internal/pkg/objectstorage/localkey"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis/lock"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis/memory"
+	imagerepo "github.com/albertwidi/go-project-example/internal/repository/image"
 	imageusecase "github.com/albertwidi/go-project-example/internal/usecase/image"
 	imagemock "github.com/albertwidi/go-project-example/internal/usecase/image/mock"
 	"github.com/golang/mock/gomock"
 	"github.com/google/go-cmp/cmp"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/fileblob"
 )
 
 func newLocalStorage(bucketName string) (*objectstorage.Storage, error) {
@@ -23,25 +46,76 @@ func newLocalStorage(bucketName string) (*objectstorage.Storage, error) {
 	return objectstorage.New(storage), nil
 }
 
+func newLocker(t *testing.T) *lock.Locker {
+	m := memory.New(nil)
+	lock.RegisterMemoryScripts(m)
+	locker, err := lock.New([]redis.Redis{m}, &lock.Options{RetryCount: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return locker
+}
+
+func newImage(t *testing.T, format imageentity.Format, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+
+	buff := bytes.Buffer{}
+	var err error
+	switch format {
+	case imageentity.FormatJPEG:
+		err = jpeg.Encode(&buff, img, nil)
+	case imageentity.FormatPNG:
+		err = png.Encode(&buff, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buff.Bytes()
+}
+
+func newObjectStoragePath(t *testing.T) *objstoragepath.ObjectStoragePath {
+	objPath, err := objstoragepath.New(&objstoragepath.Config{
+		Private: objstoragepath.DownloadConfig{
+			DownloadProto: "http://",
+			DownloadHost:  "localhost",
+			DownloadPort:  ":9000",
+			DownloadPath:  "/image",
+		},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return objPath
+}
+
 func TestUpload(t *testing.T) {
 	t.Parallel()
 
-	repo := imagemock.NewMockimageRepository(gomock.NewController(t))
-	repo.EXPECT().
-		GetTempPath(context.Background(), "abcd").
-		Return("jkl", nil)
-	repo.EXPECT().
-		GetTempPath(context.Background(), "jkl").
-		Return("", errors.New("fuck you"))
-
-	storage, err := newLocalStorage("./testUpload")
+	storage, err := newLocalStorage("./testUpload/")
 	if err != nil {
 		t.Error(err)
 		return
 	}
+	defer os.RemoveAll("./testUpload")
 	defer storage.Close()
 
-	usecase, err := imageusecase.New(storage, repo, nil)
+	avatar := newImage(t, imageentity.FormatPNG, 4, 4)
+	sum := sha256.Sum256(avatar)
+	filePath := "user/avatar/" + hex.EncodeToString(sum[:])
+
+	repo := imagemock.NewMockimageRepository(gomock.NewController(t))
+	repo.EXPECT().
+		AddReference(context.Background(), filePath, "eUjks").
+		Return(1, nil)
+
+	usecase, err := imageusecase.New(storage, repo, newObjectStoragePath(t), newLocker(t), &imageusecase.Options{
+		Variants: map[imageentity.Variant]imageentity.Manipulation{},
+	})
 	if err != nil {
 		t.Error(err)
 		return
@@ -54,20 +128,59 @@ func TestUpload(t *testing.T) {
 		expectError error
 	}{
 		{
+			reader: bytes.NewReader(avatar),
 			info: imageentity.FileInfo{
 				FileName: "testing.go",
 				Size:     1000,
+				Header:   textproto.MIMEHeader{"Content-Type": []string{"image/png"}},
 				UserHash: "eUjks",
 				Mode:     imageentity.ModePrivate,
 				Group:    imageentity.GroupUserAvatar,
 				Tags:     "asd,jkl,abcd",
 			},
+			expectImage: imageusecase.Image{
+				Proto:        "http://",
+				Host:         "localhost",
+				FilePath:     filePath,
+				DownloadPath: "/image/" + filePath,
+				DownloadLink: "http://localhost:9000/image?image_path=" + url.QueryEscape(filePath),
+			},
+		},
+		{
+			reader: bytes.NewReader(avatar),
+			info: imageentity.FileInfo{
+				FileName: "testing.go",
+				Mode:     imageentity.ModePrivate,
+				Tags:     "a,b,c,d,e,f",
+			},
+			expectError: imageentity.ErrTooManyTags,
+		},
+		{
+			reader: strings.NewReader("avatar"),
+			info: imageentity.FileInfo{
+				FileName: "avatar.png",
+				UserHash: "eUjks",
+				Mode:     imageentity.ModePrivate,
+				Group:    imageentity.GroupUserAvatar,
+			},
+			expectError: imageentity.ErrUnsupportedFormat,
+		},
+		{
+			reader: bytes.NewReader(avatar),
+			info: imageentity.FileInfo{
+				FileName: "avatar.jpg",
+				Header:   textproto.MIMEHeader{"Content-Type": []string{"image/jpeg"}},
+				UserHash: "eUjks",
+				Mode:     imageentity.ModePrivate,
+				Group:    imageentity.GroupUserAvatar,
+			},
+			expectError: imageentity.ErrContentTypeMismatch,
 		},
 	}
 
 	for _, c := range cases {
 		img, err := usecase.Upload(context.Background(), c.reader, c.info)
-		if err != c.expectError {
+		if !errors.Is(err, c.expectError) {
 			t.Errorf("testUpload: expecting error %v but got %v", c.expectError, err)
 			return
 		}
@@ -79,5 +192,971 @@ func TestUpload(t *testing.T) {
 	}
 }
 
+func TestNewWithoutLocker(t *testing.T) {
+	t.Parallel()
+
+	if _, err := imageusecase.New(nil, imagerepo.New(memory.New(nil)), nil, nil, nil); err != imageusecase.ErrNilLocker {
+		t.Errorf("expecting error %v but got %v", imageusecase.ErrNilLocker, err)
+		return
+	}
+}
+
+func TestDeduplication(t *testing.T) {
+	t.Parallel()
+
+	storage, err := newLocalStorage("./testDeduplication/")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll("./testDeduplication")
+	defer storage.Close()
+
+	usecase, err := imageusecase.New(storage, imagerepo.New(memory.New(nil)), newObjectStoragePath(t), newLocker(t), nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ktp := newImage(t, imageentity.FormatJPEG, 8, 8)
+	users := []userentity.Hash{"eUjks", "kLmno"}
+	var (
+		filePath      string
+		thumbnailPath string
+	)
+	for _, user := range users {
+		img, err := usecase.Upload(context.Background(), bytes.NewReader(ktp), imageentity.FileInfo{
+			FileName: "ktp.jpg",
+			UserHash: user,
+			Mode:     imageentity.ModePrivate,
+			Group:    imageentity.GroupUserKTP,
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if filePath != "" && img.FilePath != filePath {
+			t.Errorf("expecting the same file path %s but got %s", filePath, img.FilePath)
+			return
+		}
+		filePath = img.FilePath
+		thumbnailPath = img.Variants[imageentity.VariantThumbnail].FilePath
+	}
+
+	// the second uploader is allowed to download by its reference
+	out, err := usecase.Download(context.Background(), filePath, imageentity.Subject{UserHash: users[1]})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(out, ktp) {
+		t.Error("expecting the same image as uploaded")
+		return
+	}
+	if _, err := usecase.Download(context.Background(), thumbnailPath, imageentity.Subject{UserHash: users[1]}); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := usecase.Download(context.Background(), filePath, imageentity.Subject{UserHash: "qRstu"}); err == nil {
+		t.Error("expecting error for user without reference")
+		return
+	}
+
+	// the references can't be changed while the image is locked by other request
+	locker := newLocker(t)
+	locked, err := imageusecase.New(storage, imagerepo.New(memory.New(nil)), newObjectStoragePath(t), locker, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	lease, err := locker.Obtain(context.Background(), "image:"+filePath, time.Second*10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := locked.Delete(context.Background(), filePath, imageentity.Subject{UserHash: users[0]}); !errors.Is(err, lock.ErrNotObtained) {
+		t.Errorf("expecting error %v but got %v", lock.ErrNotObtained, err)
+		return
+	}
+	lease.Release(context.Background())
+
+	cases := []struct {
+		user   userentity.Hash
+		exists bool
+	}{
+		{user: users[0], exists: true},
+		{user: users[1], exists: false},
+	}
+	for _, c := range cases {
+		if err := usecase.Delete(context.Background(), filePath, imageentity.Subject{UserHash: c.user}); err != nil {
+			t.Error(err)
+			return
+		}
+		for _, key := range []string{filePath, thumbnailPath} {
+			exists, err := storage.Exists(context.Background(), key)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if exists != c.exists {
+				t.Errorf("%s: %s: expecting exists %v but got %v", c.user, key, c.exists, exists)
+				return
+			}
+		}
+	}
+}
+
+func TestDeduplicationGrants(t *testing.T) {
+	t.Parallel()
+
+	storage, err := newLocalStorage("./testDeduplicationGrants/")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll("./testDeduplicationGrants")
+	defer storage.Close()
+
+	usecase, err := imageusecase.New(storage, imagerepo.New(memory.New(nil)), newObjectStoragePath(t), newLocker(t), &imageusecase.Options{
+		Variants: map[imageentity.Variant]imageentity.Manipulation{},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ktp := newImage(t, imageentity.FormatJPEG, 8, 8)
+	owner := imageentity.Subject{UserHash: "eUjks"}
+	reference := imageentity.Subject{UserHash: "kLmno"}
+	friend := imageentity.Subject{UserHash: "qRstu"}
+	propertyOwner := imageentity.Subject{UserHash: "vWxyz", OwnedProperties: []string{"prop-1"}}
+
+	upload := func(subject imageentity.Subject, grant imageentity.Grant) (string, error) {
+		img, err := usecase.Upload(context.Background(), bytes.NewReader(ktp), imageentity.FileInfo{
+			FileName: "ktp.jpg",
+			UserHash: subject.UserHash,
+			Mode:     imageentity.ModePrivate,
+			Group:    imageentity.GroupUserKTP,
+			Grants:   []imageentity.Grant{grant},
+		})
+		if err != nil {
+			return "", err
+		}
+		return img.FilePath, nil
+	}
+	filePath, err := upload(owner, imageentity.Grant{
+		Principal:   imageentity.PropertyOwnerPrincipal("prop-1"),
+		Permissions: []imageentity.Permission{imageentity.PermissionRead},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// the grant of the second uploader only allow the principal to read the image
+	friendGrant := imageentity.Grant{
+		Principal:   imageentity.UserPrincipal(friend.UserHash),
+		Permissions: []imageentity.Permission{imageentity.PermissionRead, imageentity.PermissionWrite},
+	}
+	if _, err := upload(reference, friendGrant); err != nil {
+		t.Error(err)
+		return
+	}
+
+	read := []imageentity.Permission{imageentity.PermissionRead}
+	download := func(subject imageentity.Subject) func() error {
+		return func() error {
+			_, err := usecase.Download(context.Background(), filePath, subject)
+			return err
+		}
+	}
+	cases := []struct {
+		name        string
+		fn          func() error
+		expectError error
+	}{
+		{
+			name: "property owner read by grant of owner",
+			fn:   download(propertyOwner),
+		},
+		{
+			name: "friend read by grant of reference",
+			fn:   download(friend),
+		},
+		{
+			name: "friend update tags",
+			fn: func() error {
+				return usecase.UpdateTags(context.Background(), filePath, friend, "ktp")
+			},
+			expectError: imageentity.ErrPermissionDenied,
+		},
+		{
+			name: "reference update tags",
+			fn: func() error {
+				return usecase.UpdateTags(context.Background(), filePath, reference, "ktp")
+			},
+			expectError: imageentity.ErrPermissionDenied,
+		},
+		{
+			name: "reference share",
+			fn: func() error {
+				return usecase.Share(context.Background(), filePath, reference, imageentity.UserPrincipal("abcde"), read, time.Hour)
+			},
+			expectError: imageentity.ErrPermissionDenied,
+		},
+		{
+			name: "reference revoke grant of owner",
+			fn: func() error {
+				return usecase.Revoke(context.Background(), filePath, reference, imageentity.PropertyOwnerPrincipal("prop-1"))
+			},
+			expectError: imageentity.ErrPermissionDenied,
+		},
+		{
+			name: "reference revoke its own grant",
+			fn: func() error {
+				return usecase.Revoke(context.Background(), filePath, reference, imageentity.UserPrincipal(friend.UserHash))
+			},
+		},
+		{
+			name:        "friend read after revoked",
+			fn:          download(friend),
+			expectError: imageentity.ErrPermissionDenied,
+		},
+		{
+			name: "friend read after the reference upload again",
+			fn: func() error {
+				if _, err := upload(reference, friendGrant); err != nil {
+					return err
+				}
+				return download(friend)()
+			},
+		},
+		{
+			name: "friend read after the reference is removed",
+			fn: func() error {
+				if err := usecase.Delete(context.Background(), filePath, reference); err != nil {
+					return err
+				}
+				return download(friend)()
+			},
+			expectError: imageentity.ErrPermissionDenied,
+		},
+		{
+			name: "property owner read after the reference is removed",
+			fn:   download(propertyOwner),
+		},
+	}
+	for _, c := range cases {
+		err := c.fn()
+		if c.expectError == nil && err != nil || c.expectError != nil && !errors.Is(err, c.expectError) {
+			t.Errorf("%s: expecting error %v but got %v", c.name, c.expectError, err)
+			return
+		}
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	t.Parallel()
+
+	storage, err := newLocalStorage("./testChecksumMismatch/")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll("./testChecksumMismatch")
+	defer storage.Close()
+
+	usecase, err := imageusecase.New(storage, imagerepo.New(memory.New(nil)), newObjectStoragePath(t), newLocker(t), &imageusecase.Options{
+		Variants: map[imageentity.Variant]imageentity.Manipulation{},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	img, err := usecase.Upload(context.Background(), bytes.NewReader(newImage(t, imageentity.FormatJPEG, 8, 8)), imageentity.FileInfo{
+		FileName: "ktp.jpg",
+		UserHash: "eUjks",
+		Mode:     imageentity.ModePrivate,
+		Group:    imageentity.GroupUserKTP,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// corrupt the image while keeping its metadata
+	attrs, err := storage.Attributes(context.Background(), img.FilePath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := storage.UploadByte(context.Background(), []byte("corrupted"), img.FilePath, &objectstorage.WriteOptions{Metadata: attrs.Metadata}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := usecase.Download(context.Background(), img.FilePath, imageentity.Subject{UserHash: "eUjks"}); !errors.Is(err, imageentity.ErrChecksumMismatch) {
+		t.Errorf("expecting error %v but got %v", imageentity.ErrChecksumMismatch, err)
+		return
+	}
+}
+
 func TestDownload(t *testing.T) {
+	t.Parallel()
+
+	storage, err := newLocalStorage("./testDownload/")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll("./testDownload")
+	defer storage.Close()
+
+	usecase, err := imageusecase.New(storage, imagerepo.New(memory.New(nil)), newObjectStoragePath(t), newLocker(t), nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	img, err := usecase.Upload(context.Background(), bytes.NewReader(newImage(t, imageentity.FormatJPEG, 8, 8)), imageentity.FileInfo{
+		FileName: "room.jpg",
+		UserHash: "eUjks",
+		Mode:     imageentity.ModePrivate,
+		Group:    imageentity.GroupPropertyRoom,
+		Grants: []imageentity.Grant{
+			{
+				Principal:   imageentity.PropertyOwnerPrincipal("123"),
+				Permissions: []imageentity.Permission{imageentity.PermissionRead},
+			},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	cases := []struct {
+		name        string
+		filePath    string
+		subject     imageentity.Subject
+		expectError bool
+	}{
+		{name: "owner", filePath: img.FilePath, subject: imageentity.Subject{UserHash: "eUjks"}},
+		{name: "owner variant", filePath: img.Variants[imageentity.VariantThumbnail].FilePath, subject: imageentity.Subject{UserHash: "eUjks"}},
+		{name: "admin", filePath: img.FilePath, subject: imageentity.Subject{UserHash: "aDmin", Roles: []string{imageentity.RoleAdmin}}},
+		{name: "property owner", filePath: img.FilePath, subject: imageentity.Subject{UserHash: "kLmno", OwnedProperties: []string{"123"}}},
+		{name: "other property owner", filePath: img.FilePath, subject: imageentity.Subject{UserHash: "kLmno", OwnedProperties: []string{"456"}}, expectError: true},
+		{name: "other user", filePath: img.FilePath, subject: imageentity.Subject{UserHash: "qRstu"}, expectError: true},
+		{name: "anonymous", filePath: img.FilePath, expectError: true},
+	}
+	for _, c := range cases {
+		_, err := usecase.Download(context.Background(), c.filePath, c.subject)
+		if (err != nil) != c.expectError {
+			t.Errorf("%s: expecting error %v but got %v", c.name, c.expectError, err)
+			return
+		}
+		if err != nil && !errors.Is(err, imageentity.ErrPermissionDenied) {
+			t.Errorf("%s: expecting error %v but got %v", c.name, imageentity.ErrPermissionDenied, err)
+			return
+		}
+	}
+}
+
+func TestShare(t *testing.T) {
+	t.Parallel()
+
+	storage, err := newLocalStorage("./testShare/")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll("./testShare")
+	defer storage.Close()
+
+	usecase, err := imageusecase.New(storage, imagerepo.New(memory.New(nil)), newObjectStoragePath(t), newLocker(t), &imageusecase.Options{
+		Variants: map[imageentity.Variant]imageentity.Manipulation{},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ktp := newImage(t, imageentity.FormatJPEG, 8, 8)
+	img, err := usecase.Upload(context.Background(), bytes.NewReader(ktp), imageentity.FileInfo{
+		FileName: "ktp.jpg",
+		UserHash: "eUjks",
+		Mode:     imageentity.ModePrivate,
+		Group:    imageentity.GroupUserKTP,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	owner := imageentity.Subject{UserHash: "eUjks"}
+	friend := imageentity.Subject{UserHash: "kLmno"}
+	stranger := imageentity.Subject{UserHash: "qRstu"}
+	read := []imageentity.Permission{imageentity.PermissionRead}
+
+	if err := usecase.Share(context.Background(), img.FilePath, owner, imageentity.UserPrincipal(friend.UserHash), read, time.Hour); err != nil {
+		t.Error(err)
+		return
+	}
+	out, err := usecase.Download(context.Background(), img.FilePath, friend)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// the content is not changed when the access control list is updated
+	if !bytes.Equal(out, ktp) {
+		t.Error("expecting the same image as uploaded")
+		return
+	}
+
+	cases := []struct {
+		name string
+		fn   func() error
+	}{
+		{
+			name: "delete without permission",
+			fn: func() error {
+				return usecase.Delete(context.Background(), img.FilePath, friend)
+			},
+		},
+		{
+			name: "update tags without permission",
+			fn: func() error {
+				return usecase.UpdateTags(context.Background(), img.FilePath, friend, "ktp")
+			},
+		},
+		{
+			name: "share without permission",
+			fn: func() error {
+				return usecase.Share(context.Background(), img.FilePath, friend, imageentity.UserPrincipal(stranger.UserHash), read, time.Hour)
+			},
+		},
+		{
+			name: "read after revoked",
+			fn: func() error {
+				if err := usecase.Revoke(context.Background(), img.FilePath, owner, imageentity.UserPrincipal(friend.UserHash)); err != nil {
+					return err
+				}
+				_, err := usecase.Download(context.Background(), img.FilePath, friend)
+				return err
+			},
+		},
+		{
+			name: "read after expired",
+			fn: func() error {
+				if err := usecase.Share(context.Background(), img.FilePath, owner, imageentity.UserPrincipal(friend.UserHash), read, time.Nanosecond); err != nil {
+					return err
+				}
+				time.Sleep(time.Millisecond)
+				_, err := usecase.Download(context.Background(), img.FilePath, friend)
+				return err
+			},
+		},
+	}
+	for _, c := range cases {
+		if err := c.fn(); !errors.Is(err, imageentity.ErrPermissionDenied) {
+			t.Errorf("%s: expecting error %v but got %v", c.name, imageentity.ErrPermissionDenied, err)
+			return
+		}
+	}
+
+	if err := usecase.UpdateTags(context.Background(), img.FilePath, owner, "ktp,verified"); err != nil {
+		t.Error(err)
+		return
+	}
+	attrs, err := storage.Attributes(context.Background(), img.FilePath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if attrs.Metadata["tags"] != "ktp,verified" {
+		t.Errorf("expecting tags ktp,verified but got %s", attrs.Metadata["tags"])
+		return
+	}
+}
+
+func TestShareLimit(t *testing.T) {
+	t.Parallel()
+
+	storage, err := newLocalStorage("./testShareLimit/")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll("./testShareLimit")
+	defer storage.Close()
+
+	usecase, err := imageusecase.New(storage, imagerepo.New(memory.New(nil)), newObjectStoragePath(t), newLocker(t), &imageusecase.Options{
+		Variants: map[imageentity.Variant]imageentity.Manipulation{},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	img, err := usecase.Upload(context.Background(), bytes.NewReader(newImage(t, imageentity.FormatJPEG, 8, 8)), imageentity.FileInfo{
+		FileName: "ktp.jpg",
+		UserHash: "eUjks",
+		Mode:     imageentity.ModePrivate,
+		Group:    imageentity.GroupUserKTP,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	owner := imageentity.Subject{UserHash: "eUjks"}
+	friend := imageentity.Subject{UserHash: "kLmno"}
+	stranger := imageentity.Subject{UserHash: "qRstu"}
+	readShare := []imageentity.Permission{imageentity.PermissionRead, imageentity.PermissionShare}
+	read := []imageentity.Permission{imageentity.PermissionRead}
+
+	if err := usecase.Share(context.Background(), img.FilePath, owner, imageentity.UserPrincipal(friend.UserHash), readShare, time.Hour); err != nil {
+		t.Error(err)
+		return
+	}
+
+	cases := []struct {
+		name        string
+		subject     imageentity.Subject
+		principal   imageentity.Principal
+		expiry      time.Duration
+		expectError error
+	}{
+		{
+			name:        "owner share to itself",
+			subject:     owner,
+			principal:   imageentity.UserPrincipal(owner.UserHash),
+			expiry:      time.Hour,
+			expectError: imageentity.ErrShareToSelf,
+		},
+		{
+			name:        "share to itself",
+			subject:     friend,
+			principal:   imageentity.UserPrincipal(friend.UserHash),
+			expiry:      time.Hour * 2,
+			expectError: imageentity.ErrShareToSelf,
+		},
+		{
+			name:        "share without expiry",
+			subject:     friend,
+			principal:   imageentity.UserPrincipal(stranger.UserHash),
+			expectError: imageentity.ErrPermissionDenied,
+		},
+		{
+			name:      "share longer than the sharer",
+			subject:   friend,
+			principal: imageentity.UserPrincipal(stranger.UserHash),
+			expiry:    time.Hour * 24,
+		},
+	}
+	for _, c := range cases {
+		err := usecase.Share(context.Background(), img.FilePath, c.subject, c.principal, read, c.expiry)
+		if c.expectError == nil && err != nil || c.expectError != nil && !errors.Is(err, c.expectError) {
+			t.Errorf("%s: expecting error %v but got %v", c.name, c.expectError, err)
+			return
+		}
+	}
+
+	attrs, err := storage.Attributes(context.Background(), img.FilePath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	acl, err := imageentity.DecodeACL(attrs.Metadata["acl"])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// the grant of stranger expires together with the grant of friend
+	friendExpiry := acl.Expiry(friend, read, time.Now())
+	strangerExpiry := acl.Expiry(stranger, read, time.Now())
+	if friendExpiry == nil || strangerExpiry == nil || !strangerExpiry.Equal(*friendExpiry) {
+		t.Errorf("expecting grant expires at %v but got %v", friendExpiry, strangerExpiry)
+		return
+	}
+}
+
+func TestVariants(t *testing.T) {
+	t.Parallel()
+
+	storage, err := newLocalStorage("./testVariants/")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll("./testVariants")
+	defer storage.Close()
+
+	usecase, err := imageusecase.New(storage, imagerepo.New(memory.New(nil)), newObjectStoragePath(t), newLocker(t), nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	img, err := usecase.Upload(context.Background(), bytes.NewReader(newImage(t, imageentity.FormatPNG, 400, 300)), imageentity.FileInfo{
+		FileName: "room.png",
+		UserHash: "eUjks",
+		Mode:     imageentity.ModePrivate,
+		Group:    imageentity.GroupPropertyRoom,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	cases := []struct {
+		variant      imageentity.Variant
+		expectFormat string
+		expectWidth  int
+		expectHeight int
+	}{
+		{variant: imageentity.VariantThumbnail, expectFormat: "jpeg", expectWidth: 200, expectHeight: 150},
+		// the image is never enlarged
+		{variant: imageentity.VariantMedium, expectFormat: "jpeg", expectWidth: 400, expectHeight: 300},
+	}
+	for _, c := range cases {
+		out, err := usecase.Download(context.Background(), img.Variants[c.variant].FilePath, imageentity.Subject{UserHash: "eUjks"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		config, format, err := image.DecodeConfig(bytes.NewReader(out))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if format != c.expectFormat || config.Width != c.expectWidth || config.Height != c.expectHeight {
+			t.Errorf("%s: expecting %s %dx%d but got %s %dx%d", c.variant, c.expectFormat, c.expectWidth, c.expectHeight, format, config.Width, config.Height)
+			return
+		}
+	}
+}
+
+func TestStripMetadata(t *testing.T) {
+	t.Parallel()
+
+	storage, err := newLocalStorage("./testStripMetadata/")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll("./testStripMetadata")
+	defer storage.Close()
+
+	usecase, err := imageusecase.New(storage, imagerepo.New(memory.New(nil)), newObjectStoragePath(t), newLocker(t), nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// insert exif segment with gps info after the start of image marker
+	exif := []byte("Exif\x00\x00GPSLatitude")
+	segment := append([]byte{0xff, 0xe1, 0x00, byte(len(exif) + 2)}, exif...)
+	original := newImage(t, imageentity.FormatJPEG, 8, 8)
+	withExif := append(append(append([]byte{}, original[:2]...), segment...), original[2:]...)
+
+	cases := []struct {
+		group      imageentity.Group
+		expectExif bool
+	}{
+		{group: imageentity.GroupUserKTP, expectExif: false},
+		{group: imageentity.GroupPropertyKos, expectExif: false},
+		{group: imageentity.GroupUserAvatar, expectExif: true},
+	}
+	for _, c := range cases {
+		img, err := usecase.Upload(context.Background(), bytes.NewReader(withExif), imageentity.FileInfo{
+			FileName: "photo.jpg",
+			UserHash: "eUjks",
+			Mode:     imageentity.ModePrivate,
+			Group:    c.group,
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		out, err := usecase.Download(context.Background(), img.FilePath, imageentity.Subject{UserHash: "eUjks"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if bytes.Contains(out, exif) != c.expectExif {
+			t.Errorf("%s: expecting exif %v", c.group, c.expectExif)
+			return
+		}
+		if !c.expectExif && !bytes.Equal(out, original) {
+			t.Errorf("%s: expecting only the exif segment removed", c.group)
+			return
+		}
+	}
+}
+
+// newOrientedExif return exif segment with orientation and gps location
+func newOrientedExif() (segment, orientation, latitude []byte) {
+	le := binary.LittleEndian
+	tiff := []byte("II\x2a\x00\x08\x00\x00\x00")
+
+	// IFD0 at offset 8 with orientation and gps info
+	ifd0 := make([]byte, 2+2*12+4)
+	le.PutUint16(ifd0, 2)
+	orientation = ifd0[2:14]
+	le.PutUint16(orientation[0:], 0x0112)
+	le.PutUint16(orientation[2:], 3)
+	le.PutUint32(orientation[4:], 1)
+	le.PutUint16(orientation[8:], 6)
+	gpsInfo := ifd0[14:26]
+	le.PutUint16(gpsInfo[0:], 0x8825)
+	le.PutUint16(gpsInfo[2:], 4)
+	le.PutUint32(gpsInfo[4:], 1)
+	le.PutUint32(gpsInfo[8:], uint32(len(tiff)+len(ifd0)))
+	tiff = append(tiff, ifd0...)
+
+	// gps ifd with latitude ref stored in the entry and latitude stored after the ifd
+	gps := make([]byte, 2+2*12+4)
+	le.PutUint16(gps, 2)
+	le.PutUint16(gps[2:], 0x0001)
+	le.PutUint16(gps[4:], 2)
+	le.PutUint32(gps[6:], 2)
+	copy(gps[10:], "S\x00")
+	le.PutUint16(gps[14:], 0x0002)
+	le.PutUint16(gps[16:], 5)
+	le.PutUint32(gps[18:], 3)
+	le.PutUint32(gps[22:], uint32(len(tiff)+len(gps)))
+	tiff = append(tiff, gps...)
+
+	latitude = make([]byte, 24)
+	for i, v := range []uint32{6, 1, 12, 1, 0x0badf00d, 100} {
+		le.PutUint32(latitude[i*4:], v)
+	}
+	tiff = append(tiff, latitude...)
+
+	exif := append([]byte("Exif\x00\x00"), tiff...)
+	segment = append([]byte{0xff, 0xe1, 0x00, byte(len(exif) + 2)}, exif...)
+	return segment, append([]byte{}, orientation...), append([]byte{}, latitude...)
+}
+
+func TestStripGPSKeepOrientation(t *testing.T) {
+	t.Parallel()
+
+	storage, err := newLocalStorage("./testStripGPSKeepOrientation/")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll("./testStripGPSKeepOrientation")
+	defer storage.Close()
+
+	usecase, err := imageusecase.New(storage, imagerepo.New(memory.New(nil)), newObjectStoragePath(t), newLocker(t), &imageusecase.Options{
+		Variants: map[imageentity.Variant]imageentity.Manipulation{},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	segment, orientation, latitude := newOrientedExif()
+	original := newImage(t, imageentity.FormatJPEG, 8, 8)
+	withExif := append(append(append([]byte{}, original[:2]...), segment...), original[2:]...)
+
+	img, err := usecase.Upload(context.Background(), bytes.NewReader(withExif), imageentity.FileInfo{
+		FileName: "ktp.jpg",
+		UserHash: "eUjks",
+		Mode:     imageentity.ModePrivate,
+		Group:    imageentity.GroupUserKTP,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	out, err := usecase.Download(context.Background(), img.FilePath, imageentity.Subject{UserHash: "eUjks"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// the exif segment is kept with the same size, only the gps is removed
+	if len(out) != len(withExif) {
+		t.Errorf("expecting %d bytes but got %d", len(withExif), len(out))
+		return
+	}
+	if !bytes.Contains(out, orientation) {
+		t.Error("expecting orientation to be kept")
+		return
+	}
+	if bytes.Contains(out, latitude) || bytes.Contains(out, []byte{0x25, 0x88, 0x04, 0x00}) {
+		t.Error("expecting gps to be removed")
+		return
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	t.Parallel()
+
+	storage, err := newLocalStorage("./testCollectGarbage/")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll("./testCollectGarbage")
+	defer storage.Close()
+
+	usecase, err := imageusecase.New(storage, imagerepo.New(memory.New(nil)), nil, newLocker(t), nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ktp := newImage(t, imageentity.FormatJPEG, 8, 8)
+	info := imageentity.FileInfo{FileName: "ktp.jpg", UserHash: "eUjks"}
+	committed, err := usecase.UploadTemporary(context.Background(), bytes.NewReader(ktp), info)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	orphaned, err := usecase.UploadTemporary(context.Background(), bytes.NewReader(ktp), info)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	key, err := usecase.Commit(context.Background(), committed, imageentity.GroupUserKTP)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// negative expiry means all temporary images are expired
+	deleted, err := usecase.CollectGarbage(context.Background(), -time.Minute)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if deleted != 1 {
+		t.Errorf("expecting 1 image deleted but got %d", deleted)
+		return
+	}
+
+	cases := []struct {
+		key    string
+		exists bool
+	}{
+		{key: key, exists: true},
+		{key: committed, exists: false},
+		{key: orphaned, exists: false},
+	}
+	for _, c := range cases {
+		exists, err := storage.Exists(context.Background(), c.key)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if exists != c.exists {
+			t.Errorf("%s: expecting exists %v but got %v", c.key, c.exists, exists)
+			return
+		}
+	}
+}
+
+// remoteProvider is local bucket that able to sign url, to test the storage that is not local
+type remoteProvider struct {
+	bucket *blob.Bucket
+}
+
+func (p *remoteProvider) Bucket() *blob.Bucket {
+	return p.bucket
+}
+
+func (p *remoteProvider) Name() string {
+	return objectstorage.StorageGCS
+}
+
+func (p *remoteProvider) BucketName() string {
+	return "remote"
+}
+
+func (p *remoteProvider) BucketURL() string {
+	return ""
+}
+
+func (p *remoteProvider) Close() error {
+	return p.bucket.Close()
+}
+
+func TestGenerateSignedURL(t *testing.T) {
+	t.Parallel()
+
+	if err := os.MkdirAll("./testGenerateSignedURL", 0744); err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll("./testGenerateSignedURL")
+
+	signedURL, err := url.Parse("https://storage.example.com/")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	bucket, err := fileblob.OpenBucket("./testGenerateSignedURL", &fileblob.Options{
+		URLSigner: fileblob.NewURLSignerHMAC(signedURL, []byte("secret")),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	provider := &remoteProvider{bucket: bucket}
+	defer provider.Close()
+
+	key := make([]byte, localkey.KeySize)
+	rand.Read(key)
+	keyProvider, err := localkey.NewFromKey(key)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	plainStorage := objectstorage.New(provider)
+	encryptedStorage := objectstorage.NewWithOptions(provider, &objectstorage.Options{KeyProvider: keyProvider})
+
+	if _, err := plainStorage.UploadByte(context.Background(), []byte("plain"), "plain.jpg", nil); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := encryptedStorage.UploadByte(context.Background(), []byte("encrypted"), "encrypted.jpg", nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	usecase, err := imageusecase.New(encryptedStorage, imagerepo.New(memory.New(nil)), newObjectStoragePath(t), newLocker(t), nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	cases := []struct {
+		filePath    string
+		expectURL   string
+		expectError bool
+	}{
+		{filePath: "plain.jpg", expectURL: "https://storage.example.com/"},
+		// encrypted image can only be decrypted by the image proxy
+		{filePath: "encrypted.jpg", expectURL: "http://localhost:9000/image"},
+		{filePath: "notfound.jpg", expectError: true},
+	}
+	for _, c := range cases {
+		u, err := usecase.GenerateSignedURL(context.Background(), c.filePath, time.Minute)
+		if (err != nil) != c.expectError {
+			t.Errorf("%s: expecting error %v but got %v", c.filePath, c.expectError, err)
+			return
+		}
+		if !strings.HasPrefix(u, c.expectURL) {
+			t.Errorf("%s: expecting url %s but got %s", c.filePath, c.expectURL, u)
+			return
+		}
+	}
 }
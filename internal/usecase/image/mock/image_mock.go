@@ -6,6 +6,7 @@ package image
 
 import (
 	context "context"
+	lock "github.com/albertwidi/go-project-example/internal/pkg/redis/lock"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
 	time "time"
@@ -62,3 +63,100 @@ func (mr *MockimageRepositoryMockRecorder) GetTempPath(ctx, id interface{}) *gom
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTempPath", reflect.TypeOf((*MockimageRepository)(nil).GetTempPath), ctx, id)
 }
+
+// AddReference mocks base method
+func (m *MockimageRepository) AddReference(ctx context.Context, filePath, owner string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddReference", ctx, filePath, owner)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddReference indicates an expected call of AddReference
+func (mr *MockimageRepositoryMockRecorder) AddReference(ctx, filePath, owner interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddReference", reflect.TypeOf((*MockimageRepository)(nil).AddReference), ctx, filePath, owner)
+}
+
+// RemoveReference mocks base method
+func (m *MockimageRepository) RemoveReference(ctx context.Context, filePath, owner string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveReference", ctx, filePath, owner)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RemoveReference indicates an expected call of RemoveReference
+func (mr *MockimageRepositoryMockRecorder) RemoveReference(ctx, filePath, owner interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveReference", reflect.TypeOf((*MockimageRepository)(nil).RemoveReference), ctx, filePath, owner)
+}
+
+// HasReference mocks base method
+func (m *MockimageRepository) HasReference(ctx context.Context, filePath, owner string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HasReference", ctx, filePath, owner)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HasReference indicates an expected call of HasReference
+func (mr *MockimageRepositoryMockRecorder) HasReference(ctx, filePath, owner interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HasReference", reflect.TypeOf((*MockimageRepository)(nil).HasReference), ctx, filePath, owner)
+}
+
+// DeleteReferences mocks base method
+func (m *MockimageRepository) DeleteReferences(ctx context.Context, filePath string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteReferences", ctx, filePath)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteReferences indicates an expected call of DeleteReferences
+func (mr *MockimageRepositoryMockRecorder) DeleteReferences(ctx, filePath interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteReferences", reflect.TypeOf((*MockimageRepository)(nil).DeleteReferences), ctx, filePath)
+}
+
+// Mocklocker is a mock of locker interface
+type Mocklocker struct {
+	ctrl     *gomock.Controller
+	recorder *MocklockerMockRecorder
+}
+
+// MocklockerMockRecorder is the mock recorder for Mocklocker
+type MocklockerMockRecorder struct {
+	mock *Mocklocker
+}
+
+// NewMocklocker creates a new mock instance
+func NewMocklocker(ctrl *gomock.Controller) *Mocklocker {
+	mock := &Mocklocker{ctrl: ctrl}
+	mock.recorder = &MocklockerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *Mocklocker) EXPECT() *MocklockerMockRecorder {
+	return m.recorder
+}
+
+// Obtain mocks base method
+func (m *Mocklocker) Obtain(ctx context.Context, key string, ttl time.Duration) (*lock.Lease, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Obtain", ctx, key, ttl)
+	ret0, _ := ret[0].(*lock.Lease)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Obtain indicates an expected call of Obtain
+func (mr *MocklockerMockRecorder) Obtain(ctx, key, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Obtain", reflect.TypeOf((*Mocklocker)(nil).Obtain), ctx, key, ttl)
+}
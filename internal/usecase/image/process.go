@@ -0,0 +1,498 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"strings"
+
+	imageentity "github.com/albertwidi/go-project-example/internal/entity/image"
+)
+
+// DefaultVariants of private image
+var DefaultVariants = map[imageentity.Variant]imageentity.Manipulation{
+	imageentity.VariantThumbnail: {
+		Resize: imageentity.Resize{Width: 200, Height: 200},
+		Format: imageentity.FormatJPEG,
+	},
+	imageentity.VariantMedium: {
+		Resize: imageentity.Resize{Width: 800, Height: 800},
+		Format: imageentity.FormatJPEG,
+	},
+}
+
+const (
+	// sniffLen is the number of bytes used to detect the content type, see http.DetectContentType
+	sniffLen = 512
+	// maxPixels of image that is decoded, to prevent image with huge dimension to use all memory
+	maxPixels   = 50 * 1000 * 1000
+	jpegQuality = 85
+)
+
+// formats of image that can be uploaded, by its content type
+var formats = map[string]imageentity.Format{
+	"image/jpeg": imageentity.FormatJPEG,
+	"image/png":  imageentity.FormatPNG,
+	"image/gif":  imageentity.FormatGIF,
+}
+
+// stripMetadataGroups is the group of images that might contain the location of user in its metadata
+// the location in the metadata of these images is removed before the image is stored
+var stripMetadataGroups = map[imageentity.Group]bool{
+	imageentity.GroupPropertyKos:    true,
+	imageentity.GroupPropertyHotel:  true,
+	imageentity.GroupPropertyHostel: true,
+	imageentity.GroupPropertyHouse:  true,
+	imageentity.GroupPropertyRoom:   true,
+	imageentity.GroupUserKTP:        true,
+}
+
+// detectFormat detect the format of image from its magic bytes and make sure it matches the declared content type
+func detectFormat(head []byte, header textproto.MIMEHeader) (imageentity.Format, error) {
+	contentType := http.DetectContentType(head)
+	format, ok := formats[contentType]
+	if !ok {
+		return "", fmt.Errorf("%w, got %s", imageentity.ErrUnsupportedFormat, contentType)
+	}
+
+	declared := header.Get("Content-Type")
+	if declared == "" {
+		return format, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(declared)
+	if err != nil {
+		return "", fmt.Errorf("%w, got %s", imageentity.ErrContentTypeMismatch, declared)
+	}
+	// image/jpg is not a valid content type, but commonly used
+	if mediaType == "image/jpg" {
+		mediaType = "image/jpeg"
+	}
+	if mediaType != contentType {
+		return "", fmt.Errorf("%w, declared %s but got %s", imageentity.ErrContentTypeMismatch, mediaType, contentType)
+	}
+	return format, nil
+}
+
+// variantPattern match the path of image variant, the path is {group}/{sha256}_{variant}
+var variantPattern = regexp.MustCompile(`/[0-9a-f]{64}_[a-z]+$`)
+
+// variantKey return the path of image variant
+func variantKey(key string, variant imageentity.Variant) string {
+	return key + "_" + string(variant)
+}
+
+// originalKey return the path of original image from the path of image variant
+func originalKey(key string) string {
+	if !variantPattern.MatchString(key) {
+		return key
+	}
+	return key[:strings.LastIndex(key, "_")]
+}
+
+// uploadVariants generate and upload all variants of the image
+func (u *Usecase) uploadVariants(ctx context.Context, c *content, key string, format imageentity.Format, info imageentity.FileInfo) error {
+	if len(u.variants) == 0 {
+		return nil
+	}
+	// seek the file back, so the original image can be uploaded after the variants
+	defer c.file.Seek(0, io.SeekStart)
+
+	config, _, err := image.DecodeConfig(c.file)
+	if err != nil {
+		return fmt.Errorf("%w: %v", imageentity.ErrInvalidImage, err)
+	}
+	if config.Width*config.Height > maxPixels {
+		return fmt.Errorf("%w, got %dx%d", imageentity.ErrImageTooLarge, config.Width, config.Height)
+	}
+	if _, err := c.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	img, _, err := image.Decode(c.file)
+	if err != nil {
+		return fmt.Errorf("%w: %v", imageentity.ErrInvalidImage, err)
+	}
+
+	for variant, manipulation := range u.variants {
+		variantFormat := manipulation.Format
+		if variantFormat == "" {
+			variantFormat = format
+		}
+
+		buff := bytes.Buffer{}
+		if err := encode(&buff, resize(img, manipulation.Resize), variantFormat); err != nil {
+			return err
+		}
+
+		md5Sum := md5.Sum(buff.Bytes())
+		sha256Sum := sha256.Sum256(buff.Bytes())
+		writeOptions, err := privateWriteOptions(info, &content{md5: md5Sum[:], sha256: hex.EncodeToString(sha256Sum[:])})
+		if err != nil {
+			return err
+		}
+		writeOptions.ContentType = variantFormat.ContentType()
+		if _, err := u.privateStorage.Upload(ctx, &buff, variantKey(key, variant), writeOptions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resize the image to fit the size while keeping its aspect ratio
+// the image is downscaled using the average of source pixels, and never enlarged
+func resize(src image.Image, size imageentity.Resize) image.Image {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	scale := 1.0
+	if size.Width > 0 && float64(size.Width)/float64(srcWidth) < scale {
+		scale = float64(size.Width) / float64(srcWidth)
+	}
+	if size.Height > 0 && float64(size.Height)/float64(srcHeight) < scale {
+		scale = float64(size.Height) / float64(srcHeight)
+	}
+	if scale == 1 {
+		return src
+	}
+
+	width := int(float64(srcWidth)*scale + 0.5)
+	if width < 1 {
+		width = 1
+	}
+	height := int(float64(srcHeight)*scale + 0.5)
+	if height < 1 {
+		height = 1
+	}
+
+	// convert to rgba first, so the pixels can be accessed directly
+	rgba := image.NewRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcHeight/height, (y+1)*srcHeight/height
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcWidth/width, (x+1)*srcWidth/width
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				offset := rgba.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					for i := 0; i < 4; i++ {
+						sum[i] += int(rgba.Pix[offset+i])
+					}
+					offset += 4
+				}
+			}
+
+			n := (y1 - y0) * (x1 - x0)
+			offset := dst.PixOffset(x, y)
+			for i := 0; i < 4; i++ {
+				dst.Pix[offset+i] = uint8(sum[i] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// encode the image using the format
+func encode(w io.Writer, img image.Image, format imageentity.Format) error {
+	switch format {
+	case imageentity.FormatJPEG:
+		// jpeg has no transparency, so the image is drawn on white background
+		bounds := img.Bounds()
+		flatten := image.NewRGBA(bounds)
+		draw.Draw(flatten, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(flatten, bounds, img, bounds.Min, draw.Over)
+		return jpeg.Encode(w, flatten, &jpeg.Options{Quality: jpegQuality})
+	case imageentity.FormatPNG:
+		return png.Encode(w, img)
+	case imageentity.FormatGIF:
+		return gif.Encode(w, img, nil)
+	default:
+		return fmt.Errorf("%w, got %s", imageentity.ErrUnsupportedFormat, format)
+	}
+}
+
+// stripMetadata return the reader of image without its metadata
+// the metadata is removed while reading, so the image is never fully loaded into memory
+func stripMetadata(reader io.Reader, format imageentity.Format) io.ReadCloser {
+	var strip func(w io.Writer, r io.Reader) error
+	switch format {
+	case imageentity.FormatJPEG:
+		strip = stripJPEG
+	case imageentity.FormatPNG:
+		strip = stripPNG
+	default:
+		return ioutil.NopCloser(reader)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		err := strip(pw, reader)
+		// the image is truncated if the source ends before the image data
+		if err == io.EOF {
+			err = fmt.Errorf("%w: unexpected end of image", imageentity.ErrInvalidImage)
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// list of jpeg markers
+const (
+	jpegMarkerSOI  = 0xd8
+	jpegMarkerEOI  = 0xd9
+	jpegMarkerSOS  = 0xda
+	jpegMarkerAPP1 = 0xe1
+	jpegMarkerTEM  = 0x01
+	jpegMarkerRST0 = 0xd0
+	jpegMarkerRST7 = 0xd7
+)
+
+// stripJPEG remove the gps location from the APP1 segments of jpeg
+// the gps ifd is removed from the exif, and the rest of exif is kept so the image is still shown with the right orientation.
+// The xmp and the exif that can't be parsed are removed entirely, as they might contain the gps location.
+func stripJPEG(w io.Writer, r io.Reader) error {
+	br := bufio.NewReader(r)
+	marker := make([]byte, 2)
+	if _, err := io.ReadFull(br, marker); err != nil {
+		return err
+	}
+	if marker[0] != 0xff || marker[1] != jpegMarkerSOI {
+		return fmt.Errorf("%w: jpeg start of image not found", imageentity.ErrInvalidImage)
+	}
+	if _, err := w.Write(marker); err != nil {
+		return err
+	}
+
+	length := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(br, marker); err != nil {
+			return err
+		}
+		if marker[0] != 0xff {
+			return fmt.Errorf("%w: invalid jpeg marker", imageentity.ErrInvalidImage)
+		}
+		// skip the fill bytes before the marker
+		for marker[1] == 0xff {
+			b, err := br.ReadByte()
+			if err != nil {
+				return err
+			}
+			marker[1] = b
+		}
+
+		switch {
+		case marker[1] == jpegMarkerSOS || marker[1] == jpegMarkerEOI:
+			// the metadata is always before the image data, so the rest is copied as is
+			if _, err := w.Write(marker); err != nil {
+				return err
+			}
+			_, err := io.Copy(w, br)
+			return err
+		case marker[1] == jpegMarkerTEM || (marker[1] >= jpegMarkerRST0 && marker[1] <= jpegMarkerRST7):
+			// marker without segment
+			if _, err := w.Write(marker); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := io.ReadFull(br, length); err != nil {
+			return err
+		}
+		// the length includes the length bytes
+		n := int64(binary.BigEndian.Uint16(length)) - 2
+		if n < 0 {
+			return fmt.Errorf("%w: invalid jpeg segment length", imageentity.ErrInvalidImage)
+		}
+
+		if marker[1] == jpegMarkerAPP1 {
+			// the segment is at most 64KB, so it is read into memory to remove the gps ifd
+			segment := make([]byte, n)
+			if _, err := io.ReadFull(br, segment); err != nil {
+				return err
+			}
+			if !stripGPS(segment) {
+				continue
+			}
+			if _, err := w.Write(marker); err != nil {
+				return err
+			}
+			if _, err := w.Write(length); err != nil {
+				return err
+			}
+			if _, err := w.Write(segment); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := w.Write(marker); err != nil {
+			return err
+		}
+		if _, err := w.Write(length); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w, br, n); err != nil {
+			return err
+		}
+	}
+}
+
+// exifHeader is the header of exif APP1 segment, followed by the tiff header
+var exifHeader = []byte("Exif\x00\x00")
+
+// exifTagGPSInfo is the tag of IFD0 entry that points to the gps ifd
+const exifTagGPSInfo = 0x8825
+
+// exifTypeSize is the size of exif value by its type
+var exifTypeSize = [...]int{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8}
+
+// stripGPS remove the gps ifd from the exif segment in place, so the size of segment is not changed
+// false is returned if the segment is not exif or the exif can't be parsed
+func stripGPS(segment []byte) bool {
+	if !bytes.HasPrefix(segment, exifHeader) {
+		return false
+	}
+	tiff := segment[len(exifHeader):]
+	if len(tiff) < 8 {
+		return false
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return false
+	}
+
+	ifd0 := int(order.Uint32(tiff[4:8]))
+	if ifd0 < 8 || ifd0+2 > len(tiff) {
+		return false
+	}
+	n := int(order.Uint16(tiff[ifd0:]))
+	// the entries are followed by the offset of next ifd
+	end := ifd0 + 2 + n*12 + 4
+	if end > len(tiff) {
+		return false
+	}
+
+	for i := 0; i < n; i++ {
+		entry := ifd0 + 2 + i*12
+		if order.Uint16(tiff[entry:]) != exifTagGPSInfo {
+			continue
+		}
+		if !clearIFD(tiff, order, int(order.Uint32(tiff[entry+8:]))) {
+			return false
+		}
+		// remove the gps entry, the offset of other ifd and values are not changed
+		copy(tiff[entry:end-12], tiff[entry+12:end])
+		zero(tiff[end-12 : end])
+		order.PutUint16(tiff[ifd0:], uint16(n-1))
+		break
+	}
+	return true
+}
+
+// clearIFD zero the entries of ifd and the values that stored outside of the entries
+func clearIFD(tiff []byte, order binary.ByteOrder, offset int) bool {
+	if offset < 8 || offset+2 > len(tiff) {
+		return false
+	}
+	n := int(order.Uint16(tiff[offset:]))
+	end := offset + 2 + n*12
+	if end > len(tiff) {
+		return false
+	}
+
+	for i := 0; i < n; i++ {
+		entry := offset + 2 + i*12
+		valueType := int(order.Uint16(tiff[entry+2:]))
+		if valueType >= len(exifTypeSize) {
+			return false
+		}
+		// the value is stored in the entry if it fits in 4 bytes
+		size := int64(exifTypeSize[valueType]) * int64(order.Uint32(tiff[entry+4:]))
+		if size <= 4 {
+			continue
+		}
+		value := int64(order.Uint32(tiff[entry+8:]))
+		if value+size > int64(len(tiff)) {
+			return false
+		}
+		zero(tiff[value : value+size])
+	}
+	zero(tiff[offset:end])
+	return true
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// pngStripChunks is the png chunks that contain metadata, xmp metadata is stored in text chunk
+var pngStripChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+}
+
+// stripPNG remove the metadata chunks of png
+func stripPNG(w io.Writer, r io.Reader) error {
+	signature := make([]byte, 8)
+	if _, err := io.ReadFull(r, signature); err != nil {
+		return err
+	}
+	if _, err := w.Write(signature); err != nil {
+		return err
+	}
+
+	// chunk is {length}{type}{data}{crc}
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return err
+		}
+		n := int64(binary.BigEndian.Uint32(header[:4])) + 4
+		chunkType := string(header[4:])
+
+		if pngStripChunks[chunkType] {
+			if _, err := io.CopyN(ioutil.Discard, r, n); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w, r, n); err != nil {
+			return err
+		}
+		if chunkType == "IEND" {
+			return nil
+		}
+	}
+}
@@ -2,21 +2,45 @@ package otp
 
 import (
 	"context"
+	"errors"
 	"strconv"
 	"time"
 
 	otpentity "github.com/albertwidi/go-project-example/internal/entity/otp"
 	"github.com/albertwidi/go-project-example/internal/pkg/randgen"
+	"github.com/albertwidi/go-project-example/internal/pkg/ratelimit"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis/lock"
 	"github.com/albertwidi/go-project-example/internal/xerrors"
 )
 
+// createLockTTL is the maximum time to create otp for the same unique id
+const createLockTTL = time.Second * 10
+
+// ResendLimit is the limit of otp resend, use it to create the rate limiter of the usecase
+var ResendLimit = ratelimit.Limit{
+	Rate:   otpentity.ThresholdOTPResend,
+	Period: otpentity.ResendTimeAfterThreshold,
+}
+
 // Usecase of otp
 type Usecase struct {
 	repo otpRepo
+	// locker to make sure only one otp is created at the same time for the same unique id
+	locker locker
+	// limiter to limit the number of otp resend
+	limiter rateLimiter
 	// code generator
 	rgen map[otpentity.CodeLength]*randgen.Generator
 }
 
+type locker interface {
+	Obtain(ctx context.Context, key string, ttl time.Duration) (*lock.Lease, error)
+}
+
+type rateLimiter interface {
+	Allow(ctx context.Context, key string) (ratelimit.Result, error)
+}
+
 type otpRepo interface {
 	Save(ctx context.Context, otp otpentity.OTP) error
 	SetLast(ctx context.Context, otp otpentity.OTP) error
@@ -27,16 +51,19 @@ type otpRepo interface {
 	DeleteAll(ctx context.Context, uniqueID string) error
 }
 
-// New otp usecase
-func New(otpRepo otpRepo) (*Usecase, error) {
+// New otp usecase, locker and limiter are optional
+// the resend is throttled using the length of otp list when limiter is nil
+func New(otpRepo otpRepo, locker locker, limiter rateLimiter) (*Usecase, error) {
 	workerNumber := 3
 	rgen := make(map[otpentity.CodeLength]*randgen.Generator)
 	rgen[otpentity.CodeLength4] = randgen.New(workerNumber, 1000, 9999, time.Now().UnixNano())
 	rgen[otpentity.CodeLength6] = randgen.New(workerNumber, 100000, 999999, time.Now().UnixNano())
 
 	u := Usecase{
-		repo: otpRepo,
-		rgen: rgen,
+		repo:    otpRepo,
+		locker:  locker,
+		limiter: limiter,
+		rgen:    rgen,
 	}
 	return &u, nil
 }
@@ -52,6 +79,18 @@ func (u Usecase) Create(ctx context.Context, uniqueID string, codeLength otpenti
 		resendDuration = otpentity.ResendTimeDefault
 	)
 
+	// lock the unique id, so concurrent requests can't create otp based on the same last otp
+	if u.locker != nil {
+		lease, err := u.locker.Obtain(ctx, "otp:"+uniqueID, createLockTTL)
+		if err != nil {
+			if errors.Is(err, lock.ErrNotObtained) {
+				return nil, xerrors.New(otpentity.ErrOTPNotResendable)
+			}
+			return nil, err
+		}
+		defer lease.Release(ctx)
+	}
+
 	lastOTP, err := u.repo.GetLast(ctx, uniqueID)
 	if err != nil {
 		return nil, err
@@ -69,14 +108,31 @@ func (u Usecase) Create(ctx context.Context, uniqueID string, codeLength otpenti
 			return nil, xerrors.New(otpentity.ErrOTPNotResendable)
 		}
 
-		// get the length of current otp
-		otpLen, err := u.repo.Len(ctx, uniqueID)
+		if u.limiter == nil {
+			// get the length of current otp
+			otpLen, err := u.repo.Len(ctx, uniqueID)
+			if err != nil {
+				return nil, err
+			}
+
+			// means otp is on its threshold
+			if otpLen%otpentity.ThresholdOTPResend == 0 {
+				resendDuration = otpentity.ResendTimeAfterThreshold
+			}
+		}
+	}
+
+	if u.limiter != nil {
+		result, err := u.limiter.Allow(ctx, uniqueID)
 		if err != nil {
 			return nil, err
 		}
+		if !result.Allowed {
+			return nil, xerrors.New(otpentity.ErrOTPReachResendMaxAttempt)
+		}
 
 		// means otp is on its threshold
-		if otpLen%otpentity.ThresholdOTPResend == 0 {
+		if result.Remaining == 0 {
 			resendDuration = otpentity.ResendTimeAfterThreshold
 		}
 	}
@@ -0,0 +1,254 @@
+package otp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	otpentity "github.com/albertwidi/go-project-example/internal/entity/otp"
+	"github.com/albertwidi/go-project-example/internal/pkg/ratelimit"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis/lock"
+	"github.com/albertwidi/go-project-example/internal/pkg/redis/memory"
+	"github.com/albertwidi/go-project-example/internal/xerrors"
+)
+
+// fakeRepo keep the otp list of each unique id in memory
+type fakeRepo struct {
+	mu   sync.Mutex
+	otps map[string][]otpentity.OTP
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{otps: make(map[string][]otpentity.OTP)}
+}
+
+func (r *fakeRepo) Save(ctx context.Context, otp otpentity.OTP) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.otps[otp.UniqueID] = append([]otpentity.OTP{otp}, r.otps[otp.UniqueID]...)
+	return nil
+}
+
+func (r *fakeRepo) SetLast(ctx context.Context, otp otpentity.OTP) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.otps[otp.UniqueID]) > 0 {
+		r.otps[otp.UniqueID][0] = otp
+	}
+	return nil
+}
+
+func (r *fakeRepo) GetLast(ctx context.Context, uniqueID string) (otpentity.OTP, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.otps[uniqueID]) == 0 {
+		return otpentity.OTP{}, nil
+	}
+	return r.otps[uniqueID][0], nil
+}
+
+func (r *fakeRepo) Len(ctx context.Context, uniqueID string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.otps[uniqueID]), nil
+}
+
+func (r *fakeRepo) IncreaseValidateAttempt(ctx context.Context, uniqueID string, attempt int) (int, error) {
+	return attempt, nil
+}
+
+func (r *fakeRepo) DeleteValidateAttempt(ctx context.Context, uniqueID string) error {
+	return nil
+}
+
+func (r *fakeRepo) DeleteAll(ctx context.Context, uniqueID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.otps, uniqueID)
+	return nil
+}
+
+// makeResendable set the last otp to be resendable now, so the next otp can be created
+func (r *fakeRepo) makeResendable(uniqueID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.otps[uniqueID]) > 0 {
+		r.otps[uniqueID][0].ResendableAt = time.Now().Add(-time.Second)
+	}
+}
+
+type errLimiter struct {
+	err error
+}
+
+func (l errLimiter) Allow(ctx context.Context, key string) (ratelimit.Result, error) {
+	return ratelimit.Result{}, l.err
+}
+
+func newLocker(t *testing.T) *lock.Locker {
+	m := memory.New(nil)
+	lock.RegisterMemoryScripts(m)
+	locker, err := lock.New([]redis.Redis{m}, &lock.Options{RetryCount: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return locker
+}
+
+func TestCreateLocked(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	locker := newLocker(t)
+	repo := newFakeRepo()
+	u, err := New(repo, locker, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// otp is being created by other request
+	lease, err := locker.Obtain(ctx, "otp:user", time.Second*10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := u.Create(ctx, "user", otpentity.CodeLength4, 0); !xerrors.Is(err, otpentity.ErrOTPNotResendable) {
+		t.Errorf("expecting error %v but got %v", otpentity.ErrOTPNotResendable, err)
+		return
+	}
+	if n, _ := repo.Len(ctx, "user"); n != 0 {
+		t.Errorf("expecting no otp created but got %d", n)
+		return
+	}
+
+	// the otp can be created when the lock is released by the other request
+	lease.Release(ctx)
+	if _, err := u.Create(ctx, "user", otpentity.CodeLength4, 0); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := u.Create(ctx, "other", otpentity.CodeLength4, 0); err != nil {
+		t.Error(err)
+		return
+	}
+	// the lock is released after the otp is created
+	if _, err := locker.Obtain(ctx, "otp:user", time.Second*10); err != nil {
+		t.Errorf("expecting lock released but got %v", err)
+		return
+	}
+}
+
+func TestCreateLimited(t *testing.T) {
+	t.Parallel()
+
+	errRedis := errors.New("redis is down")
+	limiter, err := ratelimit.NewLocalSlidingWindow(ResendLimit, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	cases := []struct {
+		name           string
+		limiter        rateLimiter
+		expectResend   []time.Duration
+		expectLimitErr error
+	}{
+		{
+			name:    "limiter",
+			limiter: limiter,
+			expectResend: []time.Duration{
+				otpentity.ResendTimeDefault,
+				otpentity.ResendTimeDefault,
+				otpentity.ResendTimeAfterThreshold,
+			},
+			expectLimitErr: otpentity.ErrOTPReachResendMaxAttempt,
+		},
+		{
+			name:           "limiter error",
+			limiter:        errLimiter{err: errRedis},
+			expectLimitErr: errRedis,
+		},
+	}
+
+	for _, c := range cases {
+		ctx := context.Background()
+		repo := newFakeRepo()
+		u, err := New(repo, newLocker(t), c.limiter)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		for i, expect := range c.expectResend {
+			otp, err := u.Create(ctx, "user", otpentity.CodeLength4, 0)
+			if err != nil {
+				t.Errorf("%s: %d: %v", c.name, i, err)
+				return
+			}
+			if resend := otp.ResendableAt.Sub(otp.CreatedAt); resend != expect {
+				t.Errorf("%s: %d: expecting resendable after %v but got %v", c.name, i, expect, resend)
+				return
+			}
+			repo.makeResendable("user")
+		}
+
+		_, err = u.Create(ctx, "user", otpentity.CodeLength4, 0)
+		if !xerrors.Is(err, c.expectLimitErr) {
+			t.Errorf("%s: expecting error %v but got %v", c.name, c.expectLimitErr, err)
+			return
+		}
+		if n, _ := repo.Len(ctx, "user"); n != len(c.expectResend) {
+			t.Errorf("%s: expecting %d otp created but got %d", c.name, len(c.expectResend), n)
+			return
+		}
+	}
+}
+
+func TestCreateWithoutLimiter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := newFakeRepo()
+	u, err := New(repo, nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// the resend is throttled using the length of otp list
+	expectResend := []time.Duration{
+		otpentity.ResendTimeDefault,
+		otpentity.ResendTimeDefault,
+		otpentity.ResendTimeDefault,
+		otpentity.ResendTimeAfterThreshold,
+	}
+	for i, expect := range expectResend {
+		otp, err := u.Create(ctx, "user", otpentity.CodeLength4, 0)
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			return
+		}
+		if resend := otp.ResendableAt.Sub(otp.CreatedAt); resend != expect {
+			t.Errorf("%d: expecting resendable after %v but got %v", i, expect, resend)
+			return
+		}
+		repo.makeResendable("user")
+	}
+
+	if _, err := u.Create(ctx, "user", otpentity.CodeLength4, 0); err != nil {
+		t.Error(err)
+		return
+	}
+	repo.mu.Lock()
+	repo.otps["user"][0].ResendableAt = time.Now().Add(time.Minute)
+	repo.mu.Unlock()
+	if _, err := u.Create(ctx, "user", otpentity.CodeLength4, 0); !xerrors.Is(err, otpentity.ErrOTPNotResendable) {
+		t.Errorf("expecting error %v but got %v", otpentity.ErrOTPNotResendable, err)
+		return
+	}
+}